@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime"
+	"strings"
 
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
@@ -101,7 +102,9 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		reqBody = bytes.NewReader(data)
 	}
 
+	path, query, _ := strings.Cut(path, "?")
 	requestURL := c.base.JoinPath(path)
+	requestURL.RawQuery = query
 	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
 	if err != nil {
 		return err
@@ -294,10 +297,36 @@ func (c *Client) Create(ctx context.Context, req *CreateRequest, fn CreateProgre
 	})
 }
 
-// List lists models that are available locally.
-func (c *Client) List(ctx context.Context) (*ListResponse, error) {
+// ExportProgressFunc is a function that [Client.Export] invokes when progress
+// is made.
+// It's similar to other progress function types like [PullProgressFunc].
+type ExportProgressFunc func(ProgressResponse) error
+
+// Export writes a model as Hugging Face safetensors to a directory on the
+// server. fn is a progress function that behaves similarly to other methods
+// (see [Client.Pull]).
+func (c *Client) Export(ctx context.Context, req *ExportRequest, fn ExportProgressFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/export", req, func(bts []byte) error {
+		var resp ProgressResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+// List lists models that are available locally. If labels are given, only
+// models with every label are listed. A label is "key=value", or "key" for
+// models with the label set to any value.
+func (c *Client) List(ctx context.Context, labels ...string) (*ListResponse, error) {
+	path := "/api/tags"
+	if len(labels) > 0 {
+		path += "?" + url.Values{"label": labels}.Encode()
+	}
+
 	var lr ListResponse
-	if err := c.do(ctx, http.MethodGet, "/api/tags", nil, &lr); err != nil {
+	if err := c.do(ctx, http.MethodGet, path, nil, &lr); err != nil {
 		return nil, err
 	}
 	return &lr, nil
@@ -329,6 +358,35 @@ func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
 	return nil
 }
 
+// Prune removes the least recently used models until the models directory fits
+// within the server's configured quota.
+func (c *Client) Prune(ctx context.Context, req *PruneRequest) (*PruneResponse, error) {
+	var resp PruneResponse
+	if err := c.do(ctx, http.MethodPost, "/api/prune", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RemoteTags lists the tags of a model's repository in the registry.
+func (c *Client) RemoteTags(ctx context.Context, req *RemoteTagsRequest) (*RemoteTagsResponse, error) {
+	var resp RemoteTagsResponse
+	if err := c.do(ctx, http.MethodPost, "/api/tags/remote", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Outdated checks every local model against the registry, reporting the
+// models which have changed since they were pulled.
+func (c *Client) Outdated(ctx context.Context, req *OutdatedRequest) (*OutdatedResponse, error) {
+	var resp OutdatedResponse
+	if err := c.do(ctx, http.MethodPost, "/api/outdated", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Show obtains model information, including details, modelfile, license etc.
 func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, error) {
 	var resp ShowResponse
@@ -338,6 +396,25 @@ func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, err
 	return &resp, nil
 }
 
+// Lint checks a Modelfile for problems without creating a model.
+func (c *Client) Lint(ctx context.Context, req *LintRequest) (*LintResponse, error) {
+	var resp LintResponse
+	if err := c.do(ctx, http.MethodPost, "/api/lint", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Render renders the prompt a generate or chat request would send to the
+// model, without running inference.
+func (c *Client) Render(ctx context.Context, req *RenderRequest) (*RenderResponse, error) {
+	var resp RenderResponse
+	if err := c.do(ctx, http.MethodPost, "/api/render", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Hearbeat checks if the server has started and is responsive; if yes, it
 // returns nil, otherwise an error.
 func (c *Client) Heartbeat(ctx context.Context) error {
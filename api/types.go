@@ -233,6 +233,14 @@ type CreateRequest struct {
 	Stream    *bool  `json:"stream,omitempty"`
 	Quantize  string `json:"quantize,omitempty"`
 
+	// BuildArgs are the values of ARGs declared in the Modelfile
+	BuildArgs map[string]string `json:"build_args,omitempty"`
+
+	// Source is the Modelfile as it was written, before includes, ARGs and
+	// paths were resolved by the client. It's kept with the model for show
+	// and defaults to Modelfile.
+	Source string `json:"source,omitempty"`
+
 	// Name is deprecated, see Model
 	Name string `json:"name"`
 
@@ -240,6 +248,99 @@ type CreateRequest struct {
 	Quantization string `json:"quantization,omitempty"`
 }
 
+// LintRequest is the request passed to [Client.Lint].
+type LintRequest struct {
+	// Modelfile is the Modelfile to lint
+	Modelfile string `json:"modelfile"`
+
+	// Path is the path of the Modelfile on the server, paths in FROM and
+	// ADAPTER are relative to it. The file itself isn't read
+	Path string `json:"path"`
+}
+
+// LintDiagnostic is a problem found in a Modelfile. Line and Column start at 1.
+type LintDiagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// LintResponse is the response returned from [Client.Lint].
+type LintResponse struct {
+	Diagnostics []LintDiagnostic `json:"diagnostics"`
+}
+
+// RenderRequest is the request passed to [Client.Render]. It takes the fields
+// of a [GenerateRequest] or, if Messages is set, of a [ChatRequest].
+type RenderRequest struct {
+	// Model is the model name, as in [GenerateRequest].
+	Model string `json:"model"`
+
+	// Messages is the messages of a chat request. They can't be combined
+	// with the fields of a generate request.
+	Messages []Message `json:"messages,omitempty"`
+
+	// Prompt, System, Template, Context, Raw and Images are the fields of a
+	// generate request, see [GenerateRequest].
+	Prompt   string      `json:"prompt,omitempty"`
+	System   string      `json:"system,omitempty"`
+	Template string      `json:"template,omitempty"`
+	Context  []int       `json:"context,omitempty"`
+	Raw      bool        `json:"raw,omitempty"`
+	Images   []ImageData `json:"images,omitempty"`
+
+	// KeepAlive controls how long the model will stay loaded in memory
+	// following this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options. The context window size num_ctx
+	// decides which messages are dropped.
+	Options map[string]interface{} `json:"options"`
+}
+
+// RenderMessage is a message of the request in [RenderResponse]. Tokens
+// counts the message's content alone, without the template or images.
+type RenderMessage struct {
+	Role    string `json:"role"`
+	Tokens  int    `json:"tokens"`
+	Dropped bool   `json:"dropped,omitempty"`
+}
+
+// RenderImage is an image of the request in [RenderResponse]. Message is the
+// index of the message it belongs to and Offset the byte offset of its
+// placeholder, e.g. "[img-0]", in the prompt or -1 if it isn't in the prompt.
+type RenderImage struct {
+	ID      int `json:"id"`
+	Message int `json:"message"`
+	Offset  int `json:"offset"`
+}
+
+// RenderResponse is the response returned from [Client.Render].
+type RenderResponse struct {
+	Model string `json:"model"`
+
+	// Prompt is the prompt the request would send to the model and Tokens
+	// the number of tokens in it.
+	Prompt string `json:"prompt"`
+	Tokens int    `json:"tokens"`
+
+	// Messages are the request's messages in order, or its prompt for a
+	// generate request. The model's default system message isn't included.
+	Messages []RenderMessage `json:"messages"`
+	Images   []RenderImage   `json:"images,omitempty"`
+}
+
+// ExportRequest is the request passed to [Client.Export].
+type ExportRequest struct {
+	Model string `json:"model"`
+
+	// Path is the directory the model is written to, relative to the server's
+	// export directory. It must not exist yet or be empty.
+	Path   string `json:"path"`
+	Stream *bool  `json:"stream,omitempty"`
+}
+
 // DeleteRequest is the request passed to [Client.Delete].
 type DeleteRequest struct {
 	Model string `json:"model"`
@@ -255,6 +356,10 @@ type ShowRequest struct {
 	Template string `json:"template"`
 	Verbose  bool   `json:"verbose"`
 
+	// Tensors includes the tensors of the model and the size of each layer
+	// in the response
+	Tensors bool `json:"tensors,omitempty"`
+
 	Options map[string]interface{} `json:"options"`
 
 	// Name is deprecated, see Model
@@ -263,16 +368,47 @@ type ShowRequest struct {
 
 // ShowResponse is the response returned from [Client.Show].
 type ShowResponse struct {
-	License       string         `json:"license,omitempty"`
-	Modelfile     string         `json:"modelfile,omitempty"`
-	Parameters    string         `json:"parameters,omitempty"`
-	Template      string         `json:"template,omitempty"`
-	System        string         `json:"system,omitempty"`
-	Details       ModelDetails   `json:"details,omitempty"`
-	Messages      []Message      `json:"messages,omitempty"`
-	ModelInfo     map[string]any `json:"model_info,omitempty"`
-	ProjectorInfo map[string]any `json:"projector_info,omitempty"`
-	ModifiedAt    time.Time      `json:"modified_at,omitempty"`
+	License       string            `json:"license,omitempty"`
+	Modelfile     string            `json:"modelfile,omitempty"`
+	Parameters    string            `json:"parameters,omitempty"`
+	Template      string            `json:"template,omitempty"`
+	System        string            `json:"system,omitempty"`
+	Details       ModelDetails      `json:"details,omitempty"`
+	Messages      []Message         `json:"messages,omitempty"`
+	Adapters      []AdapterInfo     `json:"adapters,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	ModelInfo     map[string]any    `json:"model_info,omitempty"`
+	ProjectorInfo map[string]any    `json:"projector_info,omitempty"`
+	Tensors       []TensorInfo      `json:"tensors,omitempty"`
+	Layers        []LayerInfo       `json:"layers,omitempty"`
+	ModifiedAt    time.Time         `json:"modified_at,omitempty"`
+}
+
+// AdapterInfo describes an adapter applied to a model, in the order they're
+// applied.
+type AdapterInfo struct {
+	Digest string  `json:"digest"`
+	Scale  float32 `json:"scale"`
+}
+
+// TensorInfo describes a tensor in the weights of a model.
+type TensorInfo struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Shape []uint64 `json:"shape"`
+	Size  uint64   `json:"size"`
+
+	// Offset is the offset of the tensor's data from the start of the
+	// tensor data in the model file
+	Offset uint64 `json:"offset"`
+}
+
+// LayerInfo is the size of the tensors in a layer of a model, e.g. blk.0,
+// in total and by GGML type.
+type LayerInfo struct {
+	Name  string            `json:"name"`
+	Size  uint64            `json:"size"`
+	Types map[string]uint64 `json:"types"`
 }
 
 // CopyRequest is the request passed to [Client.Copy].
@@ -293,6 +429,42 @@ type PullRequest struct {
 	Name string `json:"name"`
 }
 
+// RemoteTagsRequest is the request passed to [Client.RemoteTags].
+type RemoteTagsRequest struct {
+	Model    string `json:"model"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// RemoteTagsResponse is the response from [Client.RemoteTags].
+type RemoteTagsResponse struct {
+	Model string   `json:"model"`
+	Tags  []string `json:"tags"`
+}
+
+// OutdatedRequest is the request passed to [Client.Outdated].
+type OutdatedRequest struct {
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// OutdatedResponse is the response from [Client.Outdated].
+type OutdatedResponse struct {
+	Models []OutdatedModelResponse `json:"models"`
+}
+
+// OutdatedModelResponse compares a single local model with the registry in
+// [OutdatedResponse]. Local is set if the registry doesn't have the model,
+// e.g. because it was created locally, and Error if the registry couldn't be
+// checked.
+type OutdatedModelResponse struct {
+	Name         string `json:"name"`
+	Model        string `json:"model"`
+	Digest       string `json:"digest,omitempty"`
+	RemoteDigest string `json:"remote_digest,omitempty"`
+	Outdated     bool   `json:"outdated"`
+	Local        bool   `json:"local,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
 // ProgressResponse is the response passed to progress functions like
 // [PullProgressFunc] and [PushProgressFunc].
 type ProgressResponse struct {
@@ -300,6 +472,10 @@ type ProgressResponse struct {
 	Digest    string `json:"digest,omitempty"`
 	Total     int64  `json:"total,omitempty"`
 	Completed int64  `json:"completed,omitempty"`
+
+	// Skipped is set if the layer didn't need to be transferred, e.g.
+	// because the registry already has it
+	Skipped bool `json:"skipped,omitempty"`
 }
 
 // PushRequest is the request passed to [Client.Push].
@@ -310,6 +486,9 @@ type PushRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// Sign adds a signature made with the server's key to the pushed manifest.
+	Sign bool `json:"sign,omitempty"`
+
 	// Name is deprecated, see Model
 	Name string `json:"name"`
 }
@@ -326,12 +505,14 @@ type ProcessResponse struct {
 
 // ListModelResponse is a single model description in [ListResponse].
 type ListModelResponse struct {
-	Name       string       `json:"name"`
-	Model      string       `json:"model"`
-	ModifiedAt time.Time    `json:"modified_at"`
-	Size       int64        `json:"size"`
-	Digest     string       `json:"digest"`
-	Details    ModelDetails `json:"details,omitempty"`
+	Name       string            `json:"name"`
+	Model      string            `json:"model"`
+	ModifiedAt time.Time         `json:"modified_at"`
+	Size       int64             `json:"size"`
+	Digest     string            `json:"digest"`
+	Root       string            `json:"root,omitempty"`
+	Details    ModelDetails      `json:"details,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
 }
 
 // ProcessModelResponse is a single model description in [ProcessResponse].
@@ -345,6 +526,28 @@ type ProcessModelResponse struct {
 	SizeVRAM  int64        `json:"size_vram"`
 }
 
+// PruneRequest is the request passed to [Client.Prune].
+type PruneRequest struct {
+	// DryRun reports which models would be removed without removing them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// PruneResponse is the response from [Client.Prune].
+type PruneResponse struct {
+	Models    []PruneModelResponse `json:"models"`
+	Reclaimed int64                `json:"reclaimed"`
+	Size      int64                `json:"size"`
+	Quota     int64                `json:"quota"`
+}
+
+// PruneModelResponse is a single model description in [PruneResponse].
+type PruneModelResponse struct {
+	Name     string    `json:"name"`
+	Model    string    `json:"model"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
 type TokenResponse struct {
 	Token string `json:"token"`
 }
@@ -89,3 +89,33 @@ func Sign(ctx context.Context, bts []byte) (string, error) {
 	// signature is <pubkey>:<signature>
 	return fmt.Sprintf("%s:%s", bytes.TrimSpace(parts[1]), base64.StdEncoding.EncodeToString(signedData.Blob)), nil
 }
+
+// Verify checks that signature, in the format returned by Sign, is a valid
+// signature of bts. It returns the public key which produced the signature.
+func Verify(bts []byte, signature string) (ssh.PublicKey, error) {
+	key, sig, ok := strings.Cut(signature, ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed signature")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := ssh.ParsePublicKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := publicKey.Verify(bts, &ssh.Signature{Format: publicKey.Type(), Blob: sigBytes}); err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
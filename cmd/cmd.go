@@ -3,10 +3,12 @@ package cmd
 import (
 	"archive/zip"
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -21,6 +23,7 @@ import (
 	"regexp"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -36,6 +39,7 @@ import (
 	"github.com/ollama/ollama/auth"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/progress"
 	"github.com/ollama/ollama/server"
@@ -59,17 +63,39 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
-	f, err := os.Open(filename)
+	// the Modelfile as it's written is sent along with the resolved one
+	source, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	modelfile, err := parser.ParseFile(f)
+	modelfile, err := parser.ParseFile(bytes.NewReader(source))
 	if err != nil {
 		return err
 	}
 
+	// includes are inlined so the server doesn't need the fragments
+	if err := modelfile.Include(filename); err != nil {
+		return err
+	}
+
+	buildArgs, _ := cmd.Flags().GetStringArray("build-arg")
+	values := make(map[string]string)
+	for _, arg := range buildArgs {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("invalid build arg %q, expected name=value", arg)
+		}
+
+		values[name] = value
+	}
+
+	// args are substituted before paths are resolved since they may be used
+	// in FROM or ADAPTER
+	if err := modelfile.Expand(values); err != nil {
+		return err
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -82,7 +108,14 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	for i := range modelfile.Commands {
 		switch modelfile.Commands[i].Name {
 		case "model", "adapter":
-			path := modelfile.Commands[i].Args
+			path, scale := modelfile.Commands[i].Args, float32(1)
+			if modelfile.Commands[i].Name == "adapter" {
+				path, scale, err = parser.ParseAdapter(path)
+				if err != nil {
+					return err
+				}
+			}
+
 			if path == "~" {
 				path = home
 			} else if strings.HasPrefix(path, "~/") {
@@ -100,9 +133,33 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 				return err
 			}
 
+			if modelfile.Commands[i].Name == "model" {
+				// the shards of a split gguf model are uploaded separately and
+				// merged by the server
+				shards, err := llm.SplitFiles(path)
+				if err != nil {
+					return err
+				}
+
+				if len(shards) > 0 {
+					digests := make([]string, len(shards))
+					for j, shard := range shards {
+						digest, err := createBlob(cmd, client, shard)
+						if err != nil {
+							return err
+						}
+
+						digests[j] = "@" + digest
+					}
+
+					modelfile.Commands[i].Args = strings.Join(digests, " ")
+					continue
+				}
+			}
+
 			if fi.IsDir() {
-				// this is likely a safetensors or pytorch directory
-				// TODO make this work w/ adapters
+				// this is likely a safetensors or pytorch directory, or a
+				// safetensors adapter
 				tempfile, err := tempZipFiles(path)
 				if err != nil {
 					return err
@@ -118,6 +175,9 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 			}
 
 			modelfile.Commands[i].Args = "@" + digest
+			if modelfile.Commands[i].Name == "adapter" {
+				modelfile.Commands[i].Args = parser.FormatAdapter("@"+digest, scale)
+			}
 		}
 	}
 
@@ -147,7 +207,7 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 
 	quantize, _ := cmd.Flags().GetString("quantize")
 
-	request := api.CreateRequest{Name: args[0], Modelfile: modelfile.String(), Quantize: quantize}
+	request := api.CreateRequest{Name: args[0], Modelfile: modelfile.String(), Source: string(source), Quantize: quantize}
 	if err := client.Create(cmd.Context(), &request, fn); err != nil {
 		return err
 	}
@@ -155,6 +215,215 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func LintHandler(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("file")
+	filename, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// targets are checked by the server so they're resolved the same way as
+	// by create, paths are relative to the Modelfile
+	diags, err := parser.Lint(f, func(c parser.Command) *parser.Diagnostic {
+		// includes are inlined by create before the server sees them
+		if c.Name == "include" {
+			path, err := parser.IncludePath(filepath.Dir(filename), c.Args)
+			if err != nil {
+				return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+			}
+
+			if _, err := os.Stat(path); err != nil {
+				return &parser.Diagnostic{Severity: parser.SeverityError, Message: fmt.Sprintf("%s doesn't exist", c.Args)}
+			}
+
+			return nil
+		}
+
+		// an ADAPTER needs a FROM but its path is resolved the same way
+		if c.Name == "adapter" {
+			c.Name = "model"
+		}
+
+		resp, err := client.Lint(cmd.Context(), &api.LintRequest{
+			Modelfile: c.String(),
+			Path:      filename,
+		})
+		if err != nil {
+			return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+		}
+
+		if len(resp.Diagnostics) == 0 {
+			return nil
+		}
+
+		d := resp.Diagnostics[0]
+		return &parser.Diagnostic{Severity: parser.Severity(d.Severity), Message: d.Message}
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs int
+	for _, d := range diags {
+		fmt.Printf("%s:%s\n", name, d)
+		if d.Severity == parser.SeverityError {
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%d errors found in %s", errs, name)
+	}
+
+	return nil
+}
+
+func RenderHandler(cmd *cobra.Command, args []string) error {
+	var req api.RenderRequest
+	if name, _ := cmd.Flags().GetString("file"); name != "" {
+		// the file is the body of a generate or chat request
+		bts, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(bts, &req); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if len(args) > 0 {
+		req.Model = args[0]
+	}
+
+	if len(args) > 1 {
+		req.Prompt = args[1]
+	}
+
+	if req.Model == "" {
+		return errors.New("a model is required, either as an argument or in the request file")
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Render(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(resp.Prompt)
+	fmt.Println()
+
+	var data [][]string
+	for i, m := range resp.Messages {
+		var dropped string
+		if m.Dropped {
+			dropped = "yes"
+		}
+
+		data = append(data, []string{strconv.Itoa(i), m.Role, strconv.Itoa(m.Tokens), dropped})
+	}
+
+	newTable := func(header []string) *tablewriter.Table {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("\t")
+		return table
+	}
+
+	if len(data) > 0 {
+		table := newTable([]string{"MESSAGE", "ROLE", "TOKENS", "DROPPED"})
+		table.AppendBulk(data)
+		table.Render()
+		fmt.Println()
+	}
+
+	if len(resp.Images) > 0 {
+		data = nil
+		for _, img := range resp.Images {
+			offset := "dropped"
+			if img.Offset >= 0 {
+				offset = strconv.Itoa(img.Offset)
+			}
+
+			data = append(data, []string{fmt.Sprintf("[img-%d]", img.ID), strconv.Itoa(img.Message), offset})
+		}
+
+		table := newTable([]string{"IMAGE", "MESSAGE", "OFFSET"})
+		table.AppendBulk(data)
+		table.Render()
+		fmt.Println()
+	}
+
+	fmt.Printf("%d tokens\n", resp.Tokens)
+	return nil
+}
+
+func FormatHandler(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"Modelfile"}
+	}
+
+	check, _ := cmd.Flags().GetBool("check")
+
+	var unformatted []string
+	for _, name := range args {
+		bts, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := parser.Format(bytes.NewReader(bts))
+		if err != nil {
+			return fmt.Errorf("%s:%w", name, err)
+		}
+
+		if formatted == string(bts) {
+			continue
+		}
+
+		if check {
+			fmt.Println(name)
+			unformatted = append(unformatted, name)
+			continue
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(name, []byte(formatted), fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d files aren't formatted", len(unformatted))
+	}
+
+	return nil
+}
+
 func tempZipFiles(path string) (string, error) {
 	tempfile, err := os.CreateTemp("", "ollama-tf")
 	if err != nil {
@@ -210,6 +479,10 @@ func tempZipFiles(path string) (string, error) {
 		// pytorch files might also be unresolved git lfs references; skip if they are
 		// covers consolidated.x.pth, consolidated.pth
 		files = append(files, pt...)
+	} else if st, _ := glob(filepath.Join(path, "adapter_model.safetensors"), "application/octet-stream"); len(st) > 0 {
+		// peft adapters are converted against the FROM model, adapter_config.json
+		// is picked up with the other json files
+		files = append(files, st...)
 	} else {
 		return "", errors.New("no safetensors or torch files found")
 	}
@@ -230,6 +503,16 @@ func tempZipFiles(path string) (string, error) {
 		files = append(files, tks...)
 	}
 
+	// sentence-transformers keeps its pooling configuration in a subdirectory
+	// referenced by modules.json; vocab.txt is the vocabulary of older bert models
+	for _, pattern := range []string{"*_Pooling/config.json", "vocab.txt"} {
+		txt, err := glob(filepath.Join(path, pattern), "text/plain")
+		if err != nil {
+			return "", err
+		}
+		files = append(files, txt...)
+	}
+
 	zipfile := zip.NewWriter(tempfile)
 	defer zipfile.Close()
 
@@ -250,6 +533,12 @@ func tempZipFiles(path string) (string, error) {
 			return "", err
 		}
 
+		// keep pooling configurations in their subdirectory so they don't
+		// replace the model's config.json
+		if rel, err := filepath.Rel(path, file); err == nil && strings.HasSuffix(filepath.Dir(rel), "_Pooling") {
+			zfi.Name = filepath.ToSlash(rel)
+		}
+
 		zf, err := zipfile.CreateHeader(zfi)
 		if err != nil {
 			return "", err
@@ -422,6 +711,11 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	sign, err := cmd.Flags().GetBool("sign")
+	if err != nil {
+		return err
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -437,7 +731,12 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 
 			bar, ok := bars[resp.Digest]
 			if !ok {
-				bar = progress.NewBar(fmt.Sprintf("pushing %s...", resp.Digest[7:19]), resp.Total, resp.Completed)
+				msg := fmt.Sprintf("pushing %s...", resp.Digest[7:19])
+				if resp.Skipped {
+					msg = fmt.Sprintf("skipping %s...", resp.Digest[7:19])
+				}
+
+				bar = progress.NewBar(msg, resp.Total, resp.Completed)
 				bars[resp.Digest] = bar
 				p.Add(resp.Digest, bar)
 			}
@@ -456,7 +755,7 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.PushRequest{Name: args[0], Insecure: insecure}
+	request := api.PushRequest{Name: args[0], Insecure: insecure, Sign: sign}
 	if err := client.Push(cmd.Context(), &request, fn); err != nil {
 		if spinner != nil {
 			spinner.Stop()
@@ -485,21 +784,38 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	models, err := client.List(cmd.Context())
+	labels, _ := cmd.Flags().GetStringArray("label")
+	models, err := client.List(cmd.Context(), labels...)
 	if err != nil {
 		return err
 	}
 
+	// only show where models are stored if there's more than one models directory
+	roots := make(map[string]struct{})
+	for _, m := range models.Models {
+		roots[m.Root] = struct{}{}
+	}
+
 	var data [][]string
 
 	for _, m := range models.Models {
 		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
-			data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
+			row := []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")}
+			if len(roots) > 1 {
+				row = append(row, m.Root)
+			}
+
+			data = append(data, row)
 		}
 	}
 
+	header := []string{"NAME", "ID", "SIZE", "MODIFIED"}
+	if len(roots) > 1 {
+		header = append(header, "ROOT")
+	}
+
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"NAME", "ID", "SIZE", "MODIFIED"})
+	table.SetHeader(header)
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetHeaderLine(false)
@@ -574,6 +890,57 @@ func DeleteHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func PruneHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Prune(cmd.Context(), &api.PruneRequest{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+
+	if resp.Quota == 0 {
+		fmt.Println("no quota is set, nothing to reclaim")
+		return nil
+	}
+
+	if len(resp.Models) == 0 {
+		fmt.Printf("using %s of %s, nothing to reclaim\n", format.HumanBytes(resp.Size), format.HumanBytes(resp.Quota))
+		return nil
+	}
+
+	var data [][]string
+	for _, m := range resp.Models {
+		data = append(data, []string{m.Name, format.HumanBytes(m.Size), format.HumanTime(m.LastUsed, "Never")})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "SIZE", "LAST USED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	if dryRun {
+		fmt.Printf("\nwould reclaim %s, using %s of %s\n", format.HumanBytes(resp.Reclaimed), format.HumanBytes(resp.Size), format.HumanBytes(resp.Quota))
+	} else {
+		fmt.Printf("\nreclaimed %s, using %s of %s\n", format.HumanBytes(resp.Reclaimed), format.HumanBytes(resp.Size), format.HumanBytes(resp.Quota))
+	}
+
+	return nil
+}
+
 func ShowHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -585,8 +952,9 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	parameters, errParams := cmd.Flags().GetBool("parameters")
 	system, errSystem := cmd.Flags().GetBool("system")
 	template, errTemplate := cmd.Flags().GetBool("template")
+	tensors, errTensors := cmd.Flags().GetBool("tensors")
 
-	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate} {
+	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate, errTensors} {
 		if boolErr != nil {
 			return errors.New("error retrieving flags")
 		}
@@ -620,12 +988,17 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		showType = "template"
 	}
 
+	if tensors {
+		flagsSet++
+		showType = "tensors"
+	}
+
 	if flagsSet > 1 {
-		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', or '--template' can be specified")
+		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', '--template', or '--tensors' can be specified")
 	}
 
 	if flagsSet == 1 {
-		req := api.ShowRequest{Name: args[0]}
+		req := api.ShowRequest{Name: args[0], Tensors: tensors}
 		resp, err := client.Show(cmd.Context(), &req)
 		if err != nil {
 			return err
@@ -642,6 +1015,8 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 			fmt.Println(resp.System)
 		case "template":
 			fmt.Println(resp.Template)
+		case "tensors":
+			showTensors(resp)
 		}
 
 		return nil
@@ -683,6 +1058,15 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		)
 	}
 
+	if len(resp.Adapters) > 0 {
+		var adapters [][]string
+		for _, a := range resp.Adapters {
+			adapters = append(adapters, []string{strings.TrimPrefix(a.Digest, "sha256:")[:12], fmt.Sprintf("scale %v", a.Scale)})
+		}
+
+		mainTableData = append(mainTableData, []string{"Adapters"}, []string{renderSubTable(adapters, false)})
+	}
+
 	if resp.Parameters != "" {
 		mainTableData = append(mainTableData, []string{"Parameters"}, []string{formatParams(resp.Parameters)})
 	}
@@ -691,6 +1075,19 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		mainTableData = append(mainTableData, []string{"System"}, []string{renderSubTable(twoLines(resp.System), true)})
 	}
 
+	if len(resp.Labels) > 0 {
+		var labels [][]string
+		for k, v := range resp.Labels {
+			labels = append(labels, []string{k, v})
+		}
+
+		slices.SortFunc(labels, func(a, b []string) int {
+			return cmp.Compare(a[0], b[0])
+		})
+
+		mainTableData = append(mainTableData, []string{"Labels"}, []string{renderSubTable(labels, false)})
+	}
+
 	if resp.License != "" {
 		mainTableData = append(mainTableData, []string{"License"}, []string{renderSubTable(twoLines(resp.License), true)})
 	}
@@ -709,6 +1106,56 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// showTensors prints the tensors of a model followed by the size of each
+// layer by type.
+func showTensors(resp *api.ShowResponse) {
+	newTable := func(header ...string) *tablewriter.Table {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetNoWhiteSpace(true)
+		table.SetTablePadding("\t")
+		return table
+	}
+
+	table := newTable("NAME", "TYPE", "SHAPE", "SIZE", "OFFSET")
+	for _, t := range resp.Tensors {
+		shape := make([]string, len(t.Shape))
+		for i, dim := range t.Shape {
+			shape[i] = strconv.FormatUint(dim, 10)
+		}
+
+		table.Append([]string{t.Name, t.Type, strings.Join(shape, " x "), format.HumanBytes2(t.Size), strconv.FormatUint(t.Offset, 10)})
+	}
+
+	table.Render()
+	fmt.Println()
+
+	table = newTable("LAYER", "SIZE", "TYPES")
+	for _, l := range resp.Layers {
+		var types []string
+		for typ := range l.Types {
+			types = append(types, typ)
+		}
+
+		// largest first
+		slices.SortFunc(types, func(a, b string) int {
+			return cmp.Compare(l.Types[b], l.Types[a])
+		})
+
+		for i, typ := range types {
+			types[i] = fmt.Sprintf("%s %s", typ, format.HumanBytes2(l.Types[typ]))
+		}
+
+		table.Append([]string{l.Name, format.HumanBytes2(l.Size), strings.Join(types, ", ")})
+	}
+
+	table.Render()
+}
+
 func renderSubTable(data [][]string, file bool) string {
 	var buf bytes.Buffer
 	table := tablewriter.NewWriter(&buf)
@@ -761,6 +1208,39 @@ func formatParams(s string) string {
 	return renderSubTable(table, false)
 }
 
+func ExportHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.Stop()
+
+	var status string
+	var spinner *progress.Spinner
+	fn := func(resp api.ProgressResponse) error {
+		if status != resp.Status {
+			if spinner != nil {
+				spinner.Stop()
+			}
+
+			status = resp.Status
+			spinner = progress.NewSpinner(status)
+			p.Add(status, spinner)
+		}
+
+		return nil
+	}
+
+	request := api.ExportRequest{Model: args[0], Path: args[1]}
+	if err := client.Export(cmd.Context(), &request, fn); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func CopyHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -775,6 +1255,105 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func TagsHandler(cmd *cobra.Command, args []string) error {
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RemoteTags(cmd.Context(), &api.RemoteTagsRequest{Model: args[0], Insecure: insecure})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range resp.Tags {
+		fmt.Println(tag)
+	}
+
+	return nil
+}
+
+func OutdatedHandler(cmd *cobra.Command, args []string) error {
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return err
+	}
+
+	update, err := cmd.Flags().GetBool("update")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Outdated(cmd.Context(), &api.OutdatedRequest{Insecure: insecure})
+	if err != nil {
+		return err
+	}
+
+	short := func(digest string) string {
+		if len(digest) > 12 {
+			return digest[:12]
+		}
+
+		return digest
+	}
+
+	// models which aren't in the registry, such as those created locally,
+	// can't be outdated
+	var outdated []string
+	var data [][]string
+	for _, m := range resp.Models {
+		var remote string
+		switch {
+		case m.Error != "":
+			remote = m.Error
+		case m.Outdated:
+			remote = short(m.RemoteDigest)
+			outdated = append(outdated, m.Name)
+		default:
+			continue
+		}
+
+		data = append(data, []string{m.Name, short(m.Digest), remote})
+	}
+
+	if len(data) == 0 {
+		fmt.Println("all models are up to date")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "ID", "REMOTE ID"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	if update {
+		for _, name := range outdated {
+			fmt.Printf("\nupdating %s\n", name)
+			if err := PullHandler(cmd, []string{name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
@@ -1222,6 +1801,35 @@ func NewCLI() *cobra.Command {
 
 	createCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_0)")
+	createCmd.Flags().StringArray("build-arg", nil, "Set the value of an ARG in the Modelfile (e.g. ctx=8192)")
+
+	lintCmd := &cobra.Command{
+		Use:     "lint",
+		Short:   "Check a Modelfile for problems",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    LintHandler,
+	}
+
+	lintCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile")
+
+	renderCmd := &cobra.Command{
+		Use:     "render [MODEL] [PROMPT]",
+		Short:   "Show the prompt a request would send to a model",
+		Args:    cobra.MaximumNArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    RenderHandler,
+	}
+
+	renderCmd.Flags().StringP("file", "f", "", "Read a generate or chat request from this JSON file")
+
+	fmtCmd := &cobra.Command{
+		Use:   "fmt [MODELFILE...]",
+		Short: "Format Modelfiles",
+		RunE:  FormatHandler,
+	}
+
+	fmtCmd.Flags().Bool("check", false, "List files which aren't formatted instead of formatting them")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1236,6 +1844,7 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().Bool("parameters", false, "Show parameters of a model")
 	showCmd.Flags().Bool("template", false, "Show template of a model")
 	showCmd.Flags().Bool("system", false, "Show system message of a model")
+	showCmd.Flags().Bool("tensors", false, "Show tensors and layer sizes of a model")
 
 	runCmd := &cobra.Command{
 		Use:     "run MODEL [PROMPT]",
@@ -1277,6 +1886,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pushCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pushCmd.Flags().Bool("sign", false, "Sign the model with your Ollama key")
 
 	listCmd := &cobra.Command{
 		Use:     "list",
@@ -1286,6 +1896,8 @@ func NewCLI() *cobra.Command {
 		RunE:    ListHandler,
 	}
 
+	listCmd.Flags().StringArray("label", nil, "Only list models with this label, as key=value or key (e.g. owner=ml-team)")
+
 	psCmd := &cobra.Command{
 		Use:     "ps",
 		Short:   "List running models",
@@ -1301,6 +1913,14 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	exportCmd := &cobra.Command{
+		Use:     "export MODEL DIRECTORY",
+		Short:   "Export a model as Hugging Face safetensors to the server's export directory",
+		Args:    cobra.ExactArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ExportHandler,
+	}
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1309,12 +1929,45 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	pruneCmd := &cobra.Command{
+		Use:     "prune",
+		Short:   "Remove least recently used models to fit within the models quota",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    PruneHandler,
+	}
+
+	pruneCmd.Flags().Bool("dry-run", false, "Show which models would be removed without removing them")
+
+	tagsCmd := &cobra.Command{
+		Use:     "tags MODEL",
+		Short:   "List the tags of a model in the registry",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    TagsHandler,
+	}
+
+	tagsCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+
+	outdatedCmd := &cobra.Command{
+		Use:     "outdated",
+		Short:   "List models which have changed in the registry",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    OutdatedHandler,
+	}
+
+	outdatedCmd.Flags().Bool("update", false, "Pull the models which have changed")
+	outdatedCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+
 	envVars := envconfig.AsMap()
 
 	envs := []envconfig.EnvVar{envVars["OLLAMA_HOST"]}
 
 	for _, cmd := range []*cobra.Command{
 		createCmd,
+		lintCmd,
+		renderCmd,
 		showCmd,
 		runCmd,
 		pullCmd,
@@ -1322,7 +1975,11 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		exportCmd,
 		deleteCmd,
+		pruneCmd,
+		tagsCmd,
+		outdatedCmd,
 		serveCmd,
 	} {
 		switch cmd {
@@ -1331,15 +1988,20 @@ func NewCLI() *cobra.Command {
 		case serveCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{
 				envVars["OLLAMA_DEBUG"],
+				envVars["OLLAMA_EXPORT_DIR"],
 				envVars["OLLAMA_HOST"],
 				envVars["OLLAMA_KEEP_ALIVE"],
 				envVars["OLLAMA_MAX_LOADED_MODELS"],
 				envVars["OLLAMA_MAX_QUEUE"],
 				envVars["OLLAMA_MODELS"],
+				envVars["OLLAMA_MODELS_QUOTA"],
 				envVars["OLLAMA_NUM_PARALLEL"],
 				envVars["OLLAMA_NOPRUNE"],
 				envVars["OLLAMA_ORIGINS"],
+				envVars["OLLAMA_PINNED_MODELS"],
 				envVars["OLLAMA_TMPDIR"],
+				envVars["OLLAMA_TRUSTED_KEYS"],
+				envVars["OLLAMA_VERIFY_SIGNATURES"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
 				envVars["OLLAMA_LLM_LIBRARY"],
 				envVars["OLLAMA_MAX_VRAM"],
@@ -1352,6 +2014,9 @@ func NewCLI() *cobra.Command {
 	rootCmd.AddCommand(
 		serveCmd,
 		createCmd,
+		lintCmd,
+		fmtCmd,
+		renderCmd,
 		showCmd,
 		runCmd,
 		pullCmd,
@@ -1359,7 +2024,11 @@ func NewCLI() *cobra.Command {
 		listCmd,
 		psCmd,
 		copyCmd,
+		exportCmd,
 		deleteCmd,
+		pruneCmd,
+		tagsCmd,
+		outdatedCmd,
 	)
 
 	return rootCmd
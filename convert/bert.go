@@ -0,0 +1,224 @@
+package convert
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// pooling types understood by llama.cpp
+const (
+	poolingTypeNone uint32 = iota
+	poolingTypeMean
+	poolingTypeCLS
+)
+
+type BertModel struct {
+	ModelData
+}
+
+func (m *BertModel) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+	setOffsets(m.Tensors)
+	return nil
+}
+
+// LoadVocab reads the WordPiece vocabulary from tokenizer.json or, for older
+// checkpoints, vocab.txt. llama.cpp marks the start of a word with a phantom
+// space rather than marking continuations with ## so tokens are rewritten to
+// match.
+func (m *BertModel) LoadVocab() error {
+	tokens, err := m.wordPieceTokens()
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range tokens {
+		content := t.Content
+		switch {
+		case t.Special || strings.HasPrefix(content, "[") && strings.HasSuffix(content, "]"):
+			t.Special = true
+		case strings.HasPrefix(content, "##"):
+			content = content[2:]
+		default:
+			content = "▁" + content
+		}
+
+		m.Vocab.Tokens = append(m.Vocab.Tokens, content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	return nil
+}
+
+func (m *BertModel) wordPieceTokens() ([]Token, error) {
+	_, tokens, _, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		return tokens, err
+	}
+
+	f, err := os.Open(filepath.Join(m.Path, "vocab.txt"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		tokens = append(tokens, Token{ID: len(tokens), Content: scanner.Text()})
+	}
+
+	return tokens, scanner.Err()
+}
+
+// sentenceTransformersModule is an entry in a sentence-transformers
+// modules.json which lists the modules applied after the transformer.
+type sentenceTransformersModule struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// poolingType reads the pooling type from the sentence-transformers pooling
+// module, if there is one.
+func (m *BertModel) poolingType() (uint32, bool, error) {
+	bts, err := os.ReadFile(filepath.Join(m.Path, "modules.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	var modules []sentenceTransformersModule
+	if err := json.Unmarshal(bts, &modules); err != nil {
+		return 0, false, err
+	}
+
+	i := slices.IndexFunc(modules, func(module sentenceTransformersModule) bool {
+		return module.Type == "sentence_transformers.models.Pooling"
+	})
+	if i < 0 {
+		return 0, false, nil
+	}
+
+	bts, err = os.ReadFile(filepath.Join(m.Path, modules[i].Path, "config.json"))
+	if err != nil {
+		return 0, false, err
+	}
+
+	var pooling struct {
+		CLS  bool `json:"pooling_mode_cls_token"`
+		Mean bool `json:"pooling_mode_mean_tokens"`
+		Max  bool `json:"pooling_mode_max_tokens"`
+	}
+
+	if err := json.Unmarshal(bts, &pooling); err != nil {
+		return 0, false, err
+	}
+
+	switch {
+	case pooling.Mean:
+		return poolingTypeMean, true, nil
+	case pooling.CLS:
+		return poolingTypeCLS, true, nil
+	case pooling.Max:
+		return 0, false, errors.New("max pooling is not supported")
+	default:
+		return poolingTypeNone, true, nil
+	}
+}
+
+func (m *BertModel) WriteGGUF(ws io.WriteSeeker) error {
+	arch := "bert"
+	if slices.Contains(m.Params.Architectures, "NomicBertModel") {
+		arch = "nomic-bert"
+	}
+
+	kv := llm.KV{
+		"general.architecture":                 arch,
+		"general.name":                         m.Name,
+		arch + ".context_length":               uint32(m.Params.ContextSize),
+		arch + ".embedding_length":             uint32(m.Params.HiddenSize),
+		arch + ".feed_forward_length":          uint32(m.Params.IntermediateSize),
+		arch + ".block_count":                  uint32(m.Params.HiddenLayers),
+		arch + ".attention.head_count":         uint32(m.Params.AttentionHeads),
+		arch + ".attention.layer_norm_epsilon": float32(m.Params.LayerNormEPS),
+		arch + ".attention.causal":             false,
+		"general.file_type":                    m.Params.FileType(),
+		"tokenizer.ggml.model":                 "bert",
+		"tokenizer.ggml.token_type_count":      uint32(cmp.Or(m.Params.TypeVocabSize, 2)),
+		"tokenizer.ggml.tokens":                m.Vocab.Tokens,
+		"tokenizer.ggml.token_type":            m.Vocab.Types,
+	}
+
+	if arch == "nomic-bert" {
+		kv[arch+".rope.freq_base"] = float32(cmp.Or(m.Params.RopeFrequencyBase, 10000))
+	}
+
+	pooling, ok, err := m.poolingType()
+	if err != nil {
+		return err
+	} else if ok {
+		kv[arch+".pooling_type"] = pooling
+	}
+
+	for k, token := range map[string]string{
+		"tokenizer.ggml.unknown_token_id":   "[UNK]",
+		"tokenizer.ggml.seperator_token_id": "[SEP]",
+		"tokenizer.ggml.padding_token_id":   "[PAD]",
+		"tokenizer.ggml.cls_token_id":       "[CLS]",
+		"tokenizer.ggml.mask_token_id":      "[MASK]",
+	} {
+		if i := slices.Index(m.Vocab.Tokens, token); i >= 0 {
+			kv[k] = uint32(i)
+		}
+	}
+
+	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+}
+
+// nomicBertParams are the parameters NomicBertModel names differently from
+// other architectures.
+type nomicBertParams struct {
+	HiddenSize        int     `json:"n_embd"`
+	HiddenLayers      int     `json:"n_layer"`
+	AttentionHeads    int     `json:"n_head"`
+	IntermediateSize  int     `json:"n_inner"`
+	ContextSize       int     `json:"n_positions"`
+	LayerNormEPS      float64 `json:"layer_norm_epsilon"`
+	RopeFrequencyBase float64 `json:"rotary_emb_base"`
+}
+
+func (p *Params) fromNomicBert(bts []byte) error {
+	var nomic nomicBertParams
+	if err := json.Unmarshal(bts, &nomic); err != nil {
+		return err
+	}
+
+	if nomic.HiddenSize == 0 || nomic.AttentionHeads == 0 {
+		return fmt.Errorf("invalid nomic-bert config: n_embd and n_head are required")
+	}
+
+	p.HiddenSize = nomic.HiddenSize
+	p.HiddenLayers = nomic.HiddenLayers
+	p.AttentionHeads = nomic.AttentionHeads
+	p.IntermediateSize = cmp.Or(nomic.IntermediateSize, 4*nomic.HiddenSize)
+	p.ContextSize = nomic.ContextSize
+	p.LayerNormEPS = nomic.LayerNormEPS
+	p.RopeFrequencyBase = nomic.RopeFrequencyBase
+	return nil
+}
@@ -0,0 +1,234 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeBertCheckpoint(t *testing.T, dir string, tensors map[string]syntheticTensor, pooling map[string]bool) {
+	t.Helper()
+
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), tensors)
+
+	writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 0, "content": "[PAD]", "special": true},
+			{"id": 1, "content": "[UNK]", "special": true},
+			{"id": 2, "content": "[CLS]", "special": true},
+			{"id": 3, "content": "[SEP]", "special": true},
+			{"id": 4, "content": "[MASK]", "special": true},
+		},
+		"model": map[string]any{
+			"type": "WordPiece",
+			"vocab": map[string]int{
+				"[PAD]": 0, "[UNK]": 1, "[CLS]": 2, "[SEP]": 3, "[MASK]": 4,
+				"hello": 5, "##ing": 6,
+			},
+		},
+	})
+
+	if pooling != nil {
+		writeJSON(t, filepath.Join(dir, "modules.json"), []map[string]any{
+			{"idx": 0, "name": "0", "path": "", "type": "sentence_transformers.models.Transformer"},
+			{"idx": 1, "name": "1", "path": "1_Pooling", "type": "sentence_transformers.models.Pooling"},
+		})
+
+		if err := os.Mkdir(filepath.Join(dir, "1_Pooling"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		writeJSON(t, filepath.Join(dir, "1_Pooling", "config.json"), pooling)
+	}
+}
+
+func TestBert(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":           []string{"BertModel"},
+		"vocab_size":              7,
+		"hidden_size":             8,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"intermediate_size":       16,
+		"max_position_embeddings": 32,
+		"type_vocab_size":         2,
+		"layer_norm_eps":          1e-12,
+	})
+
+	tensors := map[string]syntheticTensor{
+		"embeddings.word_embeddings.weight":       {shape: []uint64{7, 8}},
+		"embeddings.token_type_embeddings.weight": {shape: []uint64{2, 8}},
+		"embeddings.position_embeddings.weight":   {shape: []uint64{32, 8}},
+		"embeddings.position_ids":                 {shape: []uint64{1, 32}},
+		"embeddings.LayerNorm.weight":             {shape: []uint64{8}},
+		"embeddings.LayerNorm.bias":               {shape: []uint64{8}},
+		"pooler.dense.weight":                     {shape: []uint64{8, 8}},
+		"pooler.dense.bias":                       {shape: []uint64{8}},
+	}
+
+	for _, name := range []string{"attention.self.query", "attention.self.key", "attention.self.value", "attention.output.dense"} {
+		tensors["encoder.layer.0."+name+".weight"] = syntheticTensor{shape: []uint64{8, 8}}
+		tensors["encoder.layer.0."+name+".bias"] = syntheticTensor{shape: []uint64{8}}
+	}
+
+	for _, name := range []string{"attention.output.LayerNorm", "output.LayerNorm"} {
+		tensors["encoder.layer.0."+name+".weight"] = syntheticTensor{shape: []uint64{8}}
+		tensors["encoder.layer.0."+name+".bias"] = syntheticTensor{shape: []uint64{8}}
+	}
+
+	tensors["encoder.layer.0.intermediate.dense.weight"] = syntheticTensor{shape: []uint64{16, 8}}
+	tensors["encoder.layer.0.intermediate.dense.bias"] = syntheticTensor{shape: []uint64{16}}
+	tensors["encoder.layer.0.output.dense.weight"] = syntheticTensor{shape: []uint64{8, 16}}
+	tensors["encoder.layer.0.output.dense.bias"] = syntheticTensor{shape: []uint64{8}}
+
+	writeBertCheckpoint(t, dir, tensors, map[string]bool{"pooling_mode_mean_tokens": true})
+
+	ggml, _ := convertSynthetic(t, dir)
+
+	kv := ggml.KV()
+	if kv.Architecture() != "bert" {
+		t.Errorf("expected bert, actual %s", kv.Architecture())
+	}
+
+	for k, expect := range map[string]any{
+		"bert.context_length":             uint32(32),
+		"bert.feed_forward_length":        uint32(16),
+		"bert.attention.causal":           false,
+		"bert.pooling_type":               poolingTypeMean,
+		"tokenizer.ggml.model":            "bert",
+		"tokenizer.ggml.token_type_count": uint32(2),
+		"tokenizer.ggml.unknown_token_id": uint32(1),
+		"tokenizer.ggml.cls_token_id":     uint32(2),
+		"tokenizer.ggml.mask_token_id":    uint32(4),
+	} {
+		if kv[k] != expect {
+			t.Errorf("%s: expected %v, actual %v", k, expect, kv[k])
+		}
+	}
+
+	bts, err := json.Marshal(kv["tokenizer.ggml.tokens"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	if err := json.Unmarshal(bts, &tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "▁hello", "ing"}; !slices.Equal(tokens, expect) {
+		t.Errorf("expected tokens %v, actual %v", expect, tokens)
+	}
+
+	var names []string
+	for _, tensor := range ggml.Tensors() {
+		names = append(names, tensor.Name)
+	}
+
+	for _, name := range []string{"token_types.weight", "position_embd.weight", "token_embd_norm.bias", "blk.0.attn_q.bias", "blk.0.attn_output_norm.weight", "blk.0.ffn_up.bias", "blk.0.ffn_down.weight", "blk.0.layer_output_norm.bias"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected tensor %s", name)
+		}
+	}
+
+	for _, name := range names {
+		if strings.Contains(name, "pooler") || strings.Contains(name, "position_ids") {
+			t.Errorf("unexpected tensor %s", name)
+		}
+	}
+
+	checkOffsets(t, ggml.Tensors())
+}
+
+func TestNomicBert(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":      []string{"NomicBertModel"},
+		"vocab_size":         7,
+		"n_embd":             8,
+		"n_layer":            1,
+		"n_head":             2,
+		"n_inner":            16,
+		"n_positions":        64,
+		"type_vocab_size":    2,
+		"layer_norm_epsilon": 1e-12,
+		"rotary_emb_base":    1000,
+	})
+
+	writeBertCheckpoint(t, dir, map[string]syntheticTensor{
+		"embeddings.word_embeddings.weight":       {shape: []uint64{7, 8}},
+		"embeddings.token_type_embeddings.weight": {shape: []uint64{2, 8}},
+		"emb_ln.weight":                         {shape: []uint64{8}},
+		"emb_ln.bias":                           {shape: []uint64{8}},
+		"encoder.layers.0.attn.Wqkv.weight":     {shape: []uint64{24, 8}},
+		"encoder.layers.0.attn.out_proj.weight": {shape: []uint64{8, 8}},
+		"encoder.layers.0.norm1.weight":         {shape: []uint64{8}},
+		"encoder.layers.0.norm1.bias":           {shape: []uint64{8}},
+		"encoder.layers.0.mlp.fc11.weight":      {shape: []uint64{16, 8}},
+		"encoder.layers.0.mlp.fc12.weight":      {shape: []uint64{16, 8}},
+		"encoder.layers.0.mlp.fc2.weight":       {shape: []uint64{8, 16}},
+		"encoder.layers.0.norm2.weight":         {shape: []uint64{8}},
+		"encoder.layers.0.norm2.bias":           {shape: []uint64{8}},
+	}, map[string]bool{"pooling_mode_cls_token": true})
+
+	ggml, _ := convertSynthetic(t, dir)
+
+	kv := ggml.KV()
+	if kv.Architecture() != "nomic-bert" {
+		t.Errorf("expected nomic-bert, actual %s", kv.Architecture())
+	}
+
+	for k, expect := range map[string]any{
+		"nomic-bert.context_length":       uint32(64),
+		"nomic-bert.embedding_length":     uint32(8),
+		"nomic-bert.feed_forward_length":  uint32(16),
+		"nomic-bert.attention.head_count": uint32(2),
+		"nomic-bert.rope.freq_base":       float32(1000),
+		"nomic-bert.pooling_type":         poolingTypeCLS,
+	} {
+		if kv[k] != expect {
+			t.Errorf("%s: expected %v, actual %v", k, expect, kv[k])
+		}
+	}
+
+	var names []string
+	for _, tensor := range ggml.Tensors() {
+		names = append(names, tensor.Name)
+	}
+
+	for _, name := range []string{"token_embd_norm.weight", "blk.0.attn_qkv.weight", "blk.0.attn_output.weight", "blk.0.ffn_up.weight", "blk.0.ffn_gate.weight", "blk.0.ffn_down.weight", "blk.0.layer_output_norm.bias"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected tensor %s", name)
+		}
+	}
+}
+
+func TestBertMaxPooling(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":       []string{"BertModel"},
+		"hidden_size":         8,
+		"num_attention_heads": 2,
+	})
+
+	writeBertCheckpoint(t, dir, map[string]syntheticTensor{
+		"embeddings.word_embeddings.weight": {shape: []uint64{7, 8}},
+	}, map[string]bool{"pooling_mode_max_tokens": true})
+
+	params, err := (&SafetensorFormat{}).GetParams(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &BertModel{ModelData{Path: dir, Params: params}}
+	if _, _, err := m.poolingType(); err == nil {
+		t.Error("expected an error for max pooling")
+	}
+}
@@ -44,25 +44,57 @@ type Params struct {
 	PaddingTokenID    int      `json:"pad_token_id"`
 	RopeFrequencyBase float64  `json:"rope_theta"`
 
+	// OriginalContextSize is the context size before any rope scaling
+	OriginalContextSize int          `json:"original_max_position_embeddings"`
+	RopeScaling         *RopeScaling `json:"rope_scaling"`
+	SlidingWindow       int          `json:"sliding_window"`
+
+	// LayerNormEPS and TypeVocabSize are used by BERT style encoders
+	LayerNormEPS  float64 `json:"layer_norm_eps"`
+	TypeVocabSize int     `json:"type_vocab_size"`
+
 	Experts     int `json:"num_local_experts"`
 	ExpertsUsed int `json:"num_experts_per_tok"`
 
 	PreTokenizer string
 
+	fileType uint32
+
 	ByteOrder
 }
 
+// RopeScaling describes how rotary embeddings are extended beyond the
+// original context size. Phi-3 uses LongRoPE ("su" or "longrope") which
+// rescales each rotary dimension by a factor.
+type RopeScaling struct {
+	Type        string    `json:"type"`
+	Factor      float64   `json:"factor"`
+	LongFactor  []float32 `json:"long_factor"`
+	ShortFactor []float32 `json:"short_factor"`
+}
+
 type ByteOrder interface {
 	binary.ByteOrder
 	binary.AppendByteOrder
 }
 
+// ModelArch converts a model of a particular architecture. GetTensors only
+// describes the tensors of the model. Their data is streamed from the
+// checkpoint, through any repacking, as WriteGGUF writes them so memory use
+// doesn't grow with the size of the model.
 type ModelArch interface {
 	GetTensors() error
 	LoadVocab() error
 	WriteGGUF(io.WriteSeeker) error
+
+	// GenerationParams returns the default parameters of the model, which
+	// requires the vocabulary to be loaded
+	GenerationParams() (map[string]any, error)
 }
 
+// ModelFormat reads checkpoints in a particular file format. The tensors
+// returned by GetTensors are written by a tensorWriterTo which reads the
+// checkpoint in bounded chunks.
 type ModelFormat interface {
 	GetLayerName(string) (string, error)
 	GetTensors(string, *Params) ([]llm.Tensor, error)
@@ -79,6 +111,47 @@ type ModelData struct {
 	Format  ModelFormat
 }
 
+// repackTensors reads the tensors of the model, repacking each with the
+// tensorRepack returned by fn. fn returns nil for tensors written as is.
+func (md *ModelData) repackTensors(fn func(name string, shape []uint64) (*tensorRepack, error)) error {
+	ts, err := md.Format.GetTensors(md.Path, md.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range ts {
+		repack, err := fn(t.Name, t.Shape)
+		if err != nil {
+			return err
+		}
+
+		if repack != nil {
+			if t, err = repackTensor(t, *repack); err != nil {
+				return err
+			}
+		}
+
+		md.Tensors = append(md.Tensors, t)
+	}
+
+	// quantized tensors may not be a multiple of the alignment
+	setOffsets(md.Tensors)
+	return nil
+}
+
+// repackTensor returns a copy of t which is repacked as it's written.
+func repackTensor(t llm.Tensor, repack tensorRepack) (llm.Tensor, error) {
+	wt, ok := t.WriterTo.(tensorWriterTo)
+	if !ok {
+		return t, fmt.Errorf("%s: can't repack tensor", t.Name)
+	}
+
+	wt.t = &t
+	wt.repack = repack
+	t.WriterTo = wt
+	return t, nil
+}
+
 func GetModelFormat(dirname string) (ModelFormat, error) {
 	files, err := filepath.Glob(filepath.Join(dirname, "*"))
 	if err != nil {
@@ -104,6 +177,17 @@ type Vocab struct {
 	Scores []float32
 	Types  []int32
 	Merges []string
+
+	// Special maps the type of a special token, i.e. bos, eos, pad or unk,
+	// to its id
+	Special map[string]int
+
+	// AddBOS and AddEOS are whether the tokenizer adds bos and eos tokens
+	// to prompts, if it's known
+	AddBOS, AddEOS *bool
+
+	// ChatTemplate is the Hugging Face chat template of the tokenizer
+	ChatTemplate string
 }
 
 func LoadSentencePieceTokens(dirpath string, params *Params) (*Vocab, error) {
@@ -146,45 +230,53 @@ func LoadSentencePieceTokens(dirpath string, params *Params) (*Vocab, error) {
 
 	// add any additional tokens
 	addIn, err := os.ReadFile(filepath.Join(dirpath, "added_tokens.json"))
-	if os.IsNotExist(err) {
-		return v, nil
-	} else if err != nil {
-		return nil, err
-	}
+	if err == nil {
+		slog.Info("reading user defined tokens")
 
-	slog.Info("reading user defined tokens")
-
-	var extraTokenData map[string]int
-	if err := json.Unmarshal(addIn, &extraTokenData); err != nil {
-		return nil, err
-	}
+		var extraTokenData map[string]int
+		if err := json.Unmarshal(addIn, &extraTokenData); err != nil {
+			return nil, err
+		}
 
-	type token struct {
-		key string
-		pos int
-	}
+		type token struct {
+			key string
+			pos int
+		}
 
-	extraTokens := make([]token, 0)
-	for k, id := range extraTokenData {
-		extraTokens = append(extraTokens, token{k, id})
-	}
+		extraTokens := make([]token, 0)
+		for k, id := range extraTokenData {
+			extraTokens = append(extraTokens, token{k, id})
+		}
 
-	slices.SortFunc(extraTokens, func(a, b token) int {
-		return cmp.Compare(a.pos, b.pos)
-	})
+		slices.SortFunc(extraTokens, func(a, b token) int {
+			return cmp.Compare(a.pos, b.pos)
+		})
 
-	numToks := len(v.Tokens)
+		numToks := len(v.Tokens)
 
-	for cnt, t := range extraTokens {
-		// the token id should match the specific index for the total number of tokens
-		if t.pos != cnt+numToks {
-			return nil, fmt.Errorf("token ID '%d' for '%s' doesn't match total token size", t.pos, t.key)
+		for cnt, t := range extraTokens {
+			// the token id should match the specific index for the total number of tokens
+			if t.pos != cnt+numToks {
+				return nil, fmt.Errorf("token ID '%d' for '%s' doesn't match total token size", t.pos, t.key)
+			}
+			v.Tokens = append(v.Tokens, t.key)
+			v.Scores = append(v.Scores, -1000.0)
+			v.Types = append(v.Types, tokenTypeUserDefined)
 		}
-		v.Tokens = append(v.Tokens, t.key)
-		v.Scores = append(v.Scores, -1000.0)
-		v.Types = append(v.Types, tokenTypeUserDefined)
+		slog.Info(fmt.Sprintf("vocab size w/ extra tokens: %d", len(v.Tokens)))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// added tokens in tokenizer.json also mark which tokens are special
+	added, err := loadAddedTokens(dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.addTokens(added); err != nil {
+		return nil, err
 	}
-	slog.Info(fmt.Sprintf("vocab size w/ extra tokens: %d", len(v.Tokens)))
 
 	if params.VocabSize > len(v.Tokens) {
 		missingTokens := params.VocabSize - len(v.Tokens)
@@ -196,5 +288,9 @@ func LoadSentencePieceTokens(dirpath string, params *Params) (*Vocab, error) {
 		}
 	}
 
+	if err := v.loadSpecialTokens(dirpath); err != nil {
+		return nil, err
+	}
+
 	return v, nil
 }
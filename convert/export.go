@@ -0,0 +1,751 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/x448/float16"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+	"github.com/ollama/ollama/llm"
+)
+
+// exportShardSize is the maximum size of each safetensors file written by
+// Export.
+var exportShardSize uint64 = 5 << 30
+
+// exportArch describes how a GGUF architecture is exported.
+type exportArch struct {
+	// architecture and modelType are the Hugging Face architecture and model
+	// type of the exported checkpoint
+	architecture string
+	modelType    string
+	activation   string
+
+	// repack reverses the repacking done when the model was converted. shape
+	// is the shape of the exported tensor.
+	repack func(name string, shape []uint64, kv llm.KV) (*tensorRepack, error)
+}
+
+var exportArches = map[string]exportArch{
+	"llama": {"LlamaForCausalLM", "llama", "silu", llamaUnrepack},
+	"gemma": {"GemmaForCausalLM", "gemma", "gelu_pytorch_tanh", gemmaUnrepack},
+	"qwen2": {"Qwen2ForCausalLM", "qwen2", "silu", nil},
+}
+
+// exportTypes maps the tensor types which can be exported to the dtype they're
+// written as. Q8_0 is dequantized to F16.
+var exportTypes = map[uint32]string{
+	tensorKindF32:  "F32",
+	tensorKindF16:  "F16",
+	tensorKindBF16: "BF16",
+	tensorKindQ8_0: "F16",
+}
+
+var exportNames = map[string]string{
+	"token_embd.weight":  "model.embed_tokens.weight",
+	"output_norm.weight": "model.norm.weight",
+	"output.weight":      "lm_head.weight",
+}
+
+var exportLayerNames = map[string]string{
+	"attn_norm.weight":   "input_layernorm.weight",
+	"ffn_norm.weight":    "post_attention_layernorm.weight",
+	"attn_q.weight":      "self_attn.q_proj.weight",
+	"attn_k.weight":      "self_attn.k_proj.weight",
+	"attn_v.weight":      "self_attn.v_proj.weight",
+	"attn_q.bias":        "self_attn.q_proj.bias",
+	"attn_k.bias":        "self_attn.k_proj.bias",
+	"attn_v.bias":        "self_attn.v_proj.bias",
+	"attn_output.weight": "self_attn.o_proj.weight",
+	"ffn_gate.weight":    "mlp.gate_proj.weight",
+	"ffn_up.weight":      "mlp.up_proj.weight",
+	"ffn_down.weight":    "mlp.down_proj.weight",
+}
+
+// pretokenizerPatterns are the split patterns of the pretokenizers detected
+// by parseTokens.
+var pretokenizerPatterns = map[string]string{
+	"llama-bpe": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	"qwen2":     `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+}
+
+// Export writes the GGUF model in the file fn to dir as a Hugging Face
+// checkpoint: config.json, the tokenizer and the tensors in sharded
+// safetensors files. F16, BF16 and Q8_0 tensors are dequantized and the
+// repacking done during conversion is reversed. Other quantizations can't be
+// exported.
+func Export(fn, dir string, progress func(string)) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ggml, n, err := llm.DecodeGGML(f, -1)
+	if err != nil {
+		return err
+	}
+
+	if ggml.Name() != "gguf" {
+		return fmt.Errorf("exporting %s models isn't supported", ggml.Name())
+	}
+
+	kv := ggml.KV()
+	arch, ok := exportArches[kv.Architecture()]
+	if !ok {
+		return fmt.Errorf("exporting %s models isn't supported", kv.Architecture())
+	}
+
+	var end uint64
+	for _, t := range ggml.Tensors() {
+		end = max(end, t.Offset+t.Size())
+	}
+
+	start := n - int64(end)
+
+	var ts []exportTensor
+	for _, t := range ggml.Tensors() {
+		if t.Name == "rope_freqs.weight" {
+			slog.Warn("rope frequencies aren't exported", "tensor", t.Name)
+			continue
+		}
+
+		dtype, ok := exportTypes[t.Kind]
+		if !ok {
+			return fmt.Errorf("%s: %s tensors can't be exported, only F32, F16, BF16 and Q8_0 are supported", t.Name, t.TypeString())
+		}
+
+		name, err := exportTensorName(t.Name)
+		if err != nil {
+			return err
+		}
+
+		// shapes are decoded in gguf order and padded to 4 dimensions
+		dims := len(t.Shape)
+		for dims > 1 && t.Shape[dims-1] == 1 {
+			dims--
+		}
+
+		shape := slices.Clone(t.Shape[:dims])
+		slices.Reverse(shape)
+
+		et := exportTensor{
+			name:  name,
+			dtype: dtype,
+			shape: shape,
+			kind:  t.Kind,
+			r:     io.NewSectionReader(f, start+int64(t.Offset), int64(t.Size())),
+		}
+
+		if arch.repack != nil {
+			repack, err := arch.repack(t.Name, shape, kv)
+			if err != nil {
+				return err
+			}
+
+			if repack != nil {
+				et.repack = *repack
+			}
+		}
+
+		ts = append(ts, et)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := exportTensors(dir, ts, progress); err != nil {
+		return err
+	}
+
+	progress("writing config")
+	if err := exportConfig(dir, kv, arch, ts); err != nil {
+		return err
+	}
+
+	progress("writing tokenizer")
+	return exportTokenizer(dir, kv)
+}
+
+func exportTensorName(name string) (string, error) {
+	if n, ok := exportNames[name]; ok {
+		return n, nil
+	}
+
+	if rest, ok := strings.CutPrefix(name, "blk."); ok {
+		block, suffix, _ := strings.Cut(rest, ".")
+		if n, ok := exportLayerNames[suffix]; ok {
+			return fmt.Sprintf("model.layers.%s.%s", block, n), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: tensor can't be exported", name)
+}
+
+// llamaUnrepack reverses llamaRepack so the rows of the q and k projections
+// are in the half split order of Hugging Face checkpoints.
+func llamaUnrepack(name string, shape []uint64, kv llm.KV) (*tensorRepack, error) {
+	var heads uint64
+	switch {
+	case strings.HasSuffix(name, "attn_q.weight"):
+		heads = kv.HeadCount()
+	case strings.HasSuffix(name, "attn_k.weight"):
+		heads = kv.HeadCountKV()
+	default:
+		return nil, nil
+	}
+
+	if heads == 0 || shape[0]%(2*heads) != 0 {
+		return nil, fmt.Errorf("%s: can't split %d rows into %d heads", name, shape[0], heads)
+	}
+
+	// within each head, rows 2i and 2i+1 become row i of the first half and
+	// row i of the second half
+	headDim := shape[0] / heads
+	return &tensorRepack{
+		row: func(i uint64) uint64 {
+			head, r := i/headDim, i%headDim
+			if r < headDim/2 {
+				return head*headDim + 2*r
+			}
+
+			return head*headDim + 2*(r-headDim/2) + 1
+		},
+	}, nil
+}
+
+// gemmaUnrepack subtracts the one added to the norm weights during
+// conversion.
+func gemmaUnrepack(name string, _ []uint64, _ llm.KV) (*tensorRepack, error) {
+	if !strings.HasSuffix(name, "norm.weight") {
+		return nil, nil
+	}
+
+	return &tensorRepack{
+		values: func(f32s []float32) {
+			for i := range f32s {
+				f32s[i]--
+			}
+		},
+	}, nil
+}
+
+// exportTensor is a tensor of the exported checkpoint which is read from the
+// GGUF file as it's written.
+type exportTensor struct {
+	name  string
+	dtype string
+
+	// shape is the shape of the exported tensor, i.e. the reverse of the gguf
+	// shape
+	shape []uint64
+
+	kind   uint32
+	r      *io.SectionReader
+	repack tensorRepack
+}
+
+func (t exportTensor) dims() (rows, cols uint64) {
+	rows = 1
+	for _, dim := range t.shape[:len(t.shape)-1] {
+		rows *= dim
+	}
+
+	return rows, t.shape[len(t.shape)-1]
+}
+
+func (t exportTensor) size() uint64 {
+	rows, cols := t.dims()
+	if t.dtype == "F32" {
+		return rows * cols * 4
+	}
+
+	return rows * cols * 2
+}
+
+// rowSize is the size of a row of the gguf tensor.
+func (t exportTensor) rowSize(cols uint64) uint64 {
+	switch t.kind {
+	case tensorKindF32:
+		return cols * 4
+	case tensorKindQ8_0:
+		return cols / 32 * 34
+	default:
+		return cols * 2
+	}
+}
+
+func (t exportTensor) WriteTo(w io.Writer) (int64, error) {
+	rows, cols := t.dims()
+	rowSize := t.rowSize(cols)
+	chunkRows := max(1, chunkSize/cols)
+
+	src := make([]byte, min(rows, chunkRows)*rowSize)
+	f32s := make([]float32, 0, min(rows, chunkRows)*cols)
+	var bts []byte
+
+	var n int64
+	for begin := uint64(0); begin < rows; begin += chunkRows {
+		end := min(rows, begin+chunkRows)
+		b := src[:(end-begin)*rowSize]
+		if t.repack.row == nil {
+			if _, err := t.r.ReadAt(b, int64(begin*rowSize)); err != nil {
+				return n, fmt.Errorf("%s: %w", t.name, err)
+			}
+		} else {
+			for i := begin; i < end; i++ {
+				if _, err := t.r.ReadAt(b[(i-begin)*rowSize:(i-begin+1)*rowSize], int64(t.repack.row(i)*rowSize)); err != nil {
+					return n, fmt.Errorf("%s: %w", t.name, err)
+				}
+			}
+		}
+
+		f32s = dequantizeRows(f32s[:0], t.kind, b)
+		if t.repack.values != nil {
+			t.repack.values(f32s)
+		}
+
+		bts = appendSafetensorsData(bts[:0], t.dtype, f32s)
+		written, err := w.Write(bts)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// dequantizeRows appends the values of the little endian gguf tensor data b
+// to dst.
+func dequantizeRows(dst []float32, kind uint32, b []byte) []float32 {
+	switch kind {
+	case tensorKindF32:
+		for ; len(b) >= 4; b = b[4:] {
+			dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+	case tensorKindF16:
+		for ; len(b) >= 2; b = b[2:] {
+			dst = append(dst, float16.Frombits(binary.LittleEndian.Uint16(b)).Float32())
+		}
+	case tensorKindBF16:
+		for ; len(b) >= 2; b = b[2:] {
+			dst = append(dst, math.Float32frombits(uint32(binary.LittleEndian.Uint16(b))<<16))
+		}
+	case tensorKindQ8_0:
+		for ; len(b) >= 34; b = b[34:] {
+			d := float16.Frombits(binary.LittleEndian.Uint16(b)).Float32()
+			for _, q := range b[2:34] {
+				dst = append(dst, float32(int8(q))*d)
+			}
+		}
+	}
+
+	return dst
+}
+
+func appendSafetensorsData(b []byte, dtype string, f32s []float32) []byte {
+	for _, f := range f32s {
+		switch dtype {
+		case "F32":
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+		case "F16":
+			b = appendF16(b, binary.LittleEndian, f)
+		case "BF16":
+			// round to nearest even
+			bits := math.Float32bits(f)
+			bits += 0x7fff + bits>>16&1
+			b = binary.LittleEndian.AppendUint16(b, uint16(bits>>16))
+		}
+	}
+
+	return b
+}
+
+// exportTensors writes ts to safetensors files of at most exportShardSize
+// bytes, unless a tensor is larger, and an index of which file each tensor is
+// in.
+func exportTensors(dir string, ts []exportTensor, progress func(string)) error {
+	var shards [][]exportTensor
+	var size uint64
+	for _, t := range ts {
+		if len(shards) == 0 || size > 0 && size+t.size() > exportShardSize {
+			shards = append(shards, nil)
+			size = 0
+		}
+
+		shards[len(shards)-1] = append(shards[len(shards)-1], t)
+		size += t.size()
+	}
+
+	index := struct {
+		Metadata struct {
+			TotalSize uint64 `json:"total_size"`
+		} `json:"metadata"`
+		WeightMap map[string]string `json:"weight_map"`
+	}{WeightMap: make(map[string]string)}
+
+	for i, shard := range shards {
+		name := fmt.Sprintf("model-%05d-of-%05d.safetensors", i+1, len(shards))
+		progress(fmt.Sprintf("writing %s", name))
+		if err := exportShard(filepath.Join(dir, name), shard); err != nil {
+			return err
+		}
+
+		for _, t := range shard {
+			index.WeightMap[t.name] = name
+			index.Metadata.TotalSize += t.size()
+		}
+	}
+
+	return writeExportJSON(filepath.Join(dir, "model.safetensors.index.json"), index)
+}
+
+func exportShard(fn string, ts []exportTensor) error {
+	header := map[string]any{
+		"__metadata__": map[string]string{"format": "pt"},
+	}
+
+	var offset int64
+	for _, t := range ts {
+		header[t.name] = safetensorMetadata{
+			Type:    t.dtype,
+			Shape:   t.shape,
+			Offsets: []int64{offset, offset + int64(t.size())},
+		}
+
+		offset += int64(t.size())
+	}
+
+	bts, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	// the header is padded so tensor data is aligned
+	if n := len(bts) % 8; n > 0 {
+		bts = append(bts, strings.Repeat(" ", 8-n)...)
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := binary.Write(f, binary.LittleEndian, int64(len(bts))); err != nil {
+		return err
+	}
+
+	if _, err := f.Write(bts); err != nil {
+		return err
+	}
+
+	for _, t := range ts {
+		if _, err := t.WriteTo(f); err != nil {
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+func exportConfig(dir string, kv llm.KV, arch exportArch, ts []exportTensor) error {
+	prefix := kv.Architecture()
+	config := map[string]any{
+		"architectures":           []string{arch.architecture},
+		"model_type":              arch.modelType,
+		"hidden_act":              arch.activation,
+		"hidden_size":             kv.EmbeddingLength(),
+		"intermediate_size":       kv.Uint(prefix + ".feed_forward_length"),
+		"num_hidden_layers":       kv.BlockCount(),
+		"num_attention_heads":     kv.HeadCount(),
+		"num_key_value_heads":     kv.HeadCountKV(),
+		"max_position_embeddings": kv.ContextLength(),
+		"rms_norm_eps":            kv[prefix+".attention.layer_norm_rms_epsilon"],
+		"rope_theta":              cmp.Or(kv[prefix+".rope.freq_base"], any(float32(10000))),
+		"tie_word_embeddings":     !slices.ContainsFunc(ts, func(t exportTensor) bool { return t.name == "lm_head.weight" }),
+	}
+
+	if arch.modelType == "gemma" {
+		config["head_dim"] = kv.EmbeddingHeadCountK()
+	}
+
+	if i := slices.IndexFunc(ts, func(t exportTensor) bool { return t.name == "model.embed_tokens.weight" }); i >= 0 {
+		config["vocab_size"] = ts[i].shape[0]
+		config["torch_dtype"] = map[string]string{"F32": "float32", "F16": "float16", "BF16": "bfloat16"}[ts[i].dtype]
+	}
+
+	for name, key := range map[string]string{
+		"bos_token_id": "tokenizer.ggml.bos_token_id",
+		"eos_token_id": "tokenizer.ggml.eos_token_id",
+		"pad_token_id": "tokenizer.ggml.padding_token_id",
+	} {
+		if _, ok := kv[key]; ok {
+			config[name] = kv.Uint(key)
+		}
+	}
+
+	return writeExportJSON(filepath.Join(dir, "config.json"), config)
+}
+
+// exportAddedToken is a token in the added_tokens of tokenizer.json.
+type exportAddedToken struct {
+	ID         int    `json:"id"`
+	Content    string `json:"content"`
+	SingleWord bool   `json:"single_word"`
+	LStrip     bool   `json:"lstrip"`
+	RStrip     bool   `json:"rstrip"`
+	Normalized bool   `json:"normalized"`
+	Special    bool   `json:"special"`
+}
+
+// exportTokenizer writes tokenizer.json and tokenizer_config.json and, for
+// sentencepiece vocabularies, tokenizer.model.
+func exportTokenizer(dir string, kv llm.KV) error {
+	tokens := kv.Strings("tokenizer.ggml.tokens")
+	if len(tokens) == 0 {
+		return errors.New("model doesn't have a tokenizer")
+	}
+
+	types := kv.Ints("tokenizer.ggml.token_type")
+	if len(types) != len(tokens) {
+		types = make([]int32, len(tokens))
+		for i := range types {
+			types[i] = tokenTypeNormal
+		}
+	}
+
+	vocab := make(map[string]int, len(tokens))
+	added := []exportAddedToken{}
+	for i, token := range tokens {
+		if _, ok := vocab[token]; !ok {
+			vocab[token] = i
+		}
+
+		if types[i] == tokenTypeControl || types[i] == tokenTypeUserDefined {
+			special := types[i] == tokenTypeControl
+			added = append(added, exportAddedToken{ID: i, Content: token, Normalized: !special, Special: special})
+		}
+	}
+
+	tokenizer := map[string]any{
+		"version":      "1.0",
+		"truncation":   nil,
+		"padding":      nil,
+		"added_tokens": added,
+	}
+
+	switch model, _ := kv["tokenizer.ggml.model"].(string); model {
+	case "gpt2":
+		merges := kv.Strings("tokenizer.ggml.merges")
+		if merges == nil {
+			merges = []string{}
+		}
+
+		byteLevel := map[string]any{"type": "ByteLevel", "add_prefix_space": false, "trim_offsets": true, "use_regex": true}
+		tokenizer["normalizer"] = nil
+		tokenizer["pre_tokenizer"] = byteLevel
+		pre, _ := kv["tokenizer.ggml.pre"].(string)
+		if pattern, ok := pretokenizerPatterns[pre]; ok {
+			tokenizer["pre_tokenizer"] = map[string]any{
+				"type": "Sequence",
+				"pretokenizers": []map[string]any{
+					{"type": "Split", "pattern": map[string]string{"Regex": pattern}, "behavior": "Isolated", "invert": false},
+					{"type": "ByteLevel", "add_prefix_space": false, "trim_offsets": true, "use_regex": false},
+				},
+			}
+		}
+
+		tokenizer["post_processor"] = byteLevel
+		tokenizer["decoder"] = byteLevel
+		tokenizer["model"] = map[string]any{
+			"type":                      "BPE",
+			"dropout":                   nil,
+			"unk_token":                 nil,
+			"continuing_subword_prefix": nil,
+			"end_of_word_suffix":        nil,
+			"fuse_unk":                  false,
+			"byte_fallback":             false,
+			"vocab":                     vocab,
+			"merges":                    merges,
+		}
+	case "llama":
+		scores := kv.Floats("tokenizer.ggml.scores")
+		if len(scores) != len(tokens) {
+			scores = make([]float32, len(tokens))
+		}
+
+		if err := exportSentencePiece(filepath.Join(dir, "tokenizer.model"), tokens, scores, types); err != nil {
+			return err
+		}
+
+		var unk any
+		if i := slices.Index(types, tokenTypeUnknown); i >= 0 {
+			unk = tokens[i]
+		}
+
+		tokenizer["normalizer"] = map[string]any{
+			"type": "Sequence",
+			"normalizers": []map[string]any{
+				{"type": "Prepend", "prepend": "▁"},
+				{"type": "Replace", "pattern": map[string]string{"String": " "}, "content": "▁"},
+			},
+		}
+		tokenizer["pre_tokenizer"] = nil
+		tokenizer["post_processor"] = nil
+		tokenizer["decoder"] = map[string]any{
+			"type": "Sequence",
+			"decoders": []map[string]any{
+				{"type": "Replace", "pattern": map[string]string{"String": "▁"}, "content": " "},
+				{"type": "ByteFallback"},
+				{"type": "Fuse"},
+				{"type": "Strip", "content": " ", "start": 1, "stop": 0},
+			},
+		}
+		tokenizer["model"] = map[string]any{
+			"type":                      "BPE",
+			"dropout":                   nil,
+			"unk_token":                 unk,
+			"continuing_subword_prefix": nil,
+			"end_of_word_suffix":        nil,
+			"fuse_unk":                  true,
+			"byte_fallback":             true,
+			"vocab":                     vocab,
+			"merges":                    sentencePieceMerges(tokens, scores),
+		}
+	default:
+		return fmt.Errorf("exporting %q tokenizers isn't supported", model)
+	}
+
+	if err := writeExportJSON(filepath.Join(dir, "tokenizer.json"), tokenizer); err != nil {
+		return err
+	}
+
+	config := map[string]any{
+		"tokenizer_class":  "PreTrainedTokenizerFast",
+		"model_max_length": kv.ContextLength(),
+	}
+
+	for name, key := range map[string]string{
+		"bos_token": "tokenizer.ggml.bos_token_id",
+		"eos_token": "tokenizer.ggml.eos_token_id",
+		"pad_token": "tokenizer.ggml.padding_token_id",
+		"unk_token": "tokenizer.ggml.unknown_token_id",
+	} {
+		if _, ok := kv[key]; ok {
+			if id := kv.Uint(key); id < uint64(len(tokens)) {
+				config[name] = tokens[id]
+			}
+		}
+	}
+
+	for _, name := range []string{"add_bos_token", "add_eos_token"} {
+		if b, ok := kv["tokenizer.ggml."+name].(bool); ok {
+			config[name] = b
+		}
+	}
+
+	if s := kv.ChatTemplate(); s != "" {
+		config["chat_template"] = s
+	}
+
+	return writeExportJSON(filepath.Join(dir, "tokenizer_config.json"), config)
+}
+
+func exportSentencePiece(fn string, tokens []string, scores []float32, types []int32) error {
+	m := sentencepiece.ModelProto{
+		TrainerSpec: &sentencepiece.TrainerSpec{
+			ModelType:    sentencepiece.TrainerSpec_BPE.Enum(),
+			ByteFallback: proto.Bool(slices.Contains(types, tokenTypeByte)),
+		},
+	}
+
+	for i, token := range tokens {
+		m.Pieces = append(m.Pieces, &sentencepiece.ModelProto_SentencePiece{
+			Piece: proto.String(token),
+			Score: proto.Float32(scores[i]),
+			Type:  sentencepiece.ModelProto_SentencePiece_Type(types[i]).Enum(),
+		})
+	}
+
+	bts, err := proto.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fn, bts, 0o644)
+}
+
+// sentencePieceMerges derives BPE merges from a sentencepiece vocabulary the
+// way Hugging Face tokenizers does: each split of a token into two tokens is a
+// merge and merges are ranked by the score of the merged token.
+func sentencePieceMerges(tokens []string, scores []float32) []string {
+	ids := make(map[string]int, len(tokens))
+	for i, token := range tokens {
+		if _, ok := ids[token]; !ok {
+			ids[token] = i
+		}
+	}
+
+	type merge struct {
+		left, right int
+		score       float32
+	}
+
+	var merges []merge
+	for i, token := range tokens {
+		runes := []rune(token)
+		for j := 1; j < len(runes); j++ {
+			left, lok := ids[string(runes[:j])]
+			right, rok := ids[string(runes[j:])]
+			if lok && rok {
+				merges = append(merges, merge{left, right, scores[i]})
+			}
+		}
+	}
+
+	slices.SortStableFunc(merges, func(a, b merge) int {
+		return cmp.Or(
+			cmp.Compare(b.score, a.score),
+			cmp.Compare(a.left, b.left),
+			cmp.Compare(a.right, b.right),
+		)
+	})
+
+	s := make([]string, len(merges))
+	for i, m := range merges {
+		s[i] = tokens[m.left] + " " + tokens[m.right]
+	}
+
+	return s
+}
+
+func writeExportJSON(fn string, v any) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
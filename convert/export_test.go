@@ -0,0 +1,241 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// exportSynthetic converts the checkpoint in dir to file type ft and exports
+// the result to a new directory.
+func exportSynthetic(t *testing.T, dir, ft string) string {
+	t.Helper()
+
+	out := t.TempDir()
+	if err := Export(writeSyntheticGGUF(t, dir, ft), out, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func TestExportLlama(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":           []string{"LlamaForCausalLM"},
+		"vocab_size":              4,
+		"hidden_size":             8,
+		"num_hidden_layers":       1,
+		"max_position_embeddings": 128,
+		"intermediate_size":       6,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     1,
+		"rms_norm_eps":            1e-5,
+		"rope_theta":              500000.0,
+		"bos_token_id":            3,
+		"eos_token_id":            3,
+	})
+
+	// values are distinct so the q and k rows can't be permuted by mistake
+	value := func(r, c uint64) float32 { return float32(r*8 + c) }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.embed_tokens.weight":                      {shape: []uint64{4, 8}, fn: value},
+		"lm_head.weight":                                 {shape: []uint64{4, 8}, fn: value},
+		"model.norm.weight":                              {shape: []uint64{8}, fn: value},
+		"model.layers.0.input_layernorm.weight":          {shape: []uint64{8}, fn: value},
+		"model.layers.0.post_attention_layernorm.weight": {shape: []uint64{8}, fn: value},
+		"model.layers.0.self_attn.q_proj.weight":         {shape: []uint64{8, 8}, fn: value},
+		"model.layers.0.self_attn.k_proj.weight":         {shape: []uint64{4, 8}, fn: value},
+		"model.layers.0.self_attn.v_proj.weight":         {shape: []uint64{4, 8}, fn: value},
+		"model.layers.0.self_attn.o_proj.weight":         {shape: []uint64{8, 8}, fn: value},
+		"model.layers.0.mlp.gate_proj.weight":            {shape: []uint64{6, 8}, fn: value},
+		"model.layers.0.mlp.up_proj.weight":              {shape: []uint64{6, 8}, fn: value},
+		"model.layers.0.mlp.down_proj.weight":            {shape: []uint64{8, 6}, fn: value},
+	})
+
+	writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 3, "content": "<|begin_of_text|>", "special": true},
+		},
+		"model": map[string]any{
+			"type":   "BPE",
+			"vocab":  map[string]int{"a": 0, "b": 1, "ab": 2},
+			"merges": []string{"a b"},
+		},
+		"pre_tokenizer": map[string]any{
+			"type": "Sequence",
+			"pretokenizers": []map[string]any{
+				{"type": "Split", "pattern": map[string]any{"Regex": pretokenizerPatterns["llama-bpe"]}},
+				{"type": "ByteLevel"},
+			},
+		},
+	})
+
+	shardSize := exportShardSize
+	t.Cleanup(func() { exportShardSize = shardSize })
+	exportShardSize = 256
+
+	out := exportSynthetic(t, dir, "")
+
+	var index struct {
+		WeightMap map[string]string `json:"weight_map"`
+	}
+
+	bts, err := os.ReadFile(filepath.Join(out, "model.safetensors.index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(bts, &index); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.WeightMap) != 12 {
+		t.Errorf("expected 12 tensors, actual %d", len(index.WeightMap))
+	}
+
+	shards, err := filepath.Glob(filepath.Join(out, "model-*.safetensors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(shards) < 2 || !strings.HasSuffix(shards[0], fmt.Sprintf("model-00001-of-%05d.safetensors", len(shards))) {
+		t.Errorf("expected several shards, actual %v", shards)
+	}
+
+	var config map[string]any
+	bts, err = os.ReadFile(filepath.Join(out, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(bts, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, expect := range map[string]any{
+		"architectures":       []any{"LlamaForCausalLM"},
+		"num_key_value_heads": float64(1),
+		"rope_theta":          float64(500000),
+		"tie_word_embeddings": false,
+		"torch_dtype":         "float16",
+		"vocab_size":          float64(4),
+	} {
+		if !reflect.DeepEqual(config[k], expect) {
+			t.Errorf("%s: expected %v, actual %v", k, expect, config[k])
+		}
+	}
+
+	// converting the exported checkpoint gives the same model
+	expect, expectValues := convertSynthetic(t, dir)
+	actual, actualValues := convertSynthetic(t, out)
+
+	if !reflect.DeepEqual(actualValues, expectValues) {
+		t.Errorf("expected values %v, actual %v", expectValues, actualValues)
+	}
+
+	for _, k := range []string{"tokenizer.ggml.pre", "tokenizer.ggml.bos_token_id", "llama.context_length"} {
+		if actual.KV()[k] != expect.KV()[k] {
+			t.Errorf("%s: expected %v, actual %v", k, expect.KV()[k], actual.KV()[k])
+		}
+	}
+
+	for _, k := range []string{"tokenizer.ggml.tokens", "tokenizer.ggml.merges"} {
+		if e, a := expect.KV().Strings(k), actual.KV().Strings(k); !slices.Equal(a, e) {
+			t.Errorf("%s: expected %v, actual %v", k, e, a)
+		}
+	}
+}
+
+// writeGemma writes a gemma checkpoint whose tensors can be quantized.
+func writeGemma(t *testing.T, dir string) {
+	t.Helper()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":       []string{"GemmaForCausalLM"},
+		"vocab_size":          5,
+		"hidden_size":         32,
+		"num_hidden_layers":   1,
+		"intermediate_size":   64,
+		"num_attention_heads": 2,
+		"num_key_value_heads": 1,
+		"head_dim":            16,
+		"rms_norm_eps":        1e-6,
+	})
+
+	value := func(r, c uint64) float32 { return float32(r%7) - float32(c%5)/4 }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.embed_tokens.weight":                      {shape: []uint64{5, 32}, fn: value},
+		"model.norm.weight":                              {shape: []uint64{32}, fn: value},
+		"model.layers.0.input_layernorm.weight":          {shape: []uint64{32}, fn: value},
+		"model.layers.0.post_attention_layernorm.weight": {shape: []uint64{32}, fn: value},
+		"model.layers.0.self_attn.q_proj.weight":         {shape: []uint64{32, 32}, fn: value},
+		"model.layers.0.self_attn.k_proj.weight":         {shape: []uint64{16, 32}, fn: value},
+		"model.layers.0.self_attn.v_proj.weight":         {shape: []uint64{16, 32}, fn: value},
+		"model.layers.0.self_attn.o_proj.weight":         {shape: []uint64{32, 32}, fn: value},
+		"model.layers.0.mlp.gate_proj.weight":            {shape: []uint64{64, 32}, fn: value},
+		"model.layers.0.mlp.up_proj.weight":              {shape: []uint64{64, 32}, fn: value},
+		"model.layers.0.mlp.down_proj.weight":            {shape: []uint64{32, 64}, fn: value},
+	})
+
+	writeSentencePiece(t, dir, "a", "b")
+}
+
+func TestExportGemmaQ8_0(t *testing.T) {
+	dir := t.TempDir()
+	writeGemma(t, dir)
+
+	out := exportSynthetic(t, dir, "Q8_0")
+
+	if _, err := os.Stat(filepath.Join(out, "model-00001-of-00001.safetensors")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Q8_0 tensors are dequantized to F16 so values differ only by rounding
+	expect, expectValues := convertSyntheticFileType(t, dir, "Q8_0")
+	actual, actualValues := convertSynthetic(t, out)
+
+	for name, e := range expectValues {
+		a := actualValues[name]
+		if len(a) != len(e) {
+			t.Fatalf("%s: expected %d values, actual %d", name, len(e), len(a))
+		}
+
+		for i := range e {
+			if math.Abs(float64(a[i]-e[i])) > 0.01 {
+				t.Fatalf("%s[%d]: expected %v, actual %v", name, i, e[i], a[i])
+			}
+		}
+	}
+
+	for _, k := range []string{"tokenizer.ggml.tokens"} {
+		if e, a := expect.KV().Strings(k), actual.KV().Strings(k); !slices.Equal(a, e) {
+			t.Errorf("%s: expected %v, actual %v", k, e, a)
+		}
+	}
+
+	if e, a := expect.KV().Floats("tokenizer.ggml.scores"), actual.KV().Floats("tokenizer.ggml.scores"); !slices.Equal(a, e) {
+		t.Errorf("scores: expected %v, actual %v", e, a)
+	}
+
+	if e, a := expect.KV().Ints("tokenizer.ggml.token_type"), actual.KV().Ints("tokenizer.ggml.token_type"); !slices.Equal(a, e) {
+		t.Errorf("token types: expected %v, actual %v", e, a)
+	}
+}
+
+func TestExportUnsupportedType(t *testing.T) {
+	dir := t.TempDir()
+	writeGemma(t, dir)
+
+	err := Export(writeSyntheticGGUF(t, dir, "Q4_0"), t.TempDir(), func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "Q4_0 tensors can't be exported") {
+		t.Errorf("expected an error for Q4_0 tensors, actual %v", err)
+	}
+}
@@ -1,14 +1,9 @@
 package convert
 
 import (
-	"fmt"
 	"io"
-	"log/slog"
 	"strings"
 
-	"github.com/pdevine/tensor"
-	"github.com/pdevine/tensor/native"
-
 	"github.com/ollama/ollama/llm"
 )
 
@@ -16,45 +11,8 @@ type GemmaModel struct {
 	ModelData
 }
 
-func addOnes(data []float32, vectorSize int) ([]float32, error) {
-	n := tensor.New(tensor.WithShape(vectorSize), tensor.WithBacking(data))
-	ones := tensor.Ones(tensor.Float32, vectorSize)
-
-	n, err := n.Add(ones)
-	if err != nil {
-		return nil, err
-	}
-
-	ts, err := native.SelectF32(n, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	var f32s []float32
-	for _, t := range ts {
-		f32s = append(f32s, t...)
-	}
-
-	return f32s, nil
-}
-
 func (m *GemmaModel) GetTensors() error {
-	t, err := m.Format.GetTensors(m.Path, m.Params)
-	if err != nil {
-		return err
-	}
-
-	slog.Debug(fmt.Sprintf("Total tensors: %d", len(t)))
-	for _, l := range t {
-		if strings.HasSuffix(l.Name, "norm.weight") {
-			wt := l.WriterTo.(safetensorWriterTo)
-			wt.repacker = m.Repack
-			l.WriterTo = wt
-		}
-		m.Tensors = append(m.Tensors, l)
-	}
-
-	return nil
+	return m.repackTensors(m.repack)
 }
 
 func (m *GemmaModel) LoadVocab() error {
@@ -66,8 +24,19 @@ func (m *GemmaModel) LoadVocab() error {
 	return nil
 }
 
-func (m *GemmaModel) Repack(_ string, data []float32, shape []uint64) ([]float32, error) {
-	return addOnes(data, int(shape[0]))
+// repack adds one to the norm weights which gemma stores offset by one.
+func (m *GemmaModel) repack(name string, _ []uint64) (*tensorRepack, error) {
+	if !strings.HasSuffix(name, "norm.weight") {
+		return nil, nil
+	}
+
+	return &tensorRepack{values: addOnes}, nil
+}
+
+func addOnes(f32s []float32) {
+	for i := range f32s {
+		f32s[i]++
+	}
 }
 
 func (m *GemmaModel) WriteGGUF(ws io.WriteSeeker) error {
@@ -83,7 +52,7 @@ func (m *GemmaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"gemma.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
 		"gemma.attention.key_length":             uint32(m.Params.HeadDimension),
 		"gemma.attention.value_length":           uint32(m.Params.HeadDimension),
-		"general.file_type":                      uint32(1),
+		"general.file_type":                      m.Params.FileType(),
 		"tokenizer.ggml.model":                   "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -98,5 +67,6 @@ func (m *GemmaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.add_eos_token":    false,
 	}
 
+	m.Vocab.setSpecialKV(kv)
 	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
 }
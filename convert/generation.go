@@ -0,0 +1,76 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// tokenIDs is a token id or a list of token ids.
+type tokenIDs []int
+
+func (ids *tokenIDs) UnmarshalJSON(b []byte) error {
+	var id int
+	if err := json.Unmarshal(b, &id); err == nil {
+		*ids = tokenIDs{id}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]int)(ids))
+}
+
+// generationConfig is the subset of generation_config.json which has sampling
+// defaults.
+type generationConfig struct {
+	DoSample          *bool    `json:"do_sample"`
+	Temperature       *float32 `json:"temperature"`
+	TopP              *float32 `json:"top_p"`
+	TopK              *int     `json:"top_k"`
+	RepetitionPenalty *float32 `json:"repetition_penalty"`
+	EOSTokenID        tokenIDs `json:"eos_token_id"`
+}
+
+// GenerationParams reads generation_config.json as Ollama parameters. Its eos
+// tokens are stop sequences. Sampling parameters are ignored if the model
+// defaults to greedy decoding.
+func (md *ModelData) GenerationParams() (map[string]any, error) {
+	var c generationConfig
+	if err := readTokenizerConfig(md.Path, "generation_config.json", &c); err != nil {
+		return nil, fmt.Errorf("generation_config.json: %w", err)
+	}
+
+	params := make(map[string]any)
+	if c.DoSample == nil || *c.DoSample {
+		if c.Temperature != nil {
+			params["temperature"] = *c.Temperature
+		}
+
+		if c.TopP != nil {
+			params["top_p"] = *c.TopP
+		}
+
+		if c.TopK != nil {
+			params["top_k"] = *c.TopK
+		}
+	}
+
+	if c.RepetitionPenalty != nil {
+		params["repeat_penalty"] = *c.RepetitionPenalty
+	}
+
+	var stop []string
+	for _, id := range c.EOSTokenID {
+		if md.Vocab == nil || id < 0 || id >= len(md.Vocab.Tokens) {
+			slog.Warn("eos token isn't in the vocabulary", "id", id)
+			continue
+		}
+
+		stop = append(stop, md.Vocab.Tokens[id])
+	}
+
+	if len(stop) > 0 {
+		params["stop"] = stop
+	}
+
+	return params, nil
+}
@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerationParams(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]any
+		expect map[string]any
+	}{
+		{
+			"sampling",
+			map[string]any{"do_sample": true, "temperature": 0.6, "top_p": 0.9, "top_k": 40, "repetition_penalty": 1.1, "eos_token_id": []int{1, 2}},
+			map[string]any{"temperature": float32(0.6), "top_p": float32(0.9), "top_k": 40, "repeat_penalty": float32(1.1), "stop": []string{"b", "<|eot_id|>"}},
+		},
+		{
+			"greedy",
+			map[string]any{"do_sample": false, "temperature": 0.6, "eos_token_id": 2},
+			map[string]any{"stop": []string{"<|eot_id|>"}},
+		},
+		{
+			"unknown eos",
+			map[string]any{"eos_token_id": 10},
+			map[string]any{},
+		},
+		{
+			"missing",
+			nil,
+			map[string]any{},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.config != nil {
+				writeJSON(t, filepath.Join(dir, "generation_config.json"), tt.config)
+			}
+
+			m := &LlamaModel{ModelData{Path: dir, Vocab: &Vocab{Tokens: []string{"a", "b", "<|eot_id|>"}}}}
+			params, err := m.GenerationParams()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(params, tt.expect) {
+				t.Errorf("expected %v, actual %v", tt.expect, params)
+			}
+		})
+	}
+}
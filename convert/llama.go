@@ -7,12 +7,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
-	"github.com/pdevine/tensor"
-	"github.com/pdevine/tensor/native"
-
 	"github.com/ollama/ollama/llm"
 )
 
@@ -21,35 +17,7 @@ type LlamaModel struct {
 }
 
 func (m *LlamaModel) GetTensors() error {
-	t, err := m.Format.GetTensors(m.Path, m.Params)
-	if err != nil {
-		return err
-	}
-
-	pattern := `^blk\.[0-9]+\.attn_(?P<layer>q|k)\.weight$`
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return err
-	}
-
-	for _, l := range t {
-		matches := re.FindAllStringSubmatch(l.Name, -1)
-		if len(matches) > 0 {
-			switch m.Format.(type) {
-			case *TorchFormat:
-				wt := l.WriterTo.(torchWriterTo)
-				wt.repacker = m.Repack
-				l.WriterTo = wt
-			case *SafetensorFormat:
-				wt := l.WriterTo.(safetensorWriterTo)
-				wt.repacker = m.Repack
-				l.WriterTo = wt
-			}
-		}
-		m.Tensors = append(m.Tensors, l)
-	}
-
-	return nil
+	return m.repackTensors(m.repack)
 }
 
 func (m *LlamaModel) LoadVocab() (err error) {
@@ -68,7 +36,7 @@ func (m *LlamaModel) LoadVocab() (err error) {
 
 	m.Vocab.Merges = merges
 	m.Params.PreTokenizer = pre
-	return nil
+	return m.Vocab.loadSpecialTokens(m.Path)
 }
 
 func (m *LlamaModel) WriteGGUF(ws io.WriteSeeker) error {
@@ -85,7 +53,7 @@ func (m *LlamaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.attention.head_count":             uint32(m.Params.AttentionHeads),
 		"llama.attention.head_count_kv":          uint32(m.Params.KeyValHeads),
 		"llama.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
-		"general.file_type":                      uint32(1),
+		"general.file_type":                      m.Params.FileType(),
 		"tokenizer.ggml.model":                   "gpt2",
 
 		"tokenizer.ggml.pre":        m.Params.PreTokenizer,
@@ -103,21 +71,18 @@ func (m *LlamaModel) WriteGGUF(ws io.WriteSeeker) error {
 		kv["tokenizer.ggml.scores"] = m.Vocab.Scores
 	}
 
+	m.Vocab.setSpecialKV(kv)
 	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
 }
 
-func (m *LlamaModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
-	return llamaRepack(name, m.Params, data, shape)
+func (m *LlamaModel) repack(name string, shape []uint64) (*tensorRepack, error) {
+	return llamaRepack(name, m.Params, shape)
 }
 
-func llamaRepack(name string, params *Params, data []float32, shape []uint64) ([]float32, error) {
-	var dims []int
-	for _, dim := range shape {
-		if dim != 0 {
-			dims = append(dims, int(dim))
-		}
-	}
-
+// llamaRepack permutes the rows of the q and k projections from the half
+// split rotary embeddings of Hugging Face checkpoints to the interleaved
+// rotary embeddings of llama.cpp. Other tensors aren't repacked.
+func llamaRepack(name string, params *Params, shape []uint64) (*tensorRepack, error) {
 	var heads int
 	switch {
 	case strings.HasSuffix(name, "attn_q.weight"):
@@ -125,35 +90,20 @@ func llamaRepack(name string, params *Params, data []float32, shape []uint64) ([
 	case strings.HasSuffix(name, "attn_k.weight"):
 		heads = cmp.Or(params.KeyValHeads, params.AttentionHeads)
 	default:
-		return nil, fmt.Errorf("unknown tensor name: %s", name)
+		return nil, nil
 	}
 
-	n := tensor.New(tensor.WithShape(dims...), tensor.WithBacking(data))
-	if err := n.Reshape(append([]int{heads, 2, dims[0] / heads / 2}, dims[1:]...)...); err != nil {
-		return nil, err
-	}
-
-	if err := n.T(0, 2, 1, 3); err != nil {
-		return nil, err
-	}
-
-	if err := n.Reshape(dims...); err != nil {
-		return nil, err
-	}
-
-	if err := n.Transpose(); err != nil {
-		return nil, err
-	}
-
-	ts, err := native.SelectF32(n, 1)
-	if err != nil {
-		return nil, err
-	}
-
-	var f32s []float32
-	for _, t := range ts {
-		f32s = append(f32s, t...)
+	if heads <= 0 || shape[0]%uint64(2*heads) != 0 {
+		return nil, fmt.Errorf("%s: can't split %d rows into %d heads", name, shape[0], heads)
 	}
 
-	return f32s, nil
+	// within each head, row i of the first half and row i of the second
+	// half become rows 2i and 2i+1
+	headDim := shape[0] / uint64(heads)
+	return &tensorRepack{
+		row: func(i uint64) uint64 {
+			head, r := i/headDim, i%headDim
+			return head*headDim + r%2*(headDim/2) + r/2
+		},
+	}, nil
 }
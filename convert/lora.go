@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// AdapterParams are the parameters of a PEFT LoRA adapter read from
+// adapter_config.json.
+type AdapterParams struct {
+	PeftType  string  `json:"peft_type"`
+	R         int     `json:"r"`
+	Alpha     float64 `json:"lora_alpha"`
+	BaseModel string  `json:"base_model_name_or_path"`
+}
+
+// IsAdapter reports whether dirpath contains a PEFT adapter.
+func IsAdapter(dirpath string) bool {
+	_, err := os.Stat(filepath.Join(dirpath, "adapter_config.json"))
+	return err == nil
+}
+
+// LoraAdapter converts a PEFT LoRA adapter into a ggla adapter for the base
+// model it was trained on.
+type LoraAdapter struct {
+	Path    string
+	Params  *AdapterParams
+	Tensors []llm.Tensor
+
+	base *llm.GGML
+}
+
+func NewLoraAdapter(dirpath string, base *llm.GGML) (*LoraAdapter, error) {
+	if base == nil {
+		return nil, errors.New("adapters require a base model")
+	}
+
+	f, err := os.Open(filepath.Join(dirpath, "adapter_config.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var params AdapterParams
+	if err := json.NewDecoder(f).Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if params.PeftType != "LORA" {
+		return nil, fmt.Errorf("unsupported adapter type: %s", params.PeftType)
+	}
+
+	if params.R <= 0 {
+		return nil, fmt.Errorf("invalid adapter rank: %d", params.R)
+	}
+
+	return &LoraAdapter{Path: dirpath, Params: &params, base: base}, nil
+}
+
+// GetTensors reads the lora_A and lora_B tensors of the adapter, renames them
+// to match the base model and checks their shapes are compatible with it.
+//
+// ggla stores A transposed and the product BA is added to the base weights
+// as is, so B is scaled by alpha/r and, for llama models, its rows are
+// permuted the same way as the q and k weights.
+func (a *LoraAdapter) GetTensors() error {
+	fn := filepath.Join(a.Path, "adapter_model.safetensors")
+	headers, n, err := readSafetensorsHeader(fn)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for key, value := range headers {
+		if len(value.Shape) > 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	baseTensors := make(map[string]*llm.Tensor)
+	for _, t := range a.base.Tensors() {
+		baseTensors[t.Name] = t
+	}
+
+	kv := a.base.KV()
+	params := &Params{
+		AttentionHeads: int(kv.HeadCount()),
+		KeyValHeads:    int(kv.HeadCountKV()),
+		ByteOrder:      binary.LittleEndian,
+	}
+
+	scale := float32(a.Params.Alpha / float64(a.Params.R))
+	r := uint64(a.Params.R)
+
+	var format SafetensorFormat
+	for _, key := range keys {
+		value := headers[key]
+
+		// e.g. base_model.model.model.layers.0.self_attn.q_proj.lora_A.weight
+		name, suffix, ok := strings.Cut(strings.TrimPrefix(key, "base_model.model."), ".lora_")
+		if !ok || len(value.Shape) != 2 {
+			return fmt.Errorf("unsupported adapter tensor: %s", key)
+		}
+
+		layerName, err := format.GetLayerName(name + ".weight")
+		if err != nil {
+			return err
+		}
+
+		base, ok := baseTensors[layerName]
+		if !ok {
+			return fmt.Errorf("%s: base model has no tensor %s", key, layerName)
+		}
+
+		// base tensors are decoded as [in, out], lora_A is [r, in] and lora_B is [out, r]
+		in, out := base.Shape[0], base.Shape[1]
+
+		t := llm.Tensor{Kind: 0}
+		var repack tensorRepack
+		switch suffix {
+		case "A.weight":
+			if value.Shape[0] != r || value.Shape[1] != in {
+				return fmt.Errorf("%s: expected shape [%d %d], got %v", key, r, in, value.Shape)
+			}
+
+			t.Name = layerName + ".loraA"
+			t.Shape = []uint64{in, r}
+			repack.transpose = true
+		case "B.weight":
+			if value.Shape[0] != out || value.Shape[1] != r {
+				return fmt.Errorf("%s: expected shape [%d %d], got %v", key, out, r, value.Shape)
+			}
+
+			t.Name = layerName + ".loraB"
+			t.Shape = []uint64{out, r}
+			repack.values = func(f32s []float32) {
+				for i := range f32s {
+					f32s[i] *= scale
+				}
+			}
+
+			if kv.Architecture() == "llama" {
+				permute, err := llamaRepack(layerName, params, t.Shape)
+				if err != nil {
+					return err
+				}
+
+				if permute != nil {
+					repack.row = permute.row
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported adapter tensor: %s", key)
+		}
+
+		t.WriterTo = tensorWriterTo{
+			t:      &t,
+			bo:     params.ByteOrder,
+			source: fileSource{filename: fn, dtype: value.Type, offset: 8 + n + value.Offsets[0]},
+			repack: repack,
+		}
+
+		a.Tensors = append(a.Tensors, t)
+	}
+
+	if len(a.Tensors) == 0 {
+		return errors.New("adapter has no tensors")
+	}
+
+	for _, t := range a.Tensors {
+		pair := strings.TrimSuffix(t.Name, ".loraA") + ".loraB"
+		if strings.HasSuffix(t.Name, ".loraB") {
+			pair = strings.TrimSuffix(t.Name, ".loraB") + ".loraA"
+		}
+
+		if !slices.ContainsFunc(a.Tensors, func(t llm.Tensor) bool { return t.Name == pair }) {
+			return fmt.Errorf("adapter is missing %s", pair)
+		}
+	}
+
+	return nil
+}
+
+// WriteGGLA writes the adapter to ws. B has already been scaled so alpha is
+// written as r.
+func (a *LoraAdapter) WriteGGLA(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"r":     uint32(a.Params.R),
+		"alpha": uint32(a.Params.R),
+	}
+
+	return llm.NewGGLAV1().Encode(ws, kv, a.Tensors)
+}
@@ -0,0 +1,203 @@
+package convert
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// writeLlamaBase writes a llama model with q and v projections of size
+// hidden x hidden and decodes it.
+func writeLlamaBase(t *testing.T, hidden uint64) *llm.GGML {
+	t.Helper()
+
+	var tensors []llm.Tensor
+	for _, name := range []string{"blk.0.attn_q.weight", "blk.0.attn_v.weight"} {
+		tensors = append(tensors, llm.Tensor{
+			Name:     name,
+			Kind:     0,
+			Shape:    []uint64{hidden, hidden},
+			WriterTo: f32WriterTo{make([]float32, hidden*hidden), binary.LittleEndian},
+		})
+	}
+
+	setOffsets(tensors)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "base.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := llm.NewGGUFV3(binary.LittleEndian).Encode(f, llm.KV{
+		"general.architecture":          "llama",
+		"llama.attention.head_count":    uint32(2),
+		"llama.attention.head_count_kv": uint32(2),
+	}, tensors); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	ggml, _, err := llm.DecodeGGML(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ggml
+}
+
+func writeAdapter(t *testing.T, dir string, tensors map[string]syntheticTensor) {
+	t.Helper()
+
+	writeJSON(t, filepath.Join(dir, "adapter_config.json"), map[string]any{
+		"peft_type":               "LORA",
+		"r":                       2,
+		"lora_alpha":              4,
+		"base_model_name_or_path": "test",
+	})
+
+	writeSafetensors(t, filepath.Join(dir, "adapter_model.safetensors"), tensors)
+}
+
+func TestLoraAdapter(t *testing.T) {
+	dir := t.TempDir()
+	base := writeLlamaBase(t, 8)
+
+	// the value of each element is its index
+	index := func(cols uint64) func(r, c uint64) float32 {
+		return func(r, c uint64) float32 { return float32(r*cols + c) }
+	}
+
+	writeAdapter(t, dir, map[string]syntheticTensor{
+		"base_model.model.model.layers.0.self_attn.q_proj.lora_A.weight": {shape: []uint64{2, 8}, fn: index(8)},
+		"base_model.model.model.layers.0.self_attn.q_proj.lora_B.weight": {shape: []uint64{8, 2}, fn: index(2)},
+		"base_model.model.model.layers.0.self_attn.v_proj.lora_A.weight": {shape: []uint64{2, 8}, fn: index(8)},
+		"base_model.model.model.layers.0.self_attn.v_proj.lora_B.weight": {shape: []uint64{8, 2}, fn: index(2)},
+	})
+
+	if !IsAdapter(dir) {
+		t.Fatal("expected an adapter")
+	}
+
+	adapter, err := NewLoraAdapter(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adapter.GetTensors(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "adapter.ggla"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := adapter.WriteGGLA(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	ggml, _, err := llm.DecodeGGML(f, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ggml.Name() != "ggla" {
+		t.Fatalf("expected ggla, actual %s", ggml.Name())
+	}
+
+	// B is scaled by alpha/r so alpha is the same as r
+	if kv := ggml.KV(); kv["r"] != uint32(2) || kv["alpha"] != uint32(2) {
+		t.Errorf("expected r and alpha 2, actual %v and %v", kv["r"], kv["alpha"])
+	}
+
+	values := make(map[string][]float32)
+	for _, tensor := range ggml.Tensors() {
+		f32s := make([]float32, tensor.Size()/4)
+		if err := binary.Read(io.NewSectionReader(f, int64(tensor.Offset), int64(tensor.Size())), binary.LittleEndian, f32s); err != nil {
+			t.Fatal(err)
+		}
+
+		values[tensor.Name] = f32s
+
+		expect := []uint64{8, 2}
+		if !slices.Equal(tensor.Shape, expect) {
+			t.Errorf("%s: expected shape %v, actual %v", tensor.Name, expect, tensor.Shape)
+		}
+	}
+
+	var transposed, scaled []float32
+	for i := range uint64(16) {
+		transposed = append(transposed, float32(i%2*8+i/2))
+		scaled = append(scaled, float32(i)*2)
+	}
+
+	if !slices.Equal(values["blk.0.attn_v.weight.loraA"], transposed) {
+		t.Errorf("expected A to be transposed, actual %v", values["blk.0.attn_v.weight.loraA"])
+	}
+
+	if !slices.Equal(values["blk.0.attn_v.weight.loraB"], scaled) {
+		t.Errorf("expected B to be scaled, actual %v", values["blk.0.attn_v.weight.loraB"])
+	}
+
+	// the rows of each head are interleaved from its two halves
+	var permuted []float32
+	for _, row := range []int{0, 2, 1, 3, 4, 6, 5, 7} {
+		permuted = append(permuted, scaled[row*2:row*2+2]...)
+	}
+
+	if !slices.Equal(values["blk.0.attn_q.weight.loraB"], permuted) {
+		t.Errorf("expected B of q to be permuted, actual %v", values["blk.0.attn_q.weight.loraB"])
+	}
+}
+
+func TestLoraAdapterIncompatible(t *testing.T) {
+	cases := map[string]map[string]syntheticTensor{
+		"shape": {
+			"base_model.model.model.layers.0.self_attn.v_proj.lora_A.weight": {shape: []uint64{2, 16}},
+			"base_model.model.model.layers.0.self_attn.v_proj.lora_B.weight": {shape: []uint64{16, 2}},
+		},
+		"rank": {
+			"base_model.model.model.layers.0.self_attn.v_proj.lora_A.weight": {shape: []uint64{4, 8}},
+			"base_model.model.model.layers.0.self_attn.v_proj.lora_B.weight": {shape: []uint64{8, 4}},
+		},
+		"missing base tensor": {
+			"base_model.model.model.layers.0.self_attn.k_proj.lora_A.weight": {shape: []uint64{2, 8}},
+			"base_model.model.model.layers.0.self_attn.k_proj.lora_B.weight": {shape: []uint64{8, 2}},
+		},
+		"missing pair": {
+			"base_model.model.model.layers.0.self_attn.v_proj.lora_A.weight": {shape: []uint64{2, 8}},
+		},
+	}
+
+	base := writeLlamaBase(t, 8)
+	for name, tensors := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeAdapter(t, dir, tensors)
+
+			adapter, err := NewLoraAdapter(dir, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := adapter.GetTensors(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
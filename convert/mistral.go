@@ -2,7 +2,6 @@ package convert
 
 import (
 	"io"
-	"regexp"
 
 	"github.com/ollama/ollama/llm"
 )
@@ -12,28 +11,7 @@ type MistralModel struct {
 }
 
 func (m *MistralModel) GetTensors() error {
-	t, err := m.Format.GetTensors(m.Path, m.Params)
-	if err != nil {
-		return err
-	}
-
-	pattern := `^blk\.[0-9]+\.attn_(?P<layer>q|k)\.weight$`
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return err
-	}
-
-	for _, l := range t {
-		matches := re.FindAllStringSubmatch(l.Name, -1)
-		if len(matches) > 0 {
-			wt := l.WriterTo.(safetensorWriterTo)
-			wt.repacker = m.Repack
-			l.WriterTo = wt
-		}
-		m.Tensors = append(m.Tensors, l)
-	}
-
-	return nil
+	return m.repackTensors(m.repack)
 }
 
 func (m *MistralModel) LoadVocab() error {
@@ -57,7 +35,7 @@ func (m *MistralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.attention.head_count":             uint32(m.Params.AttentionHeads),
 		"llama.attention.head_count_kv":          uint32(m.Params.KeyValHeads),
 		"llama.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
-		"general.file_type":                      uint32(1),
+		"general.file_type":                      m.Params.FileType(),
 		"tokenizer.ggml.model":                   "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -71,9 +49,10 @@ func (m *MistralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.unknown_token_id": uint32(0),
 	}
 
+	m.Vocab.setSpecialKV(kv)
 	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
 }
 
-func (m *MistralModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
-	return llamaRepack(name, m.Params, data, shape)
+func (m *MistralModel) repack(name string, shape []uint64) (*tensorRepack, error) {
+	return llamaRepack(name, m.Params, shape)
 }
@@ -2,7 +2,6 @@ package convert
 
 import (
 	"io"
-	"regexp"
 
 	"github.com/ollama/ollama/llm"
 )
@@ -12,28 +11,7 @@ type MixtralModel struct {
 }
 
 func (m *MixtralModel) GetTensors() error {
-	t, err := m.Format.GetTensors(m.Path, m.Params)
-	if err != nil {
-		return err
-	}
-
-	pattern := `^blk\.[0-9]+\.attn_(?P<layer>q|k)\.weight$`
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return err
-	}
-
-	for _, l := range t {
-		matches := re.FindAllStringSubmatch(l.Name, -1)
-		if len(matches) > 0 {
-			wt := l.WriterTo.(safetensorWriterTo)
-			wt.repacker = m.Repack
-			l.WriterTo = wt
-		}
-		m.Tensors = append(m.Tensors, l)
-	}
-
-	return nil
+	return m.repackTensors(m.repack)
 }
 
 func (m *MixtralModel) LoadVocab() error {
@@ -65,7 +43,7 @@ func (m *MixtralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.vocab_size":           uint32(len(m.Vocab.Tokens)),
 		"llama.rope.dimension_count": uint32(m.Params.HiddenSize / m.Params.AttentionHeads),
 
-		"general.file_type":    uint32(1),
+		"general.file_type":    m.Params.FileType(),
 		"tokenizer.ggml.model": "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -79,9 +57,10 @@ func (m *MixtralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.add_eos_token":    false,
 	}
 
+	m.Vocab.setSpecialKV(kv)
 	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
 }
 
-func (m *MixtralModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
-	return llamaRepack(name, m.Params, data, shape)
+func (m *MixtralModel) repack(name string, shape []uint64) (*tensorRepack, error) {
+	return llamaRepack(name, m.Params, shape)
 }
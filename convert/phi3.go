@@ -0,0 +1,196 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type Phi3Model struct {
+	ModelData
+}
+
+func (m *Phi3Model) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	headDim := uint64(m.Params.HiddenSize / m.Params.AttentionHeads)
+	heads := uint64(m.Params.AttentionHeads)
+	kvHeads := uint64(cmp.Or(m.Params.KeyValHeads, m.Params.AttentionHeads))
+	ff := uint64(m.Params.IntermediateSize)
+
+	for _, l := range t {
+		switch {
+		case strings.HasSuffix(l.Name, "attn_qkv.weight"):
+			// q, k and v are fused into a single tensor
+			ts, err := splitTensor(l, []string{"attn_q", "attn_k", "attn_v"}, []uint64{heads * headDim, kvHeads * headDim, kvHeads * headDim})
+			if err != nil {
+				return err
+			}
+
+			m.Tensors = append(m.Tensors, ts...)
+		case strings.HasSuffix(l.Name, "ffn_gate_up.weight"):
+			// the gate and up projections are fused into a single tensor
+			ts, err := splitTensor(l, []string{"ffn_gate", "ffn_up"}, []uint64{ff, ff})
+			if err != nil {
+				return err
+			}
+
+			m.Tensors = append(m.Tensors, ts...)
+		default:
+			m.Tensors = append(m.Tensors, l)
+		}
+	}
+
+	if rs := m.Params.RopeScaling; rs != nil && len(rs.LongFactor) > 0 {
+		if len(rs.LongFactor) != len(rs.ShortFactor) || uint64(len(rs.LongFactor)) != headDim/2 {
+			return fmt.Errorf("rope scaling factors must have %d values, got %d long and %d short", headDim/2, len(rs.LongFactor), len(rs.ShortFactor))
+		}
+
+		m.Tensors = append(m.Tensors, llm.Tensor{
+			Name:     "rope_factors_long.weight",
+			Kind:     0,
+			Shape:    []uint64{uint64(len(rs.LongFactor))},
+			WriterTo: f32WriterTo{rs.LongFactor, m.Params.ByteOrder},
+		}, llm.Tensor{
+			Name:     "rope_factors_short.weight",
+			Kind:     0,
+			Shape:    []uint64{uint64(len(rs.ShortFactor))},
+			WriterTo: f32WriterTo{rs.ShortFactor, m.Params.ByteOrder},
+		})
+	}
+
+	setOffsets(m.Tensors)
+	return nil
+}
+
+func (m *Phi3Model) LoadVocab() error {
+	v, err := LoadSentencePieceTokens(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+	m.Vocab = v
+	return nil
+}
+
+func (m *Phi3Model) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":                      "phi3",
+		"general.name":                              m.Name,
+		"phi3.context_length":                       uint32(m.Params.ContextSize),
+		"phi3.rope.scaling.original_context_length": uint32(cmp.Or(m.Params.OriginalContextSize, m.Params.ContextSize)),
+		"phi3.embedding_length":                     uint32(m.Params.HiddenSize),
+		"phi3.feed_forward_length":                  uint32(m.Params.IntermediateSize),
+		"phi3.block_count":                          uint32(m.Params.HiddenLayers),
+		"phi3.attention.head_count":                 uint32(m.Params.AttentionHeads),
+		"phi3.attention.head_count_kv":              uint32(cmp.Or(m.Params.KeyValHeads, m.Params.AttentionHeads)),
+		"phi3.attention.layer_norm_rms_epsilon":     float32(m.Params.NormEPS),
+		"phi3.rope.dimension_count":                 uint32(m.Params.HiddenSize / m.Params.AttentionHeads),
+		"phi3.rope.freq_base":                       float32(cmp.Or(m.Params.RopeFrequencyBase, 10000)),
+		"general.file_type":                         m.Params.FileType(),
+		"tokenizer.ggml.model":                      "llama",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.scores":     m.Vocab.Scores,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+		"tokenizer.ggml.unknown_token_id": uint32(0),
+	}
+
+	if m.Params.SlidingWindow > 0 {
+		kv["phi3.attention.sliding_window"] = uint32(m.Params.SlidingWindow)
+	}
+
+	// attention is scaled up to compensate for the longer context
+	// ref: https://arxiv.org/abs/2402.13753
+	if original := m.Params.OriginalContextSize; original > 0 && m.Params.ContextSize > original {
+		scale := float64(m.Params.ContextSize) / float64(original)
+		kv["phi3.rope.scaling.attn_factor"] = float32(math.Sqrt(1 + math.Log(scale)/math.Log(float64(original))))
+	}
+
+	m.Vocab.setSpecialKV(kv)
+	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+}
+
+// splitTensor splits a tensor which fuses several tensors along its first
+// dimension into tensors named by replacing the fused tensor's type, e.g.
+// blk.0.attn_qkv.weight into blk.0.attn_q.weight, blk.0.attn_k.weight and
+// blk.0.attn_v.weight.
+func splitTensor(t llm.Tensor, names []string, rows []uint64) ([]llm.Tensor, error) {
+	var total uint64
+	for _, r := range rows {
+		total += r
+	}
+
+	if len(t.Shape) != 2 || t.Shape[0] != total {
+		return nil, fmt.Errorf("%s: expected %d rows, got shape %v", t.Name, total, t.Shape)
+	}
+
+	wt, ok := t.WriterTo.(tensorWriterTo)
+	if !ok {
+		return nil, fmt.Errorf("%s: can't split tensor", t.Name)
+	}
+
+	// e.g. blk.0.attn_qkv.weight -> blk.0., .weight
+	prefix := t.Name[:strings.LastIndex(t.Name[:strings.LastIndex(t.Name, ".")], ".")+1]
+	suffix := t.Name[strings.LastIndex(t.Name, "."):]
+	cols := t.Shape[1]
+
+	var ts []llm.Tensor
+	var start uint64
+	for i, name := range names {
+		offset := start
+		start += rows[i]
+
+		split := &llm.Tensor{
+			Name:  prefix + name + suffix,
+			Kind:  t.Kind,
+			Shape: []uint64{rows[i], cols},
+		}
+
+		swt := wt
+		swt.t = split
+		swt.repack = tensorRepack{row: func(i uint64) uint64 { return offset + i }}
+
+		split.WriterTo = swt
+		ts = append(ts, *split)
+	}
+
+	return ts, nil
+}
+
+// setOffsets recalculates the offsets of tensors, e.g. after tensors have been
+// split or added, so they match the alignment used by the GGUF encoder.
+func setOffsets(ts []llm.Tensor) {
+	const alignment = 32
+
+	var offset uint64
+	for i := range ts {
+		ts[i].Offset = offset
+		offset += ts[i].Size()
+		offset += (alignment - offset%alignment) % alignment
+	}
+}
+
+type f32WriterTo struct {
+	data []float32
+	bo   ByteOrder
+}
+
+func (r f32WriterTo) WriteTo(w io.Writer) (int64, error) {
+	if err := binary.Write(w, r.bo, r.data); err != nil {
+		return 0, err
+	}
+
+	return int64(len(r.data) * 4), nil
+}
@@ -0,0 +1,125 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPhi3(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":                    []string{"Phi3ForCausalLM"},
+		"vocab_size":                       5,
+		"hidden_size":                      8,
+		"num_hidden_layers":                1,
+		"max_position_embeddings":          128,
+		"original_max_position_embeddings": 32,
+		"intermediate_size":                6,
+		"num_attention_heads":              2,
+		"num_key_value_heads":              1,
+		"rms_norm_eps":                     1e-5,
+		"rope_theta":                       10000.0,
+		"sliding_window":                   64,
+		"bos_token_id":                     1,
+		"eos_token_id":                     2,
+		"rope_scaling": map[string]any{
+			"type":         "longrope",
+			"long_factor":  []float32{1, 2},
+			"short_factor": []float32{1, 1.5},
+		},
+	})
+
+	row := func(r, _ uint64) float32 { return float32(r) }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.embed_tokens.weight":                      {shape: []uint64{5, 8}},
+		"model.norm.weight":                              {shape: []uint64{8}},
+		"lm_head.weight":                                 {shape: []uint64{5, 8}},
+		"model.layers.0.input_layernorm.weight":          {shape: []uint64{8}},
+		"model.layers.0.post_attention_layernorm.weight": {shape: []uint64{8}},
+		"model.layers.0.self_attn.qkv_proj.weight":       {shape: []uint64{16, 8}, fn: row},
+		"model.layers.0.self_attn.o_proj.weight":         {shape: []uint64{8, 8}},
+		"model.layers.0.mlp.gate_up_proj.weight":         {shape: []uint64{12, 8}, fn: row},
+		"model.layers.0.mlp.down_proj.weight":            {shape: []uint64{8, 6}},
+	})
+
+	writeSentencePiece(t, dir, "▁a", "b")
+
+	ggml, values := convertSynthetic(t, dir)
+
+	kv := ggml.KV()
+	if kv.Architecture() != "phi3" {
+		t.Errorf("expected phi3, actual %s", kv.Architecture())
+	}
+
+	for k, expect := range map[string]any{
+		"phi3.context_length":                       uint32(128),
+		"phi3.rope.scaling.original_context_length": uint32(32),
+		"phi3.attention.head_count_kv":              uint32(1),
+		"phi3.attention.sliding_window":             uint32(64),
+		"phi3.rope.dimension_count":                 uint32(4),
+	} {
+		if kv[k] != expect {
+			t.Errorf("%s: expected %v, actual %v", k, expect, kv[k])
+		}
+	}
+
+	if attnFactor, ok := kv["phi3.rope.scaling.attn_factor"].(float32); !ok || attnFactor <= 1 {
+		t.Errorf("expected attention factor greater than 1, actual %v", kv["phi3.rope.scaling.attn_factor"])
+	}
+
+	var names []string
+	for _, tensor := range ggml.Tensors() {
+		names = append(names, tensor.Name)
+	}
+
+	for _, name := range []string{"blk.0.attn_qkv.weight", "blk.0.ffn_gate_up.weight"} {
+		if slices.Contains(names, name) {
+			t.Errorf("expected %s to be split", name)
+		}
+	}
+
+	// rows of the fused tensors are numbered so each split tensor should
+	// contain a contiguous range of them
+	for name, rows := range map[string][2]float32{
+		"blk.0.attn_q.weight":   {0, 8},
+		"blk.0.attn_k.weight":   {8, 12},
+		"blk.0.attn_v.weight":   {12, 16},
+		"blk.0.ffn_gate.weight": {0, 6},
+		"blk.0.ffn_up.weight":   {6, 12},
+	} {
+		var expect []float32
+		for r := rows[0]; r < rows[1]; r++ {
+			for range 8 {
+				expect = append(expect, r)
+			}
+		}
+
+		if !slices.Equal(values[name], expect) {
+			t.Errorf("%s: expected %v, actual %v", name, expect, values[name])
+		}
+	}
+
+	if !slices.Equal(values["rope_factors_long.weight"], []float32{1, 2}) {
+		t.Errorf("expected long factors [1 2], actual %v", values["rope_factors_long.weight"])
+	}
+
+	if !slices.Equal(values["rope_factors_short.weight"], []float32{1, 1.5}) {
+		t.Errorf("expected short factors [1 1.5], actual %v", values["rope_factors_short.weight"])
+	}
+}
+
+func TestF32WriterTo(t *testing.T) {
+	var b bytes.Buffer
+	n, err := f32WriterTo{[]float32{1, 2, 3}, binary.LittleEndian}.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 12 || int64(b.Len()) != n {
+		t.Errorf("expected 12 bytes written, actual %d with %d in the buffer", n, b.Len())
+	}
+}
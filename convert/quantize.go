@@ -0,0 +1,438 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/x448/float16"
+)
+
+// ggml file types which can be written during conversion
+const (
+	fileTypeF16    uint32 = 1
+	fileTypeQ4_0   uint32 = 2
+	fileTypeQ8_0   uint32 = 7
+	fileTypeQ4_K_S uint32 = 14
+)
+
+// ggml tensor types
+const (
+	tensorKindF32  uint32 = 0
+	tensorKindF16  uint32 = 1
+	tensorKindQ4_0 uint32 = 2
+	tensorKindQ8_0 uint32 = 8
+	tensorKindQ4_K uint32 = 12
+	tensorKindQ5_K uint32 = 13
+	tensorKindBF16 uint32 = 30
+)
+
+var ErrUnsupportedFileType = errors.New("file type is not supported during conversion")
+
+// SetFileType sets the file type of the converted model, e.g. Q8_0. Models are
+// converted to F16 by default. Supported quantizations are applied to each
+// tensor as it's written so the unquantized model is never written out.
+func (p *Params) SetFileType(s string) error {
+	switch strings.ToUpper(s) {
+	case "F16":
+		p.fileType = fileTypeF16
+	case "Q4_0":
+		p.fileType = fileTypeQ4_0
+	case "Q8_0":
+		p.fileType = fileTypeQ8_0
+	case "Q4_K_S":
+		p.fileType = fileTypeQ4_K_S
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFileType, s)
+	}
+
+	return nil
+}
+
+// FileType returns the ggml file type of the converted model.
+func (p *Params) FileType() uint32 {
+	return cmp.Or(p.fileType, fileTypeF16)
+}
+
+// tensorKind returns the type a tensor is written as. Vectors are always F32
+// and matrices are quantized if their rows are a multiple of the block size.
+// Q4_K_S keeps the tensors llama.cpp does at Q5_K or Q8_0.
+func (p *Params) tensorKind(name string, shape []uint64) uint32 {
+	var dims []uint64
+	for _, dim := range shape {
+		if dim > 0 {
+			dims = append(dims, dim)
+		}
+	}
+
+	if len(dims) < 2 {
+		return tensorKindF32
+	}
+
+	kind := tensorKindF16
+	switch p.FileType() {
+	case fileTypeQ8_0:
+		kind = tensorKindQ8_0
+	case fileTypeQ4_0:
+		kind = tensorKindQ4_0
+	case fileTypeQ4_K_S:
+		kind = tensorKindQ4_K
+	}
+
+	switch {
+	case kind == tensorKindF16,
+		// these are small or looked up by index so there's little to gain
+		strings.HasSuffix(name, "ffn_gate_inp.weight"),
+		strings.HasSuffix(name, "token_types.weight"),
+		strings.HasSuffix(name, "position_embd.weight"):
+		return tensorKindF16
+	case name == "output.weight" && kind != tensorKindQ8_0:
+		// the output projection is the most sensitive to quantization
+		kind = tensorKindQ8_0
+	case p.FileType() == fileTypeQ4_K_S:
+		kind = p.q4KSKind(name)
+	}
+
+	if dims[len(dims)-1]%quantizationBlockSize(kind) != 0 {
+		return tensorKindF16
+	}
+
+	return kind
+}
+
+// q4KSKind returns the type of a tensor in the Q4_K_S mix following
+// llama_tensor_get_type in llama.cpp: value projections of the first 4
+// layers and feed forward down projections of the first eighth of the layers
+// are Q5_K and, for models with 8 experts, value projections are Q8_0 and
+// output projections Q5_K.
+func (p *Params) q4KSKind(name string) uint32 {
+	var layer int
+	if s, ok := strings.CutPrefix(name, "blk."); ok {
+		s, _, _ = strings.Cut(s, ".")
+		layer, _ = strconv.Atoi(s)
+	}
+
+	switch {
+	case strings.Contains(name, "attn_v.weight") && p.Experts == 8:
+		return tensorKindQ8_0
+	case strings.Contains(name, "attn_v.weight") && layer < 4,
+		strings.Contains(name, "ffn_down") && layer < p.HiddenLayers/8,
+		strings.Contains(name, "attn_output.weight") && p.Experts == 8:
+		return tensorKindQ5_K
+	}
+
+	return tensorKindQ4_K
+}
+
+func quantizationBlockSize(kind uint32) uint64 {
+	if kind == tensorKindQ4_K || kind == tensorKindQ5_K {
+		return 256
+	}
+
+	return 32
+}
+
+// appendTensorData appends f32s to b as a tensor of type kind.
+func appendTensorData(b []byte, bo ByteOrder, kind uint32, f32s []float32) ([]byte, error) {
+	switch kind {
+	case tensorKindF32:
+		for _, f := range f32s {
+			b = bo.AppendUint32(b, math.Float32bits(f))
+		}
+
+		return b, nil
+	case tensorKindF16:
+		for _, f := range f32s {
+			b = bo.AppendUint16(b, float16.Fromfloat32(f).Bits())
+		}
+
+		return b, nil
+	case tensorKindQ8_0, tensorKindQ4_0, tensorKindQ4_K, tensorKindQ5_K:
+		return quantize(b, bo, kind, f32s)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %d", kind)
+	}
+}
+
+// quantize appends f32s to b quantized into blocks of type kind following the
+// reference implementations in ggml-quants.c.
+func quantize(b []byte, bo ByteOrder, kind uint32, f32s []float32) ([]byte, error) {
+	blockSize := int(quantizationBlockSize(kind))
+	if len(f32s)%blockSize != 0 {
+		return nil, fmt.Errorf("%d values is not a multiple of the block size %d", len(f32s), blockSize)
+	}
+
+	for i := 0; i < len(f32s); i += blockSize {
+		block := f32s[i : i+blockSize]
+		switch kind {
+		case tensorKindQ8_0:
+			b = quantizeQ8_0(b, bo, block)
+		case tensorKindQ4_0:
+			b = quantizeQ4_0(b, bo, block)
+		case tensorKindQ4_K:
+			b = quantizeQ4_K(b, bo, block)
+		case tensorKindQ5_K:
+			b = quantizeQ5_K(b, bo, block)
+		default:
+			return nil, fmt.Errorf("unknown quantization: %d", kind)
+		}
+	}
+
+	return b, nil
+}
+
+func appendF16(b []byte, bo ByteOrder, f float32) []byte {
+	return bo.AppendUint16(b, float16.Fromfloat32(f).Bits())
+}
+
+// quantizeQ8_0 writes 32 values as a scale and 8-bit values.
+func quantizeQ8_0(b []byte, bo ByteOrder, x []float32) []byte {
+	var amax float32
+	for _, v := range x {
+		amax = max(amax, abs(v))
+	}
+
+	d := amax / 127
+	var id float32
+	if d != 0 {
+		id = 1 / d
+	}
+
+	b = appendF16(b, bo, d)
+	for _, v := range x {
+		b = append(b, byte(int8(math.Round(float64(v*id)))))
+	}
+
+	return b
+}
+
+// quantizeQ4_0 writes 32 values as a scale and 4-bit values offset by 8.
+func quantizeQ4_0(b []byte, bo ByteOrder, x []float32) []byte {
+	var amax, vmax float32
+	for _, v := range x {
+		if abs(v) > amax {
+			amax, vmax = abs(v), v
+		}
+	}
+
+	d := vmax / -8
+	var id float32
+	if d != 0 {
+		id = 1 / d
+	}
+
+	b = appendF16(b, bo, d)
+	for j := range 16 {
+		x0 := min(15, int8(x[j]*id+8.5))
+		x1 := min(15, int8(x[16+j]*id+8.5))
+		b = append(b, byte(x0)|byte(x1)<<4)
+	}
+
+	return b
+}
+
+// quantizeQ4_K writes 256 values as 8 sub-blocks of 32 4-bit values, each
+// with a 6-bit scale and minimum, which are in turn scaled by a super-block
+// scale and minimum.
+func quantizeQ4_K(b []byte, bo ByteOrder, x []float32) []byte {
+	var L [256]uint8
+	b = quantizeK(b, bo, x, L[:], 15, -1, 20)
+	for j := 0; j < 256; j += 64 {
+		for l := range 32 {
+			b = append(b, L[j+l]|L[j+l+32]<<4)
+		}
+	}
+
+	return b
+}
+
+// quantizeQ5_K writes 256 values like quantizeQ4_K but with 5-bit values whose
+// high bits are stored separately.
+func quantizeQ5_K(b []byte, bo ByteOrder, x []float32) []byte {
+	var L [256]uint8
+	b = quantizeK(b, bo, x, L[:], 31, -0.5, 15)
+
+	var qh [32]uint8
+	var qs [128]uint8
+	for n, m := 0, uint8(1); n < 256; n, m = n+64, m<<2 {
+		for j := range 32 {
+			l1, l2 := L[n+j], L[n+j+32]
+			if l1 > 15 {
+				l1 -= 16
+				qh[j] |= m
+			}
+
+			if l2 > 15 {
+				l2 -= 16
+				qh[j] |= m << 1
+			}
+
+			qs[n/2+j] = l1 | l2<<4
+		}
+	}
+
+	b = append(b, qh[:]...)
+	return append(b, qs[:]...)
+}
+
+// quantizeK quantizes 256 values into L with values in [0, nmax] and appends
+// the super-block scale and minimum and the packed sub-block scales and
+// minimums shared by the K quantizations.
+func quantizeK(b []byte, bo ByteOrder, x []float32, L []uint8, nmax int, rmin float32, nstep int) []byte {
+	var scales, mins [8]float32
+	var maxScale, maxMin float32
+
+	for j := range 8 {
+		sub := x[32*j : 32*j+32]
+
+		var sumX2 float32
+		for _, v := range sub {
+			sumX2 += v * v
+		}
+
+		avX := float32(math.Sqrt(float64(sumX2 / 32)))
+
+		var weights [32]float32
+		for l, v := range sub {
+			weights[l] = avX + abs(v)
+		}
+
+		scales[j], mins[j] = makeQKX2Quants(nmax, sub, weights[:], L[32*j:32*j+32], rmin, 0.1, nstep)
+		maxScale = max(maxScale, scales[j])
+		maxMin = max(maxMin, mins[j])
+	}
+
+	var invScale, invMin float32
+	if maxScale > 0 {
+		invScale = 63 / maxScale
+	}
+
+	if maxMin > 0 {
+		invMin = 63 / maxMin
+	}
+
+	var packed [12]uint8
+	for j := range 8 {
+		ls := uint8(min(63, nearestInt(invScale*scales[j])))
+		lm := uint8(min(63, nearestInt(invMin*mins[j])))
+		if j < 4 {
+			packed[j] = ls
+			packed[j+4] = lm
+		} else {
+			packed[j+4] = ls&0xf | (lm&0xf)<<4
+			packed[j-4] |= (ls >> 4) << 6
+			packed[j] |= (lm >> 4) << 6
+		}
+	}
+
+	d := float16.Fromfloat32(maxScale / 63)
+	dmin := float16.Fromfloat32(maxMin / 63)
+
+	for j := range 8 {
+		sc, m := scaleMinK4(j, packed[:])
+		d := d.Float32() * float32(sc)
+		if d == 0 {
+			continue
+		}
+
+		dm := dmin.Float32() * float32(m)
+		for ii := range 32 {
+			L[32*j+ii] = uint8(max(0, min(nmax, nearestInt((x[32*j+ii]+dm)/d))))
+		}
+	}
+
+	b = appendF16(b, bo, d.Float32())
+	b = appendF16(b, bo, dmin.Float32())
+	return append(b, packed[:]...)
+}
+
+// scaleMinK4 unpacks the 6-bit scale and minimum of sub-block j.
+func scaleMinK4(j int, q []uint8) (uint8, uint8) {
+	if j < 4 {
+		return q[j] & 63, q[j+4] & 63
+	}
+
+	return q[j+4]&0xf | (q[j-4]>>6)<<4, q[j+4]>>4 | (q[j]>>6)<<4
+}
+
+// makeQKX2Quants finds the scale and minimum which minimize the weighted
+// squared error of quantizing x to values in [0, nmax], searching nstep
+// scales around the naive one. It returns the scale and the negated minimum.
+func makeQKX2Quants(nmax int, x, weights []float32, L []uint8, rmin, rdelta float32, nstep int) (float32, float32) {
+	vmin, vmax := x[0], x[0]
+	sumW, sumX := weights[0], weights[0]*x[0]
+	for i := 1; i < len(x); i++ {
+		vmin = min(vmin, x[i])
+		vmax = max(vmax, x[i])
+		sumW += weights[i]
+		sumX += weights[i] * x[i]
+	}
+
+	vmin = min(vmin, 0)
+	if vmax == vmin {
+		clear(L)
+		return 0, -vmin
+	}
+
+	iscale := float32(nmax) / (vmax - vmin)
+	scale := 1 / iscale
+
+	var bestMad float32
+	for i := range x {
+		L[i] = uint8(max(0, min(nmax, nearestInt(iscale*(x[i]-vmin)))))
+		diff := scale*float32(L[i]) + vmin - x[i]
+		bestMad += weights[i] * diff * diff
+	}
+
+	Laux := make([]uint8, len(x))
+	for is := 0; is <= nstep; is++ {
+		iscale := (rmin + rdelta*float32(is) + float32(nmax)) / (vmax - vmin)
+
+		var sumL, sumL2, sumXL float32
+		for i := range x {
+			l := uint8(max(0, min(nmax, nearestInt(iscale*(x[i]-vmin)))))
+			Laux[i] = l
+			w := weights[i]
+			sumL += w * float32(l)
+			sumL2 += w * float32(l) * float32(l)
+			sumXL += w * float32(l) * x[i]
+		}
+
+		D := sumW*sumL2 - sumL*sumL
+		if D > 0 {
+			thisScale := (sumW*sumXL - sumX*sumL) / D
+			thisMin := (sumL2*sumX - sumL*sumXL) / D
+			if thisMin > 0 {
+				thisMin = 0
+				thisScale = sumXL / sumL2
+			}
+
+			var mad float32
+			for i := range x {
+				diff := thisScale*float32(Laux[i]) + thisMin - x[i]
+				mad += weights[i] * diff * diff
+			}
+
+			if mad < bestMad {
+				copy(L, Laux)
+				bestMad = mad
+				scale = thisScale
+				vmin = thisMin
+			}
+		}
+	}
+
+	return scale, -vmin
+}
+
+// nearestInt rounds to the nearest integer with ties to even like ggml.
+func nearestInt(f float32) int {
+	return int(math.RoundToEven(float64(f)))
+}
+
+func abs(f float32) float32 {
+	return float32(math.Abs(float64(f)))
+}
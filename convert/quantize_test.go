@@ -0,0 +1,286 @@
+package convert
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/x448/float16"
+)
+
+func readF16(b []byte) float32 {
+	return float16.Frombits(binary.LittleEndian.Uint16(b)).Float32()
+}
+
+// dequantize is the inverse of quantize following dequantize_row_* in
+// ggml-quants.c.
+func dequantize(t *testing.T, kind uint32, b []byte) []float32 {
+	t.Helper()
+
+	var f32s []float32
+	switch kind {
+	case tensorKindQ8_0:
+		for ; len(b) > 0; b = b[34:] {
+			d := readF16(b)
+			for _, q := range b[2:34] {
+				f32s = append(f32s, float32(int8(q))*d)
+			}
+		}
+	case tensorKindQ4_0:
+		for ; len(b) > 0; b = b[18:] {
+			d := readF16(b)
+			var block [32]float32
+			for j, q := range b[2:18] {
+				block[j] = float32(int(q&0xf)-8) * d
+				block[j+16] = float32(int(q>>4)-8) * d
+			}
+			f32s = append(f32s, block[:]...)
+		}
+	case tensorKindQ4_K:
+		for ; len(b) > 0; b = b[144:] {
+			d, dmin := readF16(b), readF16(b[2:])
+			scales, qs := b[4:16], b[16:144]
+			for j := 0; j < 8; j += 2 {
+				sc1, m1 := scaleMinK4(j, scales)
+				sc2, m2 := scaleMinK4(j+1, scales)
+				for _, q := range qs[:32] {
+					f32s = append(f32s, d*float32(sc1)*float32(q&0xf)-dmin*float32(m1))
+				}
+				for _, q := range qs[:32] {
+					f32s = append(f32s, d*float32(sc2)*float32(q>>4)-dmin*float32(m2))
+				}
+				qs = qs[32:]
+			}
+		}
+	case tensorKindQ5_K:
+		for ; len(b) > 0; b = b[176:] {
+			d, dmin := readF16(b), readF16(b[2:])
+			scales, qh, qs := b[4:16], b[16:48], b[48:176]
+			for j, u := 0, uint8(1); j < 8; j, u = j+2, u<<2 {
+				sc1, m1 := scaleMinK4(j, scales)
+				sc2, m2 := scaleMinK4(j+1, scales)
+				for l, q := range qs[:32] {
+					q &= 0xf
+					if qh[l]&u != 0 {
+						q |= 16
+					}
+					f32s = append(f32s, d*float32(sc1)*float32(q)-dmin*float32(m1))
+				}
+				for l, q := range qs[:32] {
+					q >>= 4
+					if qh[l]&(u<<1) != 0 {
+						q |= 16
+					}
+					f32s = append(f32s, d*float32(sc2)*float32(q)-dmin*float32(m2))
+				}
+				qs = qs[32:]
+			}
+		}
+	default:
+		t.Fatalf("unexpected kind %d", kind)
+	}
+
+	return f32s
+}
+
+func TestQuantizeQ8_0(t *testing.T) {
+	var f32s []float32
+	for i := range 32 {
+		f32s = append(f32s, float32(i-16))
+	}
+
+	bts, err := quantize(nil, binary.LittleEndian, tensorKindQ8_0, f32s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bts) != 34 {
+		t.Fatalf("expected 34 bytes, actual %d", len(bts))
+	}
+
+	// the largest magnitude maps to -127
+	if d := readF16(bts); d != float16.Fromfloat32(16.0/127).Float32() {
+		t.Errorf("unexpected scale %v", d)
+	}
+
+	if q := int8(bts[2]); q != -127 {
+		t.Errorf("expected -127, actual %d", q)
+	}
+
+	if q := int8(bts[2+16]); q != 0 {
+		t.Errorf("expected 0, actual %d", q)
+	}
+
+	// scales are written in the byte order of the file
+	bts, err = quantize(nil, binary.BigEndian, tensorKindQ8_0, f32s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := float16.Frombits(binary.BigEndian.Uint16(bts)).Float32(); d != float16.Fromfloat32(16.0/127).Float32() {
+		t.Errorf("unexpected big endian scale %v", d)
+	}
+}
+
+func TestQuantizeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	f32s := make([]float32, 1024)
+	for i := range f32s {
+		f32s[i] = float32(r.NormFloat64())
+	}
+
+	cases := []struct {
+		kind    uint32
+		size    int
+		maxRMSE float64
+	}{
+		{tensorKindQ8_0, 1024 / 32 * 34, 0.01},
+		{tensorKindQ4_0, 1024 / 32 * 18, 0.15},
+		{tensorKindQ4_K, 1024 / 256 * 144, 0.12},
+		{tensorKindQ5_K, 1024 / 256 * 176, 0.06},
+	}
+
+	for _, tt := range cases {
+		bts, err := quantize(nil, binary.LittleEndian, tt.kind, f32s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bts) != tt.size {
+			t.Errorf("kind %d: expected %d bytes, actual %d", tt.kind, tt.size, len(bts))
+		}
+
+		dequantized := dequantize(t, tt.kind, bts)
+		if len(dequantized) != len(f32s) {
+			t.Fatalf("kind %d: expected %d values, actual %d", tt.kind, len(f32s), len(dequantized))
+		}
+
+		var sum float64
+		for i := range f32s {
+			diff := float64(f32s[i] - dequantized[i])
+			sum += diff * diff
+		}
+
+		if rmse := math.Sqrt(sum / float64(len(f32s))); rmse > tt.maxRMSE {
+			t.Errorf("kind %d: expected rmse at most %v, actual %v", tt.kind, tt.maxRMSE, rmse)
+		}
+	}
+}
+
+func TestTensorKind(t *testing.T) {
+	var params Params
+	if err := params.SetFileType("q4_0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := params.SetFileType("Q3_K_M"); err == nil {
+		t.Error("expected an error for an unsupported file type")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		shape  []uint64
+		expect uint32
+	}{
+		{"blk.0.attn_norm.weight", []uint64{64}, tensorKindF32},
+		{"blk.0.attn_q.weight", []uint64{64, 64}, tensorKindQ4_0},
+		{"blk.0.attn_q.weight", []uint64{64, 48}, tensorKindF16},
+		{"output.weight", []uint64{64, 64}, tensorKindQ8_0},
+		{"blk.0.ffn_gate_inp.weight", []uint64{8, 64}, tensorKindF16},
+	} {
+		if kind := params.tensorKind(tt.name, tt.shape); kind != tt.expect {
+			t.Errorf("%s %v: expected %d, actual %d", tt.name, tt.shape, tt.expect, kind)
+		}
+	}
+
+	// Q4_K_S keeps some tensors at higher precision like llama.cpp
+	params = Params{HiddenLayers: 16}
+	if err := params.SetFileType("Q4_K_S"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		experts int
+		expect  uint32
+	}{
+		{"blk.0.attn_q.weight", 0, tensorKindQ4_K},
+		{"blk.3.attn_v.weight", 0, tensorKindQ5_K},
+		{"blk.4.attn_v.weight", 0, tensorKindQ4_K},
+		{"blk.1.ffn_down.weight", 0, tensorKindQ5_K},
+		{"blk.2.ffn_down.weight", 0, tensorKindQ4_K},
+		{"blk.4.attn_output.weight", 0, tensorKindQ4_K},
+		{"blk.4.attn_v.weight", 8, tensorKindQ8_0},
+		{"blk.4.attn_output.weight", 8, tensorKindQ5_K},
+		{"blk.1.ffn_down.3.weight", 8, tensorKindQ5_K},
+		{"output.weight", 0, tensorKindQ8_0},
+	} {
+		params.Experts = tt.experts
+		if kind := params.tensorKind(tt.name, []uint64{256, 256}); kind != tt.expect {
+			t.Errorf("%s with %d experts: expected %d, actual %d", tt.name, tt.experts, tt.expect, kind)
+		}
+	}
+}
+
+func TestConvertQuantized(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":       []string{"GemmaForCausalLM"},
+		"vocab_size":          5,
+		"hidden_size":         32,
+		"num_hidden_layers":   1,
+		"intermediate_size":   64,
+		"num_attention_heads": 2,
+		"num_key_value_heads": 1,
+		"head_dim":            16,
+		"rms_norm_eps":        1e-6,
+	})
+
+	value := func(r, c uint64) float32 { return float32(r%7) - float32(c%5)/4 }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.embed_tokens.weight":                      {shape: []uint64{5, 32}, fn: value},
+		"model.norm.weight":                              {shape: []uint64{32}},
+		"model.layers.0.input_layernorm.weight":          {shape: []uint64{32}},
+		"model.layers.0.post_attention_layernorm.weight": {shape: []uint64{32}},
+		"model.layers.0.self_attn.q_proj.weight":         {shape: []uint64{32, 32}, fn: value},
+		"model.layers.0.self_attn.k_proj.weight":         {shape: []uint64{16, 32}, fn: value},
+		"model.layers.0.self_attn.v_proj.weight":         {shape: []uint64{16, 32}, fn: value},
+		"model.layers.0.self_attn.o_proj.weight":         {shape: []uint64{32, 32}, fn: value},
+		"model.layers.0.mlp.gate_proj.weight":            {shape: []uint64{64, 32}, fn: value},
+		"model.layers.0.mlp.up_proj.weight":              {shape: []uint64{64, 32}, fn: value},
+		"model.layers.0.mlp.down_proj.weight":            {shape: []uint64{32, 64}, fn: value},
+	})
+
+	writeSentencePiece(t, dir, "a", "b")
+
+	ggml, values := convertSyntheticFileType(t, dir, "Q8_0")
+	if ft := ggml.KV().FileType().String(); ft != "Q8_0" {
+		t.Errorf("expected Q8_0, actual %s", ft)
+	}
+
+	for _, tensor := range ggml.Tensors() {
+		expect := tensorKindQ8_0
+		if tensor.Shape[1] == 1 {
+			expect = tensorKindF32
+		}
+
+		if tensor.Kind != expect {
+			t.Errorf("%s: expected kind %d, actual %d", tensor.Name, expect, tensor.Kind)
+		}
+	}
+
+	// Q8_0 rows aren't a multiple of the alignment
+	checkOffsets(t, ggml.Tensors())
+
+	// values are small integers and quarters so they survive quantization
+	// with little error
+	for i, v := range values["blk.0.attn_v.weight"] {
+		if expect := value(uint64(i/32), uint64(i%32)); math.Abs(float64(v-expect)) > 0.03 {
+			t.Fatalf("blk.0.attn_v.weight[%d]: expected %v, actual %v", i, expect, v)
+		}
+	}
+}
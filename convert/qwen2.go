@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type Qwen2Model struct {
+	ModelData
+}
+
+func (m *Qwen2Model) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+
+	// smaller variants tie the output projection to the token embeddings so
+	// the checkpoint has no lm_head
+	if !slices.ContainsFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "output.weight" }) {
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "token_embd.weight" })
+		if i < 0 {
+			return fmt.Errorf("missing token_embd.weight")
+		}
+
+		wt, ok := m.Tensors[i].WriterTo.(tensorWriterTo)
+		if !ok {
+			return fmt.Errorf("%s: can't tie tensor", m.Tensors[i].Name)
+		}
+
+		output := &llm.Tensor{
+			Name:  "output.weight",
+			Kind:  m.Params.tensorKind("output.weight", m.Tensors[i].Shape),
+			Shape: slices.Clone(m.Tensors[i].Shape),
+		}
+
+		wt.t = output
+		output.WriterTo = wt
+		m.Tensors = append(m.Tensors, *output)
+	}
+
+	setOffsets(m.Tensors)
+	return nil
+}
+
+func (m *Qwen2Model) LoadVocab() error {
+	pre, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for i, t := range ts {
+		if t.Content == "" {
+			// ids without a token are padding
+			t = Token{ID: i, Content: fmt.Sprintf("[PAD%d]", i), UserDefined: true}
+		}
+
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	// the embeddings are usually padded beyond the tokenizer's vocabulary
+	for i := len(m.Vocab.Tokens); i < m.Params.VocabSize; i++ {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, fmt.Sprintf("[PAD%d]", i))
+		m.Vocab.Types = append(m.Vocab.Types, tokenTypeUserDefined)
+	}
+
+	m.Vocab.Merges = merges
+	m.Params.PreTokenizer = pre
+	return m.Vocab.loadSpecialTokens(m.Path)
+}
+
+func (m *Qwen2Model) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":                   "qwen2",
+		"general.name":                           m.Name,
+		"qwen2.context_length":                   uint32(m.Params.ContextSize),
+		"qwen2.embedding_length":                 uint32(m.Params.HiddenSize),
+		"qwen2.block_count":                      uint32(m.Params.HiddenLayers),
+		"qwen2.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"qwen2.attention.head_count":             uint32(m.Params.AttentionHeads),
+		"qwen2.attention.head_count_kv":          uint32(cmp.Or(m.Params.KeyValHeads, m.Params.AttentionHeads)),
+		"qwen2.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
+		"qwen2.rope.freq_base":                   float32(cmp.Or(m.Params.RopeFrequencyBase, 10000)),
+		"general.file_type":                      m.Params.FileType(),
+		"tokenizer.ggml.model":                   "gpt2",
+
+		"tokenizer.ggml.pre":        m.Params.PreTokenizer,
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+
+		// qwen2 doesn't prepend a bos token
+		"tokenizer.ggml.add_bos_token": false,
+	}
+
+	m.Vocab.setSpecialKV(kv)
+	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+}
@@ -0,0 +1,126 @@
+package convert
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestQwen2(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "config.json"), map[string]any{
+		"architectures":           []string{"Qwen2ForCausalLM"},
+		"vocab_size":              6,
+		"hidden_size":             8,
+		"num_hidden_layers":       1,
+		"max_position_embeddings": 128,
+		"intermediate_size":       6,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     1,
+		"rms_norm_eps":            1e-6,
+		"rope_theta":              1000000.0,
+		"tie_word_embeddings":     true,
+		"bos_token_id":            3,
+		"eos_token_id":            3,
+	})
+
+	row := func(r, _ uint64) float32 { return float32(r) }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.embed_tokens.weight":                      {shape: []uint64{6, 8}, fn: row},
+		"model.norm.weight":                              {shape: []uint64{8}},
+		"model.layers.0.input_layernorm.weight":          {shape: []uint64{8}},
+		"model.layers.0.post_attention_layernorm.weight": {shape: []uint64{8}},
+		"model.layers.0.self_attn.q_proj.weight":         {shape: []uint64{8, 8}},
+		"model.layers.0.self_attn.q_proj.bias":           {shape: []uint64{8}, fn: row},
+		"model.layers.0.self_attn.k_proj.weight":         {shape: []uint64{4, 8}},
+		"model.layers.0.self_attn.k_proj.bias":           {shape: []uint64{4}, fn: row},
+		"model.layers.0.self_attn.v_proj.weight":         {shape: []uint64{4, 8}},
+		"model.layers.0.self_attn.v_proj.bias":           {shape: []uint64{4}, fn: row},
+		"model.layers.0.self_attn.o_proj.weight":         {shape: []uint64{8, 8}},
+		"model.layers.0.mlp.gate_proj.weight":            {shape: []uint64{6, 8}},
+		"model.layers.0.mlp.up_proj.weight":              {shape: []uint64{6, 8}},
+		"model.layers.0.mlp.down_proj.weight":            {shape: []uint64{8, 6}},
+	})
+
+	writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 3, "content": "<|endoftext|>", "special": true},
+		},
+		"model": map[string]any{
+			"type":   "BPE",
+			"vocab":  map[string]int{"a": 0, "b": 1, "ab": 2},
+			"merges": []string{"a b"},
+		},
+		"pre_tokenizer": map[string]any{
+			"type": "Sequence",
+			"pretokenizers": []map[string]any{
+				{
+					"type": "Split",
+					"pattern": map[string]any{
+						"Regex": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+					},
+				},
+				{"type": "ByteLevel"},
+			},
+		},
+	})
+
+	ggml, values := convertSynthetic(t, dir)
+
+	kv := ggml.KV()
+	if kv.Architecture() != "qwen2" {
+		t.Errorf("expected qwen2, actual %s", kv.Architecture())
+	}
+
+	for k, expect := range map[string]any{
+		"qwen2.context_length":          uint32(128),
+		"qwen2.attention.head_count_kv": uint32(1),
+		"qwen2.rope.freq_base":          float32(1000000),
+		"tokenizer.ggml.model":          "gpt2",
+		"tokenizer.ggml.pre":            "qwen2",
+		"tokenizer.ggml.add_bos_token":  false,
+	} {
+		if kv[k] != expect {
+			t.Errorf("%s: expected %v, actual %v", k, expect, kv[k])
+		}
+	}
+
+	for k, expect := range map[string][]string{
+		"tokenizer.ggml.tokens": {"a", "b", "ab", "<|endoftext|>", "[PAD4]", "[PAD5]"},
+		"tokenizer.ggml.merges": {"a b"},
+	} {
+		bts, err := json.Marshal(kv[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var actual []string
+		if err := json.Unmarshal(bts, &actual); err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(actual, expect) {
+			t.Errorf("%s: expected %v, actual %v", k, expect, actual)
+		}
+	}
+
+	for name, expect := range map[string][]float32{
+		"blk.0.attn_q.bias": {0, 1, 2, 3, 4, 5, 6, 7},
+		"blk.0.attn_k.bias": {0, 1, 2, 3},
+		"blk.0.attn_v.bias": {0, 1, 2, 3},
+	} {
+		if !slices.Equal(values[name], expect) {
+			t.Errorf("%s: expected %v, actual %v", name, expect, values[name])
+		}
+	}
+
+	if values["output.weight"] == nil {
+		t.Fatal("expected output.weight to be tied to token_embd.weight")
+	}
+
+	if !slices.Equal(values["output.weight"], values["token_embd.weight"]) {
+		t.Errorf("expected output.weight to equal token_embd.weight, actual %v", values["output.weight"])
+	}
+}
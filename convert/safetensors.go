@@ -12,31 +12,23 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/d4l3k/go-bfloat16"
-	"github.com/x448/float16"
-
 	"github.com/ollama/ollama/llm"
 )
 
-type safetensorWriterTo struct {
-	t *llm.Tensor
-
-	params *Params
-	bo     ByteOrder
-
-	filename string
-	dtype    string
-
-	offset, size int64
-	repacker     func(string, []float32, []uint64) ([]float32, error)
-}
-
 type safetensorMetadata struct {
 	Type    string   `json:"dtype"`
 	Shape   []uint64 `json:"shape"`
 	Offsets []int64  `json:"data_offsets"`
 }
 
+// skipTensorSuffixes are suffixes of tensors which aren't needed for inference
+var skipTensorSuffixes = []string{
+	"self_attn.rotary_embd.inv_freq",
+	"embeddings.position_ids",
+	"pooler.dense.weight",
+	"pooler.dense.bias",
+}
+
 type SafetensorFormat struct{}
 
 func (m *SafetensorFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor, error) {
@@ -60,7 +52,9 @@ func (m *SafetensorFormat) GetTensors(dirpath string, params *Params) ([]llm.Ten
 	return tensors, nil
 }
 
-func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params) ([]llm.Tensor, uint64, error) {
+// readSafetensorsHeader reads the header of the safetensors file fn. It also
+// returns the size of the header which precedes the tensor data.
+func readSafetensorsHeader(fn string) (map[string]safetensorMetadata, int64, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, 0, err
@@ -82,9 +76,18 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 		return nil, 0, err
 	}
 
+	return headers, n, nil
+}
+
+func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params) ([]llm.Tensor, uint64, error) {
+	headers, n, err := readSafetensorsHeader(fn)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var keys []string
 	for key := range headers {
-		if !strings.HasSuffix(key, "self_attn.rotary_embd.inv_freq") {
+		if !slices.ContainsFunc(skipTensorSuffixes, func(s string) bool { return strings.HasSuffix(key, s) }) {
 			keys = append(keys, key)
 		}
 	}
@@ -95,13 +98,9 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 	for _, key := range keys {
 		value := headers[key]
 
-		var kind uint32
-		switch len(value.Shape) {
-		case 0:
+		if len(value.Shape) == 0 {
 			// valuedata
 			continue
-		case 2:
-			kind = 1
 		}
 
 		name, err := m.GetLayerName(key)
@@ -109,13 +108,11 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 			return nil, 0, err
 		}
 
+		kind := params.tensorKind(name, value.Shape)
+
 		shape := make([]uint64, len(value.Shape))
 		copy(shape, value.Shape)
 
-		pad := func(s int64) int64 {
-			return 8 + n + s
-		}
-
 		t := llm.Tensor{
 			Name:   name,
 			Kind:   kind,
@@ -123,14 +120,10 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 			Shape:  shape,
 		}
 
-		t.WriterTo = safetensorWriterTo{
-			t:        &t,
-			params:   params,
-			bo:       params.ByteOrder,
-			filename: fn,
-			dtype:    value.Type,
-			offset:   pad(value.Offsets[0]),
-			size:     pad(value.Offsets[1]) - pad(value.Offsets[0]),
+		t.WriterTo = tensorWriterTo{
+			t:      &t,
+			bo:     params.ByteOrder,
+			source: fileSource{filename: fn, dtype: value.Type, offset: 8 + n + value.Offsets[0]},
 		}
 
 		offset += t.Size()
@@ -147,12 +140,22 @@ func (m *SafetensorFormat) GetParams(dirpath string) (*Params, error) {
 	}
 	defer f.Close()
 
-	var params Params
+	bts, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := json.NewDecoder(f).Decode(&params); err != nil {
+	var params Params
+	if err := json.Unmarshal(bts, &params); err != nil {
 		return nil, err
 	}
 
+	if slices.Contains(params.Architectures, "NomicBertModel") {
+		if err := params.fromNomicBert(bts); err != nil {
+			return nil, err
+		}
+	}
+
 	params.ByteOrder = binary.LittleEndian
 	return &params, nil
 }
@@ -162,6 +165,14 @@ func (m *SafetensorFormat) GetLayerName(n string) (string, error) {
 		"model.embed_tokens.weight": "token_embd.weight",
 		"lm_head.weight":            "output.weight",
 		"model.norm.weight":         "output_norm.weight",
+
+		"embeddings.word_embeddings.weight":       "token_embd.weight",
+		"embeddings.token_type_embeddings.weight": "token_types.weight",
+		"embeddings.position_embeddings.weight":   "position_embd.weight",
+		"embeddings.LayerNorm.weight":             "token_embd_norm.weight",
+		"embeddings.LayerNorm.bias":               "token_embd_norm.bias",
+		"emb_ln.weight":                           "token_embd_norm.weight",
+		"emb_ln.bias":                             "token_embd_norm.bias",
 	}
 
 	tMap := map[string]string{
@@ -174,12 +185,37 @@ func (m *SafetensorFormat) GetLayerName(n string) (string, error) {
 		"model.layers.(\\d+).self_attn.o_proj.weight":                   "blk.$1.attn_output.weight",
 		"model.layers.(\\d+).self_attn.q_proj.weight":                   "blk.$1.attn_q.weight",
 		"model.layers.(\\d+).self_attn.v_proj.weight":                   "blk.$1.attn_v.weight",
+		"model.layers.(\\d+).self_attn.qkv_proj.weight":                 "blk.$1.attn_qkv.weight",
+		"model.layers.(\\d+).self_attn.q_proj.bias":                     "blk.$1.attn_q.bias",
+		"model.layers.(\\d+).self_attn.k_proj.bias":                     "blk.$1.attn_k.bias",
+		"model.layers.(\\d+).self_attn.v_proj.bias":                     "blk.$1.attn_v.bias",
+		"model.layers.(\\d+).mlp.gate_up_proj.weight":                   "blk.$1.ffn_gate_up.weight",
 		"model.layers.(\\d+).block_sparse_moe.gate.weight":              "blk.$1.ffn_gate_inp.weight",
 		"model.layers.(\\d+).block_sparse_moe.experts.(\\d+).w1.weight": "blk.$1.ffn_gate.$2.weight",
 		"model.layers.(\\d+).block_sparse_moe.experts.(\\d+).w2.weight": "blk.$1.ffn_down.$2.weight",
 		"model.layers.(\\d+).block_sparse_moe.experts.(\\d+).w3.weight": "blk.$1.ffn_up.$2.weight",
+
+		"encoder.layer.(\\d+).attention.self.query.(weight|bias)":       "blk.$1.attn_q.$2",
+		"encoder.layer.(\\d+).attention.self.key.(weight|bias)":         "blk.$1.attn_k.$2",
+		"encoder.layer.(\\d+).attention.self.value.(weight|bias)":       "blk.$1.attn_v.$2",
+		"encoder.layer.(\\d+).attention.output.dense.(weight|bias)":     "blk.$1.attn_output.$2",
+		"encoder.layer.(\\d+).attention.output.LayerNorm.(weight|bias)": "blk.$1.attn_output_norm.$2",
+		"encoder.layer.(\\d+).intermediate.dense.(weight|bias)":         "blk.$1.ffn_up.$2",
+		"encoder.layer.(\\d+).output.dense.(weight|bias)":               "blk.$1.ffn_down.$2",
+		"encoder.layer.(\\d+).output.LayerNorm.(weight|bias)":           "blk.$1.layer_output_norm.$2",
+
+		"encoder.layers.(\\d+).attn.Wqkv.(weight|bias)":     "blk.$1.attn_qkv.$2",
+		"encoder.layers.(\\d+).attn.out_proj.(weight|bias)": "blk.$1.attn_output.$2",
+		"encoder.layers.(\\d+).norm1.(weight|bias)":         "blk.$1.attn_output_norm.$2",
+		"encoder.layers.(\\d+).mlp.fc11.(weight|bias)":      "blk.$1.ffn_up.$2",
+		"encoder.layers.(\\d+).mlp.fc12.(weight|bias)":      "blk.$1.ffn_gate.$2",
+		"encoder.layers.(\\d+).mlp.fc2.(weight|bias)":       "blk.$1.ffn_down.$2",
+		"encoder.layers.(\\d+).norm2.(weight|bias)":         "blk.$1.layer_output_norm.$2",
 	}
 
+	// bert checkpoints may prefix names with the model type
+	n = strings.TrimPrefix(n, "bert.")
+
 	v, ok := directMap[n]
 	if ok {
 		return v, nil
@@ -197,67 +233,6 @@ func (m *SafetensorFormat) GetLayerName(n string) (string, error) {
 	return "", fmt.Errorf("couldn't find a layer name for '%s'", n)
 }
 
-func (r safetensorWriterTo) WriteTo(w io.Writer) (n int64, err error) {
-	f, err := os.Open(r.filename)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
-
-	if _, err = f.Seek(r.offset, io.SeekStart); err != nil {
-		return 0, err
-	}
-
-	var f32s []float32
-	switch r.dtype {
-	case "F32":
-		f32s = make([]float32, r.size/4)
-		if err = binary.Read(f, r.bo, f32s); err != nil {
-			return 0, err
-		}
-	case "F16":
-		u16s := make([]uint16, r.size/2)
-		if err = binary.Read(f, r.bo, u16s); err != nil {
-			return 0, err
-		}
-
-		for _, b := range u16s {
-			f32s = append(f32s, float16.Frombits(b).Float32())
-		}
-
-	case "BF16":
-		u8s := make([]uint8, r.size)
-		if err = binary.Read(f, r.bo, u8s); err != nil {
-			return 0, err
-		}
-
-		f32s = bfloat16.DecodeFloat32(u8s)
-	default:
-		return 0, fmt.Errorf("unknown data type: %s", r.dtype)
-	}
-
-	if r.repacker != nil {
-		f32s, err = r.repacker(r.t.Name, f32s, r.t.Shape)
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	switch r.t.Kind {
-	case 0:
-		return 0, binary.Write(w, r.bo, f32s)
-	case 1:
-		f16s := make([]uint16, len(f32s))
-		for i := range f32s {
-			f16s[i] = float16.Fromfloat32(f32s[i]).Bits()
-		}
-
-		return 0, binary.Write(w, r.bo, f16s)
-	default:
-		return 0, fmt.Errorf("unknown storage type: %d", r.t.Kind)
-	}
-}
-
 func (m *SafetensorFormat) GetModelArch(name, dirPath string, params *Params) (ModelArch, error) {
 	switch len(params.Architectures) {
 	case 0:
@@ -300,6 +275,33 @@ func (m *SafetensorFormat) GetModelArch(name, dirPath string, params *Params) (M
 					Format: m,
 				},
 			}, nil
+		case "Phi3ForCausalLM":
+			return &Phi3Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "BertModel", "NomicBertModel":
+			return &BertModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "Qwen2ForCausalLM":
+			return &Qwen2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
 		default:
 			return nil, fmt.Errorf("Models based on '%s' are not yet supported", params.Architectures[0])
 		}
@@ -0,0 +1,267 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/x448/float16"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+	"github.com/ollama/ollama/llm"
+)
+
+// syntheticTensor is a tensor in a synthetic checkpoint. If fn is set, the
+// value of each element is fn of its row and column, otherwise it's zero.
+type syntheticTensor struct {
+	shape []uint64
+	fn    func(row, col uint64) float32
+}
+
+// writeSafetensors writes tensors to a F32 safetensors file at p.
+func writeSafetensors(t *testing.T, p string, tensors map[string]syntheticTensor) {
+	t.Helper()
+
+	var names []string
+	for name := range tensors {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	var data bytes.Buffer
+	header := make(map[string]safetensorMetadata)
+	for _, name := range names {
+		tt := tensors[name]
+
+		rows, cols := tt.shape[0], uint64(1)
+		if len(tt.shape) > 1 {
+			cols = tt.shape[1]
+		}
+
+		begin := int64(data.Len())
+		for row := range rows {
+			for col := range cols {
+				var f float32
+				if tt.fn != nil {
+					f = tt.fn(row, col)
+				}
+
+				if err := binary.Write(&data, binary.LittleEndian, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		header[name] = safetensorMetadata{Type: "F32", Shape: tt.shape, Offsets: []int64{begin, int64(data.Len())}}
+	}
+
+	bts, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := binary.Write(f, binary.LittleEndian, int64(len(bts))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write(bts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.Copy(f, &data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeJSON writes v as JSON to p.
+func writeJSON(t *testing.T, p string, v any) {
+	t.Helper()
+
+	bts, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeSentencePiece writes a sentencepiece tokenizer.model with pieces to
+// dir. The first three pieces are <unk>, <s> and </s>.
+func writeSentencePiece(t *testing.T, dir string, pieces ...string) {
+	t.Helper()
+
+	unknown := sentencepiece.ModelProto_SentencePiece_UNKNOWN
+	control := sentencepiece.ModelProto_SentencePiece_CONTROL
+	normal := sentencepiece.ModelProto_SentencePiece_NORMAL
+
+	var m sentencepiece.ModelProto
+	for i, piece := range append([]string{"<unk>", "<s>", "</s>"}, pieces...) {
+		typ := &normal
+		switch i {
+		case 0:
+			typ = &unknown
+		case 1, 2:
+			typ = &control
+		}
+
+		m.Pieces = append(m.Pieces, &sentencepiece.ModelProto_SentencePiece{
+			Piece: proto.String(piece),
+			Score: proto.Float32(float32(-i)),
+			Type:  typ,
+		})
+	}
+
+	bts, err := proto.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer.model"), bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// convertSynthetic converts the checkpoint in dir and decodes the result. It
+// also returns the F32 values of each tensor, converting from F16 if needed.
+func convertSynthetic(t *testing.T, dir string) (*llm.GGML, map[string][]float32) {
+	t.Helper()
+	return convertSyntheticFileType(t, dir, "")
+}
+
+// convertSyntheticFileType is like convertSynthetic but converts to file type
+// ft. Quantized tensors are dequantized.
+func convertSyntheticFileType(t *testing.T, dir, ft string) (*llm.GGML, map[string][]float32) {
+	t.Helper()
+
+	f, err := os.Open(writeSyntheticGGUF(t, dir, ft))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ggml, end, err := llm.DecodeGGML(f, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tensor data is at the end of the file so find where it begins from the
+	// last tensor
+	tensors := ggml.Tensors()
+	last := tensors[len(tensors)-1]
+	start := end - int64(last.Offset+last.Size())
+
+	values := make(map[string][]float32)
+	for _, tensor := range tensors {
+		n := tensor.Size()
+		sr := io.NewSectionReader(f, start+int64(tensor.Offset), int64(n))
+
+		var f32s []float32
+		switch tensor.Kind {
+		case 0:
+			f32s = make([]float32, n/4)
+			if err := binary.Read(sr, binary.LittleEndian, f32s); err != nil {
+				t.Fatal(err)
+			}
+		case 1:
+			u16s := make([]uint16, n/2)
+			if err := binary.Read(sr, binary.LittleEndian, u16s); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, u16 := range u16s {
+				f32s = append(f32s, float16.Frombits(u16).Float32())
+			}
+		default:
+			bts := make([]byte, n)
+			if _, err := io.ReadFull(sr, bts); err != nil {
+				t.Fatal(err)
+			}
+
+			f32s = dequantize(t, tensor.Kind, bts)
+		}
+
+		values[tensor.Name] = f32s
+	}
+
+	return ggml, values
+}
+
+// checkOffsets checks that the tensors are packed one after another at the
+// alignment of the GGUF encoder, so the offsets in the header match the data.
+func checkOffsets(t *testing.T, tensors llm.Tensors) {
+	t.Helper()
+
+	var offset uint64
+	for _, tensor := range tensors {
+		if tensor.Offset != offset {
+			t.Errorf("%s: expected offset %d, actual %d", tensor.Name, offset, tensor.Offset)
+		}
+
+		offset = tensor.Offset + tensor.Size()
+		offset += (32 - offset%32) % 32
+	}
+}
+
+// writeSyntheticGGUF converts the checkpoint in dir to file type ft and
+// returns the path of the GGUF file.
+func writeSyntheticGGUF(t *testing.T, dir, ft string) string {
+	t.Helper()
+
+	mf, err := GetModelFormat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := mf.GetParams(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ft != "" {
+		if err := params.SetFileType(ft); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arch, err := mf.GetModelArch("test", dir, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.GetTensors(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.LoadVocab(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := filepath.Join(t.TempDir(), "model.gguf")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := arch.WriteGGUF(f); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
@@ -0,0 +1,225 @@
+package convert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/x448/float16"
+	"golang.org/x/exp/mmap"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// chunkSize is the number of values converted at a time. Tensors are written
+// in chunks of whole rows so memory use is bounded regardless of the size of
+// the tensor.
+const chunkSize = 1 << 16
+
+// tensorSource is the data of a tensor in a checkpoint.
+type tensorSource interface {
+	open() (elementReader, error)
+}
+
+// elementReader reads the values of a tensor as float32s.
+type elementReader interface {
+	io.Closer
+
+	// readAt fills dst with consecutive values starting at the value off.
+	readAt(dst []float32, off uint64) error
+}
+
+// fileSource is a tensor stored contiguously in a file at offset, e.g. in a
+// safetensors file or an uncompressed torch zip archive. The file is mmapped
+// when the tensor is written.
+type fileSource struct {
+	filename string
+	dtype    string
+	offset   int64
+}
+
+func (s fileSource) open() (elementReader, error) {
+	var size int
+	switch s.dtype {
+	case "F32":
+		size = 4
+	case "F16", "BF16":
+		size = 2
+	default:
+		return nil, fmt.Errorf("unknown data type: %s", s.dtype)
+	}
+
+	r, err := mmap.Open(s.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileReader{ReaderAt: r, dtype: s.dtype, size: size, offset: s.offset}, nil
+}
+
+type fileReader struct {
+	*mmap.ReaderAt
+
+	dtype  string
+	size   int
+	offset int64
+
+	buf []byte
+}
+
+func (r *fileReader) readAt(dst []float32, off uint64) error {
+	n := len(dst) * r.size
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+
+	b := r.buf[:n]
+	if _, err := r.ReadAt(b, r.offset+int64(off)*int64(r.size)); err != nil {
+		return err
+	}
+
+	// checkpoints are always little endian
+	switch r.dtype {
+	case "F32":
+		for i := range dst {
+			dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+	case "F16":
+		for i := range dst {
+			dst[i] = float16.Frombits(binary.LittleEndian.Uint16(b[2*i:])).Float32()
+		}
+	case "BF16":
+		for i := range dst {
+			dst[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(b[2*i:])) << 16)
+		}
+	}
+
+	return nil
+}
+
+// memorySource is a tensor which has already been read into memory.
+type memorySource []float32
+
+func (s memorySource) open() (elementReader, error) {
+	return s, nil
+}
+
+func (s memorySource) readAt(dst []float32, off uint64) error {
+	if off+uint64(len(dst)) > uint64(len(s)) {
+		return io.ErrUnexpectedEOF
+	}
+
+	copy(dst, s[off:])
+	return nil
+}
+
+func (memorySource) Close() error {
+	return nil
+}
+
+// tensorRepack describes how a tensor is rearranged or transformed as it's
+// written. The zero value writes the tensor as is.
+type tensorRepack struct {
+	// row maps a row of the written tensor to a row of the source
+	row func(uint64) uint64
+
+	// transpose reads the source, which has the written shape reversed,
+	// column by column
+	transpose bool
+
+	// values transforms a chunk of rows in place
+	values func([]float32)
+}
+
+// tensorWriterTo streams a tensor from its source through any repacking and
+// into the GGUF writer chunkSize values at a time.
+type tensorWriterTo struct {
+	t *llm.Tensor
+
+	bo     ByteOrder
+	source tensorSource
+	repack tensorRepack
+}
+
+// dims returns the number of rows and the number of values in each row.
+func (r tensorWriterTo) dims() (rows, cols uint64) {
+	rows, cols = 1, 1
+	for _, dim := range r.t.Shape {
+		if dim > 0 {
+			rows *= cols
+			cols = dim
+		}
+	}
+
+	return rows, cols
+}
+
+func (r tensorWriterTo) WriteTo(w io.Writer) (int64, error) {
+	rd, err := r.source.open()
+	if err != nil {
+		return 0, err
+	}
+	defer rd.Close()
+
+	rows, cols := r.dims()
+	chunkRows := max(1, chunkSize/cols)
+
+	f32s := make([]float32, min(rows, chunkRows)*cols)
+	var bts []byte
+
+	var n int64
+	for begin := uint64(0); begin < rows; begin += chunkRows {
+		end := min(rows, begin+chunkRows)
+		chunk := f32s[:(end-begin)*cols]
+		if err := r.readRows(rd, chunk, begin, end, rows, cols); err != nil {
+			return n, fmt.Errorf("%s: %w", r.t.Name, err)
+		}
+
+		if r.repack.values != nil {
+			r.repack.values(chunk)
+		}
+
+		bts, err = appendTensorData(bts[:0], r.bo, r.t.Kind, chunk)
+		if err != nil {
+			return n, err
+		}
+
+		written, err := w.Write(bts)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// readRows reads rows [begin, end) of the written tensor into dst.
+func (r tensorWriterTo) readRows(rd elementReader, dst []float32, begin, end, rows, cols uint64) error {
+	switch {
+	case r.repack.transpose:
+		// the rows are columns of the source so read the same span of each
+		// source row and transpose it in memory
+		span := make([]float32, end-begin)
+		for j := range cols {
+			if err := rd.readAt(span, j*rows+begin); err != nil {
+				return err
+			}
+
+			for i, v := range span {
+				dst[uint64(i)*cols+j] = v
+			}
+		}
+	case r.repack.row != nil:
+		for i := begin; i < end; i++ {
+			if err := rd.readAt(dst[(i-begin)*cols:(i-begin+1)*cols], r.repack.row(i)*cols); err != nil {
+				return err
+			}
+		}
+	default:
+		return rd.readAt(dst, begin*cols)
+	}
+
+	return nil
+}
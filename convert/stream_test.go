@@ -0,0 +1,122 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestStreamMemoryCeiling(t *testing.T) {
+	dir := t.TempDir()
+
+	const rows, cols = 4096, 1024
+	// values are exact in F16
+	value := func(r, c uint64) float32 { return float32(r%512) + float32(c%4)/4 }
+	writeSafetensors(t, filepath.Join(dir, "model.safetensors"), map[string]syntheticTensor{
+		"model.layers.0.self_attn.q_proj.weight": {shape: []uint64{rows, cols}, fn: value},
+	})
+
+	params := &Params{AttentionHeads: 32, ByteOrder: binary.LittleEndian}
+	ts, err := (&SafetensorFormat{}).GetTensors(dir, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repack, err := llamaRepack(ts[0].Name, params, ts[0].Shape)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tensor, err := repackTensor(ts[0], *repack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err := tensor.WriteTo(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	// the tensor is 16MB as F32 and 8MB as F16 but only a chunk at a time
+	// should be in memory
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > rows*cols*4/8 {
+		t.Errorf("expected at most %d bytes allocated, actual %d", rows*cols*4/8, allocated)
+	}
+
+	var b bytes.Buffer
+	if _, err := tensor.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Len() != rows*cols*2 {
+		t.Fatalf("expected %d bytes, actual %d", rows*cols*2, b.Len())
+	}
+
+	// rows from the two halves of each 128 row head are interleaved
+	for _, tt := range []struct{ row, source uint64 }{{0, 0}, {1, 64}, {2, 1}, {127, 127}, {128, 128}, {129, 192}, {4095, 4095}} {
+		for _, col := range []uint64{0, 1, cols - 1} {
+			if v := readF16(b.Bytes()[2*(tt.row*cols+col):]); v != value(tt.source, col) {
+				t.Errorf("row %d col %d: expected %v, actual %v", tt.row, col, value(tt.source, col), v)
+			}
+		}
+	}
+}
+
+// countingSource counts the reads of a tensor.
+type countingSource struct {
+	memorySource
+	reads *int
+}
+
+func (s countingSource) open() (elementReader, error) {
+	return s, nil
+}
+
+func (s countingSource) readAt(dst []float32, off uint64) error {
+	*s.reads++
+	return s.memorySource.readAt(dst, off)
+}
+
+func TestStreamTranspose(t *testing.T) {
+	const rows, cols = 512, 256
+
+	// the source has the written shape reversed
+	source := make(memorySource, rows*cols)
+	for i := range source {
+		source[i] = float32(i)
+	}
+
+	var reads int
+	tensor := tensorWriterTo{
+		t:      &llm.Tensor{Name: "test", Kind: tensorKindF32, Shape: []uint64{rows, cols}},
+		bo:     binary.LittleEndian,
+		source: countingSource{source, &reads},
+		repack: tensorRepack{transpose: true},
+	}
+
+	var b bytes.Buffer
+	if _, err := tensor.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ row, col uint64 }{{0, 0}, {0, 1}, {1, 0}, {rows - 1, cols - 1}, {300, 7}} {
+		if v := math.Float32frombits(binary.LittleEndian.Uint32(b.Bytes()[4*(tt.row*cols+tt.col):])); v != float32(tt.col*rows+tt.row) {
+			t.Errorf("row %d col %d: expected %v, actual %v", tt.row, tt.col, float32(tt.col*rows+tt.row), v)
+		}
+	}
+
+	// each chunk reads a span of every source row rather than single values
+	if expect := rows * cols / chunkSize * cols; reads != expect {
+		t.Errorf("expected %d reads, actual %d", expect, reads)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"cmp"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 
 	"golang.org/x/exp/maps"
+
+	"github.com/ollama/ollama/llm"
 )
 
 type Tokenizer struct {
@@ -53,18 +58,20 @@ func (t *Token) Type() int32 {
 }
 
 func (t *Tokenizer) maxID() int {
-	return max(
-		slices.Max(maps.Values(t.Model.Vocab)),
-		slices.MaxFunc(t.AddedTokens, func(a, b Token) int {
+	id := slices.Max(maps.Values(t.Model.Vocab))
+	if len(t.AddedTokens) > 0 {
+		id = max(id, slices.MaxFunc(t.AddedTokens, func(a, b Token) int {
 			return cmp.Compare(a.ID, b.ID)
-		}).ID,
-	)
+		}).ID)
+	}
+
+	return id
 }
 
 func parseTokens(dirpath string) (pre string, tokens []Token, merges []string, err error) {
 	f, err := os.Open(dirpath)
 	if err != nil {
-		panic(err)
+		return "", nil, nil, err
 	}
 	defer f.Close()
 
@@ -97,6 +104,8 @@ func parseTokens(dirpath string) (pre string, tokens []Token, merges []string, e
 		pre = "deepseek-llm"
 	case "21cde974d587f0d54dc8d56b183cc1e6239600172035c68fbd6d4b9f8da0576e":
 		pre = "deepseek-coder"
+	case "1ff7f41064896984db5d1bb6ff64fa4bc29007d08c1b439e505b7392777a319e":
+		pre = "qwen2"
 	default:
 		slog.Warn("unknown pretokenizer, using default", "digest", digest)
 		pre = "default"
@@ -104,3 +113,231 @@ func parseTokens(dirpath string) (pre string, tokens []Token, merges []string, e
 
 	return pre, tokens, t.Model.Merges, nil
 }
+
+// specialToken is a special token in tokenizer_config.json or
+// special_tokens_map.json. It's either the token's content or an object with
+// the content.
+type specialToken string
+
+func (t *specialToken) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = specialToken(s)
+		return nil
+	}
+
+	var token struct {
+		Content string `json:"content"`
+	}
+
+	if err := json.Unmarshal(b, &token); err != nil {
+		return err
+	}
+
+	*t = specialToken(token.Content)
+	return nil
+}
+
+// chatTemplate is the chat_template in tokenizer_config.json. It's either the
+// template or a list of named templates, of which the default is used.
+type chatTemplate string
+
+func (t *chatTemplate) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = chatTemplate(s)
+		return nil
+	}
+
+	var templates []struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}
+
+	if err := json.Unmarshal(b, &templates); err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		if template.Name == "default" {
+			*t = chatTemplate(template.Template)
+			return nil
+		}
+	}
+
+	if len(templates) > 0 {
+		*t = chatTemplate(templates[0].Template)
+	}
+
+	return nil
+}
+
+// tokenizerConfig is the subset of tokenizer_config.json and
+// special_tokens_map.json which describes special tokens and the chat
+// template.
+type tokenizerConfig struct {
+	BOS specialToken `json:"bos_token"`
+	EOS specialToken `json:"eos_token"`
+	PAD specialToken `json:"pad_token"`
+	UNK specialToken `json:"unk_token"`
+
+	AddBOS *bool `json:"add_bos_token"`
+	AddEOS *bool `json:"add_eos_token"`
+
+	// AddedTokensDecoder maps token ids to added tokens
+	AddedTokensDecoder map[string]Token `json:"added_tokens_decoder"`
+
+	ChatTemplate chatTemplate `json:"chat_template"`
+}
+
+// readTokenizerConfig reads the json file fn in dirpath. A missing file isn't
+// an error.
+func readTokenizerConfig(dirpath, fn string, v any) error {
+	f, err := os.Open(filepath.Join(dirpath, fn))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// loadAddedTokens reads the tokens added to the base vocabulary from
+// tokenizer.json or, if it doesn't exist, tokenizer_config.json.
+func loadAddedTokens(dirpath string) ([]Token, error) {
+	var t Tokenizer
+	if err := readTokenizerConfig(dirpath, "tokenizer.json", &t); err != nil {
+		return nil, err
+	}
+
+	if len(t.AddedTokens) > 0 {
+		return t.AddedTokens, nil
+	}
+
+	var c tokenizerConfig
+	if err := readTokenizerConfig(dirpath, "tokenizer_config.json", &c); err != nil {
+		return nil, err
+	}
+
+	var tokens []Token
+	for k, token := range c.AddedTokensDecoder {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid added token id %q", k)
+		}
+
+		token.ID = id
+		tokens = append(tokens, token)
+	}
+
+	slices.SortFunc(tokens, func(a, b Token) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return tokens, nil
+}
+
+// addTokens sets the content and type of tokens which are already in the
+// vocabulary and appends the others. Special tokens are control tokens and
+// others are user defined.
+func (v *Vocab) addTokens(tokens []Token) error {
+	for _, t := range tokens {
+		t.UserDefined = true
+		switch {
+		case t.ID < len(v.Tokens):
+			v.Tokens[t.ID] = t.Content
+			v.Types[t.ID] = t.Type()
+		case t.ID == len(v.Tokens):
+			v.Tokens = append(v.Tokens, t.Content)
+			v.Types = append(v.Types, t.Type())
+			if v.Scores != nil {
+				v.Scores = append(v.Scores, -1000.0)
+			}
+		default:
+			return fmt.Errorf("token ID '%d' for '%s' doesn't match total token size", t.ID, t.Content)
+		}
+	}
+
+	return nil
+}
+
+// loadSpecialTokens reads the special tokens and whether they're added to
+// prompts from special_tokens_map.json and tokenizer_config.json. Tokens in
+// special_tokens_map.json take precedence. The chat template is read from
+// tokenizer_config.json.
+func (v *Vocab) loadSpecialTokens(dirpath string) error {
+	var c, m tokenizerConfig
+	if err := readTokenizerConfig(dirpath, "tokenizer_config.json", &c); err != nil {
+		return err
+	}
+
+	if err := readTokenizerConfig(dirpath, "special_tokens_map.json", &m); err != nil {
+		return err
+	}
+
+	ids := make(map[string]int, len(v.Tokens))
+	for i, t := range v.Tokens {
+		if _, ok := ids[t]; !ok {
+			ids[t] = i
+		}
+	}
+
+	v.Special = make(map[string]int)
+	for typ, contents := range map[string][]specialToken{
+		"bos": {m.BOS, c.BOS},
+		"eos": {m.EOS, c.EOS},
+		"pad": {m.PAD, c.PAD},
+		"unk": {m.UNK, c.UNK},
+	} {
+		content := cmp.Or(contents...)
+		if content == "" {
+			continue
+		}
+
+		id, ok := ids[string(content)]
+		if !ok {
+			slog.Warn("special token isn't in the vocabulary", "type", typ, "token", content)
+			continue
+		}
+
+		v.Special[typ] = id
+	}
+
+	v.AddBOS, v.AddEOS = c.AddBOS, c.AddEOS
+	v.ChatTemplate = string(c.ChatTemplate)
+	return nil
+}
+
+// setSpecialKV overrides the special token ids and flags in kv, which default
+// to those in config.json, with those of the tokenizer and sets its chat
+// template.
+func (v *Vocab) setSpecialKV(kv llm.KV) {
+	for typ, key := range map[string]string{
+		"bos": "tokenizer.ggml.bos_token_id",
+		"eos": "tokenizer.ggml.eos_token_id",
+		"pad": "tokenizer.ggml.padding_token_id",
+		"unk": "tokenizer.ggml.unknown_token_id",
+	} {
+		if id, ok := v.Special[typ]; ok {
+			kv[key] = uint32(id)
+		}
+	}
+
+	if v.AddBOS != nil {
+		kv["tokenizer.ggml.add_bos_token"] = *v.AddBOS
+	}
+
+	if v.AddEOS != nil {
+		kv["tokenizer.ggml.add_eos_token"] = *v.AddEOS
+	}
+
+	if v.ChatTemplate != "" {
+		kv["tokenizer.chat_template"] = v.ChatTemplate
+	}
+}
@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestLoadSentencePieceSpecialTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	// pieces are <unk>, <s>, </s>, a and b
+	writeSentencePiece(t, dir, "a", "b")
+
+	writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 3, "content": "a", "special": true},
+			{"id": 5, "content": "<|im_start|>", "special": true},
+			{"id": 6, "content": "<tool>", "special": false},
+		},
+	})
+
+	writeJSON(t, filepath.Join(dir, "tokenizer_config.json"), map[string]any{
+		"bos_token":     "<s>",
+		"eos_token":     map[string]any{"content": "<|im_start|>", "special": true},
+		"unk_token":     nil,
+		"add_bos_token": true,
+		"add_eos_token": false,
+	})
+
+	writeJSON(t, filepath.Join(dir, "special_tokens_map.json"), map[string]any{
+		"eos_token": "</s>",
+		"pad_token": map[string]any{"content": "<unk>"},
+	})
+
+	v, err := LoadSentencePieceTokens(dir, &Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"<unk>", "<s>", "</s>", "a", "b", "<|im_start|>", "<tool>"}; !reflect.DeepEqual(v.Tokens, expect) {
+		t.Errorf("expected tokens %v, actual %v", expect, v.Tokens)
+	}
+
+	if expect := []int32{tokenTypeUnknown, tokenTypeControl, tokenTypeControl, tokenTypeControl, tokenTypeNormal, tokenTypeControl, tokenTypeUserDefined}; !reflect.DeepEqual(v.Types, expect) {
+		t.Errorf("expected types %v, actual %v", expect, v.Types)
+	}
+
+	if len(v.Scores) != len(v.Tokens) {
+		t.Errorf("expected %d scores, actual %d", len(v.Tokens), len(v.Scores))
+	}
+
+	// config.json ids are overridden by the tokenizer
+	kv := llm.KV{
+		"tokenizer.ggml.bos_token_id":     uint32(7),
+		"tokenizer.ggml.eos_token_id":     uint32(7),
+		"tokenizer.ggml.unknown_token_id": uint32(0),
+	}
+
+	v.setSpecialKV(kv)
+
+	expect := llm.KV{
+		"tokenizer.ggml.bos_token_id":     uint32(1),
+		"tokenizer.ggml.eos_token_id":     uint32(2),
+		"tokenizer.ggml.padding_token_id": uint32(0),
+		"tokenizer.ggml.unknown_token_id": uint32(0),
+		"tokenizer.ggml.add_bos_token":    true,
+		"tokenizer.ggml.add_eos_token":    false,
+	}
+
+	if !reflect.DeepEqual(kv, expect) {
+		t.Errorf("expected kv %v, actual %v", expect, kv)
+	}
+}
+
+func TestLoadBPESpecialTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+		"model": map[string]any{
+			"type":   "BPE",
+			"vocab":  map[string]int{"a": 0, "b": 1, "ab": 2},
+			"merges": []string{"a b"},
+		},
+		"added_tokens": []map[string]any{
+			{"id": 3, "content": "<|begin_of_text|>", "special": true},
+			{"id": 4, "content": "<|eot_id|>", "special": true},
+			{"id": 5, "content": "<|python_tag|>", "special": false},
+		},
+	})
+
+	writeJSON(t, filepath.Join(dir, "tokenizer_config.json"), map[string]any{
+		"bos_token": "<|begin_of_text|>",
+		"eos_token": "<|eot_id|>",
+	})
+
+	m := &LlamaModel{ModelData{Path: dir, Params: &Params{}}}
+	if err := m.LoadVocab(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []int32{tokenTypeNormal, tokenTypeNormal, tokenTypeNormal, tokenTypeControl, tokenTypeControl, tokenTypeUserDefined}; !reflect.DeepEqual(m.Vocab.Types, expect) {
+		t.Errorf("expected types %v, actual %v", expect, m.Vocab.Types)
+	}
+
+	if expect := map[string]int{"bos": 3, "eos": 4}; !reflect.DeepEqual(m.Vocab.Special, expect) {
+		t.Errorf("expected special tokens %v, actual %v", expect, m.Vocab.Special)
+	}
+
+	// flags which aren't set aren't written
+	kv := llm.KV{}
+	m.Vocab.setSpecialKV(kv)
+	if _, ok := kv["tokenizer.ggml.add_bos_token"]; ok {
+		t.Error("expected add_bos_token to be unset")
+	}
+}
+
+func TestLoadChatTemplate(t *testing.T) {
+	cases := []struct {
+		name     string
+		template any
+		expect   string
+	}{
+		{"string", "{{ messages }}", "{{ messages }}"},
+		{"named", []map[string]string{
+			{"name": "tool_use", "template": "{{ tools }}"},
+			{"name": "default", "template": "{{ messages }}"},
+		}, "{{ messages }}"},
+		{"missing", nil, ""},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			config := map[string]any{"eos_token": "b"}
+			if tt.template != nil {
+				config["chat_template"] = tt.template
+			}
+
+			writeJSON(t, filepath.Join(dir, "tokenizer.json"), map[string]any{
+				"model": map[string]any{"type": "BPE", "vocab": map[string]int{"a": 0, "b": 1}},
+			})
+			writeJSON(t, filepath.Join(dir, "tokenizer_config.json"), config)
+
+			m := &LlamaModel{ModelData{Path: dir, Params: &Params{}}}
+			if err := m.LoadVocab(); err != nil {
+				t.Fatal(err)
+			}
+
+			kv := llm.KV{}
+			m.Vocab.setSpecialKV(kv)
+			if s, _ := kv["tokenizer.chat_template"].(string); s != tt.expect {
+				t.Errorf("expected chat template %q, actual %q", tt.expect, s)
+			}
+		})
+	}
+}
@@ -1,33 +1,25 @@
 package convert
 
 import (
+	"archive/zip"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/nlpodyssey/gopickle/pickle"
 	"github.com/nlpodyssey/gopickle/pytorch"
 	"github.com/nlpodyssey/gopickle/types"
-	"github.com/x448/float16"
 
 	"github.com/ollama/ollama/llm"
 )
 
-type torchWriterTo struct {
-	t *llm.Tensor
-
-	params *Params
-	bo     ByteOrder
-
-	storage  pytorch.StorageInterface
-	repacker func(string, []float32, []uint64) ([]float32, error)
-}
-
 type TorchFormat struct{}
 
 func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor, error) {
@@ -43,46 +35,36 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 	var offset uint64
 	var tensors []llm.Tensor
 	for _, fn := range files {
-		m, err := pytorch.Load(fn)
+		keys, ts, err := loadTorch(fn)
 		if err != nil {
 			slog.Error(fmt.Sprintf("error unpickling: %q", err))
 			return []llm.Tensor{}, err
 		}
 
-		for _, k := range m.(*types.Dict).Keys() {
-			if strings.HasSuffix(k.(string), "self_attn.rotary_emb.inv_freq") {
+		for _, k := range keys {
+			if strings.HasSuffix(k, "self_attn.rotary_emb.inv_freq") {
 				continue
 			}
 
-			t, _ := m.(*types.Dict).Get(k)
-			tshape := t.(*pytorch.Tensor).Size
-
-			var size uint64
-			var kind uint32
-			switch len(tshape) {
-			case 0:
+			t := ts[k]
+			if len(t.shape) == 0 {
 				continue
-			case 1:
-				// convert to float32
-				kind = 0
-				size = uint64(tshape[0] * 4)
-			case 2:
-				// convert to float16
-				kind = 1
-				size = uint64(tshape[0] * tshape[1] * 2)
 			}
 
-			ggufName, err := tf.GetLayerName(k.(string))
+			ggufName, err := tf.GetLayerName(k)
 			if err != nil {
 				slog.Error(err.Error())
 				return nil, err
 			}
-			slog.Debug(fmt.Sprintf("'%35s': '%30s' %10d [%#v]", k.(string), ggufName, size, tshape))
 
 			shape := []uint64{0, 0, 0, 0}
-			for i := range tshape {
-				shape[i] = uint64(tshape[i])
-			}
+			copy(shape, t.shape)
+
+			// vectors are converted to float32 and matrices to float16 or
+			// the requested quantization
+			kind := params.tensorKind(ggufName, shape)
+			size := llm.Tensor{Kind: kind, Shape: t.shape}.Size()
+			slog.Debug(fmt.Sprintf("'%35s': '%30s' %10d [%#v]", k, ggufName, size, t.shape))
 
 			tensor := llm.Tensor{
 				Name:   ggufName,
@@ -91,11 +73,10 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 				Shape:  shape,
 			}
 
-			tensor.WriterTo = torchWriterTo{
-				t:       &tensor,
-				params:  params,
-				bo:      params.ByteOrder,
-				storage: t.(*pytorch.Tensor).Source,
+			tensor.WriterTo = tensorWriterTo{
+				t:      &tensor,
+				bo:     params.ByteOrder,
+				source: t.source,
 			}
 
 			tensors = append(tensors, tensor)
@@ -106,6 +87,289 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 	return tensors, nil
 }
 
+// torchTensor is a tensor in a torch checkpoint.
+type torchTensor struct {
+	shape  []uint64
+	source tensorSource
+}
+
+// torchStorage is a storage referenced by the pickled tensors. Its data is the
+// zip entry named key.
+type torchStorage struct {
+	dtype string
+	key   string
+}
+
+// torchStorageClass is a storage type such as torch.HalfStorage.
+type torchStorageClass string
+
+// torchRebuildTensor is torch._utils._rebuild_tensor_v2 which unpickles a
+// tensor as a view of a storage.
+type torchRebuildTensor struct{}
+
+func (torchRebuildTensor) Call(args ...any) (any, error) {
+	if len(args) < 4 {
+		return nil, fmt.Errorf("_rebuild_tensor_v2: expected at least 4 arguments, got %d", len(args))
+	}
+
+	storage, ok := args[0].(*torchStorage)
+	if !ok {
+		return nil, fmt.Errorf("_rebuild_tensor_v2: unexpected storage %T", args[0])
+	}
+
+	offset, ok := args[1].(int)
+	if !ok {
+		return nil, fmt.Errorf("_rebuild_tensor_v2: unexpected offset %T", args[1])
+	}
+
+	size, err := torchInts(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	stride, err := torchInts(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	// only contiguous tensors can be read directly from the storage
+	expect := 1
+	for i := len(size) - 1; i >= 0; i-- {
+		if size[i] > 1 && stride[i] != expect {
+			return nil, fmt.Errorf("_rebuild_tensor_v2: tensors with strides %v aren't supported", stride)
+		}
+
+		expect *= size[i]
+	}
+
+	shape := make([]uint64, len(size))
+	for i := range size {
+		shape[i] = uint64(size[i])
+	}
+
+	return &torchView{storage: storage, offset: offset, shape: shape}, nil
+}
+
+// torchView is a tensor which hasn't yet been resolved to its storage's
+// location in the archive.
+type torchView struct {
+	storage *torchStorage
+	offset  int
+	shape   []uint64
+}
+
+// torchRebuildParameter is torch._utils._rebuild_parameter which wraps a
+// tensor in a nn.Parameter.
+type torchRebuildParameter struct{}
+
+func (torchRebuildParameter) Call(args ...any) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("_rebuild_parameter: expected a tensor")
+	}
+
+	return args[0], nil
+}
+
+func torchInts(v any) ([]int, error) {
+	tuple, ok := v.(*types.Tuple)
+	if !ok {
+		return nil, fmt.Errorf("expected a tuple, got %T", v)
+	}
+
+	ints := make([]int, tuple.Len())
+	for i := range ints {
+		if ints[i], ok = tuple.Get(i).(int); !ok {
+			return nil, fmt.Errorf("expected an int, got %T", tuple.Get(i))
+		}
+	}
+
+	return ints, nil
+}
+
+// loadTorch reads the names and shapes of the tensors in the torch checkpoint
+// fn without reading their data. Storages must be stored uncompressed, as
+// torch.save does, so their data can be read directly from the archive.
+// Checkpoints in the legacy format are read into memory.
+func loadTorch(fn string) ([]string, map[string]torchTensor, error) {
+	r, err := zip.OpenReader(fn)
+	if errors.Is(err, zip.ErrFormat) {
+		return loadLegacyTorch(fn)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	records := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		records[path.Base(f.Name)] = f
+	}
+
+	data, ok := records["data.pkl"]
+	if !ok {
+		return nil, nil, errors.New("data.pkl not found in zip file")
+	}
+
+	df, err := data.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer df.Close()
+
+	u := pickle.NewUnpickler(df)
+	u.FindClass = func(module, name string) (any, error) {
+		switch {
+		case module == "torch._utils" && name == "_rebuild_tensor_v2":
+			return torchRebuildTensor{}, nil
+		case module == "torch._utils" && name == "_rebuild_parameter":
+			return torchRebuildParameter{}, nil
+		case module == "torch" && name == "FloatStorage":
+			return torchStorageClass("F32"), nil
+		case module == "torch" && name == "HalfStorage":
+			return torchStorageClass("F16"), nil
+		case module == "torch" && name == "BFloat16Storage":
+			return torchStorageClass("BF16"), nil
+		case module == "torch" && strings.HasSuffix(name, "Storage"):
+			return nil, fmt.Errorf("unsupported storage type: %s", name)
+		}
+
+		return types.NewGenericClass(module, name), nil
+	}
+
+	u.PersistentLoad = func(id any) (any, error) {
+		// ("storage", storage_type, key, location, size)
+		tuple, ok := id.(*types.Tuple)
+		if !ok || tuple.Len() < 5 || tuple.Get(0) != "storage" {
+			return nil, fmt.Errorf("unexpected persistent id %v", id)
+		}
+
+		dtype, ok := tuple.Get(1).(torchStorageClass)
+		if !ok {
+			return nil, fmt.Errorf("unexpected storage type %v", tuple.Get(1))
+		}
+
+		key, ok := tuple.Get(2).(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected storage key %v", tuple.Get(2))
+		}
+
+		return &torchStorage{dtype: string(dtype), key: key}, nil
+	}
+
+	v, err := u.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	views := make(map[string]*torchView)
+	add := func(k, v any) error {
+		key, ok := k.(string)
+		if !ok {
+			return fmt.Errorf("unexpected key %v", k)
+		}
+
+		if view, ok := v.(*torchView); ok {
+			keys = append(keys, key)
+			views[key] = view
+		}
+
+		return nil
+	}
+
+	switch m := v.(type) {
+	case *types.Dict:
+		for _, k := range m.Keys() {
+			v, _ := m.Get(k)
+			if err := add(k, v); err != nil {
+				return nil, nil, err
+			}
+		}
+	case *types.OrderedDict:
+		for e := m.List.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(*types.OrderedDictEntry)
+			if err := add(entry.Key, entry.Value); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("unexpected checkpoint type %T", v)
+	}
+
+	tensors := make(map[string]torchTensor, len(views))
+	for key, view := range views {
+		f, ok := records[view.storage.key]
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot find zip record '%s'", view.storage.key)
+		}
+
+		if f.Method != zip.Store {
+			return nil, nil, fmt.Errorf("%s: compressed storages aren't supported", key)
+		}
+
+		offset, err := f.DataOffset()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		size := int64(4)
+		if view.storage.dtype != "F32" {
+			size = 2
+		}
+
+		tensors[key] = torchTensor{
+			shape:  view.shape,
+			source: fileSource{filename: fn, dtype: view.storage.dtype, offset: offset + int64(view.offset)*size},
+		}
+	}
+
+	return keys, tensors, nil
+}
+
+// loadLegacyTorch reads a checkpoint saved before torch 1.6 into memory.
+func loadLegacyTorch(fn string) ([]string, map[string]torchTensor, error) {
+	m, err := pytorch.Load(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, ok := m.(*types.Dict)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected checkpoint type %T", m)
+	}
+
+	var keys []string
+	tensors := make(map[string]torchTensor)
+	for _, k := range d.Keys() {
+		v, _ := d.Get(k)
+		t, ok := v.(*pytorch.Tensor)
+		if !ok {
+			continue
+		}
+
+		var f32s []float32
+		switch s := t.Source.(type) {
+		case *pytorch.FloatStorage:
+			f32s = s.Data
+		case *pytorch.HalfStorage:
+			f32s = s.Data
+		case *pytorch.BFloat16Storage:
+			f32s = s.Data
+		default:
+			return nil, nil, fmt.Errorf("unknown data type: %T", s)
+		}
+
+		shape := make([]uint64, len(t.Size))
+		for i := range t.Size {
+			shape[i] = uint64(t.Size[i])
+		}
+
+		keys = append(keys, k.(string))
+		tensors[k.(string)] = torchTensor{shape: shape, source: memorySource(f32s[t.StorageOffset:])}
+	}
+
+	return keys, tensors, nil
+}
+
 func getAltParams(dirpath string) (*Params, error) {
 	f, err := os.Open(filepath.Join(dirpath, "params.json"))
 	if err != nil {
@@ -228,41 +492,6 @@ func (m *TorchFormat) GetLayerName(n string) (string, error) {
 	return "", fmt.Errorf("couldn't find a layer name for '%s'", n)
 }
 
-func (r torchWriterTo) WriteTo(w io.Writer) (n int64, err error) {
-	var f32s []float32
-	switch s := r.storage.(type) {
-	case *pytorch.FloatStorage:
-		f32s = s.Data
-	case *pytorch.HalfStorage:
-		f32s = s.Data
-	case *pytorch.BFloat16Storage:
-		f32s = s.Data
-	default:
-		return 0, fmt.Errorf("unknown data type: %T", s)
-	}
-
-	if r.repacker != nil {
-		f32s, err = r.repacker(r.t.Name, f32s, r.t.Shape)
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	switch r.t.Kind {
-	case 0:
-		return 0, binary.Write(w, r.bo, f32s)
-	case 1:
-		f16s := make([]uint16, len(f32s))
-		for i := range f32s {
-			f16s[i] = float16.Fromfloat32(f32s[i]).Bits()
-		}
-
-		return 0, binary.Write(w, r.bo, f16s)
-	default:
-		return 0, fmt.Errorf("unknown storage type: %d", r.t.Kind)
-	}
-}
-
 func (m *TorchFormat) GetModelArch(name, dirPath string, params *Params) (ModelArch, error) {
 	switch len(params.Architectures) {
 	case 0:
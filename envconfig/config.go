@@ -29,6 +29,8 @@ var (
 	AllowOrigins []string
 	// Set via OLLAMA_DEBUG in the environment
 	Debug bool
+	// Set via OLLAMA_EXPORT_DIR in the environment
+	ExportDir string
 	// Experimental flash attention
 	FlashAttention bool
 	// Set via OLLAMA_HOST in the environment
@@ -42,7 +44,9 @@ var (
 	// Set via OLLAMA_MAX_QUEUE in the environment
 	MaxQueuedRequests int
 	// Set via OLLAMA_MODELS in the environment
-	ModelsDir string
+	ModelsDirs []string
+	// Set via OLLAMA_MODELS_QUOTA in the environment
+	ModelsQuota uint64
 	// Set via OLLAMA_MAX_VRAM in the environment
 	MaxVRAM uint64
 	// Set via OLLAMA_NOHISTORY in the environment
@@ -51,12 +55,18 @@ var (
 	NoPrune bool
 	// Set via OLLAMA_NUM_PARALLEL in the environment
 	NumParallel int
+	// Set via OLLAMA_PINNED_MODELS in the environment
+	PinnedModels []string
 	// Set via OLLAMA_RUNNERS_DIR in the environment
 	RunnersDir string
 	// Set via OLLAMA_SCHED_SPREAD in the environment
 	SchedSpread bool
 	// Set via OLLAMA_TMPDIR in the environment
 	TmpDir string
+	// Set via OLLAMA_TRUSTED_KEYS in the environment
+	TrustedKeys string
+	// Set via OLLAMA_VERIFY_SIGNATURES in the environment
+	VerifySignatures bool
 	// Set via OLLAMA_INTEL_GPU in the environment
 	IntelGpu bool
 
@@ -81,6 +91,7 @@ type EnvVar struct {
 func AsMap() map[string]EnvVar {
 	ret := map[string]EnvVar{
 		"OLLAMA_DEBUG":             {"OLLAMA_DEBUG", Debug, "Show additional debug information (e.g. OLLAMA_DEBUG=1)"},
+		"OLLAMA_EXPORT_DIR":        {"OLLAMA_EXPORT_DIR", ExportDir, "The directory models are exported to (default \"~/.ollama/exports\")"},
 		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention, "Enabled flash attention"},
 		"OLLAMA_HOST":              {"OLLAMA_HOST", Host, "IP Address for the ollama server (default 127.0.0.1:11434)"},
 		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive, "The duration that models stay loaded in memory (default \"5m\")"},
@@ -88,14 +99,18 @@ func AsMap() map[string]EnvVar {
 		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners, "Maximum number of loaded models (default 1)"},
 		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueuedRequests, "Maximum number of queued requests"},
 		"OLLAMA_MAX_VRAM":          {"OLLAMA_MAX_VRAM", MaxVRAM, "Maximum VRAM"},
-		"OLLAMA_MODELS":            {"OLLAMA_MODELS", ModelsDir, "The path to the models directory"},
+		"OLLAMA_MODELS":            {"OLLAMA_MODELS", ModelsDirs, "The paths to the models directories, searched in order"},
+		"OLLAMA_MODELS_QUOTA":      {"OLLAMA_MODELS_QUOTA", ModelsQuota, "Maximum size of the models directory in bytes"},
 		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory, "Do not preserve readline history"},
 		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune, "Do not prune model blobs on startup"},
 		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel, "Maximum number of parallel requests (default 1)"},
 		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", AllowOrigins, "A comma separated list of allowed origins"},
+		"OLLAMA_PINNED_MODELS":     {"OLLAMA_PINNED_MODELS", PinnedModels, "A comma separated list of models which are never evicted"},
 		"OLLAMA_RUNNERS_DIR":       {"OLLAMA_RUNNERS_DIR", RunnersDir, "Location for runners"},
 		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread, "Always schedule model across all GPUs"},
 		"OLLAMA_TMPDIR":            {"OLLAMA_TMPDIR", TmpDir, "Location for temporary files"},
+		"OLLAMA_TRUSTED_KEYS":      {"OLLAMA_TRUSTED_KEYS", TrustedKeys, "Path to a file of public keys trusted to sign models, in authorized_keys format"},
+		"OLLAMA_VERIFY_SIGNATURES": {"OLLAMA_VERIFY_SIGNATURES", VerifySignatures, "Refuse to pull models which are not signed by a trusted key"},
 	}
 	if runtime.GOOS != "darwin" {
 		ret["CUDA_VISIBLE_DEVICES"] = EnvVar{"CUDA_VISIBLE_DEVICES", CudaVisibleDevices, "Set which NVIDIA devices are visible"}
@@ -191,6 +206,20 @@ func LoadConfig() {
 
 	TmpDir = clean("OLLAMA_TMPDIR")
 
+	TrustedKeys = clean("OLLAMA_TRUSTED_KEYS")
+
+	VerifySignatures = false
+	if verify := clean("OLLAMA_VERIFY_SIGNATURES"); verify != "" {
+		v, err := strconv.ParseBool(verify)
+		if err == nil {
+			VerifySignatures = v
+		} else {
+			// refusing unverified models is the safe choice for a setting which was meant to be on
+			slog.Warn("invalid setting, verifying signatures", "OLLAMA_VERIFY_SIGNATURES", verify, "error", err)
+			VerifySignatures = true
+		}
+	}
+
 	userLimit := clean("OLLAMA_MAX_VRAM")
 	if userLimit != "" {
 		avail, err := strconv.ParseUint(userLimit, 10, 64)
@@ -229,6 +258,25 @@ func LoadConfig() {
 		NoPrune = true
 	}
 
+	ModelsQuota = 0
+	if quota := clean("OLLAMA_MODELS_QUOTA"); quota != "" {
+		q, err := strconv.ParseUint(quota, 10, 64)
+		if err != nil {
+			slog.Error("invalid setting, ignoring", "OLLAMA_MODELS_QUOTA", quota, "error", err)
+		} else {
+			ModelsQuota = q
+		}
+	}
+
+	PinnedModels = nil
+	if pinned := clean("OLLAMA_PINNED_MODELS"); pinned != "" {
+		for _, p := range strings.Split(pinned, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				PinnedModels = append(PinnedModels, p)
+			}
+		}
+	}
+
 	if origins := clean("OLLAMA_ORIGINS"); origins != "" {
 		AllowOrigins = strings.Split(origins, ",")
 	}
@@ -269,9 +317,14 @@ func LoadConfig() {
 	KeepAlive = clean("OLLAMA_KEEP_ALIVE")
 
 	var err error
-	ModelsDir, err = getModelsDir()
+	ModelsDirs, err = getModelsDirs()
 	if err != nil {
-		slog.Error("invalid setting", "OLLAMA_MODELS", ModelsDir, "error", err)
+		slog.Error("invalid setting", "OLLAMA_MODELS", ModelsDirs, "error", err)
+	}
+
+	ExportDir, err = getExportDir()
+	if err != nil {
+		slog.Error("invalid setting", "OLLAMA_EXPORT_DIR", ExportDir, "error", err)
 	}
 
 	Host, err = getOllamaHost()
@@ -290,15 +343,37 @@ func LoadConfig() {
 	HsaOverrideGfxVersion = clean("HSA_OVERRIDE_GFX_VERSION")
 }
 
-func getModelsDir() (string, error) {
+func getModelsDirs() ([]string, error) {
 	if models, exists := os.LookupEnv("OLLAMA_MODELS"); exists {
-		return models, nil
+		var dirs []string
+		for _, dir := range filepath.SplitList(models) {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+
+		if len(dirs) > 0 {
+			return dirs, nil
+		}
 	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{filepath.Join(home, ".ollama", "models")}, nil
+}
+
+func getExportDir() (string, error) {
+	if dir := clean("OLLAMA_EXPORT_DIR"); dir != "" {
+		return dir, nil
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".ollama", "models"), nil
+
+	return filepath.Join(home, ".ollama", "exports"), nil
 }
 
 func getOllamaHost() (*OllamaHost, error) {
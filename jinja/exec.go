@@ -0,0 +1,691 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errBreak and errContinue unwind the body of a loop
+var (
+	errBreak    = errors.New("break outside of a loop")
+	errContinue = errors.New("continue outside of a loop")
+)
+
+type writer = strings.Builder
+
+// scope holds the variables of a template, a loop or a macro call. Loops and
+// macros don't change the variables of the scopes around them.
+type scope struct {
+	vars   map[string]any
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]any), parent: parent}
+}
+
+func (s *scope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+
+	if fn, ok := globals[name]; ok {
+		return fn, true
+	}
+
+	return nil, false
+}
+
+// wrap adds the line to errors which don't have one. Exceptions raised by
+// the template are left as they are.
+func wrap(line int, err error) error {
+	var e *Error
+	var x *Exception
+	if err == nil || err == errBreak || err == errContinue || errors.As(err, &e) || errors.As(err, &x) {
+		return err
+	}
+
+	return &Error{Line: line, Message: err.Error()}
+}
+
+func render(nodes []node, s *scope, w *writer) error {
+	for _, n := range nodes {
+		if err := n.render(s, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type textNode string
+
+func (n textNode) render(_ *scope, w *writer) error {
+	w.WriteString(string(n))
+	return nil
+}
+
+type listNode []node
+
+func (n listNode) render(s *scope, w *writer) error {
+	return render(n, s, w)
+}
+
+type outputNode struct {
+	line int
+	x    expr
+}
+
+func (n *outputNode) render(s *scope, w *writer) error {
+	v, err := n.x.eval(s)
+	if err != nil {
+		return wrap(n.line, err)
+	}
+
+	w.WriteString(str(v))
+	return nil
+}
+
+type ifNode struct {
+	line      int
+	cond      expr
+	then, els []node
+}
+
+func (n *ifNode) render(s *scope, w *writer) error {
+	v, err := n.cond.eval(s)
+	if err != nil {
+		return wrap(n.line, err)
+	}
+
+	if truthy(v) {
+		return render(n.then, s, w)
+	}
+
+	return render(n.els, s, w)
+}
+
+type forNode struct {
+	line      int
+	vars      []string
+	iter      expr
+	filter    expr
+	body, els []node
+}
+
+func (n *forNode) render(s *scope, w *writer) error {
+	v, err := n.iter.eval(s)
+	if err != nil {
+		return wrap(n.line, err)
+	}
+
+	items, err := iterate(v)
+	if err != nil {
+		return wrap(n.line, err)
+	}
+
+	inner := newScope(s)
+	if n.filter != nil {
+		var filtered []any
+		for _, item := range items {
+			if err := n.assign(inner, item); err != nil {
+				return err
+			}
+
+			ok, err := n.filter.eval(inner)
+			if err != nil {
+				return wrap(n.line, err)
+			}
+
+			if truthy(ok) {
+				filtered = append(filtered, item)
+			}
+		}
+
+		items = filtered
+	}
+
+	if len(items) == 0 {
+		return render(n.els, s, w)
+	}
+
+	for i, item := range items {
+		if err := n.assign(inner, item); err != nil {
+			return err
+		}
+
+		inner.vars["loop"] = loop(items, i)
+		if err := render(n.body, inner, w); err == errBreak {
+			break
+		} else if err != nil && err != errContinue {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *forNode) assign(s *scope, item any) error {
+	if len(n.vars) == 1 {
+		s.vars[n.vars[0]] = item
+		return nil
+	}
+
+	return wrap(n.line, unpack(s, n.vars, item))
+}
+
+func unpack(s *scope, names []string, v any) error {
+	values, ok := v.([]any)
+	if !ok || len(values) != len(names) {
+		return fmt.Errorf("cannot unpack %s into %d values", typeName(v), len(names))
+	}
+
+	for i, name := range names {
+		s.vars[name] = values[i]
+	}
+
+	return nil
+}
+
+// loop returns the loop variable for the i'th of items.
+func loop(items []any, i int) map[string]any {
+	l := map[string]any{
+		"index":     i + 1,
+		"index0":    i,
+		"revindex":  len(items) - i,
+		"revindex0": len(items) - i - 1,
+		"first":     i == 0,
+		"last":      i == len(items)-1,
+		"length":    len(items),
+		"previtem":  undefined{"previtem"},
+		"nextitem":  undefined{"nextitem"},
+		"cycle": function(func(args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("no items for cycling given")
+			}
+
+			return args[i%len(args)], nil
+		}),
+	}
+
+	if i > 0 {
+		l["previtem"] = items[i-1]
+	}
+
+	if i+1 < len(items) {
+		l["nextitem"] = items[i+1]
+	}
+
+	return l
+}
+
+type breakNode struct{}
+
+func (breakNode) render(*scope, *writer) error {
+	return errBreak
+}
+
+type continueNode struct{}
+
+func (continueNode) render(*scope, *writer) error {
+	return errContinue
+}
+
+type setNode struct {
+	line  int
+	vars  []string
+	attr  string
+	value expr
+	body  []node
+}
+
+func (n *setNode) render(s *scope, w *writer) error {
+	var v any
+	if n.value != nil {
+		var err error
+		if v, err = n.value.eval(s); err != nil {
+			return wrap(n.line, err)
+		}
+	} else {
+		var sb writer
+		if err := render(n.body, s, &sb); err != nil {
+			return err
+		}
+
+		v = sb.String()
+	}
+
+	switch {
+	case n.attr != "":
+		target, _ := s.lookup(n.vars[0])
+		ns, ok := target.(*namespace)
+		if !ok {
+			return &Error{Line: n.line, Message: fmt.Sprintf("cannot set attribute %q of %s, only of a namespace", n.attr, typeName(target))}
+		}
+
+		ns.vars[n.attr] = v
+	case len(n.vars) > 1:
+		return wrap(n.line, unpack(s, n.vars, v))
+	default:
+		s.vars[n.vars[0]] = v
+	}
+
+	return nil
+}
+
+type macroNode struct {
+	line     int
+	name     string
+	params   []string
+	defaults []expr
+	body     []node
+}
+
+func (n *macroNode) render(s *scope, _ *writer) error {
+	s.vars[n.name] = function(func(args []any, kwargs map[string]any) (any, error) {
+		if len(args) > len(n.params) {
+			return nil, fmt.Errorf("macro %s takes %d arguments, got %d", n.name, len(n.params), len(args))
+		}
+
+		inner := newScope(s)
+		for i, param := range n.params {
+			v, ok := kwargs[param]
+			switch {
+			case i < len(args):
+				v = args[i]
+			case ok:
+			case n.defaults[i] != nil:
+				var err error
+				if v, err = n.defaults[i].eval(inner); err != nil {
+					return nil, err
+				}
+			default:
+				v = undefined{param}
+			}
+
+			inner.vars[param] = v
+		}
+
+		var sb writer
+		if err := render(n.body, inner, &sb); err != nil {
+			return nil, err
+		}
+
+		return sb.String(), nil
+	})
+
+	return nil
+}
+
+type literal struct {
+	v any
+}
+
+func (x literal) eval(*scope) (any, error) {
+	return x.v, nil
+}
+
+type nameExpr string
+
+func (x nameExpr) eval(s *scope) (any, error) {
+	if v, ok := s.lookup(string(x)); ok {
+		return v, nil
+	}
+
+	return undefined{string(x)}, nil
+}
+
+type listExpr []expr
+
+func (x listExpr) eval(s *scope) (any, error) {
+	items := make([]any, len(x))
+	for i, item := range x {
+		v, err := item.eval(s)
+		if err != nil {
+			return nil, err
+		}
+
+		items[i] = v
+	}
+
+	return items, nil
+}
+
+type dictExpr struct {
+	keys, values []expr
+}
+
+func (x *dictExpr) eval(s *scope) (any, error) {
+	d := make(map[string]any, len(x.keys))
+	for i := range x.keys {
+		k, err := x.keys[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings, not %s", typeName(k))
+		}
+
+		if d[key], err = x.values[i].eval(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+type attrExpr struct {
+	x    expr
+	name string
+}
+
+func (x *attrExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return attr(v, x.name), nil
+}
+
+type indexExpr struct {
+	x, index expr
+}
+
+func (x *indexExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := x.index.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return item(v, i)
+}
+
+type sliceExpr struct {
+	x                 expr
+	start, stop, step expr
+}
+
+func (x *sliceExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds [3]*int
+	for i, e := range []expr{x.start, x.stop, x.step} {
+		if e == nil {
+			continue
+		}
+
+		b, err := e.eval(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if b == nil {
+			continue
+		}
+
+		n, ok := b.(int)
+		if !ok {
+			return nil, fmt.Errorf("slice indices must be integers, not %s", typeName(b))
+		}
+
+		bounds[i] = &n
+	}
+
+	return slice(v, bounds[0], bounds[1], bounds[2])
+}
+
+type keyword struct {
+	name string
+	x    expr
+}
+
+func evalArgs(s *scope, args []expr, kwargs []keyword) ([]any, map[string]any, error) {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		v, err := arg.eval(s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		values[i] = v
+	}
+
+	named := make(map[string]any, len(kwargs))
+	for _, kw := range kwargs {
+		v, err := kw.x.eval(s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		named[kw.name] = v
+	}
+
+	return values, named, nil
+}
+
+type callExpr struct {
+	fn     expr
+	args   []expr
+	kwargs []keyword
+}
+
+func (x *callExpr) eval(s *scope) (any, error) {
+	args, kwargs, err := evalArgs(s, x.args, x.kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	// methods of strings, lists and dicts are looked up before their items
+	if a, ok := x.fn.(*attrExpr); ok {
+		v, err := a.x.eval(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if m, ok := method(v, a.name); ok {
+			return m(args, kwargs)
+		}
+
+		fn, ok := attr(v, a.name).(function)
+		if !ok {
+			return nil, fmt.Errorf("%s has no method %q", typeName(v), a.name)
+		}
+
+		return fn(args, kwargs)
+	}
+
+	v, err := x.fn.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := v.(function)
+	if !ok {
+		if u, ok := v.(undefined); ok {
+			return nil, fmt.Errorf("%q is undefined", u.name)
+		}
+
+		return nil, fmt.Errorf("%s is not callable", typeName(v))
+	}
+
+	return fn(args, kwargs)
+}
+
+type filterExpr struct {
+	x      expr
+	name   string
+	fn     filter
+	args   []expr
+	kwargs []keyword
+}
+
+func (x *filterExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	args, kwargs, err := evalArgs(s, x.args, x.kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = x.fn(v, args, kwargs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", x.name, err)
+	}
+
+	return v, nil
+}
+
+type testExpr struct {
+	x      expr
+	name   string
+	fn     test
+	args   []expr
+	negate bool
+}
+
+func (x *testExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	args, _, err := evalArgs(s, x.args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := x.fn(v, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", x.name, err)
+	}
+
+	return ok != x.negate, nil
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (x *unaryExpr) eval(s *scope) (any, error) {
+	v, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.op == "not" {
+		return !truthy(v), nil
+	}
+
+	switch v := v.(type) {
+	case int:
+		if x.op == "-" {
+			return -v, nil
+		}
+
+		return v, nil
+	case float64:
+		if x.op == "-" {
+			return -v, nil
+		}
+
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("bad operand type for unary %s: %s", x.op, typeName(v))
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (x *binaryExpr) eval(s *scope) (any, error) {
+	a, err := x.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// and and or return the operand which decided the result
+	switch {
+	case x.op == "and" && !truthy(a), x.op == "or" && truthy(a):
+		return a, nil
+	}
+
+	b, err := x.y.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.op {
+	case "and", "or":
+		return b, nil
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(a, b)
+		if err != nil {
+			return nil, err
+		}
+
+		switch x.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "in":
+		return contains(b, a)
+	case "not in":
+		ok, err := contains(b, a)
+		return !ok, err
+	case "~":
+		return str(a) + str(b), nil
+	default:
+		return arithmetic(x.op, a, b)
+	}
+}
+
+type condExpr struct {
+	then, cond, els expr
+}
+
+func (x *condExpr) eval(s *scope) (any, error) {
+	c, err := x.cond.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if truthy(c) {
+		return x.then.eval(s)
+	}
+
+	if x.els == nil {
+		return undefined{}, nil
+	}
+
+	return x.els.eval(s)
+}
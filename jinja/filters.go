@@ -0,0 +1,753 @@
+package jinja
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// filter is applied to a value with "|"
+type filter func(v any, args []any, kwargs map[string]any) (any, error)
+
+// test checks a value with "is"
+type test func(v any, args []any) (bool, error)
+
+// filters are the filters used by Hugging Face chat templates. Unknown
+// filters are reported when a template is parsed.
+var filters map[string]filter
+
+// tests are the tests used by Hugging Face chat templates.
+var tests map[string]test
+
+// globals are the functions Hugging Face provides to chat templates.
+var globals map[string]any
+
+func init() {
+	filters = map[string]filter{
+		"abs":        absFilter,
+		"capitalize": stringFilter(capitalize),
+		"count":      lengthFilter,
+		"d":          defaultFilter,
+		"default":    defaultFilter,
+		"first":      firstFilter,
+		"float":      floatFilter,
+		"indent":     indentFilter,
+		"int":        intFilter,
+		"items":      itemsFilter,
+		"join":       joinFilter,
+		"last":       lastFilter,
+		"length":     lengthFilter,
+		"list":       listFilter,
+		"lower":      stringFilter(strings.ToLower),
+		"map":        mapFilter,
+		"reject":     selectFilter(false),
+		"rejectattr": selectAttrFilter(false),
+		"replace":    replaceFilter,
+		"reverse":    reverseFilter,
+		"round":      roundFilter,
+		"safe":       func(v any, _ []any, _ map[string]any) (any, error) { return v, nil },
+		"select":     selectFilter(true),
+		"selectattr": selectAttrFilter(true),
+		"string":     func(v any, _ []any, _ map[string]any) (any, error) { return str(v), nil },
+		"title":      stringFilter(title),
+		"tojson":     tojsonFilter,
+		"trim":       trimFilter,
+		"upper":      stringFilter(strings.ToUpper),
+	}
+
+	tests = map[string]test{
+		"boolean":     typeTest(func(v any) bool { _, ok := v.(bool); return ok }),
+		"callable":    typeTest(func(v any) bool { _, ok := v.(function); return ok }),
+		"defined":     typeTest(func(v any) bool { _, ok := v.(undefined); return !ok }),
+		"divisibleby": divisibleByTest,
+		"eq":          equalTest,
+		"equalto":     equalTest,
+		"==":          equalTest,
+		"even":        typeTest(func(v any) bool { i, ok := v.(int); return ok && i%2 == 0 }),
+		"false":       typeTest(func(v any) bool { b, ok := v.(bool); return ok && !b }),
+		"float":       typeTest(func(v any) bool { _, ok := v.(float64); return ok }),
+		"ge":          compareTest(func(c int) bool { return c >= 0 }),
+		"gt":          compareTest(func(c int) bool { return c > 0 }),
+		"in":          inTest,
+		"integer":     typeTest(func(v any) bool { _, ok := v.(int); return ok }),
+		"iterable":    typeTest(isIterable),
+		"le":          compareTest(func(c int) bool { return c <= 0 }),
+		"lower":       typeTest(func(v any) bool { s, ok := v.(string); return ok && s == strings.ToLower(s) }),
+		"lt":          compareTest(func(c int) bool { return c < 0 }),
+		"mapping":     typeTest(func(v any) bool { _, ok := v.(map[string]any); return ok }),
+		"ne":          func(v any, args []any) (bool, error) { ok, err := equalTest(v, args); return !ok, err },
+		"none":        typeTest(func(v any) bool { return v == nil }),
+		"number":      typeTest(func(v any) bool { _, ok := v.(int); _, f := v.(float64); return ok || f }),
+		"odd":         typeTest(func(v any) bool { i, ok := v.(int); return ok && i%2 != 0 }),
+		"sequence":    typeTest(isIterable),
+		"string":      typeTest(func(v any) bool { _, ok := v.(string); return ok }),
+		"true":        typeTest(func(v any) bool { b, ok := v.(bool); return ok && b }),
+		"undefined":   typeTest(func(v any) bool { _, ok := v.(undefined); return ok }),
+		"upper":       typeTest(func(v any) bool { s, ok := v.(string); return ok && s == strings.ToUpper(s) }),
+	}
+
+	globals = map[string]any{
+		"dict": function(func(args []any, kwargs map[string]any) (any, error) {
+			return kwargs, nil
+		}),
+		"namespace": function(func(args []any, kwargs map[string]any) (any, error) {
+			ns := &namespace{vars: make(map[string]any)}
+			for _, arg := range args {
+				d, ok := arg.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("namespace: expected a dict, got %s", typeName(arg))
+				}
+
+				for k, v := range d {
+					ns.vars[k] = v
+				}
+			}
+
+			for k, v := range kwargs {
+				ns.vars[k] = v
+			}
+
+			return ns, nil
+		}),
+		"raise_exception": function(func(args []any, _ map[string]any) (any, error) {
+			var message string
+			if len(args) > 0 {
+				message = str(args[0])
+			}
+
+			return nil, &Exception{Message: message}
+		}),
+		"range":        function(rangeFunc),
+		"strftime_now": function(strftimeNow),
+	}
+}
+
+// Exception is the error of a template which called raise_exception, e.g.
+// because the roles of the messages don't alternate.
+type Exception struct {
+	Message string
+}
+
+func (e *Exception) Error() string {
+	return e.Message
+}
+
+// arg returns the i'th positional argument or the keyword argument name,
+// or def if neither is set.
+func arg(args []any, kwargs map[string]any, i int, name string, def any) any {
+	if i < len(args) {
+		return args[i]
+	}
+
+	if v, ok := kwargs[name]; ok {
+		return v
+	}
+
+	return def
+}
+
+func stringFilter(fn func(string) string) filter {
+	return func(v any, _ []any, _ map[string]any) (any, error) {
+		return fn(str(v)), nil
+	}
+}
+
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[n:])
+}
+
+// title capitalizes the first letter of every word like Python's str.title.
+func title(s string) string {
+	var sb strings.Builder
+	prev := false
+	for _, r := range s {
+		if prev {
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(unicode.ToUpper(r))
+		}
+
+		prev = unicode.IsLetter(r)
+	}
+
+	return sb.String()
+}
+
+func absFilter(v any, _ []any, _ map[string]any) (any, error) {
+	switch v := v.(type) {
+	case int:
+		return max(v, -v), nil
+	case float64:
+		return math.Abs(v), nil
+	}
+
+	return nil, fmt.Errorf("bad operand type for abs: %s", typeName(v))
+}
+
+func length(v any) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return utf8.RuneCountInString(v), nil
+	case []any:
+		return len(v), nil
+	case map[string]any:
+		return len(v), nil
+	case undefined:
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("object of type %s has no length", typeName(v))
+}
+
+func lengthFilter(v any, _ []any, _ map[string]any) (any, error) {
+	return length(v)
+}
+
+func defaultFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	_, isUndefined := v.(undefined)
+	if isUndefined || truthy(arg(args, kwargs, 1, "boolean", false)) && !truthy(v) {
+		return arg(args, kwargs, 0, "default_value", ""), nil
+	}
+
+	return v, nil
+}
+
+func firstFilter(v any, _ []any, _ map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return undefined{}, nil
+	}
+
+	return items[0], nil
+}
+
+func lastFilter(v any, _ []any, _ map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return undefined{}, nil
+	}
+
+	return items[len(items)-1], nil
+}
+
+func intFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, nil
+		}
+
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int(f), nil
+		}
+	}
+
+	return arg(args, kwargs, 0, "default", 0), nil
+}
+
+func floatFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return arg(args, kwargs, 0, "default", 0.0), nil
+}
+
+func indentFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	indent := arg(args, kwargs, 0, "width", 4)
+	prefix, ok := indent.(string)
+	if !ok {
+		n, ok := indent.(int)
+		if !ok {
+			return nil, fmt.Errorf("width must be an int or a string, not %s", typeName(indent))
+		}
+
+		prefix = strings.Repeat(" ", n)
+	}
+
+	first := truthy(arg(args, kwargs, 1, "first", false))
+	blank := truthy(arg(args, kwargs, 2, "blank", false))
+
+	lines := strings.Split(str(v), "\n")
+	for i, line := range lines {
+		if (i > 0 || first) && (blank || strings.TrimSpace(line) != "") {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// itemsFilter returns the [key, value] pairs of a dict.
+func itemsFilter(v any, _ []any, _ map[string]any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		items := make([]any, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			items = append(items, []any{k, v[k]})
+		}
+
+		return items, nil
+	case undefined:
+		return []any{}, nil
+	}
+
+	return nil, fmt.Errorf("can only get items of a dict, not %s", typeName(v))
+}
+
+func joinFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	attribute, hasAttribute := kwargs["attribute"]
+	parts := make([]string, len(items))
+	for i, item := range items {
+		if hasAttribute {
+			item = attr(item, str(attribute))
+		}
+
+		parts[i] = str(item)
+	}
+
+	return strings.Join(parts, str(arg(args, kwargs, 0, "d", ""))), nil
+}
+
+func listFilter(v any, _ []any, _ map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(items), nil
+}
+
+// mapFilter applies a filter to each item or gets an attribute of each with
+// map(attribute="name").
+func mapFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make([]any, len(items))
+	if attribute, ok := kwargs["attribute"]; ok {
+		def, hasDefault := kwargs["default"]
+		for i, item := range items {
+			mapped[i] = attr(item, str(attribute))
+			if _, ok := mapped[i].(undefined); ok && hasDefault {
+				mapped[i] = def
+			}
+		}
+
+		return mapped, nil
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("expected a filter or attribute to map")
+	}
+
+	name := str(args[0])
+	fn, ok := filters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q", name)
+	}
+
+	for i, item := range items {
+		if mapped[i], err = fn(item, args[1:], nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return mapped, nil
+}
+
+// check applies the test named by args[0] with the rest of args to v, or
+// checks that v is true if there's no test.
+func check(v any, args []any) (bool, error) {
+	if len(args) == 0 {
+		return truthy(v), nil
+	}
+
+	name := str(args[0])
+	fn, ok := tests[name]
+	if !ok {
+		return false, fmt.Errorf("unknown test %q", name)
+	}
+
+	return fn(v, args[1:])
+}
+
+func selectFilter(keep bool) filter {
+	return func(v any, args []any, _ map[string]any) (any, error) {
+		items, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+
+		selected := []any{}
+		for _, item := range items {
+			ok, err := check(item, args)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok == keep {
+				selected = append(selected, item)
+			}
+		}
+
+		return selected, nil
+	}
+}
+
+func selectAttrFilter(keep bool) filter {
+	return func(v any, args []any, _ map[string]any) (any, error) {
+		if len(args) == 0 {
+			return nil, errors.New("missing attribute")
+		}
+
+		items, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+
+		selected := []any{}
+		for _, item := range items {
+			ok, err := check(attr(item, str(args[0])), args[1:])
+			if err != nil {
+				return nil, err
+			}
+
+			if ok == keep {
+				selected = append(selected, item)
+			}
+		}
+
+		return selected, nil
+	}
+}
+
+func replaceFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	if len(args) < 2 {
+		return nil, errors.New("expected the old and new strings")
+	}
+
+	n := -1
+	if count, ok := arg(args, kwargs, 2, "count", -1).(int); ok {
+		n = count
+	}
+
+	return strings.Replace(str(v), str(args[0]), str(args[1]), n), nil
+}
+
+func reverseFilter(v any, _ []any, _ map[string]any) (any, error) {
+	items, err := iterate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := slices.Clone(items)
+	slices.Reverse(reversed)
+	if _, ok := v.(string); ok {
+		var sb strings.Builder
+		for _, item := range reversed {
+			sb.WriteString(item.(string))
+		}
+
+		return sb.String(), nil
+	}
+
+	return reversed, nil
+}
+
+func roundFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	f, ok := number(v)
+	if !ok {
+		return nil, fmt.Errorf("can't round %s", typeName(v))
+	}
+
+	precision, ok := arg(args, kwargs, 0, "precision", 0).(int)
+	if !ok {
+		return nil, errors.New("precision must be an int")
+	}
+
+	scale := math.Pow(10, float64(precision))
+	switch method := str(arg(args, kwargs, 1, "method", "common")); method {
+	case "common":
+		return math.Round(f*scale) / scale, nil
+	case "ceil":
+		return math.Ceil(f*scale) / scale, nil
+	case "floor":
+		return math.Floor(f*scale) / scale, nil
+	default:
+		return nil, fmt.Errorf("unknown rounding method %q", method)
+	}
+}
+
+func trimFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	if chars, ok := arg(args, kwargs, 0, "chars", nil).(string); ok {
+		return strings.Trim(str(v), chars), nil
+	}
+
+	return strings.TrimSpace(str(v)), nil
+}
+
+// tojsonFilter encodes v like Hugging Face's tojson which, unlike Jinja's,
+// doesn't escape HTML or sort keys. Dicts here aren't ordered so keys are
+// sorted anyway.
+func tojsonFilter(v any, args []any, kwargs map[string]any) (any, error) {
+	var indent string
+	switch n := arg(args, kwargs, 0, "indent", nil).(type) {
+	case nil:
+	case int:
+		indent = strings.Repeat(" ", n)
+	case string:
+		indent = n
+	default:
+		return nil, fmt.Errorf("indent must be an int, not %s", typeName(n))
+	}
+
+	var sb strings.Builder
+	if err := writeJSON(&sb, v, indent, 0); err != nil {
+		return nil, err
+	}
+
+	return sb.String(), nil
+}
+
+// writeJSON writes v as JSON with Python's separators: ", " and ": ", or
+// "," and newlines if it's indented.
+func writeJSON(sb *strings.Builder, v any, indent string, depth int) error {
+	newline := func(depth int) {
+		if indent != "" {
+			sb.WriteByte('\n')
+			sb.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	separator := ", "
+	if indent != "" {
+		separator = ","
+	}
+
+	switch v := v.(type) {
+	case nil, undefined:
+		sb.WriteString("null")
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case int:
+		sb.WriteString(strconv.Itoa(v))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("%v is out of range for JSON", v)
+		}
+
+		sb.WriteString(formatFloat(v))
+	case string:
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+
+		sb.WriteString(strings.TrimSuffix(b.String(), "\n"))
+	case []any:
+		sb.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				sb.WriteString(separator)
+			}
+
+			newline(depth + 1)
+			if err := writeJSON(sb, item, indent, depth+1); err != nil {
+				return err
+			}
+		}
+
+		if len(v) > 0 {
+			newline(depth)
+		}
+
+		sb.WriteByte(']')
+	case map[string]any, *namespace:
+		d, ok := v.(map[string]any)
+		if !ok {
+			d = v.(*namespace).vars
+		}
+
+		sb.WriteByte('{')
+		for i, k := range sortedKeys(d) {
+			if i > 0 {
+				sb.WriteString(separator)
+			}
+
+			newline(depth + 1)
+			if err := writeJSON(sb, k, indent, depth+1); err != nil {
+				return err
+			}
+
+			sb.WriteString(": ")
+			if err := writeJSON(sb, d[k], indent, depth+1); err != nil {
+				return err
+			}
+		}
+
+		if len(d) > 0 {
+			newline(depth)
+		}
+
+		sb.WriteByte('}')
+	default:
+		return fmt.Errorf("%s is not JSON serializable", typeName(v))
+	}
+
+	return nil
+}
+
+func typeTest(fn func(any) bool) test {
+	return func(v any, _ []any) (bool, error) {
+		return fn(v), nil
+	}
+}
+
+func isIterable(v any) bool {
+	switch v.(type) {
+	case string, []any, map[string]any:
+		return true
+	}
+
+	return false
+}
+
+func equalTest(v any, args []any) (bool, error) {
+	if len(args) != 1 {
+		return false, errors.New("expected a value to compare with")
+	}
+
+	return equal(v, args[0]), nil
+}
+
+func compareTest(fn func(int) bool) test {
+	return func(v any, args []any) (bool, error) {
+		if len(args) != 1 {
+			return false, errors.New("expected a value to compare with")
+		}
+
+		c, err := compare(v, args[0])
+		if err != nil {
+			return false, err
+		}
+
+		return fn(c), nil
+	}
+}
+
+func divisibleByTest(v any, args []any) (bool, error) {
+	if len(args) != 1 {
+		return false, errors.New("expected a divisor")
+	}
+
+	i, ok := v.(int)
+	n, nok := args[0].(int)
+	if !ok || !nok || n == 0 {
+		return false, nil
+	}
+
+	return i%n == 0, nil
+}
+
+func inTest(v any, args []any) (bool, error) {
+	if len(args) != 1 {
+		return false, errors.New("expected a container")
+	}
+
+	return contains(args[0], v)
+}
+
+func rangeFunc(args []any, _ map[string]any) (any, error) {
+	bounds := make([]int, len(args))
+	for i, arg := range args {
+		n, ok := arg.(int)
+		if !ok {
+			return nil, fmt.Errorf("range: expected an int, got %s", typeName(arg))
+		}
+
+		bounds[i] = n
+	}
+
+	start, stop, step := 0, 0, 1
+	switch len(bounds) {
+	case 1:
+		stop = bounds[0]
+	case 2:
+		start, stop = bounds[0], bounds[1]
+	case 3:
+		start, stop, step = bounds[0], bounds[1], bounds[2]
+	default:
+		return nil, fmt.Errorf("range: expected 1 to 3 arguments, got %d", len(args))
+	}
+
+	if step == 0 {
+		return nil, errors.New("range: step must not be zero")
+	}
+
+	items := []any{}
+	for i := start; step > 0 && i < stop || step < 0 && i > stop; i += step {
+		items = append(items, i)
+	}
+
+	return items, nil
+}
+
+// strftimeLayouts maps Python's strftime directives to Go layouts
+var strftimeLayouts = strings.NewReplacer(
+	"%a", "Mon", "%A", "Monday", "%b", "Jan", "%B", "January",
+	"%d", "02", "%H", "15", "%I", "03", "%m", "01", "%M", "04",
+	"%p", "PM", "%S", "05", "%y", "06", "%Y", "2006", "%Z", "MST",
+	"%z", "-0700", "%%", "%",
+)
+
+func strftimeNow(args []any, _ map[string]any) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("strftime_now: expected a format")
+	}
+
+	return time.Now().Format(strftimeLayouts.Replace(str(args[0]))), nil
+}
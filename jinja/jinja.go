@@ -0,0 +1,55 @@
+// Package jinja renders the subset of Jinja used by Hugging Face chat
+// templates. It supports if, for (with loop, else, break and continue), set,
+// namespaces, macros, the usual expressions and the filters, tests and
+// globals such as raise_exception that chat templates use.
+//
+// Templates are rendered the way Hugging Face renders them: trim_blocks and
+// lstrip_blocks are on and nothing is escaped.
+package jinja
+
+import (
+	"fmt"
+	"io"
+)
+
+// Template is a parsed template.
+type Template struct {
+	nodes []node
+}
+
+// Error is an error in a template with the line it's on.
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Parse parses a template. Unknown tags, filters and tests are errors.
+func Parse(s string) (*Template, error) {
+	nodes, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{nodes: nodes}, nil
+}
+
+// Execute renders t to w with the variables in vars. An *Exception is
+// returned if the template calls raise_exception.
+func (t *Template) Execute(w io.Writer, vars map[string]any) error {
+	s := newScope(nil)
+	for k, v := range vars {
+		s.vars[k] = normalize(v)
+	}
+
+	var sb writer
+	if err := render(t.nodes, s, &sb); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
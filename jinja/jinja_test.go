@@ -0,0 +1,189 @@
+package jinja
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func execute(t *testing.T, template string, vars map[string]any) (string, error) {
+	t.Helper()
+
+	tmpl, err := Parse(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	err = tmpl.Execute(&sb, vars)
+	return sb.String(), err
+}
+
+func TestExecute(t *testing.T) {
+	messages := []map[string]any{
+		{"role": "system", "content": "You are a Wizard."},
+		{"role": "user", "content": "What are the potion ingredients?"},
+		{"role": "assistant", "content": " I don't know. "},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"text", "hello", "hello"},
+		{"variable", "{{ bos_token }}{{ missing }}", "<s>"},
+		{"literals", "{{ 1 }} {{ 1.5 }} {{ 'a' \"b\" }} {{ true }} {{ none }} {{ [1, 'a'] }} {{ {'a': 1} }}", "1 1.5 ab True None [1, 'a'] {'a': 1}"},
+		{"arithmetic", "{{ 1 + 2 * 3 }} {{ 7 // 2 }} {{ -7 // 2 }} {{ 7 % 3 }} {{ 7 / 2 }} {{ 2 ** 3 }} {{ 'a' ~ 1 }} {{ 'ab' * 2 }}", "7 3 -4 1 3.5 8 a1 abab"},
+		{"comparison", "{{ 1 < 2 }} {{ 'a' == 'b' }} {{ 'a' in 'abc' }} {{ 3 not in [1, 2] }} {{ 1 == 1.0 }}", "True False True True True"},
+		{"logic", "{{ none or 'x' }} {{ 'y' and 0 }} {{ not [] }}", "x 0 True"},
+		{"conditional expression", "{{ 'a' if messages else 'b' }}{{ 'c' if false }}", "a"},
+		{"index", "{{ messages[0]['role'] }} {{ messages[-1].role }} {{ messages[5] is defined }}", "system assistant False"},
+		{"slice", "{{ messages[1:] | length }} {{ 'abcd'[::-1] }} {{ [1, 2, 3][:-1] }}", "2 dcba [1, 2]"},
+		{"if", "{% if messages[0].role == 'user' %}user{% elif messages[0].role == 'system' %}system{% else %}other{% endif %}", "system"},
+		{"for", "{% for m in messages %}{{ loop.index }}{{ m.role[0] }}{% if not loop.last %},{% endif %}{% endfor %}", "1s,2u,3a"},
+		{"for filter", "{% for m in messages if m.role != 'system' %}{{ loop.index0 }}{{ m.role }}{% endfor %}", "0user1assistant"},
+		{"for else", "{% for m in [] %}x{% else %}empty{% endfor %}", "empty"},
+		{"for unpack", "{% for k, v in {'b': 2, 'a': 1}.items() %}{{ k }}={{ v }};{% endfor %}", "a=1;b=2;"},
+		{"break and continue", "{% for i in range(10) %}{% if i == 1 %}{% continue %}{% endif %}{% if i == 4 %}{% break %}{% endif %}{{ i }}{% endfor %}", "023"},
+		{"loop scope", "{% set x = 1 %}{% for i in [1, 2] %}{% set x = x + i %}{% endfor %}{{ x }}", "1"},
+		{"namespace", "{% set ns = namespace(found=false) %}{% for m in messages %}{% if m.role == 'user' %}{% set ns.found = true %}{% endif %}{% endfor %}{{ ns.found }}", "True"},
+		{"set block", "{% set x %}a{{ 1 }}{% endset %}{{ x }}", "a1"},
+		{"set tuple", "{% set a, b = 1, 2 %}{{ a }}{{ b }}", "12"},
+		{"macro", "{% macro tag(name, open=true) %}<{{ '' if open else '/' }}{{ name }}>{% endmacro %}{{ tag('a') }}{{ tag('a', open=false) }}", "<a></a>"},
+		{"filters", "{{ messages[2].content | trim }}|{{ 'ab' | upper }}|{{ 'hello world' | title }}|{{ [1, 2] | join(', ') }}|{{ missing | default('d') }}|{{ messages | map(attribute='role') | join }}", "I don't know.|AB|Hello World|1, 2|d|systemuserassistant"},
+		{"selectattr", "{{ messages | selectattr('role', 'equalto', 'user') | list | length }} {{ messages | rejectattr('role', 'eq', 'user') | map(attribute='role') | first }}", "1 system"},
+		{"tojson", "{{ {'b': [1, 'x'], 'a': none} | tojson }} {{ '<\"é\">' | tojson }} {{ {'a': [1]} | tojson(indent=2) }}", "{\"a\": null, \"b\": [1, \"x\"]} \"<\\\"é\\\">\" {\n  \"a\": [\n    1\n  ]\n}"},
+		{"tests", "{{ 1 is number }} {{ 'a' is string }} {{ none is none }} {{ 4 is divisibleby 2 }} {{ messages is not mapping }} {{ 3 is odd }}", "True True True True True True"},
+		{"methods", "{{ ' a '.strip() }}|{{ 'xay'.lstrip('x') }}|{{ 'abc'.startswith(('x', 'a')) }}|{{ 'a b  c'.split() }}|{{ 'a,b'.split(',') }}|{{ {'a': 1}.get('b', 2) }}|{{ '-'.join(['a', 'b']) }}", "a|ay|True|['a', 'b', 'c']|['a', 'b']|2|a-b"},
+		{"loop cycle", "{% for i in range(3) %}{{ loop.cycle('a', 'b') }}{% endfor %}", "aba"},
+		{"raw", "{% raw %}{{ x }}{% endraw %}", "{{ x }}"},
+		{"comment", "a{# comment #}b", "ab"},
+		{"generation", "{% generation %}{{ messages | length }}{% endgeneration %}", "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execute(t, tt.template, map[string]any{"messages": messages, "bos_token": "<s>"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhitespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"trim blocks", "{% if true %}\na\n{% endif %}\nb", "a\nb"},
+		{"lstrip blocks", "  {% if true %}\n  a\n  {% endif %}\n", "  a\n"},
+		{"indented block after text", "x {% if true %}a{% endif %}", "x a"},
+		{"variables aren't trimmed", "{{ 'a' }}\n  {{ 'b' }}", "a\n  b"},
+		{"minus", "a  {%- if true -%}  b  {%- endif -%}  c", "abc"},
+		{"minus variable", "a\n{{- 'b' -}}\nc", "abc"},
+		{"plus", "  {%+ if true %}a{% endif %}", "  a"},
+		{"comment", "{# comment #}\na", "a"},
+		{"crlf", "{% if true %}\r\na\r\n{% endif %}\r\n", "a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execute(t, tt.template, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatTemplate(t *testing.T) {
+	// mistral-instruct's chat template
+	template := "{{ bos_token }}{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if message['role'] == 'user' %}{{ '[INST] ' + message['content'] + ' [/INST]' }}{% elif message['role'] == 'assistant' %}{{ message['content'] + eos_token}}{% else %}{{ raise_exception('Only user and assistant roles are supported!') }}{% endif %}{% endfor %}"
+
+	vars := map[string]any{
+		"bos_token": "<s>",
+		"eos_token": "</s>",
+		"messages": []map[string]any{
+			{"role": "user", "content": "Hello"},
+			{"role": "assistant", "content": "Hi!"},
+			{"role": "user", "content": "How are you?"},
+		},
+		"add_generation_prompt": true,
+	}
+
+	got, err := execute(t, template, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<s>[INST] Hello [/INST]Hi!</s>[INST] How are you? [/INST]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	vars["messages"] = []map[string]any{{"role": "assistant", "content": "Hi!"}}
+	_, err = execute(t, template, vars)
+
+	var e *Exception
+	if !errors.As(err, &e) || e.Message != "Conversation roles must alternate user/assistant/user/assistant/..." {
+		t.Errorf("expected an exception, got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{% if true %}a", `line 1: unexpected end of template, expected "{% endif %}"`},
+		{"a\n{{ x | nope }}", `line 2: unknown filter "nope"`},
+		{"{{ x is nope }}", `line 1: unknown test "nope"`},
+		{"{% include 'x' %}", `line 1: unknown tag "include"`},
+		{"{{ x", `line 1: unclosed tag, expected "}}"`},
+		{"{{ 'x }}", "line 1: unterminated string"},
+		{"{{ x y }}", `line 1: expected "}}", found "y"`},
+		{"{% for x of y %}{% endfor %}", `line 1: expected "in", found "of"`},
+		{"{{ a ? b }}", `line 1: unexpected character '?'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			_, err := Parse(tt.template)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"\n{{ 'a' + 1 }}", "line 2: unsupported operand types for +: str and int"},
+		{"{{ missing() }}", `line 1: "missing" is undefined`},
+		{"{% for x in 1 %}{% endfor %}", "line 1: int is not iterable"},
+		{"{% set x = 1 %}{% set x.y = 2 %}", `line 1: cannot set attribute "y" of int, only of a namespace`},
+		{"{{ raise_exception('bad ' ~ 1) }}", "bad 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			_, err := execute(t, tt.template, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
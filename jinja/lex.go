@@ -0,0 +1,331 @@
+package jinja
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenText
+	tokenVarBegin
+	tokenVarEnd
+	tokenBlockBegin
+	tokenBlockEnd
+	tokenName
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenOp
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of template"
+	case tokenText:
+		return "text"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	}
+
+	return fmt.Sprintf("%q", t.value)
+}
+
+// operators are ordered so longer ones are matched first
+var operators = []string{
+	"==", "!=", "<=", ">=", "//", "**",
+	"+", "-", "*", "/", "%", "~", "|", ".", ",", ":", "(", ")", "[", "]", "{", "}", "<", ">", "=",
+}
+
+var endRaw = regexp.MustCompile(`\{%(-?)\s*endraw\s*(-?)%\}`)
+
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	tokens []token
+
+	// trimLeft strips whitespace from the start of the next text after a
+	// tag closed with "-"
+	trimLeft bool
+	// trimNewline strips the first newline after a block or comment tag
+	trimNewline bool
+}
+
+// lex splits src into tokens. Whitespace is handled like Hugging Face does
+// it: trim_blocks and lstrip_blocks are on so block tags on their own line
+// don't leave empty lines behind.
+func lex(src string) ([]token, error) {
+	l := lexer{src: strings.ReplaceAll(src, "\r\n", "\n"), line: 1}
+	for {
+		start := l.pos
+		i := l.nextTag()
+		text := l.src[start:i]
+
+		switch {
+		case l.trimLeft:
+			text = strings.TrimLeft(text, " \t\n")
+		case l.trimNewline && strings.HasPrefix(text, "\n"):
+			text = text[1:]
+			start++
+		}
+
+		l.trimLeft, l.trimNewline = false, false
+
+		if i < len(l.src) {
+			switch marker := l.at(i + 2); {
+			case marker == '-':
+				text = strings.TrimRight(text, " \t\n")
+			case marker != '+' && l.src[i+1] != '{':
+				// lstrip_blocks: remove the indentation before a block tag
+				// that starts its line
+				n := strings.LastIndexByte(text, '\n') + 1
+				if (n > 0 || start == 0 || l.src[start-1] == '\n') && strings.Trim(text[n:], " \t") == "" {
+					text = text[:n]
+				}
+			}
+		}
+
+		if text != "" {
+			l.emit(tokenText, text)
+		}
+
+		l.advance(i)
+		if l.pos >= len(l.src) {
+			l.emit(tokenEOF, "")
+			return l.tokens, nil
+		}
+
+		var err error
+		switch l.src[l.pos+1] {
+		case '#':
+			err = l.comment()
+		case '{':
+			err = l.tag(tokenVarBegin, tokenVarEnd, "}}")
+		case '%':
+			err = l.tag(tokenBlockBegin, tokenBlockEnd, "%}")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *lexer) at(i int) byte {
+	if i < len(l.src) {
+		return l.src[i]
+	}
+
+	return 0
+}
+
+// nextTag returns the position of the next tag or the end of the template.
+func (l *lexer) nextTag() int {
+	for i := l.pos; i+1 < len(l.src); i++ {
+		if l.src[i] == '{' && strings.IndexByte("{%#", l.src[i+1]) >= 0 {
+			return i
+		}
+	}
+
+	return len(l.src)
+}
+
+func (l *lexer) advance(pos int) {
+	l.line += strings.Count(l.src[l.pos:pos], "\n")
+	l.pos = pos
+}
+
+func (l *lexer) emit(kind tokenKind, value string) {
+	l.tokens = append(l.tokens, token{kind, value, l.line})
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return &Error{Line: l.line, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) comment() error {
+	end := strings.Index(l.src[l.pos:], "#}")
+	if end < 0 {
+		return l.errorf("unclosed comment")
+	}
+
+	end += l.pos
+	l.trimLeft = l.src[end-1] == '-'
+	l.trimNewline = true
+	l.advance(end + 2)
+	return nil
+}
+
+// tag lexes the expression of a variable or block tag up to and including
+// the closing delimiter.
+func (l *lexer) tag(begin, end tokenKind, delim string) error {
+	l.emit(begin, l.src[l.pos:l.pos+2])
+	l.advance(l.pos + 2)
+	if c := l.at(l.pos); c == '-' || c == '+' {
+		l.advance(l.pos + 1)
+	}
+
+	first := len(l.tokens)
+	for {
+		l.skipSpace()
+
+		rest := l.src[l.pos:]
+		switch {
+		case rest == "":
+			return l.errorf("unclosed tag, expected %q", delim)
+		case strings.HasPrefix(rest, delim), strings.HasPrefix(rest, "-"+delim):
+			l.trimLeft = rest[0] == '-'
+			l.trimNewline = end == tokenBlockEnd
+			l.emit(end, delim)
+			l.advance(l.pos + strings.Index(rest, delim) + len(delim))
+
+			if end == tokenBlockEnd && len(l.tokens) == first+2 && l.tokens[first].value == "raw" {
+				return l.raw()
+			}
+
+			return nil
+		case rest[0] == '"' || rest[0] == '\'':
+			if err := l.string(); err != nil {
+				return err
+			}
+		case isDigit(rest[0]):
+			l.number()
+		case isNameStart(rest[0]):
+			n := 1
+			for n < len(rest) && isNameChar(rest[n]) {
+				n++
+			}
+
+			l.emit(tokenName, rest[:n])
+			l.advance(l.pos + n)
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(rest, o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return l.errorf("unexpected character %q", rest[0])
+			}
+
+			l.emit(tokenOp, op)
+			l.advance(l.pos + len(op))
+		}
+	}
+}
+
+// raw emits the text up to the next {% endraw %} as is.
+func (l *lexer) raw() error {
+	// drop the "{% raw %}" tokens
+	l.tokens = l.tokens[:len(l.tokens)-3]
+
+	m := endRaw.FindStringSubmatchIndex(l.src[l.pos:])
+	if m == nil {
+		return l.errorf("unclosed raw block")
+	}
+
+	text := l.src[l.pos : l.pos+m[0]]
+	if l.trimLeft {
+		text = strings.TrimLeft(text, " \t\n")
+	} else {
+		text = strings.TrimPrefix(text, "\n")
+	}
+
+	if m[3] > m[2] {
+		text = strings.TrimRight(text, " \t\n")
+	}
+
+	if text != "" {
+		l.emit(tokenText, text)
+	}
+
+	l.trimLeft = m[5] > m[4]
+	l.trimNewline = true
+	l.advance(l.pos + m[1])
+	return nil
+}
+
+func (l *lexer) skipSpace() {
+	n := l.pos
+	for n < len(l.src) && strings.IndexByte(" \t\n", l.src[n]) >= 0 {
+		n++
+	}
+
+	l.advance(n)
+}
+
+func (l *lexer) string() error {
+	quote := l.src[l.pos]
+
+	var sb strings.Builder
+	for i := l.pos + 1; i < len(l.src); i++ {
+		c := l.src[i]
+		switch {
+		case c == quote:
+			l.emit(tokenString, sb.String())
+			l.advance(i + 1)
+			return nil
+		case c == '\\' && i+1 < len(l.src):
+			i++
+			switch c := l.src[i]; c {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '\\', '\'', '"':
+				sb.WriteByte(c)
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return l.errorf("unterminated string")
+}
+
+func (l *lexer) number() {
+	n, kind := l.pos, tokenInt
+	for n < len(l.src) && isDigit(l.src[n]) {
+		n++
+	}
+
+	if l.at(n) == '.' && isDigit(l.at(n+1)) {
+		kind = tokenFloat
+		for n++; n < len(l.src) && isDigit(l.src[n]); n++ {
+		}
+	}
+
+	l.emit(kind, l.src[l.pos:n])
+	l.advance(n)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
@@ -0,0 +1,166 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// whitespace is what Python's str.strip removes by default
+const whitespace = " \t\n\r\v\f"
+
+// method returns the Python method name of v, e.g. str.strip or dict.items.
+func method(v any, name string) (function, bool) {
+	switch v := v.(type) {
+	case string:
+		return stringMethod(v, name)
+	case map[string]any:
+		return dictMethod(v, name)
+	}
+
+	return nil, false
+}
+
+func stringMethod(s, name string) (function, bool) {
+	strip := func(trim func(string, string) string, space func(string) string) function {
+		return func(args []any, _ map[string]any) (any, error) {
+			if chars, ok := arg(args, nil, 0, "", nil).(string); ok {
+				return trim(s, chars), nil
+			}
+
+			return space(s), nil
+		}
+	}
+
+	affix := func(has func(string, string) bool) function {
+		return func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%s: expected 1 argument, got %d", name, len(args))
+			}
+
+			// a tuple checks for any of its strings
+			if items, ok := args[0].([]any); ok {
+				for _, item := range items {
+					if has(s, str(item)) {
+						return true, nil
+					}
+				}
+
+				return false, nil
+			}
+
+			return has(s, str(args[0])), nil
+		}
+	}
+
+	switch name {
+	case "strip":
+		return strip(strings.Trim, strings.TrimSpace), true
+	case "lstrip":
+		return strip(strings.TrimLeft, func(s string) string { return strings.TrimLeft(s, whitespace) }), true
+	case "rstrip":
+		return strip(strings.TrimRight, func(s string) string { return strings.TrimRight(s, whitespace) }), true
+	case "upper":
+		return func([]any, map[string]any) (any, error) { return strings.ToUpper(s), nil }, true
+	case "lower":
+		return func([]any, map[string]any) (any, error) { return strings.ToLower(s), nil }, true
+	case "title":
+		return func([]any, map[string]any) (any, error) { return title(s), nil }, true
+	case "capitalize":
+		return func([]any, map[string]any) (any, error) { return capitalize(s), nil }, true
+	case "startswith":
+		return affix(strings.HasPrefix), true
+	case "endswith":
+		return affix(strings.HasSuffix), true
+	case "split":
+		return func(args []any, kwargs map[string]any) (any, error) {
+			n := -1
+			if i, ok := arg(args, kwargs, 1, "maxsplit", -1).(int); ok && i >= 0 {
+				n = i + 1
+			}
+
+			var parts []string
+			if sep, ok := arg(args, kwargs, 0, "sep", nil).(string); ok {
+				if sep == "" {
+					return nil, errors.New("split: empty separator")
+				}
+
+				parts = strings.SplitN(s, sep, n)
+			} else {
+				parts = fields(s, n)
+			}
+
+			items := make([]any, len(parts))
+			for i, part := range parts {
+				items[i] = part
+			}
+
+			return items, nil
+		}, true
+	case "replace":
+		return func(args []any, kwargs map[string]any) (any, error) {
+			return replaceFilter(s, args, kwargs)
+		}, true
+	case "join":
+		return func(args []any, _ map[string]any) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("join: expected 1 argument, got %d", len(args))
+			}
+
+			return joinFilter(args[0], []any{s}, nil)
+		}, true
+	}
+
+	return nil, false
+}
+
+func dictMethod(d map[string]any, name string) (function, bool) {
+	switch name {
+	case "items":
+		return func([]any, map[string]any) (any, error) { return itemsFilter(d, nil, nil) }, true
+	case "keys":
+		return func([]any, map[string]any) (any, error) { return iterate(d) }, true
+	case "values":
+		return func([]any, map[string]any) (any, error) {
+			values := make([]any, 0, len(d))
+			for _, k := range sortedKeys(d) {
+				values = append(values, d[k])
+			}
+
+			return values, nil
+		}, true
+	case "get":
+		return func(args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("get: expected a key")
+			}
+
+			if k, ok := args[0].(string); ok {
+				if v, ok := d[k]; ok {
+					return v, nil
+				}
+			}
+
+			return arg(args, nil, 1, "", nil), nil
+		}, true
+	}
+
+	return nil, false
+}
+
+// fields splits s at runs of whitespace into at most n parts like Python's
+// str.split without a separator. The last part keeps the rest of s.
+func fields(s string, n int) []string {
+	var parts []string
+	for s = strings.TrimLeft(s, whitespace); s != ""; s = strings.TrimLeft(s, whitespace) {
+		i := strings.IndexAny(s, whitespace)
+		if i < 0 || len(parts) == n-1 {
+			return append(parts, s)
+		}
+
+		parts = append(parts, s[:i])
+		s = s[i:]
+	}
+
+	return parts
+}
@@ -0,0 +1,858 @@
+package jinja
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// node is a statement in a template
+type node interface {
+	render(s *scope, w *writer) error
+}
+
+// expr is an expression in a template
+type expr interface {
+	eval(s *scope) (any, error)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &Error{Line: p.peek().line, Message: fmt.Sprintf(format, args...)}
+}
+
+// is reports whether the next token is the operator or name s.
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == tokenOp || t.kind == tokenName) && t.value == s
+}
+
+// accept consumes the next token if it's the operator or name s.
+func (p *parser) accept(s string) bool {
+	if p.is(s) {
+		p.next()
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %q, found %s", s, p.peek())
+	}
+
+	return nil
+}
+
+func (p *parser) expectKind(kind tokenKind, what string) (token, error) {
+	t := p.peek()
+	if t.kind != kind {
+		return t, p.errorf("expected %s, found %s", what, t)
+	}
+
+	return p.next(), nil
+}
+
+func (p *parser) name() (string, error) {
+	t, err := p.expectKind(tokenName, "name")
+	return t.value, err
+}
+
+func (p *parser) blockEnd() error {
+	_, err := p.expectKind(tokenBlockEnd, "\"%}\"")
+	return err
+}
+
+// body parses statements up to one of the block tags in ends, which is
+// consumed and returned. The rest of that tag is left for the caller.
+func (p *parser) body(ends ...string) ([]node, string, error) {
+	var nodes []node
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokenEOF:
+			if len(ends) > 0 {
+				return nil, "", &Error{Line: t.line, Message: fmt.Sprintf("unexpected end of template, expected \"{%% %s %%}\"", ends[len(ends)-1])}
+			}
+
+			return nodes, "", nil
+		case tokenText:
+			nodes = append(nodes, textNode(t.value))
+		case tokenVarBegin:
+			x, err := p.tuple()
+			if err != nil {
+				return nil, "", err
+			}
+
+			if _, err := p.expectKind(tokenVarEnd, "\"}}\""); err != nil {
+				return nil, "", err
+			}
+
+			nodes = append(nodes, &outputNode{t.line, x})
+		case tokenBlockBegin:
+			tag := p.peek()
+			if tag.kind == tokenName && slices.Contains(ends, tag.value) {
+				p.next()
+				return nodes, tag.value, nil
+			}
+
+			n, err := p.statement()
+			if err != nil {
+				return nil, "", err
+			}
+
+			nodes = append(nodes, n)
+		default:
+			return nil, "", &Error{Line: t.line, Message: fmt.Sprintf("unexpected %s", t)}
+		}
+	}
+}
+
+func (p *parser) statement() (node, error) {
+	tag, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case "if":
+		return p.ifStatement()
+	case "for":
+		return p.forStatement()
+	case "set":
+		return p.setStatement()
+	case "macro":
+		return p.macroStatement()
+	case "break", "continue":
+		if err := p.blockEnd(); err != nil {
+			return nil, err
+		}
+
+		if tag == "break" {
+			return breakNode{}, nil
+		}
+
+		return continueNode{}, nil
+	case "generation":
+		// marks the assistant's turns for training, which doesn't change
+		// the prompt
+		if err := p.blockEnd(); err != nil {
+			return nil, err
+		}
+
+		nodes, _, err := p.body("endgeneration")
+		if err != nil {
+			return nil, err
+		}
+
+		return listNode(nodes), p.blockEnd()
+	}
+
+	p.pos--
+	return nil, p.errorf("unknown tag %q", tag)
+}
+
+func (p *parser) ifStatement() (node, error) {
+	line := p.peek().line
+
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.blockEnd(); err != nil {
+		return nil, err
+	}
+
+	then, end, err := p.body("elif", "else", "endif")
+	if err != nil {
+		return nil, err
+	}
+
+	n := &ifNode{line: line, cond: cond, then: then}
+	switch end {
+	case "elif":
+		elif, err := p.ifStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		n.els = []node{elif}
+		return n, nil
+	case "else":
+		if err := p.blockEnd(); err != nil {
+			return nil, err
+		}
+
+		if n.els, _, err = p.body("endif"); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, p.blockEnd()
+}
+
+func (p *parser) targets() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+		if !p.accept(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) forStatement() (node, error) {
+	n := &forNode{line: p.peek().line}
+
+	var err error
+	if n.vars, err = p.targets(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+
+	// "if" after the iterable filters it rather than starting a conditional
+	if n.iter, err = p.or(); err != nil {
+		return nil, err
+	}
+
+	if p.accept("if") {
+		if n.filter, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.blockEnd(); err != nil {
+		return nil, err
+	}
+
+	body, end, err := p.body("else", "endfor")
+	if err != nil {
+		return nil, err
+	}
+
+	n.body = body
+	if end == "else" {
+		if err := p.blockEnd(); err != nil {
+			return nil, err
+		}
+
+		if n.els, _, err = p.body("endfor"); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, p.blockEnd()
+}
+
+func (p *parser) setStatement() (node, error) {
+	n := &setNode{line: p.peek().line}
+
+	var err error
+	if n.vars, err = p.targets(); err != nil {
+		return nil, err
+	}
+
+	if len(n.vars) == 1 && p.accept(".") {
+		if n.attr, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("=") {
+		if n.value, err = p.tuple(); err != nil {
+			return nil, err
+		}
+
+		return n, p.blockEnd()
+	}
+
+	if len(n.vars) > 1 || n.attr != "" {
+		return nil, p.errorf("expected \"=\", found %s", p.peek())
+	}
+
+	// {% set x %}...{% endset %} sets x to the rendered body
+	if err := p.blockEnd(); err != nil {
+		return nil, err
+	}
+
+	if n.body, _, err = p.body("endset"); err != nil {
+		return nil, err
+	}
+
+	return n, p.blockEnd()
+}
+
+func (p *parser) macroStatement() (node, error) {
+	n := &macroNode{line: p.peek().line}
+
+	var err error
+	if n.name, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for !p.accept(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		var value expr
+		if p.accept("=") {
+			if value, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+
+		n.params = append(n.params, name)
+		n.defaults = append(n.defaults, value)
+
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := p.blockEnd(); err != nil {
+		return nil, err
+	}
+
+	if n.body, _, err = p.body("endmacro"); err != nil {
+		return nil, err
+	}
+
+	// the name may be repeated after endmacro
+	p.accept(n.name)
+	return n, p.blockEnd()
+}
+
+// tuple parses expressions separated by commas. A single expression isn't
+// a tuple.
+func (p *parser) tuple() (expr, error) {
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.is(",") {
+		return x, nil
+	}
+
+	items := []expr{x}
+	for p.accept(",") {
+		if p.isEnd() {
+			break
+		}
+
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, x)
+	}
+
+	return listExpr(items), nil
+}
+
+// isEnd reports whether the next token ends an expression list.
+func (p *parser) isEnd() bool {
+	switch t := p.peek(); t.kind {
+	case tokenVarEnd, tokenBlockEnd, tokenEOF:
+		return true
+	case tokenOp:
+		return t.value == ")" || t.value == "]" || t.value == "}"
+	}
+
+	return false
+}
+
+func (p *parser) expr() (expr, error) {
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("if") {
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		var els expr
+		if p.accept("else") {
+			if els, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+
+		x = &condExpr{then: x, cond: cond, els: els}
+	}
+
+	return x, nil
+}
+
+func (p *parser) or() (expr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("or") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op: "or", x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *parser) and() (expr, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("and") {
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op: "and", x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.accept("not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryExpr{op: "not", x: x}, nil
+	}
+
+	return p.compare()
+}
+
+var comparisons = []string{"==", "!=", "<", "<=", ">", ">=", "in"}
+
+func (p *parser) compare() (expr, error) {
+	x, err := p.math1()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+		switch t := p.peek(); {
+		case (t.kind == tokenOp || t.kind == tokenName) && slices.Contains(comparisons, t.value):
+			op = p.next().value
+		case p.is("not") && p.tokens[p.pos+1].kind == tokenName && p.tokens[p.pos+1].value == "in":
+			p.pos += 2
+			op = "not in"
+		default:
+			return x, nil
+		}
+
+		y, err := p.math1()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+// binary parses left associative operators in ops with operands parsed by
+// operand.
+func (p *parser) binary(operand func() (expr, error), ops ...string) (expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokenOp || !slices.Contains(ops, t.value) {
+			return x, nil
+		}
+
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op: t.value, x: x, y: y}
+	}
+}
+
+func (p *parser) math1() (expr, error) {
+	return p.binary(p.concat, "+", "-")
+}
+
+func (p *parser) concat() (expr, error) {
+	return p.binary(p.math2, "~")
+}
+
+func (p *parser) math2() (expr, error) {
+	return p.binary(p.pow, "*", "/", "//", "%")
+}
+
+func (p *parser) pow() (expr, error) {
+	return p.binary(p.unary, "**")
+}
+
+func (p *parser) unary() (expr, error) {
+	if t := p.peek(); t.kind == tokenOp && (t.value == "-" || t.value == "+") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryExpr{op: t.value, x: x}, nil
+	}
+
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if x, err = p.postfix(x); err != nil {
+		return nil, err
+	}
+
+	return p.filters(x)
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		switch t.value {
+		case "true", "True":
+			return literal{true}, nil
+		case "false", "False":
+			return literal{false}, nil
+		case "none", "None":
+			return literal{nil}, nil
+		}
+
+		return nameExpr(t.value), nil
+	case tokenString:
+		// adjacent strings are joined
+		s := t.value
+		for p.peek().kind == tokenString {
+			s += p.next().value
+		}
+
+		return literal{s}, nil
+	case tokenInt:
+		i, err := strconv.Atoi(t.value)
+		if err != nil {
+			return nil, &Error{Line: t.line, Message: err.Error()}
+		}
+
+		return literal{i}, nil
+	case tokenFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &Error{Line: t.line, Message: err.Error()}
+		}
+
+		return literal{f}, nil
+	case tokenOp:
+		switch t.value {
+		case "(":
+			if p.accept(")") {
+				return listExpr(nil), nil
+			}
+
+			x, err := p.tuple()
+			if err != nil {
+				return nil, err
+			}
+
+			return x, p.expect(")")
+		case "[":
+			var items listExpr
+			for !p.accept("]") {
+				x, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, x)
+				if !p.is("]") {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			return items, nil
+		case "{":
+			var d dictExpr
+			for !p.accept("}") {
+				k, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+
+				v, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+
+				d.keys = append(d.keys, k)
+				d.values = append(d.values, v)
+				if !p.is("}") {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			return &d, nil
+		}
+	}
+
+	p.pos--
+	return nil, p.errorf("unexpected %s", t)
+}
+
+func (p *parser) postfix(x expr) (expr, error) {
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenName && t.kind != tokenInt {
+				p.pos--
+				return nil, p.errorf("expected attribute name, found %s", t)
+			}
+
+			x = &attrExpr{x: x, name: t.value}
+		case p.accept("["):
+			i, err := p.subscript()
+			if err != nil {
+				return nil, err
+			}
+
+			if slice, ok := i.(*sliceExpr); ok {
+				slice.x = x
+				x = slice
+			} else {
+				x = &indexExpr{x: x, index: i}
+			}
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		case p.is("("):
+			p.next()
+			args, kwargs, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+
+			x = &callExpr{fn: x, args: args, kwargs: kwargs}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// subscript parses an index or a slice, start:stop:step, each of which is
+// optional.
+func (p *parser) subscript() (expr, error) {
+	var parts [3]expr
+	var n int
+	for i := range parts {
+		if !p.is(":") && !p.is("]") {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+
+			parts[i] = x
+		}
+
+		if i == 2 || !p.accept(":") {
+			break
+		}
+
+		n++
+	}
+
+	if n == 0 {
+		if parts[0] == nil {
+			return nil, p.errorf("expected index, found %s", p.peek())
+		}
+
+		return parts[0], nil
+	}
+
+	return &sliceExpr{start: parts[0], stop: parts[1], step: parts[2]}, nil
+}
+
+// args parses call arguments up to and including the closing parenthesis.
+func (p *parser) args() ([]expr, []keyword, error) {
+	var args []expr
+	var kwargs []keyword
+	for !p.accept(")") {
+		if t := p.peek(); t.kind == tokenName && p.tokens[p.pos+1].kind == tokenOp && p.tokens[p.pos+1].value == "=" {
+			p.pos += 2
+			x, err := p.expr()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			kwargs = append(kwargs, keyword{t.value, x})
+		} else {
+			x, err := p.expr()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			args = append(args, x)
+		}
+
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return args, kwargs, nil
+}
+
+// filters parses the filters applied to x and tests of it.
+func (p *parser) filters(x expr) (expr, error) {
+	for {
+		switch {
+		case p.accept("|"):
+			t := p.peek()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+
+			fn, ok := filters[name]
+			if !ok {
+				return nil, &Error{Line: t.line, Message: fmt.Sprintf("unknown filter %q", name)}
+			}
+
+			f := &filterExpr{x: x, name: name, fn: fn}
+			if p.accept("(") {
+				if f.args, f.kwargs, err = p.args(); err != nil {
+					return nil, err
+				}
+			}
+
+			x = f
+		case p.accept("is"):
+			negate := p.accept("not")
+			t := p.peek()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+
+			fn, ok := tests[name]
+			if !ok {
+				return nil, &Error{Line: t.line, Message: fmt.Sprintf("unknown test %q", name)}
+			}
+
+			e := &testExpr{x: x, name: name, fn: fn, negate: negate}
+			switch {
+			case p.accept("("):
+				if e.args, _, err = p.args(); err != nil {
+					return nil, err
+				}
+			case p.isTestArg():
+				// a single argument doesn't need parentheses
+				arg, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+
+				if arg, err = p.postfix(arg); err != nil {
+					return nil, err
+				}
+
+				e.args = []expr{arg}
+			}
+
+			x = e
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) isTestArg() bool {
+	switch t := p.peek(); t.kind {
+	case tokenString, tokenInt, tokenFloat:
+		return true
+	case tokenName:
+		return !slices.Contains([]string{"and", "or", "else", "if", "in", "is", "not"}, t.value)
+	}
+
+	return false
+}
+
+// parse parses the template in src.
+func parse(src string) ([]node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	nodes, _, err := p.body()
+	return nodes, err
+}
@@ -0,0 +1,595 @@
+package jinja
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Values in templates are nil (none), bool, int, float64, string, []any,
+// map[string]any and the types below. Lists and tuples are both []any.
+
+// undefined is the value of a variable or attribute which doesn't exist. It
+// renders as an empty string and is false.
+type undefined struct {
+	name string
+}
+
+// function is a global, a macro or a method
+type function func(args []any, kwargs map[string]any) (any, error)
+
+// namespace is an object whose attributes can be set from inside loops
+type namespace struct {
+	vars map[string]any
+}
+
+// normalize converts Go values passed to a template to the types templates
+// work with.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case nil, bool, int, float64, string, undefined, function, *namespace:
+		return v
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+
+		return items
+	case map[string]any:
+		d := make(map[string]any, len(v))
+		for k, item := range v {
+			d[k] = normalize(item)
+		}
+
+		return d
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = normalize(rv.Index(i).Interface())
+		}
+
+		return items
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			d := make(map[string]any, rv.Len())
+			for iter := rv.MapRange(); iter.Next(); {
+				d[iter.Key().String()] = normalize(iter.Value().Interface())
+			}
+
+			return d
+		}
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+
+		return normalize(rv.Elem().Interface())
+	}
+
+	return fmt.Sprint(v)
+}
+
+// typeName returns the Python name of the type of v for errors.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "none"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "dict"
+	case undefined:
+		return "undefined"
+	case function:
+		return "function"
+	case *namespace:
+		return "namespace"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+
+	return true
+}
+
+// str converts v to a string the way Python does.
+func str(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case undefined:
+		return ""
+	}
+
+	return repr(v)
+}
+
+func repr(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	case string:
+		quote := "'"
+		if strings.Contains(v, "'") && !strings.Contains(v, `"`) {
+			quote = `"`
+		}
+
+		r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`, quote, `\`+quote)
+		return quote + r.Replace(v) + quote
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = repr(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		items := make([]string, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			items = append(items, repr(k)+": "+repr(v[k]))
+		}
+
+		return "{" + strings.Join(items, ", ") + "}"
+	case undefined:
+		return ""
+	case *namespace:
+		return "<Namespace " + repr(v.vars) + ">"
+	}
+
+	return fmt.Sprint(v)
+}
+
+// formatFloat formats f like Python's repr.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+
+	if exp := math.Floor(math.Log10(math.Abs(f))); f != 0 && (exp < -4 || exp >= 16) {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		// Python writes at least two exponent digits, e.g. 1e-05
+		if m, e, ok := strings.Cut(s, "e"); ok && len(e) == 2 {
+			s = m + "e" + e[:1] + "0" + e[1:]
+		}
+
+		return s
+	}
+
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+
+	return s
+}
+
+// sortedKeys returns the keys of d in order. Dicts in templates aren't
+// ordered so keys are sorted to render them the same way every time.
+func sortedKeys(d map[string]any) []string {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case undefined:
+		_, ok := b.(undefined)
+		return ok
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, equal)
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+
+		return true
+	case *namespace:
+		return a == b
+	}
+
+	return false
+}
+
+func compare(a, b any) (int, error) {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+
+			return 0, nil
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+// contains reports whether v is in container.
+func contains(container, v any) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires string as left operand, not %s", typeName(v))
+		}
+
+		return strings.Contains(c, s), nil
+	case []any:
+		return slices.ContainsFunc(c, func(item any) bool { return equal(item, v) }), nil
+	case map[string]any:
+		s, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+
+		_, ok = c[s]
+		return ok, nil
+	case undefined:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("argument of type %s is not iterable", typeName(container))
+}
+
+func arithmetic(op string, a, b any) (any, error) {
+	x, xok := a.(int)
+	y, yok := b.(int)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "//", "%":
+			if y == 0 {
+				return nil, errors.New("integer division or modulo by zero")
+			}
+
+			// Python rounds towards negative infinity
+			q, r := x/y, x%y
+			if r != 0 && (r < 0) != (y < 0) {
+				q, r = q-1, r+y
+			}
+
+			if op == "//" {
+				return q, nil
+			}
+
+			return r, nil
+		case "**":
+			if y >= 0 {
+				n := 1
+				for range y {
+					n *= x
+				}
+
+				return n, nil
+			}
+		}
+	}
+
+	if f, ok := number(a); ok {
+		if g, ok := number(b); ok {
+			switch op {
+			case "+":
+				return f + g, nil
+			case "-":
+				return f - g, nil
+			case "*":
+				return f * g, nil
+			case "/", "//", "%":
+				if g == 0 {
+					return nil, errors.New("division by zero")
+				}
+
+				switch op {
+				case "/":
+					return f / g, nil
+				case "//":
+					return math.Floor(f / g), nil
+				default:
+					return f - math.Floor(f/g)*g, nil
+				}
+			case "**":
+				return math.Pow(f, g), nil
+			}
+		}
+	}
+
+	switch op {
+	case "+":
+		switch a := a.(type) {
+		case string:
+			if b, ok := b.(string); ok {
+				return a + b, nil
+			}
+		case []any:
+			if b, ok := b.([]any); ok {
+				return append(slices.Clip(a), b...), nil
+			}
+		}
+	case "*":
+		if s, ok := a.(string); ok && yok {
+			return strings.Repeat(s, max(y, 0)), nil
+		}
+
+		if s, ok := b.(string); ok && xok {
+			return strings.Repeat(s, max(x, 0)), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, typeName(a), typeName(b))
+}
+
+// iterate returns the items a loop over v goes through. Dicts are iterated
+// by key.
+func iterate(v any) ([]any, error) {
+	switch v := v.(type) {
+	case []any:
+		return v, nil
+	case map[string]any:
+		keys := sortedKeys(v)
+		items := make([]any, len(keys))
+		for i, k := range keys {
+			items[i] = k
+		}
+
+		return items, nil
+	case string:
+		items := make([]any, 0, utf8.RuneCountInString(v))
+		for _, r := range v {
+			items = append(items, string(r))
+		}
+
+		return items, nil
+	case undefined:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%s is not iterable", typeName(v))
+}
+
+// attr returns attribute name of v, which is an item for dicts.
+func attr(v any, name string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if item, ok := v[name]; ok {
+			return item
+		}
+	case *namespace:
+		if item, ok := v.vars[name]; ok {
+			return item
+		}
+	}
+
+	return undefined{name}
+}
+
+// item returns v[i]. Items which don't exist are undefined.
+func item(v, i any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		if k, ok := i.(string); ok {
+			if item, ok := v[k]; ok {
+				return item, nil
+			}
+		}
+
+		return undefined{str(i)}, nil
+	case *namespace:
+		return attr(v, str(i)), nil
+	case []any, string:
+		n, ok := i.(int)
+		if !ok {
+			return nil, fmt.Errorf("indices must be integers, not %s", typeName(i))
+		}
+
+		if s, ok := v.(string); ok {
+			runes := []rune(s)
+			if n < 0 {
+				n += len(runes)
+			}
+
+			if n < 0 || n >= len(runes) {
+				return undefined{}, nil
+			}
+
+			return string(runes[n]), nil
+		}
+
+		items := v.([]any)
+		if n < 0 {
+			n += len(items)
+		}
+
+		if n < 0 || n >= len(items) {
+			return undefined{}, nil
+		}
+
+		return items[n], nil
+	case undefined:
+		return undefined{}, nil
+	}
+
+	return nil, fmt.Errorf("%s is not subscriptable", typeName(v))
+}
+
+// slice returns v[start:stop:step] with Python's semantics.
+func slice(v any, start, stop, step *int) (any, error) {
+	var items []any
+	switch v := v.(type) {
+	case []any:
+		items = v
+	case string:
+		items, _ = iterate(v)
+	case undefined:
+		return undefined{}, nil
+	default:
+		return nil, fmt.Errorf("%s is not subscriptable", typeName(v))
+	}
+
+	n, k := len(items), 1
+	if step != nil {
+		k = *step
+	}
+
+	if k == 0 {
+		return nil, errors.New("slice step cannot be zero")
+	}
+
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+
+		i := *p
+		if i < 0 {
+			i += n
+		}
+
+		if k > 0 {
+			return min(max(i, 0), n)
+		}
+
+		return min(max(i, -1), n-1)
+	}
+
+	var sliced []any
+	if k > 0 {
+		for i := bound(start, 0); i < bound(stop, n); i += k {
+			sliced = append(sliced, items[i])
+		}
+	} else {
+		for i := bound(start, n-1); i > bound(stop, -1); i += k {
+			sliced = append(sliced, items[i])
+		}
+	}
+
+	if _, ok := v.(string); ok {
+		var sb strings.Builder
+		for _, item := range sliced {
+			sb.WriteString(item.(string))
+		}
+
+		return sb.String(), nil
+	}
+
+	if sliced == nil {
+		sliced = []any{}
+	}
+
+	return sliced, nil
+}
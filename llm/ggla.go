@@ -135,3 +135,62 @@ func (llm *ggla) decode(rs io.ReadSeeker) (retErr error) {
 		llm.tensors = append(llm.tensors, &t)
 	}
 }
+
+// NewGGLAV1 returns a ggla container which can encode LoRA adapters in the
+// format read by llama.cpp's --lora flag.
+func NewGGLAV1() *ggla {
+	return newGGLA(&containerGGLA{version: 1})
+}
+
+// Encode writes the adapter to ws. kv must contain the adapter's rank "r" and
+// "alpha". Tensor shapes are in the same order as Decode returns them.
+func (llm *ggla) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
+	r, ok := kv["r"].(uint32)
+	if !ok {
+		return errors.New("missing r")
+	}
+
+	alpha, ok := kv["alpha"].(uint32)
+	if !ok {
+		return errors.New("missing alpha")
+	}
+
+	for _, v := range []uint32{FILE_MAGIC_GGLA, llm.version, r, alpha} {
+		if err := binary.Write(ws, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range tensors {
+		for _, v := range []uint32{uint32(len(t.Shape)), uint32(len(t.Name)), t.Kind} {
+			if err := binary.Write(ws, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+
+		for i := range t.Shape {
+			if err := binary.Write(ws, binary.LittleEndian, uint32(t.Shape[len(t.Shape)-1-i])); err != nil {
+				return err
+			}
+		}
+
+		if _, err := ws.Write([]byte(t.Name)); err != nil {
+			return err
+		}
+
+		offset, err := ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if _, err := ws.Write(make([]byte, (offset+31)&-32-offset)); err != nil {
+			return err
+		}
+
+		if _, err := t.WriteTo(ws); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -28,6 +28,10 @@ func (kv KV) u64(key string) uint64 {
 		return v
 	case uint32:
 		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case int32:
+		return uint64(v)
 	case float64:
 		return uint64(v)
 	default:
@@ -112,6 +116,58 @@ func (kv KV) ChatTemplate() string {
 	return s
 }
 
+// SplitCount returns the number of files a split model is stored in, or 0 if
+// the model isn't split.
+func (kv KV) SplitCount() uint64 {
+	return kv.u64("split.count")
+}
+
+// SplitNo returns the index of the file of a split model, starting at 0.
+func (kv KV) SplitNo() uint64 {
+	return kv.u64("split.no")
+}
+
+// Uint returns the value of key as a uint64 or 0 if it isn't an integer.
+func (kv KV) Uint(key string) uint64 {
+	return kv.u64(key)
+}
+
+// Strings returns the values of the string array key. The array must have
+// been fully decoded.
+func (kv KV) Strings(key string) []string {
+	return arrayValues[string](kv, key)
+}
+
+// Floats returns the values of the float32 array key. The array must have
+// been fully decoded.
+func (kv KV) Floats(key string) []float32 {
+	return arrayValues[float32](kv, key)
+}
+
+// Ints returns the values of the int32 array key. The array must have been
+// fully decoded.
+func (kv KV) Ints(key string) []int32 {
+	return arrayValues[int32](kv, key)
+}
+
+func arrayValues[T any](kv KV, key string) []T {
+	switch v := kv[key].(type) {
+	case []T:
+		return v
+	case *array:
+		values := make([]T, 0, len(v.values))
+		for _, e := range v.values {
+			if t, ok := e.(T); ok {
+				values = append(values, t)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
 type Tensors []*Tensor
 
 func (ts Tensors) Layers() map[string]Layer {
@@ -135,7 +191,8 @@ func (ts Tensors) Layers() map[string]Layer {
 
 type Layer map[string]*Tensor
 
-func (l Layer) size() (size uint64) {
+// Size is the total size in bytes of the tensors in the layer.
+func (l Layer) Size() (size uint64) {
 	for _, t := range l {
 		size += t.Size()
 	}
@@ -154,6 +211,72 @@ type Tensor struct {
 	io.WriterTo `json:"-"`
 }
 
+// TypeString is the name of the GGML type of the tensor, e.g. Q4_K.
+func (t Tensor) TypeString() string {
+	switch t.Kind {
+	case 0:
+		return "F32"
+	case 1:
+		return "F16"
+	case 2:
+		return "Q4_0"
+	case 3:
+		return "Q4_1"
+	case 6:
+		return "Q5_0"
+	case 7:
+		return "Q5_1"
+	case 8:
+		return "Q8_0"
+	case 9:
+		return "Q8_1"
+	case 10:
+		return "Q2_K"
+	case 11:
+		return "Q3_K"
+	case 12:
+		return "Q4_K"
+	case 13:
+		return "Q5_K"
+	case 14:
+		return "Q6_K"
+	case 15:
+		return "Q8_K"
+	case 16:
+		return "IQ2_XXS"
+	case 17:
+		return "IQ2_XS"
+	case 18:
+		return "IQ3_XXS"
+	case 19:
+		return "IQ1_S"
+	case 20:
+		return "IQ4_NL"
+	case 21:
+		return "IQ3_S"
+	case 22:
+		return "IQ2_S"
+	case 23:
+		return "IQ4_XS"
+	case 24:
+		return "I8"
+	case 25:
+		return "I16"
+	case 26:
+		return "I32"
+	case 27:
+		return "I64"
+	case 28:
+		return "F64"
+	case 29:
+		return "IQ1_M"
+	case 30:
+		return "BF16"
+	default:
+		return "unknown"
+	}
+}
+
 func (t Tensor) blockSize() uint64 {
 	switch t.Kind {
 	case 0, 1, 24, 25, 26, 27, 28, 30: // F32, F16, I8, I16, I32, I64, F64, BF16
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -255,6 +257,41 @@ func (llm *gguf) Decode(rs io.ReadSeeker) error {
 	return nil
 }
 
+// writeGGUFDecodedArray writes an array read by readGGUFArray.
+func writeGGUFDecodedArray(llm *gguf, w io.Writer, a *array) error {
+	if len(a.values) != a.size {
+		return errors.New("array wasn't fully decoded")
+	}
+
+	if err := binary.Write(w, llm.ByteOrder, ggufTypeArray); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, llm.ByteOrder, a.t); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, llm.ByteOrder, uint64(a.size)); err != nil {
+		return err
+	}
+
+	for _, e := range a.values {
+		if s, ok := e.(string); ok {
+			if err := binary.Write(w, llm.ByteOrder, uint64(len(s))); err != nil {
+				return err
+			}
+
+			if _, err := io.WriteString(w, s); err != nil {
+				return err
+			}
+		} else if err := binary.Write(w, llm.ByteOrder, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func readGGUF[T any](llm *gguf, r io.Reader) (T, error) {
 	var t T
 	err := binary.Read(r, llm.ByteOrder, &t)
@@ -344,6 +381,8 @@ func writeGGUFString(llm *gguf, w io.Writer, s string) error {
 }
 
 type array struct {
+	// t is the gguf type of the elements
+	t      uint32
 	size   int
 	values []any
 }
@@ -363,9 +402,9 @@ func readGGUFV1Array(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{t: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
-		a.values = make([]any, 0, int(n))
+		a.values = make([]any, int(n))
 	}
 
 	for i := range n {
@@ -425,7 +464,7 @@ func readGGUFArray(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{t: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
 		a.values = make([]any, int(n))
 	}
@@ -523,6 +562,43 @@ var ggufKVOrder = map[string][]string{
 		"gemma.attention.layer_norm_rms_epsilon",
 		"gemma.attention.key_length",
 		"gemma.attention.value_length",
+		"phi3.context_length",
+		"phi3.rope.scaling.original_context_length",
+		"phi3.embedding_length",
+		"phi3.feed_forward_length",
+		"phi3.block_count",
+		"phi3.attention.head_count",
+		"phi3.attention.head_count_kv",
+		"phi3.attention.layer_norm_rms_epsilon",
+		"phi3.attention.sliding_window",
+		"phi3.rope.dimension_count",
+		"phi3.rope.freq_base",
+		"phi3.rope.scaling.attn_factor",
+		"qwen2.context_length",
+		"qwen2.embedding_length",
+		"qwen2.block_count",
+		"qwen2.feed_forward_length",
+		"qwen2.attention.head_count",
+		"qwen2.attention.head_count_kv",
+		"qwen2.attention.layer_norm_rms_epsilon",
+		"qwen2.rope.freq_base",
+		"bert.context_length",
+		"bert.embedding_length",
+		"bert.feed_forward_length",
+		"bert.block_count",
+		"bert.attention.head_count",
+		"bert.attention.layer_norm_epsilon",
+		"bert.attention.causal",
+		"bert.pooling_type",
+		"nomic-bert.context_length",
+		"nomic-bert.embedding_length",
+		"nomic-bert.feed_forward_length",
+		"nomic-bert.block_count",
+		"nomic-bert.attention.head_count",
+		"nomic-bert.attention.layer_norm_epsilon",
+		"nomic-bert.attention.causal",
+		"nomic-bert.pooling_type",
+		"nomic-bert.rope.freq_base",
 		"general.file_type",
 		"tokenizer.ggml.pre",
 		"tokenizer.ggml.model",
@@ -534,6 +610,10 @@ var ggufKVOrder = map[string][]string{
 		"tokenizer.ggml.eos_token_id",
 		"tokenizer.ggml.unknown_token_id",
 		"tokenizer.ggml.padding_token_id",
+		"tokenizer.ggml.seperator_token_id",
+		"tokenizer.ggml.cls_token_id",
+		"tokenizer.ggml.mask_token_id",
+		"tokenizer.ggml.token_type_count",
 		"tokenizer.ggml.add_bos_token",
 		"tokenizer.ggml.add_eos_token",
 		"tokenizer.chat_template",
@@ -565,18 +645,26 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 		return err
 	}
 
-	kvCheck := make(map[string]bool)
-	for k := range kv {
-		kvCheck[k] = false
+	// known keys are written in order followed by any others, e.g. when
+	// rewriting the header of an existing file
+	var keys []string
+	for _, k := range ggufKVOrder["llama"] {
+		if _, ok := kv[k]; ok {
+			keys = append(keys, k)
+		}
 	}
 
-	for _, k := range ggufKVOrder["llama"] {
-		v, ok := kv[k]
-		if !ok {
-			continue
+	var others []string
+	for k := range kv {
+		if !slices.Contains(keys, k) {
+			others = append(others, k)
 		}
-		kvCheck[k] = true
+	}
 
+	slices.Sort(others)
+	keys = append(keys, others...)
+
+	for _, k := range keys {
 		if err := binary.Write(ws, llm.ByteOrder, uint64(len(k))); err != nil {
 			return err
 		}
@@ -586,11 +674,27 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 		}
 
 		var err error
-		switch v := v.(type) {
+		switch v := kv[k].(type) {
+		case uint8:
+			err = writeGGUF(llm, ws, ggufTypeUint8, v)
+		case int8:
+			err = writeGGUF(llm, ws, ggufTypeInt8, v)
+		case uint16:
+			err = writeGGUF(llm, ws, ggufTypeUint16, v)
+		case int16:
+			err = writeGGUF(llm, ws, ggufTypeInt16, v)
 		case uint32:
 			err = writeGGUF(llm, ws, ggufTypeUint32, v)
+		case int32:
+			err = writeGGUF(llm, ws, ggufTypeInt32, v)
+		case uint64:
+			err = writeGGUF(llm, ws, ggufTypeUint64, v)
+		case int64:
+			err = writeGGUF(llm, ws, ggufTypeInt64, v)
 		case float32:
 			err = writeGGUF(llm, ws, ggufTypeFloat32, v)
+		case float64:
+			err = writeGGUF(llm, ws, ggufTypeFloat64, v)
 		case bool:
 			err = writeGGUF(llm, ws, ggufTypeBool, v)
 		case string:
@@ -623,17 +727,13 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 					return err
 				}
 			}
+		case *array:
+			err = writeGGUFDecodedArray(llm, ws, v)
 		default:
 			return fmt.Errorf("improper type for '%s'", k)
 		}
 		if err != nil {
-			return err
-		}
-	}
-
-	for k, v := range kvCheck {
-		if !v {
-			return fmt.Errorf("Didn't know how to write kv %s", k)
+			return fmt.Errorf("%s: %w", k, err)
 		}
 	}
 
@@ -672,7 +772,11 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 		}
 	}
 
-	var alignment int64 = 32
+	alignment := int64(32)
+	if a, ok := kv["general.alignment"].(uint32); ok {
+		alignment = int64(a)
+	}
+
 	for _, tensor := range tensors {
 		offset, err := ws.Seek(0, io.SeekCurrent)
 		if err != nil {
@@ -692,6 +796,59 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 	return nil
 }
 
+// EncodeKV writes the GGUF model g to ws with kv as its metadata. g must have
+// been decoded from r and offset is the end of the model as returned by
+// DecodeGGML. Tensor data is copied from r unchanged.
+func EncodeKV(ws io.WriteSeeker, g *GGML, r io.ReaderAt, offset int64, kv KV) error {
+	m, ok := g.model.(*gguf)
+	if !ok {
+		return fmt.Errorf("metadata can only be written for gguf models, not %s", g.Name())
+	}
+
+	return NewGGUFV3(m.ByteOrder).Encode(ws, kv, m.sectionTensors(r, offset))
+}
+
+// sectionTensors returns the tensors of llm with their data read from r.
+// offset is the end of the model in r as returned by DecodeGGML.
+func (llm *gguf) sectionTensors(r io.ReaderAt, offset int64) []Tensor {
+	var end uint64
+	for _, t := range llm.tensors {
+		end = max(end, t.Offset+t.Size())
+	}
+
+	start := offset - int64(end)
+
+	tensors := make([]Tensor, len(llm.tensors))
+	for i, t := range llm.tensors {
+		// shapes are decoded in gguf order and padded to 4 dimensions
+		dims := len(t.Shape)
+		for dims > 1 && t.Shape[dims-1] == 1 {
+			dims--
+		}
+
+		shape := slices.Clone(t.Shape[:dims])
+		slices.Reverse(shape)
+
+		tensors[i] = Tensor{
+			Name:     t.Name,
+			Kind:     t.Kind,
+			Offset:   t.Offset,
+			Shape:    shape,
+			WriterTo: sectionWriterTo{io.NewSectionReader(r, start+int64(t.Offset), int64(t.Size()))},
+		}
+	}
+
+	return tensors
+}
+
+type sectionWriterTo struct {
+	*io.SectionReader
+}
+
+func (s sectionWriterTo) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, s.SectionReader)
+}
+
 func (gguf) padding(offset, align int64) int64 {
 	return (align - offset%align) % align
 }
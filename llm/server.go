@@ -82,7 +82,9 @@ func LoadModel(model string, maxArraySize int) (*GGML, error) {
 
 // NewLlamaServer will run a server for the given GPUs
 // The gpu list must be a single family.
-func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, opts api.Options) (LlamaServer, error) {
+// adapterScales are the scales adapters are applied at, adapters without one
+// are applied at 1.
+func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters []string, adapterScales []float32, projectors []string, opts api.Options) (LlamaServer, error) {
 	var err error
 	var cpuRunner string
 	var estimate MemoryEstimate
@@ -127,10 +129,6 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 	// Loop through potential servers
 	finalErr := errors.New("no suitable llama servers found")
 
-	if len(adapters) > 1 {
-		return nil, errors.New("ollama supports only one lora adapter, but multiple were provided")
-	}
-
 	availableServers := availableServers()
 	var servers []string
 	if cpuRunner != "" {
@@ -178,9 +176,12 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--main-gpu", fmt.Sprintf("%d", opts.MainGPU))
 	}
 
-	if len(adapters) > 0 {
-		// TODO: applying multiple adapters is not supported by the llama.cpp server yet
-		params = append(params, "--lora", adapters[0])
+	for i, adapter := range adapters {
+		if i < len(adapterScales) && adapterScales[i] != 1 {
+			params = append(params, "--lora-scaled", adapter, strconv.FormatFloat(float64(adapterScales[i]), 'g', -1, 32))
+		} else {
+			params = append(params, "--lora", adapter)
+		}
 	}
 
 	if len(projectors) > 0 {
@@ -424,7 +425,7 @@ func projectorMemoryRequirements(filename string) uint64 {
 
 	var mem uint64
 	for _, layer := range ggml.Tensors().Layers() {
-		mem += layer.size()
+		mem += layer.Size()
 	}
 
 	return mem
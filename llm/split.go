@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// splitPattern matches the file names of split gguf models, e.g.
+// model-00001-of-00005.gguf
+var splitPattern = regexp.MustCompile(`^(.*)-(\d{5})-of-(\d{5})\.gguf$`)
+
+// SplitFiles returns the paths of every shard of the split model whose first
+// shard is path, in order. It returns nil if path isn't named like the first
+// shard of a split model.
+func SplitFiles(path string) ([]string, error) {
+	m := splitPattern.FindStringSubmatch(filepath.Base(path))
+	if m == nil || m[2] != "00001" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(m[3])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("%s: invalid shard count", path)
+	}
+
+	paths := make([]string, n)
+	for i := range n {
+		paths[i] = filepath.Join(filepath.Dir(path), fmt.Sprintf("%s-%05d-of-%s.gguf", m[1], i+1, m[3]))
+		if _, err := os.Stat(paths[i]); err != nil {
+			return nil, fmt.Errorf("missing shard %d of %d: %w", i+1, n, err)
+		}
+	}
+
+	return paths, nil
+}
+
+// SplitShard is one file of a split gguf model. GGML must have been decoded
+// from ReaderAt and Offset is the end of the shard as returned by DecodeGGML.
+type SplitShard struct {
+	GGML     *GGML
+	ReaderAt io.ReaderAt
+	Offset   int64
+}
+
+// MergeSplit writes the shards of a split gguf model to ws as a single gguf
+// file. Shards must be complete and in order. The metadata is taken from the
+// first shard without the split keys.
+func MergeSplit(ws io.WriteSeeker, shards []SplitShard) error {
+	if len(shards) == 0 {
+		return fmt.Errorf("no shards to merge")
+	}
+
+	var byteOrder binary.ByteOrder
+	var tensors []Tensor
+	for i, shard := range shards {
+		m, ok := shard.GGML.model.(*gguf)
+		if !ok {
+			return fmt.Errorf("shard %d: split models must be gguf, not %s", i+1, shard.GGML.Name())
+		}
+
+		if byteOrder == nil {
+			byteOrder = m.ByteOrder
+		}
+
+		kv := m.KV()
+		if count := kv.SplitCount(); count != uint64(len(shards)) {
+			return fmt.Errorf("shard %d: expected %d shards, got %d", i+1, count, len(shards))
+		}
+
+		if no := kv.SplitNo(); no != uint64(i) {
+			return fmt.Errorf("shard %d: out of order, it's shard %d", i+1, no+1)
+		}
+
+		tensors = append(tensors, m.sectionTensors(shard.ReaderAt, shard.Offset)...)
+	}
+
+	kv := KV{}
+	for k, v := range shards[0].GGML.KV() {
+		if !strings.HasPrefix(k, "split.") {
+			kv[k] = v
+		}
+	}
+
+	// the parameter count is recomputed when the merged model is decoded
+	delete(kv, "general.parameter_count")
+
+	if count := shards[0].GGML.KV().u64("split.tensors.count"); count > 0 && count != uint64(len(tensors)) {
+		return fmt.Errorf("expected %d tensors, shards have %d", count, len(tensors))
+	}
+
+	alignment := uint64(32)
+	if a, ok := kv["general.alignment"].(uint32); ok {
+		alignment = uint64(a)
+	}
+
+	var offset uint64
+	for i := range tensors {
+		offset += (alignment - offset%alignment) % alignment
+		tensors[i].Offset = offset
+		offset += tensors[i].Size()
+	}
+
+	return NewGGUFV3(byteOrder).Encode(ws, kv, tensors)
+}
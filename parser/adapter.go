@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseAdapter returns the path and scale of an ADAPTER, which is "path" or
+// "path SCALE scale". The scale is 1 if it isn't set. Paths may have spaces,
+// and end in a number, so the scale is only read after the SCALE keyword.
+func ParseAdapter(s string) (path string, scale float32, err error) {
+	fields := strings.Fields(s)
+	if n := len(fields); n > 0 && strings.HasPrefix(strings.ToLower(fields[n-1]), "scale=") {
+		return "", 0, fmt.Errorf("invalid adapter scale %q, the scale is set with SCALE after the path", fields[n-1])
+	} else if n < 3 || !strings.EqualFold(fields[n-2], "scale") {
+		return s, 1, nil
+	}
+
+	v := fields[len(fields)-1]
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", 0, fmt.Errorf("invalid adapter scale %q", v)
+	}
+
+	// the path is everything before the keyword
+	i := strings.LastIndexAny(strings.TrimRight(s, " \t"), " \t")
+	i = strings.LastIndexAny(strings.TrimRight(s[:i], " \t"), " \t")
+	return strings.TrimRight(s[:i], " \t"), float32(f), nil
+}
+
+// FormatAdapter returns the arguments of an ADAPTER which applies path at
+// scale.
+func FormatAdapter(path string, scale float32) string {
+	if scale == 1 {
+		return path
+	}
+
+	return path + " SCALE " + strconv.FormatFloat(float64(scale), 'g', -1, 32)
+}
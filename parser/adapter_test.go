@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAdapter(t *testing.T) {
+	cases := []struct {
+		input string
+		path  string
+		scale float32
+		err   string
+	}{
+		{"./a.gguf", "./a.gguf", 1, ""},
+		{"./a.gguf SCALE 0.5", "./a.gguf", 0.5, ""},
+		{"./a.gguf  scale  -1", "./a.gguf", -1, ""},
+		{"@sha256:abc SCALE 2", "@sha256:abc", 2, ""},
+		{"./my adapter.gguf", "./my adapter.gguf", 1, ""},
+		{"./my adapter.gguf SCALE 0.25", "./my adapter.gguf", 0.25, ""},
+		// a number without SCALE is part of the path
+		{"./lora 2", "./lora 2", 1, ""},
+		{"./lora 2 SCALE 0.5", "./lora 2", 0.5, ""},
+		{"SCALE 2", "SCALE 2", 1, ""},
+		{"./a.gguf SCALE 1e40", "", 0, `invalid adapter scale "1e40"`},
+		{"./a.gguf SCALE NaN", "", 0, `invalid adapter scale "NaN"`},
+		{"./a.gguf SCALE inf", "", 0, `invalid adapter scale "inf"`},
+		{"./a.gguf SCALE abc", "", 0, `invalid adapter scale "abc"`},
+		{"./a.gguf scale=0.5", "", 0, `invalid adapter scale "scale=0.5", the scale is set with SCALE after the path`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			path, scale, err := ParseAdapter(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.path, path)
+			assert.InDelta(t, tt.scale, scale, 0)
+		})
+	}
+}
+
+func TestFormatAdapter(t *testing.T) {
+	for _, scale := range []float32{1, 0.5, 0.1, -2, 0} {
+		for _, p := range []string{"./a.gguf", "./lora 2"} {
+			path, v, err := ParseAdapter(FormatAdapter(p, scale))
+			require.NoError(t, err)
+			assert.Equal(t, p, path)
+			assert.InDelta(t, scale, v, 0)
+		}
+	}
+}
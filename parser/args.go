@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	errUndefinedVariable = errors.New("undefined variable")
+	errUnsetArg          = errors.New("ARG has no value")
+)
+
+// argScope is the ARGs declared so far and their values.
+type argScope struct {
+	// build is the values of ARGs given when the model is created, which
+	// take precedence over defaults
+	build map[string]string
+	used  map[string]bool
+
+	vars  map[string]string
+	unset map[string]bool
+}
+
+func newArgScope(build map[string]string) *argScope {
+	return &argScope{
+		build: build,
+		used:  make(map[string]bool),
+		vars:  make(map[string]string),
+		unset: make(map[string]bool),
+	}
+}
+
+// declare declares the ARG s, which is "name" or "name=default". The default
+// may refer to ARGs declared before it.
+func (a *argScope) declare(s string) error {
+	name, value, hasDefault := strings.Cut(s, "=")
+	if !isValidArgName(name) {
+		return fmt.Errorf("invalid ARG name %q", name)
+	}
+
+	if v, ok := a.build[name]; ok {
+		a.used[name] = true
+		value = v
+	} else if !hasDefault {
+		a.unset[name] = true
+		return nil
+	} else {
+		if s, ok := unquote(value); ok {
+			value = s
+		}
+
+		var err error
+		if value, err = expand(value, a.lookup); errors.Is(err, errUnsetArg) {
+			a.unset[name] = true
+			return err
+		} else if err != nil {
+			return err
+		}
+	}
+
+	delete(a.unset, name)
+	a.vars[name] = value
+	return nil
+}
+
+func (a *argScope) lookup(name string) (string, error) {
+	if v, ok := a.vars[name]; ok {
+		return v, nil
+	} else if a.unset[name] {
+		return "", fmt.Errorf("%w: %s", errUnsetArg, name)
+	}
+
+	return "", fmt.Errorf("%w: %s", errUndefinedVariable, name)
+}
+
+// unused returns an error if any of the build args weren't declared.
+func (a *argScope) unused() error {
+	var names []string
+	for name := range a.build {
+		if !a.used[name] {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) > 0 {
+		slices.Sort(names)
+		return fmt.Errorf("build args aren't declared by an ARG: %s", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// expand replaces every ${name} in s with its value. \${ is a literal ${.
+func expand(s string, lookup func(string) (string, error)) (string, error) {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '\\' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		sb.WriteString(s[:i])
+
+		j := strings.IndexByte(s[i+2:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated variable reference: %s", s[i:])
+		}
+
+		v, err := lookup(s[i+2 : i+2+j])
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(v)
+		s = s[i+2+j+1:]
+	}
+}
+
+func isValidArgName(name string) bool {
+	if name == "" || isNumber(rune(name[0])) {
+		return false
+	}
+
+	for _, r := range name {
+		if !isAlpha(r) && !isNumber(r) && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Expand substitutes ${name} in the arguments of every command with the value
+// of the ARG called name and removes the ARG commands. The value of an ARG is
+// args[name] or else its default, and it must be declared before it's used.
+// Modelfiles without ARGs are left as is so ${ is only special once an ARG is
+// declared. Comments before an ARG move to the command after it.
+func (f *File) Expand(args map[string]string) error {
+	if !hasCommand(f.Commands, "arg") {
+		return newArgScope(args).unused()
+	}
+
+	scope := newArgScope(args)
+
+	expanded := *f
+	if err := expanded.splice(func(cmd Command) ([]Command, error) {
+		if cmd.Name == "arg" {
+			if err := scope.declare(cmd.Args); err != nil {
+				return nil, fmt.Errorf("%s: %w", cmd, err)
+			}
+
+			return nil, nil
+		}
+
+		s, err := expand(cmd.Args, scope.lookup)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cmd, err)
+		}
+
+		return []Command{{Name: cmd.Name, Args: s}}, nil
+	}); err != nil {
+		return err
+	}
+
+	if err := scope.unused(); err != nil {
+		return err
+	}
+
+	*f = expanded
+	return nil
+}
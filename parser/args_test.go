@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		args     map[string]string
+		expected []Command
+		err      error
+	}{
+		{
+			"defaults",
+			`ARG base=llama3
+ARG ctx=4096
+FROM ${base}
+PARAMETER num_ctx ${ctx}
+SYSTEM """You are ${base} with a context of ${ctx} tokens."""
+`,
+			nil,
+			[]Command{
+				{Name: "model", Args: "llama3"},
+				{Name: "num_ctx", Args: "4096"},
+				{Name: "system", Args: "You are llama3 with a context of 4096 tokens."},
+			},
+			nil,
+		},
+		{
+			"build args",
+			`ARG base=llama3
+ARG ctx
+FROM ${base}:latest
+PARAMETER num_ctx ${ctx}
+`,
+			map[string]string{"base": "mistral", "ctx": "8192"},
+			[]Command{
+				{Name: "model", Args: "mistral:latest"},
+				{Name: "num_ctx", Args: "8192"},
+			},
+			nil,
+		},
+		{
+			"defaults refer to args",
+			`ARG model=llama3
+ARG tag="${model}:8b"
+FROM ${tag}
+`,
+			nil,
+			[]Command{{Name: "model", Args: "llama3:8b"}},
+			nil,
+		},
+		{
+			"escaped",
+			`ARG name=x
+FROM foo
+SYSTEM \${name} is ${name}
+`,
+			nil,
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "system", Args: "${name} is x"},
+			},
+			nil,
+		},
+		{
+			"no args",
+			"FROM foo\nSYSTEM echo ${HOME}\n",
+			nil,
+			[]Command{
+				{Name: "model", Args: "foo"},
+				{Name: "system", Args: "echo ${HOME}"},
+			},
+			nil,
+		},
+		{
+			"undefined",
+			"ARG base=llama3\nFROM ${base}\nPARAMETER num_ctx ${ctx}\n",
+			nil,
+			nil,
+			errUndefinedVariable,
+		},
+		{
+			"used before declared",
+			"FROM ${base}\nARG base=llama3\n",
+			nil,
+			nil,
+			errUndefinedVariable,
+		},
+		{
+			"no value",
+			"ARG base\nFROM ${base}\n",
+			nil,
+			nil,
+			errUnsetArg,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFile(strings.NewReader(tt.input))
+			require.NoError(t, err)
+
+			err = f.Expand(tt.args)
+			require.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, tt.expected, f.Commands)
+			}
+		})
+	}
+}
+
+func TestExpandKeepsComments(t *testing.T) {
+	f, err := ParseFile(strings.NewReader(`# the base model
+ARG base=llama3
+FROM ${base}
+
+# a longer context
+PARAMETER num_ctx 4096
+# the end
+`))
+	require.NoError(t, err)
+	require.NoError(t, f.Expand(nil))
+
+	assert.Equal(t, `# the base model
+FROM llama3
+
+# a longer context
+PARAMETER num_ctx 4096
+# the end
+`, f.String())
+}
+
+func TestExpandInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		args  map[string]string
+	}{
+		{"ARG 1ctx=4096\nFROM foo\n", nil},
+		{"ARG ctx=4096\nFROM foo\nPARAMETER num_ctx ${ctx\n", nil},
+		{"ARG ctx=4096\nFROM foo\n", map[string]string{"ctxx": "8192"}},
+		{"FROM foo\n", map[string]string{"ctx": "8192"}},
+	} {
+		t.Run("", func(t *testing.T) {
+			f, err := ParseFile(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Error(t, f.Expand(tt.args))
+		})
+	}
+}
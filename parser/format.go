@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"cmp"
+	"io"
+	"slices"
+	"strings"
+)
+
+// order is the canonical order of commands. Parameters are between SYSTEM and
+// METADATA. FROM and ADAPTER are ordered together since adapters apply to the
+// model before them.
+var order = map[string]int{
+	"arg":      0,
+	"model":    1,
+	"adapter":  1,
+	"template": 2,
+	"system":   3,
+	"metadata": 5,
+	"label":    6,
+	"license":  7,
+	"message":  8,
+}
+
+func rank(cmd Command) int {
+	if i, ok := order[cmd.Name]; ok {
+		return i
+	}
+
+	return 4
+}
+
+func isParameter(cmd Command) bool {
+	_, ok := order[cmd.Name]
+	return !ok && cmd.Name != "include"
+}
+
+// Format puts the commands of f in canonical order: ARG, FROM and ADAPTER,
+// TEMPLATE, SYSTEM, PARAMETER by name, METADATA, LABEL by key, LICENSE and
+// MESSAGE. Commands of the same kind keep their order and nothing is moved
+// across an INCLUDE so the Modelfile means the same thing. Comments move with
+// the command after them.
+func (f *File) Format() {
+	type entry struct {
+		cmd      Command
+		comments []string
+	}
+
+	entries := make([]entry, len(f.Commands))
+	for i, cmd := range f.Commands {
+		entries[i] = entry{cmd, f.Comments[i]}
+	}
+
+	sort := func(entries []entry) {
+		slices.SortStableFunc(entries, func(a, b entry) int {
+			if c := cmp.Compare(rank(a.cmd), rank(b.cmd)); c != 0 {
+				return c
+			}
+
+			if isParameter(a.cmd) && isParameter(b.cmd) {
+				return cmp.Compare(a.cmd.Name, b.cmd.Name)
+			}
+
+			if a.cmd.Name == "label" && b.cmd.Name == "label" {
+				akey, _, _ := strings.Cut(a.cmd.Args, "=")
+				bkey, _, _ := strings.Cut(b.cmd.Args, "=")
+				return cmp.Compare(akey, bkey)
+			}
+
+			return 0
+		})
+	}
+
+	var start int
+	for i, e := range entries {
+		if e.cmd.Name == "include" {
+			sort(entries[start:i])
+			start = i + 1
+		}
+	}
+
+	sort(entries[start:])
+
+	formatted := File{Commands: make([]Command, len(entries))}
+	for i, e := range entries {
+		formatted.Commands[i] = e.cmd
+		formatted.addComments(i, e.comments)
+	}
+
+	formatted.addComments(len(entries), f.Comments[len(entries)])
+	*f = formatted
+}
+
+// Format formats the Modelfile in r. It may be a fragment without a FROM.
+// Formatting a formatted Modelfile doesn't change it.
+func Format(r io.Reader) (string, error) {
+	nodes, trailing, errs := parse(r)
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+
+	f := newFile(nodes, trailing)
+	f.Format()
+	return f.String(), nil
+}
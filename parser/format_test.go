@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileKeepsComments(t *testing.T) {
+	input := `
+
+# the base model
+FROM foo
+
+
+# keep it short
+#
+PARAMETER num_predict 64
+SYSTEM """
+# not a comment
+"""
+# the end
+
+`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, &File{
+		Commands: []Command{
+			{Name: "model", Args: "foo"},
+			{Name: "num_predict", Args: "64"},
+			{Name: "system", Args: "\n# not a comment\n"},
+		},
+		Comments: map[int][]string{
+			0: {"# the base model"},
+			1: {"", "# keep it short", "#"},
+			3: {"# the end"},
+		},
+	}, modelfile)
+
+	assert.Equal(t, `# the base model
+FROM foo
+
+# keep it short
+#
+PARAMETER num_predict 64
+SYSTEM """
+# not a comment
+"""
+# the end
+`, modelfile.String())
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"order",
+			`MESSAGE user hi
+LICENSE MIT
+PARAMETER temperature 1
+SYSTEM be nice
+PARAMETER stop a
+TEMPLATE {{ .Prompt }}
+FROM foo
+PARAMETER stop b
+ADAPTER bar
+ARG x=1
+LABEL owner=ml-team
+METADATA general.name foo
+LABEL eval=0.71
+PARAMETER num_ctx ${x}
+`,
+			`ARG x=1
+FROM foo
+ADAPTER bar
+TEMPLATE {{ .Prompt }}
+SYSTEM be nice
+PARAMETER num_ctx ${x}
+PARAMETER stop a
+PARAMETER stop b
+PARAMETER temperature 1
+METADATA general.name foo
+LABEL eval=0.71
+LABEL owner=ml-team
+LICENSE MIT
+MESSAGE user hi
+`,
+		},
+		{
+			"comments move with commands",
+			`FROM foo
+# be nice
+SYSTEM be nice
+
+# very creative
+PARAMETER temperature 2
+# short template
+TEMPLATE {{ .Prompt }}
+# the end
+`,
+			`FROM foo
+# short template
+TEMPLATE {{ .Prompt }}
+# be nice
+SYSTEM be nice
+
+# very creative
+PARAMETER temperature 2
+# the end
+`,
+		},
+		{
+			"blank first",
+			`SYSTEM be nice
+
+FROM foo
+`,
+			`FROM foo
+SYSTEM be nice
+`,
+		},
+		{
+			"include",
+			`SYSTEM be nice
+INCLUDE base.mf
+SYSTEM be mean
+PARAMETER temperature 1
+FROM foo
+`,
+			`SYSTEM be nice
+INCLUDE base.mf
+FROM foo
+SYSTEM be mean
+PARAMETER temperature 1
+`,
+		},
+		{
+			"quoting",
+			`FROM foo
+TEMPLATE "{{ .System }}
+{{ .Prompt }}"
+SYSTEM """ be nice """
+LICENSE """"quoted""""
+MESSAGE user ""
+`,
+			`FROM foo
+TEMPLATE """{{ .System }}
+{{ .Prompt }}"""
+SYSTEM " be nice "
+LICENSE """"quoted""""
+MESSAGE user ""
+`,
+		},
+		{
+			"fragment",
+			"parameter top_k 10\r\n\r\n# shared\r\nsystem be nice\r\n",
+			"# shared\nSYSTEM be nice\nPARAMETER top_k 10\n",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted, err := Format(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, formatted)
+
+			again, err := Format(strings.NewReader(formatted))
+			require.NoError(t, err)
+			assert.Equal(t, formatted, again, "formatting isn't idempotent")
+		})
+	}
+}
+
+func TestFormatKeepsMeaning(t *testing.T) {
+	input := `ARG base=foo
+# comment
+PARAMETER stop "</s>"
+MESSAGE assistant """
+hello "there"
+"""
+FROM ${base}
+ADAPTER ./adapter.gguf
+SYSTEM " spaced "
+PARAMETER stop "<|eot|>"
+LICENSE """"MIT""""
+`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	formatted, err := Format(strings.NewReader(input))
+	require.NoError(t, err)
+
+	modelfile2, err := ParseFile(strings.NewReader(formatted))
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, modelfile.Commands, modelfile2.Commands)
+}
+
+func TestFormatError(t *testing.T) {
+	_, err := Format(strings.NewReader("FROM foo\nBADCOMMAND bar\n"))
+	assert.EqualError(t, err, "2:1: "+errInvalidCommand.Error())
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Include replaces every INCLUDE with the commands of the Modelfile fragment
+// it refers to, which may include other fragments. Paths are relative to the
+// file which includes them and filename is the path of the Modelfile itself,
+// or empty if it isn't a file. The Modelfile, with its fragments, must have a
+// FROM. Comments in fragments are dropped.
+func (f *File) Include(filename string) error {
+	var stack []string
+	dir := "."
+	if filename != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+
+		stack = []string{abs}
+		dir = filepath.Dir(abs)
+	}
+
+	included := *f
+	if err := included.splice(func(cmd Command) ([]Command, error) {
+		return include([]Command{cmd}, dir, stack)
+	}); err != nil {
+		return err
+	}
+
+	if !hasCommand(included.Commands, "model") {
+		return errMissingFrom
+	}
+
+	*f = included
+	return nil
+}
+
+// include splices the fragments included by cmds, which are in a file in dir.
+// stack is the files being included, to detect cycles.
+func include(cmds []Command, dir string, stack []string) ([]Command, error) {
+	var spliced []Command
+	for _, cmd := range cmds {
+		if cmd.Name != "include" {
+			spliced = append(spliced, cmd)
+			continue
+		}
+
+		path, err := IncludePath(dir, cmd.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.Contains(stack, path) {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(slices.Clone(stack), path), " -> "))
+		}
+
+		fragment, err := parseFragment(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fragment, err = include(fragment, filepath.Dir(path), append(slices.Clone(stack), path))
+		if err != nil {
+			return nil, err
+		}
+
+		spliced = append(spliced, fragment...)
+	}
+
+	return spliced, nil
+}
+
+// IncludePath resolves the path of a fragment included by a file in dir like
+// FROM paths are resolved: relative to dir if it's there, otherwise to the
+// working directory.
+func IncludePath(dir, path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(home, strings.TrimPrefix(path[1:], "/")), nil
+	}
+
+	if !filepath.IsAbs(path) {
+		if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			// this is a file relative to the including file
+			path = filepath.Join(dir, path)
+		}
+	}
+
+	return filepath.Abs(path)
+}
+
+// parseFragment parses the Modelfile fragment at path, which doesn't need a
+// FROM.
+func parseFragment(path string) ([]Command, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	nodes, _, errs := parse(f)
+	if len(errs) > 0 {
+		var perr *Error
+		if errors.As(errs[0], &perr) {
+			// path:line:column: error
+			return nil, fmt.Errorf("%s:%w", path, errs[0])
+		}
+
+		return nil, fmt.Errorf("%s: %w", path, errs[0])
+	}
+
+	cmds := make([]Command, len(nodes))
+	for i, n := range nodes {
+		cmds[i] = n.Command
+	}
+
+	return cmds, nil
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFragments(t *testing.T, dir string, fragments map[string]string) {
+	t.Helper()
+
+	for name, content := range fragments {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFragments(t, dir, map[string]string{
+		"Modelfile": `FROM foo
+INCLUDE shared/system.mf
+PARAMETER temperature 0.5
+`,
+		"shared/system.mf": `SYSTEM You are a helpful assistant.
+INCLUDE messages.mf
+`,
+		"shared/messages.mf": `MESSAGE user Hi!
+MESSAGE assistant Hello!
+`,
+	})
+
+	f, err := os.Open(filepath.Join(dir, "Modelfile"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	modelfile, err := ParseFile(f)
+	require.NoError(t, err)
+	require.NoError(t, modelfile.Include(f.Name()))
+
+	assert.Equal(t, []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "system", Args: "You are a helpful assistant."},
+		{Name: "message", Args: "user: Hi!"},
+		{Name: "message", Args: "assistant: Hello!"},
+		{Name: "temperature", Args: "0.5"},
+	}, modelfile.Commands)
+}
+
+func TestIncludeKeepsComments(t *testing.T) {
+	dir := t.TempDir()
+	writeFragments(t, dir, map[string]string{
+		"Modelfile": `# the base model
+FROM foo
+
+# shared settings
+INCLUDE shared.mf
+# the end
+`,
+		"shared.mf": `# dropped
+PARAMETER temperature 0.5
+`,
+	})
+
+	f, err := os.Open(filepath.Join(dir, "Modelfile"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	modelfile, err := ParseFile(f)
+	require.NoError(t, err)
+	require.NoError(t, modelfile.Include(f.Name()))
+
+	assert.Equal(t, `# the base model
+FROM foo
+
+# shared settings
+PARAMETER temperature 0.5
+# the end
+`, modelfile.String())
+}
+
+func TestIncludeFrom(t *testing.T) {
+	dir := t.TempDir()
+	writeFragments(t, dir, map[string]string{
+		"base.mf":  "FROM foo\n",
+		"empty.mf": "# nothing here\n",
+	})
+
+	modelfile, err := ParseFile(strings.NewReader("INCLUDE base.mf\nSYSTEM hi\n"))
+	require.NoError(t, err)
+	require.NoError(t, modelfile.Include(filepath.Join(dir, "Modelfile")))
+	assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "system", Args: "hi"}}, modelfile.Commands)
+
+	modelfile, err = ParseFile(strings.NewReader("INCLUDE empty.mf\nSYSTEM hi\n"))
+	require.NoError(t, err)
+	require.ErrorIs(t, modelfile.Include(filepath.Join(dir, "Modelfile")), errMissingFrom)
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFragments(t, dir, map[string]string{
+		"Modelfile": "FROM foo\nINCLUDE a.mf\n",
+		"a.mf":      "INCLUDE b.mf\n",
+		"b.mf":      "SYSTEM b\nINCLUDE a.mf\n",
+		"self.mf":   "FROM foo\nINCLUDE self.mf\n",
+		"bad.mf":    "SYSTEM ok\nBADCOMMAND value\n",
+	})
+
+	cases := []struct {
+		name     string
+		filename string
+		input    string
+		err      string
+	}{
+		{
+			"cycle",
+			filepath.Join(dir, "Modelfile"),
+			"FROM foo\nINCLUDE a.mf\n",
+			"include cycle: " + strings.Join([]string{
+				filepath.Join(dir, "Modelfile"),
+				filepath.Join(dir, "a.mf"),
+				filepath.Join(dir, "b.mf"),
+				filepath.Join(dir, "a.mf"),
+			}, " -> "),
+		},
+		{
+			"self",
+			filepath.Join(dir, "self.mf"),
+			"FROM foo\nINCLUDE self.mf\n",
+			"include cycle: " + filepath.Join(dir, "self.mf") + " -> " + filepath.Join(dir, "self.mf"),
+		},
+		{
+			"invalid fragment",
+			filepath.Join(dir, "Modelfile"),
+			"FROM foo\nINCLUDE bad.mf\n",
+			filepath.Join(dir, "bad.mf") + ":2:1: " + errInvalidCommand.Error(),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			modelfile, err := ParseFile(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.EqualError(t, modelfile.Include(tt.filename), tt.err)
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		modelfile, err := ParseFile(strings.NewReader("FROM foo\nINCLUDE missing.mf\n"))
+		require.NoError(t, err)
+		require.ErrorIs(t, modelfile.Include(filepath.Join(dir, "Modelfile")), os.ErrNotExist)
+	})
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errInvalidLabel = errors.New("label must be key=value")
+
+// ParseLabel returns the key and value of a LABEL, which is "key=value". The
+// value may be quoted.
+func ParseLabel(s string) (key, value string, err error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return "", "", errInvalidLabel
+	}
+
+	if !isValidLabelKey(key) {
+		return "", "", fmt.Errorf("invalid label key %q", key)
+	}
+
+	if s, ok := unquote(value); ok {
+		value = s
+	}
+
+	return key, value, nil
+}
+
+// FormatLabel returns the arguments of a LABEL which sets key to value.
+func FormatLabel(key, value string) string {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		// "" would be read as the start of triple quotes
+		value = `"""` + value + `"""`
+	case value == "", strings.TrimSpace(value) != value:
+		value = `"` + value + `"`
+	}
+
+	return key + "=" + value
+}
+
+func isValidLabelKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, r := range key {
+		if !isAlpha(r) && !isNumber(r) && !strings.ContainsRune("._-/", r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabel(t *testing.T) {
+	cases := []struct {
+		input string
+		key   string
+		value string
+		err   string
+	}{
+		{"owner=ml-team", "owner", "ml-team", ""},
+		{"eval.mmlu=0.71", "eval.mmlu", "0.71", ""},
+		{"org/dataset=a=b", "org/dataset", "a=b", ""},
+		{`lineage="a, then b"`, "lineage", "a, then b", ""},
+		{`note=" spaced "`, "note", " spaced ", ""},
+		{"empty=", "empty", "", ""},
+		{"owner", "", "", errInvalidLabel.Error()},
+		{"=value", "", "", `invalid label key ""`},
+		{"has space=value", "", "", `invalid label key "has space"`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			key, value, err := ParseLabel(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.key, key)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestFormatLabel(t *testing.T) {
+	for _, value := range []string{"ml-team", "a, then b", " spaced ", "", `"quoted"`, `""`, `"""triple`, "a=b"} {
+		t.Run(value, func(t *testing.T) {
+			modelfile, err := ParseFile(strings.NewReader("FROM foo\nLABEL " + FormatLabel("key", value) + "\n"))
+			require.NoError(t, err)
+			require.Len(t, modelfile.Commands, 2)
+
+			key, v, err := ParseLabel(modelfile.Commands[1].Args)
+			require.NoError(t, err)
+			assert.Equal(t, "key", key)
+			assert.Equal(t, value, v)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Severity is how serious a problem found by Lint is. Errors fail model
+// creation, warnings don't.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found by Lint.
+type Diagnostic struct {
+	Pos      Position
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Resolver checks that the model, adapter or fragment a FROM, ADAPTER or
+// INCLUDE command refers to exists. It returns nil if it does. The arguments
+// of an ADAPTER are only its path, without the scale.
+type Resolver func(cmd Command) *Diagnostic
+
+// Lint parses the Modelfile in r and returns every problem in it, ordered by
+// position. resolve checks the targets of FROM, ADAPTER and INCLUDE, if it
+// isn't nil. Included fragments aren't linted. The error is only set if r
+// can't be read.
+func Lint(r io.Reader, resolve Resolver) ([]Diagnostic, error) {
+	nodes, _, errs := parse(r)
+
+	var diags []Diagnostic
+	for _, err := range errs {
+		var perr *Error
+		if !errors.As(err, &perr) {
+			return nil, err
+		}
+
+		diags = append(diags, Diagnostic{perr.Pos, SeverityError, perr.Err.Error()})
+	}
+
+	var cmds []Command
+	for _, n := range nodes {
+		cmds = append(cmds, n.Command)
+	}
+
+	// ARGs without a default are given when the model is created so
+	// commands which use them can't be checked
+	var scope *argScope
+	if hasCommand(cmds, "arg") {
+		scope = newArgScope(nil)
+	}
+
+	var from bool
+	seen := make(map[string]Position)
+	for _, n := range nodes {
+		if n.Name == "model" {
+			from = true
+		}
+
+		if scope != nil {
+			if n.Name == "arg" {
+				if err := scope.declare(n.Args); err != nil && !errors.Is(err, errUnsetArg) {
+					diags = append(diags, Diagnostic{n.Pos, SeverityError, err.Error()})
+				}
+
+				continue
+			}
+
+			s, err := expand(n.Args, scope.lookup)
+			if errors.Is(err, errUnsetArg) {
+				continue
+			} else if err != nil {
+				diags = append(diags, Diagnostic{n.Pos, SeverityError, err.Error()})
+				continue
+			}
+
+			n.Args = s
+		}
+
+		switch n.Name {
+		case "model", "adapter", "include":
+			if n.Name == "adapter" {
+				if !from {
+					diags = append(diags, Diagnostic{n.Pos, SeverityError, "ADAPTER must come after FROM"})
+				}
+
+				// only the path is resolved
+				path, _, err := ParseAdapter(n.Args)
+				if err != nil {
+					diags = append(diags, Diagnostic{n.Pos, SeverityError, err.Error()})
+					continue
+				}
+
+				n.Args = path
+			}
+
+			if resolve != nil {
+				if d := resolve(n.Command); d != nil {
+					d.Pos = n.Pos
+					diags = append(diags, *d)
+				}
+			}
+		case "template", "system":
+			if p, ok := seen[n.Name]; ok {
+				diags = append(diags, Diagnostic{n.Pos, SeverityWarning, fmt.Sprintf("%s is also set at %s, only the last one is used", strings.ToUpper(n.Name), p)})
+			}
+
+			seen[n.Name] = n.Pos
+
+			if n.Name == "template" {
+				if _, err := template.New("").Option("missingkey=zero").Parse(n.Args); err != nil {
+					diags = append(diags, Diagnostic{n.Pos, SeverityError, fmt.Sprintf("invalid template: %s", err)})
+				}
+			}
+		case "label":
+			if _, _, err := ParseLabel(n.Args); err != nil {
+				diags = append(diags, Diagnostic{n.Pos, SeverityError, err.Error()})
+			}
+		case "license", "message", "metadata", "arg":
+			// pass
+		default:
+			if _, err := api.FormatParams(map[string][]string{n.Name: {n.Args}}); err != nil {
+				diags = append(diags, Diagnostic{n.Pos, SeverityError, fmt.Sprintf("%s: %s", n.Name, err)})
+			}
+		}
+	}
+
+	// FROM may be in an included fragment
+	if !from && !hasCommand(cmds, "include") {
+		diags = append(diags, Diagnostic{Position{Line: 1, Column: 1}, SeverityError, errMissingFrom.Error()})
+	}
+
+	slices.SortStableFunc(diags, func(a, b Diagnostic) int {
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line - b.Pos.Line
+		}
+
+		return a.Pos.Column - b.Pos.Column
+	})
+
+	return diags, nil
+}
@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected []Diagnostic
+	}{
+		{
+			"valid",
+			`FROM foo
+PARAMETER temperature 0.7
+PARAMETER stop <|eot_id|>
+TEMPLATE "{{ .System }} {{ .Prompt }}"
+SYSTEM You are a linter.
+`,
+			nil,
+		},
+		{
+			"every problem",
+			`# a model
+FROM foo
+PARAMETER temperatur 0.7
+PARAMETER num_ctx large
+BADCOMMAND value
+TEMPLATE "{{ .Prompt }"
+TEMPLATE {{ .Prompt }}
+  MESSAGE narrator once upon a time
+SYSTEM one
+SYSTEM two
+`,
+			[]Diagnostic{
+				{Position{3, 1}, SeverityError, "temperatur: unknown parameter 'temperatur'"},
+				{Position{4, 1}, SeverityError, "num_ctx: invalid int value [large]"},
+				{Position{5, 1}, SeverityError, errInvalidCommand.Error()},
+				{Position{6, 1}, SeverityError, `invalid template: template: :1: unexpected "}" in operand`},
+				{Position{7, 1}, SeverityWarning, "TEMPLATE is also set at 6:1, only the last one is used"},
+				{Position{8, 3}, SeverityError, errInvalidMessageRole.Error()},
+				{Position{10, 1}, SeverityWarning, "SYSTEM is also set at 9:1, only the last one is used"},
+			},
+		},
+		{
+			"labels",
+			`FROM foo
+LABEL owner=ml-team
+LABEL owner
+LABEL =value
+`,
+			[]Diagnostic{
+				{Position{3, 1}, SeverityError, errInvalidLabel.Error()},
+				{Position{4, 1}, SeverityError, `invalid label key ""`},
+			},
+		},
+		{
+			"adapter scale",
+			`FROM foo
+ADAPTER ./a.gguf SCALE 0.5
+ADAPTER ./b.gguf SCALE 1e40
+`,
+			[]Diagnostic{
+				{Position{3, 1}, SeverityError, `invalid adapter scale "1e40"`},
+			},
+		},
+		{
+			"adapter before from",
+			"ADAPTER ./adapter.gguf\nFROM foo\n",
+			[]Diagnostic{
+				{Position{1, 1}, SeverityError, "ADAPTER must come after FROM"},
+			},
+		},
+		{
+			"missing from",
+			"\nPARAMETER temperature 0.7\n",
+			[]Diagnostic{
+				{Position{1, 1}, SeverityError, errMissingFrom.Error()},
+			},
+		},
+		{
+			"args",
+			`ARG base=llama3
+ARG ctx
+ARG 2x=1
+FROM ${base}
+PARAMETER num_ctx ${ctx}
+PARAMETER temperature ${temp}
+`,
+			[]Diagnostic{
+				{Position{3, 1}, SeverityError, `invalid ARG name "2x"`},
+				{Position{6, 1}, SeverityError, "undefined variable: temp"},
+			},
+		},
+		{
+			"invalid character",
+			"FROM foo\nPARAMETER top-k 40\nPARAMETER top_k forty\n",
+			[]Diagnostic{
+				{Position{2, 14}, SeverityError, "unexpected EOF: top"},
+				{Position{3, 1}, SeverityError, "top_k: invalid int value [forty]"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			diags, err := Lint(strings.NewReader(tt.input), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, diags)
+		})
+	}
+}
+
+func TestLintResolve(t *testing.T) {
+	input := `FROM foo
+ADAPTER ./missing.gguf SCALE 0.5
+`
+
+	var resolved []Command
+	diags, err := Lint(strings.NewReader(input), func(cmd Command) *Diagnostic {
+		resolved = append(resolved, cmd)
+		if cmd.Name == "adapter" {
+			return &Diagnostic{Severity: SeverityError, Message: "./missing.gguf doesn't exist"}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "adapter", Args: "./missing.gguf"}}, resolved)
+	assert.Equal(t, []Diagnostic{{Position{2, 1}, SeverityError, "./missing.gguf doesn't exist"}}, diags)
+}
+
+func TestParseFileErrorPosition(t *testing.T) {
+	_, err := ParseFile(strings.NewReader("FROM foo\n\nBADCOMMAND value\n"))
+	require.ErrorIs(t, err, errInvalidCommand)
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, Position{3, 1}, perr.Pos)
+	assert.Equal(t, "3:1: "+errInvalidCommand.Error(), err.Error())
+}
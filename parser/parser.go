@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -15,12 +16,28 @@ import (
 
 type File struct {
 	Commands []Command
+
+	// Comments are the comment lines, and blank lines as empty strings,
+	// before each command by its index. Those at the end of the file are at
+	// len(Commands).
+	Comments map[int][]string
 }
 
 func (f File) String() string {
 	var sb strings.Builder
-	for _, cmd := range f.Commands {
-		fmt.Fprintln(&sb, cmd.String())
+	for i := 0; i <= len(f.Commands); i++ {
+		for _, comment := range f.Comments[i] {
+			if comment == "" && sb.Len() == 0 {
+				// blank lines at the start of the file are dropped
+				continue
+			}
+
+			fmt.Fprintln(&sb, comment)
+		}
+
+		if i < len(f.Commands) {
+			fmt.Fprintln(&sb, f.Commands[i].String())
+		}
 	}
 
 	return sb.String()
@@ -36,11 +53,14 @@ func (c Command) String() string {
 	switch c.Name {
 	case "model":
 		fmt.Fprintf(&sb, "FROM %s", c.Args)
-	case "license", "template", "system", "adapter":
+	case "license", "template", "system", "adapter", "arg", "include", "label":
 		fmt.Fprintf(&sb, "%s %s", strings.ToUpper(c.Name), quote(c.Args))
 	case "message":
 		role, message, _ := strings.Cut(c.Args, ": ")
 		fmt.Fprintf(&sb, "MESSAGE %s %s", role, quote(message))
+	case "metadata":
+		key, value, _ := strings.Cut(c.Args, ": ")
+		fmt.Fprintf(&sb, "METADATA %s %s", key, quote(value))
 	default:
 		fmt.Fprintf(&sb, "PARAMETER %s %s", c.Name, quote(c.Args))
 	}
@@ -56,22 +76,157 @@ const (
 	stateValue
 	stateParameter
 	stateMessage
+	stateMetadata
 	stateComment
 )
 
 var (
 	errMissingFrom        = errors.New("no FROM line")
 	errInvalidMessageRole = errors.New("message role must be one of \"system\", \"user\", or \"assistant\"")
-	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", or \"message\"")
+	errInvalidCommand     = errors.New("command must be one of \"from\", \"license\", \"template\", \"system\", \"adapter\", \"parameter\", \"message\", \"metadata\", \"arg\", \"include\", or \"label\"")
 )
 
+// Position is a location in a Modelfile. Line and Column start at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Error is an error at a position in a Modelfile.
+type Error struct {
+	Pos Position
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// node is a command, the position it starts at and the comments before it.
+type node struct {
+	Command
+	Pos      Position
+	Comments []string
+}
+
 func ParseFile(r io.Reader) (*File, error) {
+	nodes, trailing, errs := parse(r)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	f := newFile(nodes, trailing)
+
+	// FROM may be in an included fragment, which is checked by Include
+	if hasCommand(f.Commands, "model") || hasCommand(f.Commands, "include") {
+		return f, nil
+	}
+
+	return nil, errMissingFrom
+}
+
+func newFile(nodes []node, trailing []string) *File {
+	var f File
+	for i, n := range nodes {
+		f.Commands = append(f.Commands, n.Command)
+		f.addComments(i, n.Comments)
+	}
+
+	f.addComments(len(nodes), trailing)
+	return &f
+}
+
+func (f *File) addComments(i int, comments []string) {
+	if len(comments) > 0 {
+		if f.Comments == nil {
+			f.Comments = make(map[int][]string)
+		}
+
+		f.Comments[i] = comments
+	}
+}
+
+// splice replaces every command of f with the commands fn returns for it.
+// Comments before a command stay before the first command that replaces it,
+// or move to the next command if there's none.
+func (f *File) splice(fn func(Command) ([]Command, error)) error {
+	var spliced File
+	var comments []string
+	for i, cmd := range f.Commands {
+		comments = append(comments, f.Comments[i]...)
+
+		cmds, err := fn(cmd)
+		if err != nil {
+			return err
+		}
+
+		if len(cmds) > 0 {
+			spliced.addComments(len(spliced.Commands), comments)
+			spliced.Commands = append(spliced.Commands, cmds...)
+			comments = nil
+		}
+	}
+
+	spliced.addComments(len(spliced.Commands), append(comments, f.Comments[len(f.Commands)]...))
+	*f = spliced
+	return nil
+}
+
+// hasCommand reports whether any of cmds is called name.
+func hasCommand(cmds []Command, name string) bool {
+	return slices.ContainsFunc(cmds, func(cmd Command) bool {
+		return cmd.Name == name
+	})
+}
+
+// parse parses the commands in r and the comments before them, trailing is the
+// comments after the last command. Blank lines at the start and end of r are
+// dropped and runs of blank lines are collapsed to one. Invalid commands and
+// message roles are skipped, as is the rest of a line with an invalid
+// character, so every error is returned rather than only the first.
+func parse(r io.Reader) (nodes []node, trailing []string, errs []error) {
 	var cmd Command
 	var curr state
 	var b bytes.Buffer
 	var role string
+	var key string
 
-	var f File
+	// skip is set when the command being parsed is invalid, its value is
+	// read but the command is dropped
+	var skip bool
+
+	pos := Position{Line: 1, Column: 1}
+	var start Position
+
+	// comments are the comments and blank lines since the last command
+	var comments []string
+	blank := true
+	addBlank := func() {
+		if len(comments) > 0 && comments[len(comments)-1] != "" || len(comments) == 0 && len(nodes) > 0 {
+			comments = append(comments, "")
+		}
+	}
+
+	// skipLine skips to the next line after an error at r
+	skipLine := func(r rune, err error) {
+		errs = append(errs, err)
+
+		curr = stateComment
+		if isNewline(r) {
+			curr = stateNil
+		}
+
+		b.Reset()
+		role, key, skip = "", "", false
+	}
 
 	tr := unicode.BOMOverride(unicode.UTF8.NewDecoder())
 	br := bufio.NewReader(transform.NewReader(r, tr))
@@ -81,14 +236,32 @@ func ParseFile(r io.Reader) (*File, error) {
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return nil, err
+			return nodes, nil, append(errs, err)
+		}
+
+		at := pos
+		if r == '\n' {
+			if curr == stateNil && blank {
+				addBlank()
+			}
+
+			pos.Line++
+			pos.Column = 1
+			blank = true
+		} else {
+			pos.Column++
+			if !isSpace(r) && !isNewline(r) {
+				blank = false
+			}
 		}
 
 		next, r, err := parseRuneForState(r, curr)
 		if errors.Is(err, io.ErrUnexpectedEOF) {
-			return nil, fmt.Errorf("%w: %s", err, b.String())
+			skipLine(r, &Error{at, fmt.Errorf("%w: %s", err, b.String())})
+			continue
 		} else if err != nil {
-			return nil, err
+			skipLine(r, &Error{at, err})
+			continue
 		}
 
 		// process the state transition, some transitions need to be intercepted and redirected
@@ -96,7 +269,9 @@ func ParseFile(r io.Reader) (*File, error) {
 			switch curr {
 			case stateName:
 				if !isValidCommand(b.String()) {
-					return nil, errInvalidCommand
+					errs = append(errs, &Error{start, errInvalidCommand})
+					skip = true
+					break
 				}
 
 				// next state sometimes depends on the current buffer value
@@ -106,6 +281,10 @@ func ParseFile(r io.Reader) (*File, error) {
 				case "parameter":
 					// transition to stateParameter which sets command name
 					next = stateParameter
+				case "metadata":
+					// transition to stateMetadata which reads the key
+					next = stateMetadata
+					cmd.Name = s
 				case "message":
 					// transition to stateMessage which validates the message role
 					next = stateMessage
@@ -117,17 +296,28 @@ func ParseFile(r io.Reader) (*File, error) {
 				cmd.Name = b.String()
 			case stateMessage:
 				if !isValidMessageRole(b.String()) {
-					return nil, errInvalidMessageRole
+					errs = append(errs, &Error{start, errInvalidMessageRole})
+					skip = true
 				}
 
 				role = b.String()
+			case stateMetadata:
+				key = b.String()
 			case stateComment, stateNil:
-				// pass
+				if next == stateName {
+					start = at
+				}
+
+				// the rest of a line with an error is also skipped as a
+				// comment but it doesn't start with #
+				if curr == stateComment && strings.HasPrefix(b.String(), "#") {
+					comments = append(comments, strings.TrimRight(b.String(), " \t\r"))
+				}
 			case stateValue:
 				s, ok := unquote(b.String())
 				if !ok || isSpace(r) {
 					if _, err := b.WriteRune(r); err != nil {
-						return nil, err
+						return nodes, nil, append(errs, err)
 					}
 
 					continue
@@ -138,8 +328,20 @@ func ParseFile(r io.Reader) (*File, error) {
 					role = ""
 				}
 
+				if key != "" {
+					s = key + ": " + s
+					key = ""
+				}
+
 				cmd.Args = s
-				f.Commands = append(f.Commands, cmd)
+				if err := validate(cmd); err != nil {
+					errs = append(errs, &Error{start, err})
+				} else if !skip {
+					nodes = append(nodes, node{cmd, start, comments})
+					comments = nil
+				}
+
+				skip = false
 			}
 
 			b.Reset()
@@ -148,38 +350,59 @@ func ParseFile(r io.Reader) (*File, error) {
 
 		if strconv.IsPrint(r) {
 			if _, err := b.WriteRune(r); err != nil {
-				return nil, err
+				return nodes, nil, append(errs, err)
 			}
 		}
 	}
 
 	// flush the buffer
 	switch curr {
-	case stateComment, stateNil:
+	case stateNil:
 		// pass; nothing to flush
+	case stateComment:
+		if strings.HasPrefix(b.String(), "#") {
+			comments = append(comments, strings.TrimRight(b.String(), " \t\r"))
+		}
 	case stateValue:
 		s, ok := unquote(b.String())
 		if !ok {
-			return nil, io.ErrUnexpectedEOF
+			return nodes, nil, append(errs, &Error{pos, io.ErrUnexpectedEOF})
 		}
 
 		if role != "" {
 			s = role + ": " + s
 		}
 
+		if key != "" {
+			s = key + ": " + s
+		}
+
 		cmd.Args = s
-		f.Commands = append(f.Commands, cmd)
+		if err := validate(cmd); err != nil {
+			errs = append(errs, &Error{start, err})
+		} else if !skip {
+			nodes = append(nodes, node{cmd, start, comments})
+			comments = nil
+		}
 	default:
-		return nil, io.ErrUnexpectedEOF
+		return nodes, nil, append(errs, &Error{pos, io.ErrUnexpectedEOF})
 	}
 
-	for _, cmd := range f.Commands {
-		if cmd.Name == "model" {
-			return &f, nil
-		}
+	if len(comments) > 0 && comments[len(comments)-1] == "" {
+		comments = comments[:len(comments)-1]
 	}
 
-	return nil, errMissingFrom
+	return nodes, comments, errs
+}
+
+// validate checks the arguments of commands which have a fixed form.
+func validate(cmd Command) error {
+	if cmd.Name == "adapter" {
+		_, _, err := ParseAdapter(cmd.Args)
+		return err
+	}
+
+	return nil
 }
 
 func parseRuneForState(r rune, cs state) (state, rune, error) {
@@ -187,7 +410,7 @@ func parseRuneForState(r rune, cs state) (state, rune, error) {
 	case stateNil:
 		switch {
 		case r == '#':
-			return stateComment, 0, nil
+			return stateComment, r, nil
 		case isSpace(r), isNewline(r):
 			return stateNil, 0, nil
 		default:
@@ -229,21 +452,38 @@ func parseRuneForState(r rune, cs state) (state, rune, error) {
 		default:
 			return stateNil, 0, io.ErrUnexpectedEOF
 		}
+	case stateMetadata:
+		switch {
+		case isAlpha(r), isNumber(r), r == '_', r == '.', r == '-':
+			return stateMetadata, r, nil
+		case isSpace(r):
+			return stateValue, 0, nil
+		default:
+			return stateNil, 0, io.ErrUnexpectedEOF
+		}
 	case stateComment:
 		switch {
 		case isNewline(r):
 			return stateNil, 0, nil
 		default:
-			return stateComment, 0, nil
+			return stateComment, r, nil
 		}
 	default:
 		return stateNil, 0, errors.New("")
 	}
 }
 
+// quote quotes s if it can't be used as a value as is. Multiline values are
+// always in triple quotes. A value with """ at the end of a line can't be
+// written in a Modelfile since it would end the triple quotes.
 func quote(s string) string {
-	if strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasSuffix(s, " ") {
-		if strings.Contains(s, "\"") {
+	switch {
+	case s == "":
+		return `""`
+	case strings.Contains(s, "\n"), strings.HasPrefix(s, `"`):
+		return `"""` + s + `"""`
+	case strings.HasPrefix(s, " "), strings.HasSuffix(s, " "):
+		if strings.Contains(s, `"`) {
 			return `"""` + s + `"""`
 		}
 
@@ -296,7 +536,7 @@ func isValidMessageRole(role string) bool {
 
 func isValidCommand(cmd string) bool {
 	switch strings.ToLower(cmd) {
-	case "from", "license", "template", "system", "adapter", "parameter", "message":
+	case "from", "license", "template", "system", "adapter", "parameter", "message", "metadata", "arg", "include", "label":
 		return true
 	default:
 		return false
@@ -120,6 +120,22 @@ BADCOMMAND param1 value1
 	require.ErrorIs(t, err, errInvalidCommand)
 }
 
+func TestParseFileBadAdapter(t *testing.T) {
+	for _, input := range []string{
+		"FROM foo\nADAPTER ./a.gguf scale=abc\n",
+		"FROM foo\nADAPTER ./a.gguf SCALE NaN",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseFile(strings.NewReader(input))
+
+			var perr *Error
+			require.ErrorAs(t, err, &perr)
+			assert.Equal(t, Position{Line: 2, Column: 1}, perr.Pos)
+			assert.ErrorContains(t, err, "invalid adapter scale")
+		})
+	}
+}
+
 func TestParseFileMessages(t *testing.T) {
 	var cases = []struct {
 		input    string
@@ -425,6 +441,62 @@ func TestParseFileParameters(t *testing.T) {
 	}
 }
 
+func TestParseFileMetadata(t *testing.T) {
+	var cases = []struct {
+		input    string
+		expected []Command
+		err      error
+	}{
+		{
+			"METADATA llama.context_length 8192",
+			[]Command{{Name: "metadata", Args: "llama.context_length: 8192"}},
+			nil,
+		},
+		{
+			"METADATA tokenizer.ggml.eos_token_id 128009",
+			[]Command{{Name: "metadata", Args: "tokenizer.ggml.eos_token_id: 128009"}},
+			nil,
+		},
+		{
+			"METADATA tokenizer.chat_template \"\"\"{{ .Prompt }}\n\"\"\"",
+			[]Command{{Name: "metadata", Args: "tokenizer.chat_template: {{ .Prompt }}\n"}},
+			nil,
+		},
+		{
+			"METADATA general.name my model",
+			[]Command{{Name: "metadata", Args: "general.name: my model"}},
+			nil,
+		},
+		{
+			"METADATA general/name foo",
+			nil,
+			io.ErrUnexpectedEOF,
+		},
+		{
+			"METADATA general.name",
+			nil,
+			io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run("", func(t *testing.T) {
+			var b bytes.Buffer
+			fmt.Fprintln(&b, "FROM foo")
+			fmt.Fprintln(&b, c.input)
+
+			modelfile, err := ParseFile(&b)
+			if c.err != nil {
+				assert.ErrorIs(t, err, c.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, append([]Command{{Name: "model", Args: "foo"}}, c.expected...), modelfile.Commands)
+		})
+	}
+}
+
 func TestParseFileComments(t *testing.T) {
 	var cases = []struct {
 		input    string
@@ -497,6 +569,19 @@ MESSAGE assistant Hello, I want to parse all the things!
 		`
 FROM foo
 SYSTEM ""
+`,
+		`
+ARG base=foo
+ARG system=" a system message "
+FROM ${base}
+SYSTEM ${system}
+`,
+		`
+FROM foo
+METADATA llama.context_length 8192
+METADATA tokenizer.chat_template """
+{{ .Prompt }}
+"""
 `,
 	}
 
@@ -513,6 +598,16 @@ SYSTEM ""
 	}
 }
 
+func TestQuote(t *testing.T) {
+	for _, value := range []string{`"`, `"""`, `"""triple`, `"""triple"""`, `""" spaced `, "\"\"\"multi\nline"} {
+		t.Run(value, func(t *testing.T) {
+			modelfile, err := ParseFile(strings.NewReader("FROM foo\nSYSTEM " + quote(value) + "\n"))
+			require.NoError(t, err)
+			assert.Equal(t, []Command{{Name: "model", Args: "foo"}, {Name: "system", Args: value}}, modelfile.Commands)
+		})
+	}
+}
+
 func TestParseFileUTF16ParseFile(t *testing.T) {
 	data := `FROM bob
 PARAMETER param1 1
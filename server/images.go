@@ -24,6 +24,7 @@ import (
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/convert"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/llm"
@@ -38,6 +39,9 @@ type registryOptions struct {
 	Username string
 	Password string
 	Token    string
+
+	// Sign adds a signature made with the local key when pushing
+	Sign bool
 }
 
 type Model struct {
@@ -47,19 +51,35 @@ type Model struct {
 	ModelPath      string
 	ParentModel    string
 	AdapterPaths   []string
+	AdapterScales  []float32
 	ProjectorPaths []string
 	Template       string
+	ChatTemplate   ChatTemplate
 	System         string
 	License        []string
 	Digest         string
 	Options        map[string]interface{}
 	Messages       []Message
+
+	// Modelfile is the source of the Modelfile the model was created from.
+	// It's empty for models created before it was kept.
+	Modelfile string
 }
 
 func (m *Model) IsEmbedding() bool {
 	return slices.Contains(m.Config.ModelFamilies, "bert") || slices.Contains(m.Config.ModelFamilies, "nomic-bert")
 }
 
+// adapterScale returns the scale the i'th adapter is applied at.
+func (m *Model) adapterScale(i int) float32 {
+	if i < len(m.AdapterScales) {
+		return m.AdapterScales[i]
+	}
+
+	return 1
+}
+
+// String returns a Modelfile generated from the model.
 func (m *Model) String() string {
 	var modelfile parser.File
 
@@ -68,10 +88,10 @@ func (m *Model) String() string {
 		Args: m.ModelPath,
 	})
 
-	for _, adapter := range m.AdapterPaths {
+	for i, adapter := range m.AdapterPaths {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "adapter",
-			Args: adapter,
+			Args: parser.FormatAdapter(adapter, m.adapterScale(i)),
 		})
 	}
 
@@ -96,8 +116,15 @@ func (m *Model) String() string {
 		})
 	}
 
-	for k, v := range m.Options {
-		switch v := v.(type) {
+	// options are a map so they're sorted to make the output stable
+	keys := make([]string, 0, len(m.Options))
+	for k := range m.Options {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	for _, k := range keys {
+		switch v := m.Options[k].(type) {
 		case []any:
 			for _, s := range v {
 				modelfile.Commands = append(modelfile.Commands, parser.Command{
@@ -113,6 +140,19 @@ func (m *Model) String() string {
 		}
 	}
 
+	labels := make([]string, 0, len(m.Config.Labels))
+	for k := range m.Config.Labels {
+		labels = append(labels, k)
+	}
+
+	slices.Sort(labels)
+	for _, k := range labels {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "label",
+			Args: parser.FormatLabel(k, m.Config.Labels[k]),
+		})
+	}
+
 	for _, license := range m.License {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "license",
@@ -123,7 +163,7 @@ func (m *Model) String() string {
 	for _, msg := range m.Messages {
 		modelfile.Commands = append(modelfile.Commands, parser.Command{
 			Name: "message",
-			Args: fmt.Sprintf("%s %s", msg.Role, msg.Content),
+			Args: fmt.Sprintf("%s: %s", msg.Role, msg.Content),
 		})
 	}
 
@@ -149,6 +189,9 @@ type ConfigV2 struct {
 	ModelType     string   `json:"model_type"`
 	FileType      string   `json:"file_type"`
 
+	// Labels are set by LABEL in the Modelfile
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// required by spec
 	Architecture string `json:"architecture"`
 	OS           string `json:"os"`
@@ -161,15 +204,11 @@ type RootFS struct {
 }
 
 func GetManifest(mp ModelPath) (*ManifestV2, string, error) {
-	fp, err := mp.GetManifestPath()
+	fp, err := mp.findManifestPath()
 	if err != nil {
 		return nil, "", err
 	}
 
-	if _, err = os.Stat(fp); err != nil {
-		return nil, "", err
-	}
-
 	var manifest *ManifestV2
 
 	bts, err := os.ReadFile(fp)
@@ -217,6 +256,7 @@ func GetModel(name string) (*Model, error) {
 		return nil, err
 	}
 
+	var hasTemplate bool
 	for _, layer := range manifest.Layers {
 		filename, err := GetBlobsPath(layer.Digest)
 		if err != nil {
@@ -232,7 +272,18 @@ func GetModel(name string) (*Model, error) {
 			// TODO: remove this warning in a future version
 			slog.Info("WARNING: model contains embeddings, but embeddings in modelfiles have been deprecated and will be ignored.")
 		case "application/vnd.ollama.image.adapter":
+			scale := float32(1)
+			if s, ok := layer.Annotations[annotationAdapterScale]; ok {
+				f, err := strconv.ParseFloat(s, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid adapter scale: %w", err)
+				}
+
+				scale = float32(f)
+			}
+
 			model.AdapterPaths = append(model.AdapterPaths, filename)
+			model.AdapterScales = append(model.AdapterScales, scale)
 		case "application/vnd.ollama.image.projector":
 			model.ProjectorPaths = append(model.ProjectorPaths, filename)
 		case "application/vnd.ollama.image.template":
@@ -242,6 +293,18 @@ func GetModel(name string) (*Model, error) {
 			}
 
 			model.Template = string(bts)
+			hasTemplate = true
+		case "application/vnd.ollama.image.chat_template":
+			bts, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+
+			model.ChatTemplate = ChatTemplate{
+				Template: string(bts),
+				BOSToken: layer.Annotations[annotationBOSToken],
+				EOSToken: layer.Annotations[annotationEOSToken],
+			}
 		case "application/vnd.ollama.image.system":
 			bts, err := os.ReadFile(filename)
 			if err != nil {
@@ -256,6 +319,7 @@ func GetModel(name string) (*Model, error) {
 			}
 
 			model.Template = string(bts)
+			hasTemplate = true
 		case "application/vnd.ollama.image.params":
 			params, err := os.Open(filename)
 			if err != nil {
@@ -283,9 +347,21 @@ func GetModel(name string) (*Model, error) {
 				return nil, err
 			}
 			model.License = append(model.License, string(bts))
+		case "application/vnd.ollama.image.modelfile":
+			bts, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+
+			model.Modelfile = string(bts)
 		}
 	}
 
+	// a Go template takes precedence over the model's own chat template
+	if !hasTemplate && model.ChatTemplate.Template != "" {
+		model.Template = ""
+	}
+
 	return model, nil
 }
 
@@ -314,7 +390,7 @@ func realpath(rel, from string) string {
 	return abspath
 }
 
-func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantization string, modelfile *parser.File, fn func(resp api.ProgressResponse)) (err error) {
+func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantization, source string, modelfile *parser.File, fn func(resp api.ProgressResponse)) (err error) {
 	config := ConfigV2{
 		OS:           "linux",
 		Architecture: "amd64",
@@ -324,22 +400,64 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 	}
 
 	var messages []*api.Message
+	var metadata []string
+	// template is set if the Modelfile sets TEMPLATE, which takes precedence
+	// over templates detected from metadata
+	var template bool
 	parameters := make(map[string]any)
+	labels := make(map[string]string)
 
 	var layers []*Layer
+	// base is the model adapters are applied to
+	var base *llm.GGML
 	for _, c := range modelfile.Commands {
 		mediatype := fmt.Sprintf("application/vnd.ollama.image.%s", c.Name)
 
 		switch c.Name {
 		case "model", "adapter":
+			target, scale := c.Args, float32(1)
+			if c.Name == "adapter" {
+				target, scale, err = parser.ParseAdapter(c.Args)
+				if err != nil {
+					return err
+				}
+			}
+
 			var baseLayers []*layerGGML
-			if name := model.ParseName(c.Args); name.IsValid() {
+			files, err := openSplitFiles(modelFileDir, target)
+			if err != nil {
+				return err
+			}
+
+			for _, file := range files {
+				defer file.Close()
+			}
+
+			if len(files) > 0 {
+				baseLayers, err = parseFromSplitFiles(files, fn)
+				if err != nil {
+					return err
+				}
+			} else if name := model.ParseName(target); name.IsValid() {
 				baseLayers, err = parseFromModel(ctx, name, fn)
 				if err != nil {
 					return err
 				}
-			} else if strings.HasPrefix(c.Args, "@") {
-				digest := strings.TrimPrefix(c.Args, "@")
+
+				baseLabels, err := modelLabels(name)
+				if err != nil {
+					return err
+				}
+
+				for k, v := range baseLabels {
+					if config.Labels == nil {
+						config.Labels = make(map[string]string)
+					}
+
+					config.Labels[k] = v
+				}
+			} else if strings.HasPrefix(target, "@") {
+				digest := strings.TrimPrefix(target, "@")
 				if ib, ok := intermediateBlobs[digest]; ok {
 					p, err := GetBlobsPath(ib)
 					if err != nil {
@@ -367,19 +485,19 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				}
 				defer blob.Close()
 
-				baseLayers, err = parseFromFile(ctx, blob, digest, fn)
+				baseLayers, err = parseFromFile(ctx, blob, digest, base, quantization, fn)
 				if err != nil {
 					return err
 				}
-			} else if file, err := os.Open(realpath(modelFileDir, c.Args)); err == nil {
+			} else if file, err := os.Open(realpath(modelFileDir, target)); err == nil {
 				defer file.Close()
 
-				baseLayers, err = parseFromFile(ctx, file, "", fn)
+				baseLayers, err = parseFromFile(ctx, file, "", base, quantization, fn)
 				if err != nil {
 					return err
 				}
 			} else {
-				return fmt.Errorf("invalid model reference: %s", c.Args)
+				return fmt.Errorf("invalid model reference: %s", target)
 			}
 
 			for _, baseLayer := range baseLayers {
@@ -393,9 +511,11 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 					}
 
 					ft := baseLayer.GGML.KV().FileType()
-					if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
+					if want == ft {
+						// already quantized during conversion
+					} else if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
 						return errors.New("quantization is only supported for F16 and F32 models")
-					} else if want != ft {
+					} else {
 						fn(api.ProgressResponse{Status: fmt.Sprintf("quantizing %s model to %s", ft, quantization)})
 
 						blob, err := GetBlobsPath(baseLayer.Digest)
@@ -433,6 +553,10 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 					}
 				}
 
+				if baseLayer.GGML != nil && baseLayer.MediaType == "application/vnd.ollama.image.model" {
+					base = baseLayer.GGML
+				}
+
 				if baseLayer.GGML != nil {
 					config.ModelFormat = cmp.Or(config.ModelFormat, baseLayer.GGML.Name())
 					config.ModelFamily = cmp.Or(config.ModelFamily, baseLayer.GGML.KV().Architecture())
@@ -441,9 +565,14 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 					config.ModelFamilies = append(config.ModelFamilies, baseLayer.GGML.KV().Architecture())
 				}
 
+				if scale != 1 && baseLayer.MediaType == "application/vnd.ollama.image.adapter" {
+					baseLayer.Annotations = map[string]string{annotationAdapterScale: strconv.FormatFloat(float64(scale), 'g', -1, 32)}
+				}
+
 				layers = append(layers, baseLayer.Layer)
 			}
 		case "license", "template", "system":
+			template = template || c.Name == "template"
 			if c.Name != "license" {
 				// replace
 				layers = slices.DeleteFunc(layers, func(layer *Layer) bool {
@@ -473,6 +602,15 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 			}
 
 			messages = append(messages, &api.Message{Role: role, Content: content})
+		case "metadata":
+			metadata = append(metadata, c.Args)
+		case "label":
+			key, value, err := parser.ParseLabel(c.Args)
+			if err != nil {
+				return err
+			}
+
+			labels[key] = value
 		default:
 			ps, err := api.FormatParams(map[string][]string{c.Name: {c.Args}})
 			if err != nil {
@@ -491,6 +629,56 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 		}
 	}
 
+	// labels of a base model are inherited unless they're set again
+	for k, v := range labels {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+
+		config.Labels[k] = v
+	}
+
+	if len(metadata) > 0 {
+		i := slices.IndexFunc(layers, func(layer *Layer) bool {
+			return layer.MediaType == "application/vnd.ollama.image.model"
+		})
+		if i < 0 {
+			return errors.New("metadata can only be set for a model")
+		}
+
+		fn(api.ProgressResponse{Status: "writing model metadata"})
+		baseLayer, err := setMetadata(layers[i], metadata)
+		if err != nil {
+			return err
+		}
+
+		layers[i] = baseLayer.Layer
+
+		// templates detected from the original metadata are replaced by those
+		// of the new metadata
+		if slices.ContainsFunc(metadata, func(s string) bool {
+			return strings.HasPrefix(s, "tokenizer.chat_template: ") ||
+				strings.HasPrefix(s, "tokenizer.ggml.bos_token_id: ") ||
+				strings.HasPrefix(s, "tokenizer.ggml.eos_token_id: ")
+		}) {
+			detected, err := detectChatTemplate([]*layerGGML{baseLayer})
+			if err != nil {
+				return err
+			}
+
+			layers = slices.DeleteFunc(layers, func(layer *Layer) bool {
+				return layer.MediaType == "application/vnd.ollama.image.chat_template" ||
+					layer.MediaType == "application/vnd.ollama.image.template" && !template
+			})
+
+			for _, layer := range detected[1:] {
+				if layer.MediaType != "application/vnd.ollama.image.template" || !template {
+					layers = append(layers, layer.Layer)
+				}
+			}
+		}
+	}
+
 	var err2 error
 	layers = slices.DeleteFunc(layers, func(layer *Layer) bool {
 		switch layer.MediaType {
@@ -501,6 +689,9 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 			}
 
 			return false
+		case "application/vnd.ollama.image.modelfile":
+			// the Modelfile of the base model doesn't describe this one
+			return true
 		case "application/vnd.ollama.image.params":
 			// merge inherited parameters with new ones
 			r, err := layer.Open()
@@ -567,6 +758,17 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 
 	config.RootFS.DiffIDs = digests
 
+	// the source of the Modelfile is kept for show. It describes the model
+	// rather than being part of it so it isn't in the config
+	if source != "" {
+		layer, err := NewLayer(strings.NewReader(source), "application/vnd.ollama.image.modelfile")
+		if err != nil {
+			return err
+		}
+
+		layers = append(layers, layer)
+	}
+
 	var b bytes.Buffer
 	if err := json.NewEncoder(&b).Encode(config); err != nil {
 		return err
@@ -600,6 +802,35 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 	return nil
 }
 
+func ExportModel(name model.Name, path string, fn func(resp api.ProgressResponse)) error {
+	m, err := GetModel(name.String())
+	if err != nil {
+		return err
+	}
+
+	if len(m.AdapterPaths) > 0 {
+		return errors.New("models with adapters can't be exported")
+	}
+
+	if len(m.ProjectorPaths) > 0 {
+		return errors.New("models with projectors can't be exported")
+	}
+
+	if m.ModelPath == "" {
+		return errors.New("model has no weights to export")
+	}
+
+	fn(api.ProgressResponse{Status: fmt.Sprintf("exporting to %s", path)})
+	if err := convert.Export(m.ModelPath, path, func(status string) {
+		fn(api.ProgressResponse{Status: status})
+	}); err != nil {
+		return err
+	}
+
+	fn(api.ProgressResponse{Status: "success"})
+	return nil
+}
+
 func CopyModel(src, dst model.Name) error {
 	if !dst.IsFullyQualified() {
 		return model.Unqualified(dst)
@@ -622,7 +853,11 @@ func CopyModel(src, dst model.Name) error {
 		return err
 	}
 
-	srcpath := filepath.Join(manifests, src.Filepath())
+	_, srcpath, err := findModelsFile("manifests", src.Filepath())
+	if err != nil {
+		return err
+	}
+
 	srcfile, err := os.Open(srcpath)
 	if err != nil {
 		return err
@@ -640,54 +875,49 @@ func CopyModel(src, dst model.Name) error {
 }
 
 func deleteUnusedLayers(skipModelPath *ModelPath, deleteMap map[string]struct{}) error {
-	fp, err := GetManifestPath()
-	if err != nil {
-		return err
-	}
+	// layers can be used by models in any of the models directories
+	for _, root := range modelsDirs() {
+		fp := filepath.Join(root, "manifests")
 
-	walkFunc := func(path string, info os.FileInfo, _ error) error {
-		if info.IsDir() {
-			return nil
-		}
+		walkFunc := func(path string, info os.FileInfo, _ error) error {
+			if info == nil || info.IsDir() {
+				return nil
+			}
 
-		dir, file := filepath.Split(path)
-		dir = strings.Trim(strings.TrimPrefix(dir, fp), string(os.PathSeparator))
-		tag := strings.Join([]string{dir, file}, ":")
-		fmp := ParseModelPath(tag)
+			dir, file := filepath.Split(path)
+			dir = strings.Trim(strings.TrimPrefix(dir, fp), string(os.PathSeparator))
+			tag := strings.Join([]string{dir, file}, ":")
+			fmp := ParseModelPath(tag)
 
-		// skip the manifest we're trying to delete
-		if skipModelPath != nil && skipModelPath.GetFullTagname() == fmp.GetFullTagname() {
-			return nil
-		}
+			// skip the manifest we're trying to delete
+			if skipModelPath != nil && skipModelPath.GetFullTagname() == fmp.GetFullTagname() {
+				return nil
+			}
 
-		// save (i.e. delete from the deleteMap) any files used in other manifests
-		manifest, _, err := GetManifest(fmp)
-		if err != nil {
-			//nolint:nilerr
+			// save (i.e. delete from the deleteMap) any files used in other manifests
+			manifest, _, err := GetManifest(fmp)
+			if err != nil {
+				//nolint:nilerr
+				return nil
+			}
+
+			for _, layer := range manifest.Layers {
+				delete(deleteMap, layer.Digest)
+			}
+
+			delete(deleteMap, manifest.Config.Digest)
 			return nil
 		}
 
-		for _, layer := range manifest.Layers {
-			delete(deleteMap, layer.Digest)
+		if err := filepath.Walk(fp, walkFunc); err != nil {
+			return err
 		}
-
-		delete(deleteMap, manifest.Config.Digest)
-		return nil
-	}
-
-	if err := filepath.Walk(fp, walkFunc); err != nil {
-		return err
 	}
 
 	// only delete the files which are still in the deleteMap
 	for k := range deleteMap {
-		fp, err := GetBlobsPath(k)
-		if err != nil {
-			slog.Info(fmt.Sprintf("couldn't get file path for '%s': %v", k, err))
-			continue
-		}
-		if err := os.Remove(fp); err != nil {
-			slog.Info(fmt.Sprintf("couldn't remove file '%s': %v", fp, err))
+		if err := removeBlob(k); err != nil {
+			slog.Info(fmt.Sprintf("couldn't remove blob '%s': %v", k, err))
 			continue
 		}
 	}
@@ -786,6 +1016,33 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return err
 	}
 
+	if regOpts.Sign {
+		fn(api.ProgressResponse{Status: "signing manifest"})
+		if err := signManifest(ctx, manifest); err != nil {
+			return err
+		}
+
+		// keep the local manifest identical to the signed remote manifest, it's
+		// written first so a failed push can't leave only the remote one signed
+		manifestJSON, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+
+		fp, err := mp.GetManifestPath()
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(fp, manifestJSON, 0o644); err != nil {
+			return err
+		}
+	}
+
 	var layers []*Layer
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
@@ -854,6 +1111,10 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return fmt.Errorf("pull model manifest: %s", err)
 	}
 
+	if err := verifyModelSignature(ctx, mp, manifest, regOpts, fn); err != nil {
+		return err
+	}
+
 	var layers []*Layer
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
@@ -882,13 +1143,9 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		if err := verifyBlob(layer.Digest); err != nil {
 			if errors.Is(err, errDigestMismatch) {
 				// something went wrong, delete the blob
-				fp, err := GetBlobsPath(layer.Digest)
-				if err != nil {
-					return err
-				}
-				if err := os.Remove(fp); err != nil {
+				if err := removeBlob(layer.Digest); err != nil {
 					// log this, but return the original error
-					slog.Info(fmt.Sprintf("couldn't remove file with digest mismatch '%s': %v", fp, err))
+					slog.Info(fmt.Sprintf("couldn't remove blob with digest mismatch '%s': %v", layer.Digest, err))
 				}
 			}
 			return err
@@ -929,6 +1186,57 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	return nil
 }
 
+// verifyModelSignature downloads the signatures of manifest and checks them
+// against the trusted keys. Models which fail verification are refused if
+// OLLAMA_VERIFY_SIGNATURES is set, otherwise a warning is logged.
+func verifyModelSignature(ctx context.Context, mp ModelPath, manifest *ManifestV2, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	signed := slices.ContainsFunc(manifest.Layers, func(layer *Layer) bool {
+		return layer.MediaType == signatureMediaType
+	})
+
+	if !signed && !envconfig.VerifySignatures {
+		return nil
+	}
+
+	fn(api.ProgressResponse{Status: "verifying signature"})
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != signatureMediaType {
+			continue
+		}
+
+		cacheHit, err := downloadBlob(ctx, downloadOpts{
+			mp:      mp,
+			digest:  layer.Digest,
+			regOpts: regOpts,
+			fn:      fn,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !cacheHit {
+			if err := verifyBlob(layer.Digest); err != nil {
+				return err
+			}
+		}
+	}
+
+	trusted, err := trustedKeys()
+	if err != nil {
+		return err
+	}
+
+	if err := verifyManifest(manifest, trusted); err != nil {
+		if envconfig.VerifySignatures {
+			return fmt.Errorf("%s: %w", mp.GetShortTagname(), err)
+		}
+
+		slog.Warn("couldn't verify model signature", "model", mp.GetShortTagname(), "error", err)
+	}
+
+	return nil
+}
+
 func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptions) (*ManifestV2, error) {
 	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
 
@@ -948,6 +1256,96 @@ func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptio
 	return m, err
 }
 
+// pullModelTags returns the tags of the repository of mp from the registry's
+// tags list endpoint, following pagination links.
+func pullModelTags(ctx context.Context, mp ModelPath, regOpts *registryOptions) ([]string, error) {
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "tags", "list")
+
+	var tags []string
+	for {
+		resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, regOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, list.Tags...)
+
+		next := nextLink(resp.Header.Get("Link"))
+		if next == "" {
+			return tags, nil
+		}
+
+		u, err := requestURL.Parse(next)
+		if err != nil {
+			return nil, err
+		}
+
+		requestURL = u
+	}
+}
+
+// nextLink returns the target of the rel="next" link in an RFC 5988 Link header.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+
+		for _, param := range strings.Split(params, ";") {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+// CheckOutdated compares the local manifest of name with the manifest in the
+// registry without downloading any layers.
+func CheckOutdated(ctx context.Context, name model.Name, regOpts *registryOptions) (api.OutdatedModelResponse, error) {
+	resp := api.OutdatedModelResponse{Name: name.DisplayShortest(), Model: name.DisplayShortest()}
+
+	local, err := ParseNamedManifest(name)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Digest = local.digest
+
+	remote, err := pullModelManifest(ctx, ParseModelPath(name.String()), regOpts)
+	if err != nil {
+		return resp, err
+	}
+
+	// this is the manifest which would be written by pulling the model
+	bts, err := json.Marshal(remote)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.RemoteDigest = fmt.Sprintf("%x", sha256.Sum256(bts))
+
+	// compare contents rather than digests since manifests written locally
+	// may be encoded differently
+	resp.Outdated = !slices.EqualFunc(slices.Concat(local.Layers, []*Layer{local.Config}), slices.Concat(remote.Layers, []*Layer{remote.Config}), func(a, b *Layer) bool {
+		return a.Digest == b.Digest && a.MediaType == b.MediaType
+	})
+
+	return resp, nil
+}
+
 // GetSHA256Digest returns the SHA256 hash of a given buffer and returns it, and the size of buffer
 func GetSHA256Digest(r io.Reader) (string, int64) {
 	h := sha256.New()
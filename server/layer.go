@@ -8,13 +8,25 @@ import (
 )
 
 type Layer struct {
-	MediaType string `json:"mediaType"`
-	Digest    string `json:"digest"`
-	Size      int64  `json:"size"`
-	From      string `json:"from,omitempty"`
-	status    string
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	From        string            `json:"from,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	status      string
 }
 
+// annotationAdapterScale is the annotation of an adapter layer with the scale
+// it's applied at, if it isn't 1.
+const annotationAdapterScale = "com.ollama.adapter.scale"
+
+// annotationBOSToken and annotationEOSToken are annotations of a chat template
+// layer with the model's BOS and EOS tokens, which chat templates refer to.
+const (
+	annotationBOSToken = "com.ollama.chat_template.bos_token"
+	annotationEOSToken = "com.ollama.chat_template.eos_token"
+)
+
 func NewLayer(r io.Reader, mediatype string) (*Layer, error) {
 	blobs, err := GetBlobsPath("")
 	if err != nil {
@@ -104,10 +116,5 @@ func (l *Layer) Remove() error {
 		}
 	}
 
-	blob, err := GetBlobsPath(l.Digest)
-	if err != nil {
-		return err
-	}
-
-	return os.Remove(blob)
+	return removeBlob(l.Digest)
 }
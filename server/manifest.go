@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ollama/ollama/types/model"
 )
@@ -16,9 +17,12 @@ import (
 type Manifest struct {
 	ManifestV2
 
-	filepath string
-	fi       os.FileInfo
-	digest   string
+	// root is the models directory containing the manifest
+	root      string
+	filepath  string
+	usagepath string
+	fi        os.FileInfo
+	digest    string
 }
 
 func (m *Manifest) Size() (size int64) {
@@ -29,17 +33,74 @@ func (m *Manifest) Size() (size int64) {
 	return
 }
 
+// ReadOnly reports whether the manifest is in a models directory other than
+// the writable one and so can't be modified.
+func (m *Manifest) ReadOnly() bool {
+	dir, err := modelsDir()
+	return err != nil || dir != m.root
+}
+
 func (m *Manifest) Remove() error {
+	if m.ReadOnly() {
+		return fmt.Errorf("%w: %s", errReadOnlyManifest, m.root)
+	}
+
 	if err := os.Remove(m.filepath); err != nil {
 		return err
 	}
 
+	if err := os.Remove(m.usagepath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
 	manifests, err := GetManifestPath()
 	if err != nil {
 		return err
 	}
 
-	return PruneDirectory(manifests)
+	if err := PruneDirectory(manifests); err != nil {
+		return err
+	}
+
+	usage, err := GetUsagePath()
+	if err != nil {
+		return err
+	}
+
+	if err := PruneDirectory(usage); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// LastUsed returns the last time the model was loaded. Models which have
+// never been loaded report the modification time of their manifest.
+func (m *Manifest) LastUsed() time.Time {
+	if fi, err := os.Stat(m.usagepath); err == nil {
+		return fi.ModTime()
+	}
+
+	return m.fi.ModTime()
+}
+
+// Touch records the current time as the last time the model was used.
+func (m *Manifest) Touch() error {
+	now := time.Now()
+	if err := os.Chtimes(m.usagepath, now, now); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.usagepath), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(m.usagepath)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
 }
 
 func (m *Manifest) RemoveLayers() error {
@@ -54,17 +115,28 @@ func (m *Manifest) RemoveLayers() error {
 	return nil
 }
 
+var errReadOnlyManifest = errors.New("model is in a read-only models directory")
+
+// ParseNamedManifest returns the manifest for n from the first models
+// directory which contains it.
 func ParseNamedManifest(n model.Name) (*Manifest, error) {
 	if !n.IsFullyQualified() {
 		return nil, model.Unqualified(n)
 	}
 
-	manifests, err := GetManifestPath()
+	root, p, err := findModelsFile("manifests", n.Filepath())
 	if err != nil {
 		return nil, err
 	}
 
-	p := filepath.Join(manifests, n.Filepath())
+	return parseManifest(root, p, n)
+}
+
+func parseManifest(root, p string, n model.Name) (*Manifest, error) {
+	usage, err := GetUsagePath()
+	if err != nil {
+		return nil, err
+	}
 
 	var m ManifestV2
 	f, err := os.Open(p)
@@ -85,7 +157,9 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 
 	return &Manifest{
 		ManifestV2: m,
+		root:       root,
 		filepath:   p,
+		usagepath:  filepath.Join(usage, n.Filepath()),
 		fi:         fi,
 		digest:     fmt.Sprintf("%x", sha256sum.Sum(nil)),
 	}, nil
@@ -118,45 +192,55 @@ func WriteManifest(name model.Name, config *Layer, layers []*Layer) error {
 	return json.NewEncoder(f).Encode(m)
 }
 
+// Manifests returns the manifests in all models directories. If a model is
+// in more than one, the manifest from the first models directory is used.
 func Manifests() (map[model.Name]*Manifest, error) {
-	manifests, err := GetManifestPath()
-	if err != nil {
-		return nil, err
-	}
-
-	// TODO(mxyng): use something less brittle
-	matches, err := filepath.Glob(filepath.Join(manifests, "*", "*", "*", "*"))
-	if err != nil {
+	// make sure the writable models directory exists
+	if _, err := GetManifestPath(); err != nil {
 		return nil, err
 	}
 
 	ms := make(map[model.Name]*Manifest)
-	for _, match := range matches {
-		fi, err := os.Stat(match)
+	for _, root := range modelsDirs() {
+		manifests := filepath.Join(root, "manifests")
+
+		// TODO(mxyng): use something less brittle
+		matches, err := filepath.Glob(filepath.Join(manifests, "*", "*", "*", "*"))
 		if err != nil {
 			return nil, err
 		}
 
-		if !fi.IsDir() {
-			rel, err := filepath.Rel(manifests, match)
+		for _, match := range matches {
+			fi, err := os.Stat(match)
 			if err != nil {
-				slog.Warn("bad filepath", "path", match, "error", err)
-				continue
-			}
-
-			n := model.ParseNameFromFilepath(rel)
-			if !n.IsValid() {
-				slog.Warn("bad manifest name", "path", rel, "error", err)
-				continue
+				return nil, err
 			}
 
-			m, err := ParseNamedManifest(n)
-			if err != nil {
-				slog.Warn("bad manifest", "name", n, "error", err)
-				continue
+			if !fi.IsDir() {
+				rel, err := filepath.Rel(manifests, match)
+				if err != nil {
+					slog.Warn("bad filepath", "path", match, "error", err)
+					continue
+				}
+
+				n := model.ParseNameFromFilepath(rel)
+				if !n.IsValid() {
+					slog.Warn("bad manifest name", "path", rel, "error", err)
+					continue
+				}
+
+				if _, ok := ms[n]; ok {
+					continue
+				}
+
+				m, err := parseManifest(root, match, n)
+				if err != nil {
+					slog.Warn("bad manifest", "name", n, "error", err)
+					continue
+				}
+
+				ms[n] = m
 			}
-
-			ms[n] = m
 		}
 	}
 
@@ -4,18 +4,24 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/convert"
+	"github.com/ollama/ollama/jinja"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/templates"
 	"github.com/ollama/ollama/types/model"
 )
@@ -44,11 +50,19 @@ func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressRe
 	}
 
 	for _, layer := range m.Layers {
+		if layer.MediaType == signatureMediaType {
+			// signatures don't carry over to derived models
+			continue
+		}
+
+		annotations := layer.Annotations
 		layer, err := NewLayerFromLayer(layer.Digest, layer.MediaType, name.DisplayShortest())
 		if err != nil {
 			return nil, err
 		}
 
+		layer.Annotations = annotations
+
 		switch layer.MediaType {
 		case "application/vnd.ollama.image.model",
 			"application/vnd.ollama.image.projector",
@@ -78,6 +92,27 @@ func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressRe
 	return layers, nil
 }
 
+// modelLabels returns the labels of the model called name.
+func modelLabels(name model.Name) (map[string]string, error) {
+	m, err := ParseNamedManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := m.Config.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config ConfigV2
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	return config.Labels, nil
+}
+
 func extractFromZipFile(p string, file *os.File, fn func(api.ProgressResponse)) error {
 	stat, err := file.Stat()
 	if err != nil {
@@ -130,7 +165,7 @@ func extractFromZipFile(p string, file *os.File, fn func(api.ProgressResponse))
 	return nil
 }
 
-func parseFromZipFile(_ context.Context, file *os.File, digest string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
+func parseFromZipFile(_ context.Context, file *os.File, digest string, base *llm.GGML, quantization string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
 	tempDir, err := os.MkdirTemp(filepath.Dir(file.Name()), "")
 	if err != nil {
 		return nil, err
@@ -141,6 +176,10 @@ func parseFromZipFile(_ context.Context, file *os.File, digest string, fn func(a
 		return nil, err
 	}
 
+	if convert.IsAdapter(tempDir) {
+		return parseAdapterFromDir(tempDir, base, fn)
+	}
+
 	mf, err := convert.GetModelFormat(tempDir)
 	if err != nil {
 		return nil, err
@@ -151,6 +190,14 @@ func parseFromZipFile(_ context.Context, file *os.File, digest string, fn func(a
 		return nil, err
 	}
 
+	if quantization != "" {
+		// quantizations which can't be applied during conversion are applied
+		// to the converted model instead
+		if err := params.SetFileType(quantization); err != nil && !errors.Is(err, convert.ErrUnsupportedFileType) {
+			return nil, err
+		}
+	}
+
 	mArch, err := mf.GetModelArch("", tempDir, params)
 	if err != nil {
 		return nil, err
@@ -202,11 +249,87 @@ func parseFromZipFile(_ context.Context, file *os.File, digest string, fn func(a
 
 	layers = append(layers, &layerGGML{layer, ggml})
 
-	intermediateBlobs[digest] = layer.Digest
+	defaults, err := mArch.GenerationParams()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(defaults) > 0 {
+		var b bytes.Buffer
+		if err := json.NewEncoder(&b).Encode(defaults); err != nil {
+			return nil, err
+		}
+
+		layer, err := NewLayer(&b, "application/vnd.ollama.image.params")
+		if err != nil {
+			return nil, err
+		}
+
+		layer.status = "using generation defaults from generation_config.json"
+		layers = append(layers, &layerGGML{layer, nil})
+	}
+
+	// quantized conversions can't be quantized again so only cache
+	// unquantized ones. the cached layer doesn't include the generation
+	// defaults so those conversions aren't cached either
+	if ggml.KV().FileType().String() == "F16" && len(defaults) == 0 {
+		intermediateBlobs[digest] = layer.Digest
+	}
 	return detectChatTemplate(layers)
 }
 
-func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
+// parseAdapterFromDir converts the PEFT adapter in dir into a ggla adapter
+// layer for base.
+func parseAdapterFromDir(dir string, base *llm.GGML, fn func(api.ProgressResponse)) ([]*layerGGML, error) {
+	adapter, err := convert.NewLoraAdapter(dir, base)
+	if err != nil {
+		return nil, err
+	}
+
+	fn(api.ProgressResponse{Status: "processing adapter tensors"})
+	if err := adapter.GetTensors(); err != nil {
+		return nil, err
+	}
+
+	fn(api.ProgressResponse{Status: "converting adapter"})
+	temp, err := os.CreateTemp(dir, "ggla")
+	if err != nil {
+		return nil, err
+	}
+	defer temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := adapter.WriteGGLA(temp); err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	layer, err := NewLayer(temp, "application/vnd.ollama.image.adapter")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ggml, _, err := llm.DecodeGGML(temp, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// the converted adapter depends on the base model so it isn't cached in
+	// intermediateBlobs
+	return []*layerGGML{{layer, ggml}}, nil
+}
+
+// parseFromFile parses the layers in file. base is the model adapters in file
+// apply to, if any. Models converted from safetensors or pytorch are quantized
+// during conversion if possible.
+func parseFromFile(ctx context.Context, file *os.File, digest string, base *llm.GGML, quantization string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
 	sr := io.NewSectionReader(file, 0, 512)
 	contentType, err := detectContentType(sr)
 	if err != nil {
@@ -217,7 +340,7 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 	case "gguf", "ggla":
 		// noop
 	case "application/zip":
-		return parseFromZipFile(ctx, file, digest, fn)
+		return parseFromZipFile(ctx, file, digest, base, quantization, fn)
 	default:
 		return nil, fmt.Errorf("unsupported content type: %s", contentType)
 	}
@@ -236,6 +359,10 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 			return nil, err
 		}
 
+		if count := ggml.KV().SplitCount(); count > 1 {
+			return nil, fmt.Errorf("model is split into %d files, all of them are required", count)
+		}
+
 		mediatype := "application/vnd.ollama.image.model"
 		if ggml.Name() == "ggla" {
 			mediatype = "application/vnd.ollama.image.adapter"
@@ -255,8 +382,158 @@ func parseFromFile(ctx context.Context, file *os.File, digest string, fn func(ap
 	return detectChatTemplate(layers)
 }
 
+// openSplitFiles opens the shards of a split gguf model referenced by args:
+// either the digests of the uploaded shards separated by spaces or the path of
+// the first shard. It returns nil if args doesn't reference a split model.
+func openSplitFiles(modelFileDir, args string) (files []*os.File, err error) {
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+		}
+	}()
+
+	// paths may contain spaces so only a list of digests is a list of shards
+	digests := strings.Fields(args)
+	var paths []string
+	if len(digests) > 1 && !slices.ContainsFunc(digests, func(digest string) bool { return !strings.HasPrefix(digest, "@") }) {
+		for _, digest := range digests {
+			p, err := GetBlobsPath(strings.TrimPrefix(digest, "@"))
+			if err != nil {
+				return nil, err
+			}
+
+			paths = append(paths, p)
+		}
+	} else if !strings.HasPrefix(args, "@") {
+		paths, err = llm.SplitFiles(realpath(modelFileDir, args))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return files, err
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// parseFromSplitFiles merges the shards of a split gguf model, in order, into
+// a single model layer.
+func parseFromSplitFiles(files []*os.File, fn func(api.ProgressResponse)) ([]*layerGGML, error) {
+	fn(api.ProgressResponse{Status: fmt.Sprintf("merging %d model shards", len(files))})
+
+	shards := make([]llm.SplitShard, len(files))
+	for i, f := range files {
+		ggml, n, err := llm.DecodeGGML(f, -1)
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %w", i+1, err)
+		}
+
+		shards[i] = llm.SplitShard{GGML: ggml, ReaderAt: f, Offset: n}
+	}
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	temp, err := os.CreateTemp(blobs, "split")
+	if err != nil {
+		return nil, err
+	}
+	defer temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := llm.MergeSplit(temp, shards); err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	layer, err := NewLayer(temp, "application/vnd.ollama.image.model")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ggml, _, err := llm.DecodeGGML(temp, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return detectChatTemplate([]*layerGGML{{layer, ggml}})
+}
+
+var errIncludeUnsupported = errors.New("INCLUDE isn't supported by the API, included files must be inlined by the client")
+
+// lintTarget checks that the model or adapter cmd refers to exists. It's
+// resolved the same way as when the model is created, so INCLUDE is an error.
+func lintTarget(modelFileDir string, cmd parser.Command) *parser.Diagnostic {
+	if cmd.Name == "include" {
+		return &parser.Diagnostic{Severity: parser.SeverityError, Message: errIncludeUnsupported.Error()}
+	}
+
+	files, err := openSplitFiles(modelFileDir, cmd.Args)
+	for _, f := range files {
+		f.Close()
+	}
+
+	switch {
+	case err != nil:
+		return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+	case len(files) > 0:
+		return nil
+	}
+
+	if name := model.ParseName(cmd.Args); name.IsValid() {
+		if _, err := ParseNamedManifest(name); errors.Is(err, os.ErrNotExist) {
+			return &parser.Diagnostic{Severity: parser.SeverityWarning, Message: fmt.Sprintf("model '%s' isn't available locally, it will be pulled", cmd.Args)}
+		} else if err != nil {
+			return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+		}
+
+		return nil
+	}
+
+	p := realpath(modelFileDir, cmd.Args)
+	if strings.HasPrefix(cmd.Args, "@") {
+		if p, err = GetBlobsPath(strings.TrimPrefix(cmd.Args, "@")); err != nil {
+			return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+		}
+	}
+
+	if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+		return &parser.Diagnostic{Severity: parser.SeverityError, Message: fmt.Sprintf("%s doesn't exist", cmd.Args)}
+	} else if err != nil {
+		return &parser.Diagnostic{Severity: parser.SeverityError, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// detectChatTemplate adds a template layer for the chat template of the
+// model, if it has one. Chat templates which don't match a bundled template
+// are kept as they are and rendered with the jinja package.
 func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 	for _, layer := range layers {
+		// layers such as generation defaults don't carry a model
+		if layer.GGML == nil {
+			continue
+		}
+
 		if s := layer.GGML.KV().ChatTemplate(); s != "" {
 			if t, err := templates.NamedTemplate(s); err != nil {
 				slog.Debug("template detection", "error", err)
@@ -268,13 +545,200 @@ func detectChatTemplate(layers []*layerGGML) ([]*layerGGML, error) {
 
 				tmpl.status = fmt.Sprintf("using autodetected template %s", t.Name)
 				layers = append(layers, &layerGGML{tmpl, nil})
+				continue
+			}
+
+			if _, err := jinja.Parse(s); err != nil {
+				slog.Warn("unsupported chat template", "error", err)
+				continue
+			}
+
+			bos, eos, err := specialTokens(layer.Layer)
+			if err != nil {
+				return nil, err
+			}
+
+			tmpl, err := NewLayer(strings.NewReader(s), "application/vnd.ollama.image.chat_template")
+			if err != nil {
+				return nil, err
+			}
+
+			tmpl.Annotations = make(map[string]string)
+			if bos != "" {
+				tmpl.Annotations[annotationBOSToken] = bos
+			}
+
+			if eos != "" {
+				tmpl.Annotations[annotationEOSToken] = eos
 			}
+
+			tmpl.status = "using the model's chat template"
+			layers = append(layers, &layerGGML{tmpl, nil})
 		}
 	}
 
 	return layers, nil
 }
 
+// specialTokens returns the BOS and EOS tokens of the model in layer, which
+// chat templates use. The vocabulary is decoded again since it's too large to
+// be kept when layers are parsed.
+func specialTokens(layer *Layer) (bos, eos string, err error) {
+	r, err := layer.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer r.Close()
+
+	ggml, _, err := llm.DecodeGGML(r, -1)
+	if err != nil {
+		return "", "", err
+	}
+
+	kv := ggml.KV()
+	tokens := kv.Strings("tokenizer.ggml.tokens")
+	token := func(key string) string {
+		if _, ok := kv[key]; !ok {
+			return ""
+		}
+
+		if i := kv.Uint(key); i < uint64(len(tokens)) {
+			return tokens[i]
+		}
+
+		return ""
+	}
+
+	return token("tokenizer.ggml.bos_token_id"), token("tokenizer.ggml.eos_token_id"), nil
+}
+
+// setMetadata rewrites the header of the model layer with the metadata
+// overrides applied, each of which is "key: value". Tensor data is copied from
+// the existing layer.
+func setMetadata(layer *Layer, overrides []string) (*layerGGML, error) {
+	r, err := layer.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, ok := r.(*os.File)
+	if !ok {
+		return nil, errors.New("layer is not a file")
+	}
+
+	ggml, n, err := llm.DecodeGGML(f, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := maps.Clone(ggml.KV())
+	// parameter_count is computed when decoding
+	delete(kv, "general.parameter_count")
+
+	for _, o := range overrides {
+		k, s, ok := strings.Cut(o, ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid metadata: %s", o)
+		}
+
+		v, err := parseMetadataValue(kv[k], s)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s: %w", k, err)
+		}
+
+		kv[k] = v
+	}
+
+	blob, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(blob), "metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := llm.EncodeKV(temp, ggml, f, n, kv); err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	newLayer, err := NewLayer(temp, layer.MediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ggml, _, err = llm.DecodeGGML(temp, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &layerGGML{newLayer, ggml}, nil
+}
+
+// parseMetadataValue parses s as the type of the existing value v. The type
+// of a new value is inferred from s.
+func parseMetadataValue(v any, s string) (any, error) {
+	switch v.(type) {
+	case nil:
+		if s == "true" || s == "false" {
+			return s == "true", nil
+		} else if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+			return uint32(n), nil
+		} else if n, err := strconv.ParseInt(s, 10, 32); err == nil {
+			return int32(n), nil
+		} else if f, err := strconv.ParseFloat(s, 32); err == nil {
+			return float32(f), nil
+		}
+
+		return s, nil
+	case string:
+		return s, nil
+	case bool:
+		return strconv.ParseBool(s)
+	case uint8:
+		n, err := strconv.ParseUint(s, 10, 8)
+		return uint8(n), err
+	case int8:
+		n, err := strconv.ParseInt(s, 10, 8)
+		return int8(n), err
+	case uint16:
+		n, err := strconv.ParseUint(s, 10, 16)
+		return uint16(n), err
+	case int16:
+		n, err := strconv.ParseInt(s, 10, 16)
+		return int16(n), err
+	case uint32:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return uint32(n), err
+	case int32:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return int32(n), err
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case float32:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	default:
+		return nil, errors.New("arrays can't be overridden")
+	}
+}
+
 func detectContentType(r io.Reader) (string, error) {
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, r); err != nil {
@@ -3,11 +3,13 @@ package server
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/ollama/ollama/envconfig"
 )
@@ -32,6 +34,7 @@ var (
 	ErrInvalidProtocol     = errors.New("invalid protocol scheme")
 	ErrInsecureProtocol    = errors.New("insecure protocol http")
 	ErrInvalidDigestFormat = errors.New("invalid digest format")
+	ErrNoWritableModelsDir = errors.New("no writable models directory")
 )
 
 func ParseModelPath(name string) ModelPath {
@@ -103,13 +106,68 @@ func (mp ModelPath) GetShortTagname() string {
 	return fmt.Sprintf("%s/%s/%s:%s", mp.Registry, mp.Namespace, mp.Repository, mp.Tag)
 }
 
-// modelsDir returns the value of the OLLAMA_MODELS environment variable or the user's home directory if OLLAMA_MODELS is not set.
-// The models directory is where Ollama stores its model files and manifests.
+// modelsDirs returns the models directories in the order they are searched.
+// OLLAMA_MODELS may list several directories, separated like PATH, so a
+// shared read-only store can be combined with a writable one.
+func modelsDirs() []string {
+	return envconfig.ModelsDirs
+}
+
+var writableDirs sync.Map
+
+// modelsDir returns the first writable models directory. New models and blobs are always written here.
 func modelsDir() (string, error) {
-	return envconfig.ModelsDir, nil
+	for _, dir := range modelsDirs() {
+		if writable, ok := writableDirs.Load(dir); ok {
+			if writable.(bool) {
+				return dir, nil
+			}
+
+			continue
+		}
+
+		writable := isWritable(dir)
+		writableDirs.Store(dir, writable)
+		if writable {
+			return dir, nil
+		}
+
+		slog.Debug("models directory is read-only", "path", dir)
+	}
+
+	return "", ErrNoWritableModelsDir
+}
+
+func isWritable(dir string) bool {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false
+	}
+
+	f, err := os.CreateTemp(dir, ".writable-")
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+	return os.Remove(f.Name()) == nil
+}
+
+// findModelsFile returns the models directory and path of the first file
+// named by elem, which is relative to the models directory, in search order.
+func findModelsFile(elem ...string) (dir, path string, err error) {
+	for _, dir := range modelsDirs() {
+		path := filepath.Join(append([]string{dir}, elem...)...)
+		if _, err := os.Stat(path); err == nil {
+			return dir, path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+	}
+
+	return "", "", fmt.Errorf("%s: %w", filepath.Join(elem...), os.ErrNotExist)
 }
 
-// GetManifestPath returns the path to the manifest file for the given model path, it is up to the caller to create the directory if it does not exist.
+// GetManifestPath returns the path to the manifest file for the given model path in the writable models directory, it is up to the caller to create the directory if it does not exist.
 func (mp ModelPath) GetManifestPath() (string, error) {
 	dir, err := modelsDir()
 	if err != nil {
@@ -119,6 +177,13 @@ func (mp ModelPath) GetManifestPath() (string, error) {
 	return filepath.Join(dir, "manifests", mp.Registry, mp.Namespace, mp.Repository, mp.Tag), nil
 }
 
+// findManifestPath returns the path to the manifest file for the given model
+// path in the first models directory which contains it.
+func (mp ModelPath) findManifestPath() (string, error) {
+	_, path, err := findModelsFile("manifests", mp.Registry, mp.Namespace, mp.Repository, mp.Tag)
+	return path, err
+}
+
 func (mp ModelPath) BaseURL() *url.URL {
 	return &url.URL{
 		Scheme: mp.ProtocolScheme,
@@ -140,12 +205,21 @@ func GetManifestPath() (string, error) {
 	return path, nil
 }
 
-func GetBlobsPath(digest string) (string, error) {
+// GetUsagePath returns the path to the directory which records when each model
+// was last used. The directory is created lazily by Manifest.Touch.
+func GetUsagePath() (string, error) {
 	dir, err := modelsDir()
 	if err != nil {
 		return "", err
 	}
 
+	return filepath.Join(dir, "usage"), nil
+}
+
+// GetBlobsPath returns the path to the blob for digest. Blobs are shared
+// between models directories so an existing blob in any of them is returned,
+// otherwise the path in the writable models directory.
+func GetBlobsPath(digest string) (string, error) {
 	// only accept actual sha256 digests
 	pattern := "^sha256[:-][0-9a-fA-F]{64}$"
 	re := regexp.MustCompile(pattern)
@@ -155,6 +229,17 @@ func GetBlobsPath(digest string) (string, error) {
 	}
 
 	digest = strings.ReplaceAll(digest, ":", "-")
+	if digest != "" {
+		if _, path, err := findModelsFile("blobs", digest); err == nil {
+			return path, nil
+		}
+	}
+
+	dir, err := modelsDir()
+	if err != nil {
+		return "", err
+	}
+
 	path := filepath.Join(dir, "blobs", digest)
 	dirPath := filepath.Dir(path)
 	if digest == "" {
@@ -167,3 +252,18 @@ func GetBlobsPath(digest string) (string, error) {
 
 	return path, nil
 }
+
+// removeBlob removes the blob for digest from the writable models directory.
+// Blobs in read-only models directories are never removed.
+func removeBlob(digest string) error {
+	if _, err := GetBlobsPath(digest); err != nil {
+		return err
+	}
+
+	dir, err := modelsDir()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(dir, "blobs", strings.ReplaceAll(digest, ":", "-")))
+}
@@ -3,11 +3,13 @@ package server
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"text/template"
 	"text/template/parse"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/jinja"
 )
 
 // isResponseNode checks if the node contains .Response
@@ -90,15 +92,17 @@ func countTokens(tmpl string, system string, prompt string, response string, enc
 	return len(tokens), err
 }
 
-// ChatPrompt builds up a prompt from a series of messages, truncating based on context window size
-func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(string) ([]int, error)) (string, error) {
+// ChatPrompt builds up a prompt from a series of messages, truncating based on context window size.
+// The indexes of the messages dropped to fit the context window are returned with the prompt.
+func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(string) ([]int, error)) (string, []int, error) {
 	type prompt struct {
 		System   string
 		Prompt   string
 		Response string
 
-		images []int
-		tokens int
+		images   []int
+		messages []int
+		tokens   int
 	}
 
 	var p prompt
@@ -106,7 +110,7 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 	// iterate through messages to build up {system,user,response} prompts
 	var imgId int
 	var prompts []prompt
-	for _, msg := range messages {
+	for i, msg := range messages {
 		switch strings.ToLower(msg.Role) {
 		case "system":
 			if p.System != "" || p.Prompt != "" || p.Response != "" {
@@ -138,8 +142,10 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 
 			p.Response = msg.Content
 		default:
-			return "", fmt.Errorf("invalid role: %s, role must be one of [system, user, assistant]", msg.Role)
+			return "", nil, fmt.Errorf("invalid role: %s, role must be one of [system, user, assistant]", msg.Role)
 		}
+
+		p.messages = append(p.messages, i)
 	}
 
 	// add final prompt
@@ -151,7 +157,7 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 	for i, p := range prompts {
 		tokens, err := countTokens(tmpl, p.System, p.Prompt, p.Response, encode)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		prompts[i].tokens = tokens + len(prompts[i].images)*768
@@ -160,6 +166,7 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 	// truncate images and prompts starting from the beginning of the list
 	// until either one prompt remains or the total tokens fits the context window
 	// TODO (jmorganca): this doesn't account for the context window room required for the response
+	var dropped []int
 	for {
 		var required int
 		for _, p := range prompts {
@@ -186,20 +193,24 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 
 		if len(prompts) > 1 {
 			slog.Debug("required tokens longer than context window, removing first prompt", "prompt", prompts[0].tokens, "required", required, "window", window)
-			system := prompt.System
+			system, removed := prompt.System, prompt.messages
 			prompts = prompts[1:]
 
 			if system != "" && prompts[0].System == "" {
+				// the system message always starts a prompt
 				prompts[0].System = system
+				prompts[0].messages = append([]int{removed[0]}, prompts[0].messages...)
+				removed = removed[1:]
 
 				tokens, err := countTokens(tmpl, prompts[0].System, prompts[0].Prompt, prompts[0].Response, encode)
 				if err != nil {
-					return "", err
+					return "", nil, err
 				}
 
 				prompts[0].tokens = tokens + len(prompts[0].images)*768
 			}
 
+			dropped = append(dropped, removed...)
 			continue
 		}
 
@@ -212,10 +223,139 @@ func ChatPrompt(tmpl string, messages []api.Message, window int, encode func(str
 		// last prompt should leave the response unrendered (for completion)
 		rendered, err := Prompt(tmpl, p.System, p.Prompt, p.Response, i == len(prompts)-1)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		sb.WriteString(rendered)
 	}
 
-	return sb.String(), nil
+	return sb.String(), dropped, nil
+}
+
+// ChatTemplate is the model's own chat template, written in Jinja for Hugging
+// Face. It's used for models which don't have a Go template.
+type ChatTemplate struct {
+	Template string
+	BOSToken string
+	EOSToken string
+}
+
+// Render renders messages with the chat template. The prompt for the
+// assistant's reply is added unless the last message is from the assistant.
+func (t ChatTemplate) Render(messages []api.Message) (string, error) {
+	tmpl, err := jinja.Parse(t.Template)
+	if err != nil {
+		return "", err
+	}
+
+	return t.render(tmpl, messages)
+}
+
+func (t ChatTemplate) render(tmpl *jinja.Template, messages []api.Message) (string, error) {
+	msgs := make([]map[string]any, len(messages))
+	for i, msg := range messages {
+		msgs[i] = map[string]any{"role": msg.Role, "content": msg.Content}
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, map[string]any{
+		"messages":              msgs,
+		"add_generation_prompt": len(messages) == 0 || messages[len(messages)-1].Role != "assistant",
+		"bos_token":             t.BOSToken,
+		"eos_token":             t.EOSToken,
+	}); err != nil {
+		return "", err
+	}
+
+	// the runner adds the BOS token itself
+	return strings.TrimPrefix(sb.String(), t.BOSToken), nil
+}
+
+// ChatTemplatePrompt builds up a prompt from a series of messages with the
+// model's chat template. The oldest messages other than system messages are
+// dropped until the prompt fits the context window and their indexes are
+// returned with the prompt.
+func ChatTemplatePrompt(tmpl ChatTemplate, messages []api.Message, window int, encode func(string) ([]int, error)) (string, []int, error) {
+	parsed, err := jinja.Parse(tmpl.Template)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// number the images like ChatPrompt does, estimating 768 tokens per image
+	var imgId int
+	images := make([]int, len(messages))
+	indexes := make([]int, len(messages))
+	messages = slices.Clone(messages)
+	for i, msg := range messages {
+		var sb strings.Builder
+		for range msg.Images {
+			fmt.Fprintf(&sb, "[img-%d] ", imgId)
+			imgId += 1
+		}
+
+		sb.WriteString(msg.Content)
+		messages[i].Content = sb.String()
+		images[i] = len(msg.Images)
+		indexes[i] = i
+	}
+
+	var dropped []int
+	remove := func(i int) {
+		dropped = append(dropped, indexes[i])
+		messages = slices.Delete(messages, i, i+1)
+		images = slices.Delete(images, i, i+1)
+		indexes = slices.Delete(indexes, i, i+1)
+	}
+
+	for {
+		prompt, err := tmpl.render(parsed, messages)
+		if err != nil {
+			return "", nil, err
+		}
+
+		tokens, err := encode(prompt)
+		if err != nil {
+			slog.Error("failed to encode prompt", "err", err)
+			return "", nil, err
+		}
+
+		required := len(tokens) + 1 // for bos token
+		for _, n := range images {
+			required += n * 768
+		}
+
+		if required <= window {
+			slog.Debug("prompt now fits in context window", "required", required, "window", window)
+			return prompt, dropped, nil
+		}
+
+		// keep the last message, which is being replied to
+		i := slices.IndexFunc(messages, func(msg api.Message) bool { return msg.Role != "system" })
+		if i < 0 || i == len(messages)-1 {
+			return prompt, dropped, nil
+		}
+
+		slog.Debug("required tokens longer than context window, removing first message", "required", required, "window", window)
+		remove(i)
+
+		// the conversation should start with the user
+		for i < len(messages)-1 && messages[i].Role == "assistant" {
+			remove(i)
+		}
+	}
+}
+
+// generateMessages returns the messages of a generate request to render them
+// with a chat template.
+func generateMessages(system, prompt, response string) []api.Message {
+	var messages []api.Message
+	if system != "" {
+		messages = append(messages, api.Message{Role: "system", Content: system})
+	}
+
+	messages = append(messages, api.Message{Role: "user", Content: prompt})
+	if response != "" {
+		messages = append(messages, api.Message{Role: "assistant", Content: response})
+	}
+
+	return messages
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"slices"
 	"strings"
 	"testing"
 
@@ -80,6 +81,7 @@ func TestChatPrompt(t *testing.T) {
 		messages []api.Message
 		window   int
 		want     string
+		dropped  []int
 	}{
 		{
 			name:     "simple prompt",
@@ -144,8 +146,9 @@ func TestChatPrompt(t *testing.T) {
 				{Role: "user", Content: "Why is the sky blue?"},
 				{Role: "assistant", Content: "The sky is blue from rayleigh scattering"},
 			},
-			window: 10,
-			want:   "You are a Wizard. Why is the sky blue? The sky is blue from rayleigh scattering",
+			window:  10,
+			want:    "You are a Wizard. Why is the sky blue? The sky is blue from rayleigh scattering",
+			dropped: []int{1, 2},
 		},
 		{
 			name:     "images",
@@ -192,7 +195,7 @@ func TestChatPrompt(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := ChatPrompt(tc.template, tc.messages, tc.window, encode)
+			got, dropped, err := ChatPrompt(tc.template, tc.messages, tc.window, encode)
 			if err != nil {
 				t.Errorf("error = %v", err)
 			}
@@ -200,6 +203,96 @@ func TestChatPrompt(t *testing.T) {
 			if got != tc.want {
 				t.Errorf("got: %q, want: %q", got, tc.want)
 			}
+
+			if !slices.Equal(dropped, tc.dropped) {
+				t.Errorf("dropped: %v, want: %v", dropped, tc.dropped)
+			}
+		})
+	}
+}
+
+func TestChatTemplatePrompt(t *testing.T) {
+	chatml := ChatTemplate{
+		Template: "{{ bos_token }}{% for message in messages %}{{ '<|im_start|>' + message['role'] + '\n' + message['content'] + '<|im_end|>' + '\n' }}{% endfor %}{% if add_generation_prompt %}{{ '<|im_start|>assistant\n' }}{% endif %}",
+		BOSToken: "<s>",
+	}
+
+	tests := []struct {
+		name     string
+		messages []api.Message
+		window   int
+		want     string
+		dropped  []int
+	}{
+		{
+			name: "simple prompt",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello"},
+			},
+			window: 1024,
+			want:   "<|im_start|>user\nHello<|im_end|>\n<|im_start|>assistant\n",
+		},
+		{
+			name: "with response",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "I am?"},
+			},
+			window: 1024,
+			want:   "<|im_start|>user\nHello<|im_end|>\n<|im_start|>assistant\nI am?<|im_end|>\n",
+		},
+		{
+			name: "with truncation",
+			messages: []api.Message{
+				{Role: "system", Content: "You are a Wizard."},
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "I am?"},
+				{Role: "user", Content: "Why is the sky blue?"},
+			},
+			window:  12,
+			want:    "<|im_start|>system\nYou are a Wizard.<|im_end|>\n<|im_start|>user\nWhy is the sky blue?<|im_end|>\n<|im_start|>assistant\n",
+			dropped: []int{1, 2},
+		},
+		{
+			name: "images",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello", Images: []api.ImageData{[]byte("base64")}},
+			},
+			window: 1024,
+			want:   "<|im_start|>user\n[img-0] Hello<|im_end|>\n<|im_start|>assistant\n",
+		},
+		{
+			name: "images truncated",
+			messages: []api.Message{
+				{Role: "user", Content: "Hello", Images: []api.ImageData{[]byte("img1")}},
+				{Role: "assistant", Content: "I am?"},
+				{Role: "user", Content: "And this?", Images: []api.ImageData{[]byte("img2")}},
+			},
+			window:  1024,
+			want:    "<|im_start|>user\n[img-1] And this?<|im_end|>\n<|im_start|>assistant\n",
+			dropped: []int{0, 1},
+		},
+	}
+
+	encode := func(s string) ([]int, error) {
+		words := strings.Fields(s)
+		return make([]int, len(words)), nil
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, dropped, err := ChatTemplatePrompt(chatml, tc.messages, tc.window, encode)
+			if err != nil {
+				t.Errorf("error = %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+
+			if !slices.Equal(dropped, tc.dropped) {
+				t.Errorf("dropped: %v, want: %v", dropped, tc.dropped)
+			}
 		})
 	}
 }
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"cmp"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// touchModel records that m has just been loaded
+func touchModel(m *Model) {
+	n := model.ParseName(m.Name)
+	if !n.IsValid() {
+		return
+	}
+
+	manifest, err := ParseNamedManifest(n)
+	if err != nil {
+		slog.Debug("couldn't record model usage", "model", m.Name, "error", err)
+		return
+	}
+
+	if err := manifest.Touch(); err != nil {
+		slog.Warn("couldn't record model usage", "model", m.Name, "error", err)
+	}
+}
+
+// Reclaim removes the least recently used models until the total size of all
+// models fits within quota. Models for which keep returns true are never
+// removed. A quota of zero means the models directory is unbounded. If dryRun
+// is set, the models which would be removed are reported but left in place.
+func Reclaim(quota uint64, keep func(model.Name, *Manifest) bool, dryRun bool) (*api.PruneResponse, error) {
+	ms, err := Manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := modelsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// layers are shared between models so track how many models reference
+	// each layer to know when removing a model actually frees it
+	refs := make(map[string]int)
+	sizes := make(map[string]int64)
+	layers := make(map[model.Name][]*Layer)
+	for n, m := range ms {
+		for _, layer := range slices.Concat(m.Layers, []*Layer{m.Config}) {
+			if slices.ContainsFunc(layers[n], func(l *Layer) bool { return l.Digest == layer.Digest }) {
+				continue
+			}
+
+			layers[n] = append(layers[n], layer)
+			refs[layer.Digest]++
+
+			// only blobs in the writable models directory count towards the quota
+			if blob, err := GetBlobsPath(layer.Digest); err == nil && filepath.Dir(blob) == filepath.Join(dir, "blobs") {
+				sizes[layer.Digest] = layer.Size
+			}
+		}
+	}
+
+	var size int64
+	for _, s := range sizes {
+		size += s
+	}
+
+	resp := api.PruneResponse{Models: []api.PruneModelResponse{}, Size: size, Quota: int64(quota)}
+	if quota == 0 || size <= int64(quota) {
+		return &resp, nil
+	}
+
+	var candidates []model.Name
+	for n, m := range ms {
+		if m.ReadOnly() {
+			continue
+		}
+
+		if keep == nil || !keep(n, m) {
+			candidates = append(candidates, n)
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b model.Name) int {
+		return cmp.Or(
+			ms[a].LastUsed().Compare(ms[b].LastUsed()),
+			strings.Compare(a.String(), b.String()),
+		)
+	})
+
+	for _, n := range candidates {
+		if size <= int64(quota) {
+			break
+		}
+
+		m := ms[n]
+
+		var reclaimed int64
+		deleteMap := make(map[string]struct{})
+		for _, layer := range layers[n] {
+			refs[layer.Digest]--
+			if refs[layer.Digest] == 0 {
+				reclaimed += sizes[layer.Digest]
+				deleteMap[layer.Digest] = struct{}{}
+			}
+		}
+
+		size -= reclaimed
+		resp.Reclaimed += reclaimed
+		resp.Models = append(resp.Models, api.PruneModelResponse{
+			Name:     n.DisplayShortest(),
+			Model:    n.DisplayShortest(),
+			Size:     reclaimed,
+			LastUsed: m.LastUsed(),
+		})
+
+		if dryRun {
+			continue
+		}
+
+		slog.Info("evicting model to reclaim space", "model", n.DisplayShortest(), "size", reclaimed)
+		if err := m.Remove(); err != nil {
+			return nil, err
+		}
+
+		if err := deleteUnusedLayers(nil, deleteMap); err != nil {
+			return nil, err
+		}
+	}
+
+	resp.Size = size
+	return &resp, nil
+}
+
+// enforceQuota removes models if the models directory exceeds the configured
+// quota. Errors are logged since the operation which triggered it has already
+// succeeded.
+func (s *Server) enforceQuota(keep ...model.Name) {
+	if envconfig.ModelsQuota == 0 {
+		return
+	}
+
+	if _, err := s.reclaim(false, keep...); err != nil {
+		slog.Warn("couldn't reclaim space", "error", err)
+	}
+}
+
+// reclaim enforces the configured models quota. Pinned models, models which
+// are currently loaded and any models in keep are never removed.
+func (s *Server) reclaim(dryRun bool, keep ...model.Name) (*api.PruneResponse, error) {
+	for _, p := range envconfig.PinnedModels {
+		if n := model.ParseName(p); n.IsValid() {
+			keep = append(keep, n)
+		} else {
+			slog.Warn("invalid pinned model name", "name", p)
+		}
+	}
+
+	loaded := make(map[string]struct{})
+	if s.sched != nil {
+		s.sched.loadedMu.Lock()
+		for modelPath := range s.sched.loaded {
+			loaded[modelPath] = struct{}{}
+		}
+		s.sched.loadedMu.Unlock()
+	}
+
+	return Reclaim(envconfig.ModelsQuota, func(n model.Name, m *Manifest) bool {
+		if slices.ContainsFunc(keep, func(k model.Name) bool {
+			return strings.EqualFold(k.Filepath(), n.Filepath())
+		}) {
+			return true
+		}
+
+		for _, layer := range m.Layers {
+			if layer.MediaType != "application/vnd.ollama.image.model" {
+				continue
+			}
+
+			blob, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				continue
+			}
+
+			if _, ok := loaded[blob]; ok {
+				return true
+			}
+		}
+
+		return false
+	}, dryRun)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func createQuotaModel(t *testing.T, name string, layers ...string) *Manifest {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(&ConfigV2{}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(&b, "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ls []*Layer
+	for _, l := range layers {
+		layer, err := NewLayer(strings.NewReader(l), "application/vnd.ollama.image.model")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ls = append(ls, layer)
+	}
+
+	n := model.ParseName(name)
+	if err := WriteManifest(n, config, ls); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestReclaim(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+
+	shared := strings.Repeat("s", 100)
+	a := createQuotaModel(t, "a", shared, strings.Repeat("a", 100))
+	b := createQuotaModel(t, "b", shared, strings.Repeat("b", 200))
+	c := createQuotaModel(t, "c", strings.Repeat("c", 300))
+
+	// a is the most recently used, b is older than c
+	now := time.Now()
+	for m, ts := range map[*Manifest]time.Time{
+		a: now,
+		b: now.Add(-2 * time.Hour),
+		c: now.Add(-time.Hour),
+	} {
+		if err := m.Touch(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(m.usagepath, ts, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the config is shared by all models, as is the first layer of a and b
+	total := a.Config.Size + 700
+	if resp, err := Reclaim(0, nil, false); err != nil {
+		t.Fatal(err)
+	} else if resp.Size != total {
+		t.Errorf("expected size %d, actual %d", total, resp.Size)
+	} else if len(resp.Models) > 0 {
+		t.Errorf("expected no models to be reclaimed without a quota, actual %v", resp.Models)
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		resp, err := Reclaim(uint64(total-1), nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// b is the least recently used but only its unshared layer is freed
+		if len(resp.Models) != 1 || resp.Models[0].Name != "b:latest" {
+			t.Fatalf("expected b to be reclaimed, actual %v", resp.Models)
+		}
+
+		if resp.Reclaimed != 200 {
+			t.Errorf("expected 200 bytes reclaimed, actual %d", resp.Reclaimed)
+		}
+
+		checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "a", "latest"),
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "b", "latest"),
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "c", "latest"),
+		})
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		resp, err := Reclaim(uint64(total-1), func(n model.Name, _ *Manifest) bool {
+			return n.Model == "b"
+		}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var actual []string
+		for _, m := range resp.Models {
+			actual = append(actual, m.Name)
+		}
+
+		if !slices.Equal(actual, []string{"c:latest"}) {
+			t.Errorf("expected c to be reclaimed, actual %v", actual)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		resp, err := Reclaim(uint64(a.Config.Size+300), nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var actual []string
+		for _, m := range resp.Models {
+			actual = append(actual, m.Name)
+		}
+
+		if !slices.Equal(actual, []string{"b:latest", "c:latest"}) {
+			t.Errorf("expected b and c to be reclaimed, actual %v", actual)
+		}
+
+		checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+			filepath.Join(p, "manifests", "registry.ollama.ai", "library", "a", "latest"),
+		})
+
+		checkFileExists(t, filepath.Join(p, "usage", "*", "*", "*", "*"), []string{
+			filepath.Join(p, "usage", "registry.ollama.ai", "library", "a", "latest"),
+		})
+
+		var digests []string
+		for _, layer := range slices.Concat(a.Layers, []*Layer{a.Config}) {
+			blob, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			digests = append(digests, blob)
+		}
+
+		slices.Sort(digests)
+
+		checkFileExists(t, filepath.Join(p, "blobs", "*"), digests)
+	})
+}
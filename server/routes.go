@@ -163,50 +163,12 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 
 	checkpointLoaded := time.Now()
 
-	var prompt string
-	switch {
-	case req.Raw:
-		prompt = req.Prompt
-	case req.Prompt != "":
-		if req.Template == "" {
-			req.Template = model.Template
-		}
-
-		if req.System == "" {
-			req.System = model.System
-		}
-
-		slog.Debug("generate handler", "prompt", req.Prompt)
-		slog.Debug("generate handler", "template", req.Template)
-		slog.Debug("generate handler", "system", req.System)
-
-		var sb strings.Builder
-		for i := range req.Images {
-			fmt.Fprintf(&sb, "[img-%d] ", i)
-		}
-
-		sb.WriteString(req.Prompt)
-
-		p, err := Prompt(req.Template, req.System, sb.String(), "", true)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		sb.Reset()
-		if req.Context != nil {
-			prev, err := runner.llama.Detokenize(c.Request.Context(), req.Context)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			sb.WriteString(prev)
-		}
-
-		sb.WriteString(p)
-
-		prompt = sb.String()
+	prompt, err := generatePrompt(model, &req, func(tokens []int) (string, error) {
+		return runner.llama.Detokenize(c.Request.Context(), tokens)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	slog.Debug("generate handler", "prompt", prompt)
@@ -242,7 +204,13 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 				resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
 
 				if !req.Raw {
-					p, err := Prompt(req.Template, req.System, req.Prompt, generated.String(), false)
+					var p string
+					var err error
+					if req.Template == "" && model.ChatTemplate.Template != "" {
+						p, err = model.ChatTemplate.Render(generateMessages(req.System, req.Prompt, generated.String()))
+					} else {
+						p, err = Prompt(req.Template, req.System, req.Prompt, generated.String(), false)
+					}
 					if err != nil {
 						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 						return
@@ -313,6 +281,61 @@ func (s *Server) GenerateHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+// generatePrompt builds the prompt for a generate request. The request's
+// template and system message default to the model's and the request's
+// context is turned back into text with decode.
+func generatePrompt(m *Model, req *api.GenerateRequest, decode func([]int) (string, error)) (string, error) {
+	switch {
+	case req.Raw:
+		return req.Prompt, nil
+	case req.Prompt == "":
+		return "", nil
+	}
+
+	if req.Template == "" {
+		req.Template = m.Template
+	}
+
+	if req.System == "" {
+		req.System = m.System
+	}
+
+	slog.Debug("generate handler", "prompt", req.Prompt)
+	slog.Debug("generate handler", "template", req.Template)
+	slog.Debug("generate handler", "system", req.System)
+
+	var sb strings.Builder
+	for i := range req.Images {
+		fmt.Fprintf(&sb, "[img-%d] ", i)
+	}
+
+	sb.WriteString(req.Prompt)
+
+	var p string
+	var err error
+	if req.Template == "" && m.ChatTemplate.Template != "" {
+		p, err = m.ChatTemplate.Render(generateMessages(req.System, sb.String(), ""))
+	} else {
+		p, err = Prompt(req.Template, req.System, sb.String(), "", true)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sb.Reset()
+	if req.Context != nil {
+		prev, err := decode(req.Context)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(prev)
+	}
+
+	sb.WriteString(p)
+	return sb.String(), nil
+}
+
 func getDefaultSessionDuration() time.Duration {
 	if envconfig.KeepAlive != "" {
 		v, err := strconv.Atoi(envconfig.KeepAlive)
@@ -447,7 +470,10 @@ func (s *Server) PullModelHandler(c *gin.Context) {
 
 		if err := PullModel(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
 			ch <- gin.H{"error": err.Error()}
+			return
 		}
+
+		s.enforceQuota(name)
 	}()
 
 	if req.Stream != nil && !*req.Stream {
@@ -489,6 +515,7 @@ func (s *Server) PushModelHandler(c *gin.Context) {
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Sign:     req.Sign,
 		}
 
 		ctx, cancel := context.WithCancel(c.Request.Context())
@@ -548,24 +575,34 @@ func (s *Server) CreateModelHandler(c *gin.Context) {
 		return
 	}
 
-	var sr io.Reader = strings.NewReader(r.Modelfile)
 	if r.Path != "" && r.Modelfile == "" {
-		f, err := os.Open(r.Path)
+		bts, err := os.ReadFile(r.Path)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error reading modelfile: %s", err)})
 			return
 		}
-		defer f.Close()
 
-		sr = f
+		r.Modelfile = string(bts)
 	}
 
-	f, err := parser.ParseFile(sr)
+	f, err := parser.ParseFile(strings.NewReader(r.Modelfile))
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// includes are inlined by the client, the server doesn't read files for
+	// them
+	if slices.ContainsFunc(f.Commands, func(cmd parser.Command) bool { return cmd.Name == "include" }) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errIncludeUnsupported.Error()})
+		return
+	}
+
+	if err := f.Expand(r.BuildArgs); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
@@ -577,7 +614,109 @@ func (s *Server) CreateModelHandler(c *gin.Context) {
 		defer cancel()
 
 		quantization := cmp.Or(r.Quantize, r.Quantization)
-		if err := CreateModel(ctx, name, filepath.Dir(r.Path), strings.ToUpper(quantization), f, fn); err != nil {
+		if err := CreateModel(ctx, name, filepath.Dir(r.Path), strings.ToUpper(quantization), cmp.Or(r.Source, r.Modelfile), f, fn); err != nil {
+			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		s.enforceQuota(name)
+	}()
+
+	if r.Stream != nil && !*r.Stream {
+		waitForStream(c, ch)
+		return
+	}
+
+	streamResponse(c, ch)
+}
+
+func (s *Server) LintHandler(c *gin.Context) {
+	var r api.LintRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if r.Modelfile == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "modelfile is required"})
+		return
+	}
+
+	diags, err := parser.Lint(strings.NewReader(r.Modelfile), func(cmd parser.Command) *parser.Diagnostic {
+		return lintTarget(filepath.Dir(r.Path), cmd)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.LintResponse{Diagnostics: []api.LintDiagnostic{}}
+	for _, d := range diags {
+		resp.Diagnostics = append(resp.Diagnostics, api.LintDiagnostic{
+			Line:     d.Pos.Line,
+			Column:   d.Pos.Column,
+			Severity: string(d.Severity),
+			Message:  d.Message,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) ExportModelHandler(c *gin.Context) {
+	var r api.ExportRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(r.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errtypes.InvalidModelNameErrMsg})
+		return
+	}
+
+	// models are only written to the export directory so clients can't
+	// overwrite other files on the server
+	if r.Path == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	} else if !filepath.IsLocal(r.Path) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path must be relative to the export directory"})
+		return
+	}
+
+	dir := filepath.Join(envconfig.ExportDir, r.Path)
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s isn't empty", r.Path)})
+		return
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ParseNamedManifest(name); errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", r.Model)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+		fn := func(resp api.ProgressResponse) {
+			ch <- resp
+		}
+
+		if err := ExportModel(name, dir, fn); err != nil {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
@@ -612,7 +751,10 @@ func (s *Server) DeleteModelHandler(c *gin.Context) {
 		return
 	}
 
-	if err := m.Remove(); err != nil {
+	if err := m.Remove(); errors.Is(err, errReadOnlyManifest) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -623,6 +765,83 @@ func (s *Server) DeleteModelHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) PruneModelsHandler(c *gin.Context) {
+	var r api.PruneRequest
+	if err := c.ShouldBindJSON(&r); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := s.reclaim(r.DryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) RemoteTagsHandler(c *gin.Context) {
+	var r api.RemoteTagsRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(r.Model)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name %q is invalid", r.Model)})
+		return
+	}
+
+	tags, err := pullModelTags(c.Request.Context(), ParseModelPath(n.String()), &registryOptions{Insecure: r.Insecure})
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("repository %q not found", r.Model)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slices.Sort(tags)
+	c.JSON(http.StatusOK, api.RemoteTagsResponse{Model: r.Model, Tags: tags})
+}
+
+func (s *Server) OutdatedHandler(c *gin.Context) {
+	var r api.OutdatedRequest
+	if err := c.ShouldBindJSON(&r); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ms, err := Manifests()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	models := []api.OutdatedModelResponse{}
+	for n := range ms {
+		m, err := CheckOutdated(c.Request.Context(), n, &registryOptions{Insecure: r.Insecure})
+		if errors.Is(err, os.ErrNotExist) {
+			m.Local = true
+		} else if err != nil {
+			m.Error = err.Error()
+		}
+
+		models = append(models, m)
+	}
+
+	slices.SortFunc(models, func(i, j api.OutdatedModelResponse) int {
+		return strings.Compare(i.Name, j.Name)
+	})
+
+	c.JSON(http.StatusOK, api.OutdatedResponse{Models: models})
+}
+
 func (s *Server) ShowModelHandler(c *gin.Context) {
 	var req api.ShowRequest
 	err := c.ShouldBindJSON(&req)
@@ -704,9 +923,16 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		Template:   m.Template,
 		Details:    modelDetails,
 		Messages:   msgs,
+		Labels:     m.Config.Labels,
 		ModifiedAt: manifest.fi.ModTime(),
 	}
 
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == "application/vnd.ollama.image.adapter" {
+			resp.Adapters = append(resp.Adapters, api.AdapterInfo{Digest: layer.Digest, Scale: m.adapterScale(len(resp.Adapters))})
+		}
+	}
+
 	var params []string
 	cs := 30
 	for k, v := range m.Options {
@@ -727,11 +953,24 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		}
 	}
 
+	if req.System != "" || req.Template != "" || len(req.Options) > 0 {
+		// the Modelfile the model was created from doesn't have the overrides
+		m.Modelfile = ""
+	}
+
 	var sb strings.Builder
 	fmt.Fprintln(&sb, "# Modelfile generated by \"ollama show\"")
 	fmt.Fprintln(&sb, "# To build a new Modelfile based on this, replace FROM with:")
 	fmt.Fprintf(&sb, "# FROM %s\n\n", m.ShortName)
-	fmt.Fprint(&sb, m.String())
+
+	// models are shown as they were written unless they were created before
+	// the source was kept
+	if m.Modelfile != "" {
+		fmt.Fprint(&sb, m.Modelfile)
+	} else {
+		fmt.Fprint(&sb, m.String())
+	}
+
 	resp.Modelfile = sb.String()
 
 	kvData, err := getKVData(m.ModelPath, req.Verbose)
@@ -750,6 +989,13 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 		resp.ProjectorInfo = projectorData
 	}
 
+	if req.Tensors {
+		resp.Tensors, resp.Layers, err = getTensorData(m.ModelPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
 
@@ -776,7 +1022,64 @@ func getKVData(digest string, verbose bool) (llm.KV, error) {
 	return kv, nil
 }
 
+// getTensorData returns the tensors of the model in digest in file order and
+// the size of each of its layers by type.
+func getTensorData(digest string) ([]api.TensorInfo, []api.LayerInfo, error) {
+	ggml, err := llm.LoadModel(digest, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tensors := ggml.Tensors()
+
+	var tensorInfo []api.TensorInfo
+	for _, t := range tensors {
+		// decoded shapes are padded to four dimensions
+		shape := t.Shape
+		for len(shape) > 1 && shape[len(shape)-1] == 1 {
+			shape = shape[:len(shape)-1]
+		}
+
+		tensorInfo = append(tensorInfo, api.TensorInfo{
+			Name:   t.Name,
+			Type:   t.TypeString(),
+			Shape:  shape,
+			Size:   t.Size(),
+			Offset: t.Offset,
+		})
+	}
+
+	var layerInfo []api.LayerInfo
+	offsets := make(map[string]uint64)
+	for name, layer := range tensors.Layers() {
+		info := api.LayerInfo{Name: name, Size: layer.Size(), Types: make(map[string]uint64)}
+
+		offsets[name] = math.MaxUint64
+		for _, t := range layer {
+			info.Types[t.TypeString()] += t.Size()
+			offsets[name] = min(offsets[name], t.Offset)
+		}
+
+		layerInfo = append(layerInfo, info)
+	}
+
+	// layers are ordered as they are in the file
+	slices.SortFunc(layerInfo, func(a, b api.LayerInfo) int {
+		return cmp.Compare(offsets[a.Name], offsets[b.Name])
+	})
+
+	return tensorInfo, layerInfo, nil
+}
+
 func (s *Server) ListModelsHandler(c *gin.Context) {
+	labels := c.QueryArray("label")
+	for _, label := range labels {
+		if key, _, _ := strings.Cut(label, "="); key == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid label filter %q", label)})
+			return
+		}
+	}
+
 	ms, err := Manifests()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -798,6 +1101,10 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 			continue
 		}
 
+		if !hasLabels(cf.Labels, labels) {
+			continue
+		}
+
 		// tag should never be masked
 		models = append(models, api.ListModelResponse{
 			Model:      n.DisplayShortest(),
@@ -805,6 +1112,7 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 			Size:       m.Size(),
 			Digest:     m.digest,
 			ModifiedAt: m.fi.ModTime(),
+			Root:       m.root,
 			Details: api.ModelDetails{
 				Format:            cf.ModelFormat,
 				Family:            cf.ModelFamily,
@@ -812,6 +1120,7 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 				ParameterSize:     cf.ModelType,
 				QuantizationLevel: cf.FileType,
 			},
+			Labels: cf.Labels,
 		})
 	}
 
@@ -823,6 +1132,19 @@ func (s *Server) ListModelsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, api.ListResponse{Models: models})
 }
 
+// hasLabels reports whether labels match every filter, which is "key=value"
+// or "key" for any value.
+func hasLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		key, value, hasValue := strings.Cut(filter, "=")
+		if v, ok := labels[key]; !ok || hasValue && v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *Server) CopyModelHandler(c *gin.Context) {
 	var r api.CopyRequest
 	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
@@ -1030,10 +1352,16 @@ func (s *Server) GenerateRoutes() http.Handler {
 	r.POST("/api/chat", s.ChatHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
 	r.POST("/api/create", s.CreateModelHandler)
+	r.POST("/api/export", s.ExportModelHandler)
+	r.POST("/api/lint", s.LintHandler)
+	r.POST("/api/render", s.RenderHandler)
 	r.POST("/api/push", s.PushModelHandler)
 	r.POST("/api/copy", s.CopyModelHandler)
 	r.DELETE("/api/delete", s.DeleteModelHandler)
+	r.POST("/api/prune", s.PruneModelsHandler)
 	r.POST("/api/show", s.ShowModelHandler)
+	r.POST("/api/tags/remote", s.RemoteTagsHandler)
+	r.POST("/api/outdated", s.OutdatedHandler)
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
 	r.HEAD("/api/blobs/:digest", s.HeadBlobHandler)
 	r.GET("/api/ps", s.ProcessHandler)
@@ -1101,10 +1429,13 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
+	s := &Server{addr: ln.Addr()}
+	s.enforceQuota()
+
 	ctx, done := context.WithCancel(context.Background())
 	schedCtx, schedDone := context.WithCancel(ctx)
 	sched := InitScheduler(schedCtx)
-	s := &Server{addr: ln.Addr(), sched: sched}
+	s.sched = sched
 
 	http.Handle("/", s.GenerateRoutes())
 
@@ -1241,17 +1572,27 @@ func (s *Server) ProcessHandler(c *gin.Context) {
 }
 
 // ChatPrompt builds up a prompt from a series of messages for the currently `loaded` model
-func chatPrompt(ctx context.Context, runner *runnerRef, template string, messages []api.Message, numCtx int) (string, error) {
-	encode := func(s string) ([]int, error) {
-		return runner.llama.Tokenize(ctx, s)
+func chatPrompt(m *Model, messages []api.Message, numCtx int, encode func(string) ([]int, error)) (string, []int, error) {
+	if m.Template == "" && m.ChatTemplate.Template != "" {
+		return ChatTemplatePrompt(m.ChatTemplate, messages, numCtx, encode)
 	}
 
-	prompt, err := ChatPrompt(template, messages, numCtx, encode)
-	if err != nil {
-		return "", err
+	return ChatPrompt(m.Template, messages, numCtx, encode)
+}
+
+// chatMessages adds the model's default system message to messages if the
+// first message is not a system message.
+func chatMessages(m *Model, messages []api.Message) []api.Message {
+	if len(messages) > 0 && messages[0].Role != "system" {
+		return append([]api.Message{
+			{
+				Role:    "system",
+				Content: m.System,
+			},
+		}, messages...)
 	}
 
-	return prompt, nil
+	return messages
 }
 
 func (s *Server) ChatHandler(c *gin.Context) {
@@ -1318,17 +1659,11 @@ func (s *Server) ChatHandler(c *gin.Context) {
 
 	checkpointLoaded := time.Now()
 
-	// if the first message is not a system message, then add the model's default system message
-	if len(req.Messages) > 0 && req.Messages[0].Role != "system" {
-		req.Messages = append([]api.Message{
-			{
-				Role:    "system",
-				Content: model.System,
-			},
-		}, req.Messages...)
-	}
+	req.Messages = chatMessages(model, req.Messages)
 
-	prompt, err := chatPrompt(c.Request.Context(), runner, model.Template, req.Messages, opts.NumCtx)
+	prompt, _, err := chatPrompt(model, req.Messages, opts.NumCtx, func(s string) ([]int, error) {
+		return runner.llama.Tokenize(c.Request.Context(), s)
+	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -1435,6 +1770,174 @@ func (s *Server) ChatHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+// RenderHandler renders the prompt a generate or chat request would send to
+// the model without running inference. The model is loaded to count tokens.
+func (s *Server) RenderHandler(c *gin.Context) {
+	var req api.RenderRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// validate the request
+	switch {
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	case req.Raw && (req.Template != "" || req.System != "" || len(req.Context) > 0):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "raw mode does not support template, system, or context"})
+		return
+	case len(req.Messages) > 0 && (req.Prompt != "" || req.System != "" || req.Template != "" || len(req.Context) > 0 || req.Raw || len(req.Images) > 0):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "messages cannot be combined with prompt, system, template, context, raw, or images"})
+		return
+	}
+
+	images := req.Images
+	for _, m := range req.Messages {
+		images = append(images, m.Images...)
+	}
+
+	for _, img := range images {
+		if !isSupportedImageType(img) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unsupported image format"})
+			return
+		}
+	}
+
+	model, err := GetModel(req.Model)
+	if err != nil {
+		var pErr *fs.PathError
+		if errors.As(err, &pErr) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if model.IsEmbedding() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "embedding models do not support render"})
+		return
+	}
+
+	opts, err := modelOptions(model, req.Options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessionDuration time.Duration
+	if req.KeepAlive == nil {
+		sessionDuration = getDefaultSessionDuration()
+	} else {
+		sessionDuration = req.KeepAlive.Duration
+	}
+
+	rCh, eCh := s.sched.GetRunner(c.Request.Context(), model, opts, sessionDuration)
+	var runner *runnerRef
+	select {
+	case runner = <-rCh:
+	case err = <-eCh:
+		handleErrorResponse(c, err)
+		return
+	}
+
+	encode := func(s string) ([]int, error) {
+		return runner.llama.Tokenize(c.Request.Context(), s)
+	}
+
+	// messages are reported relative to the request's so the default system
+	// message, which is rendered before them, is skipped
+	var prompt string
+	var messages []api.Message
+	var dropped []int
+	var offset int
+	if len(req.Messages) > 0 {
+		messages = chatMessages(model, req.Messages)
+		prompt, dropped, err = chatPrompt(model, messages, opts.NumCtx, encode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		offset = len(messages) - len(req.Messages)
+	} else {
+		generate := api.GenerateRequest{
+			Prompt:   req.Prompt,
+			System:   req.System,
+			Template: req.Template,
+			Context:  req.Context,
+			Raw:      req.Raw,
+			Images:   req.Images,
+		}
+
+		prompt, err = generatePrompt(model, &generate, func(tokens []int) (string, error) {
+			return runner.llama.Detokenize(c.Request.Context(), tokens)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the prompt is the request's only message
+		if req.Prompt != "" {
+			messages = []api.Message{{Role: "user", Content: req.Prompt, Images: req.Images}}
+		}
+	}
+
+	count := func(s string) (int, error) {
+		if s == "" {
+			return 0, nil
+		}
+
+		tokens, err := encode(s)
+		return len(tokens), err
+	}
+
+	resp := api.RenderResponse{
+		Model:    req.Model,
+		Prompt:   prompt,
+		Messages: []api.RenderMessage{},
+	}
+
+	resp.Tokens, err = count(prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var id int
+	for i, m := range messages[offset:] {
+		tokens, err := count(m.Content)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp.Messages = append(resp.Messages, api.RenderMessage{
+			Role:    m.Role,
+			Tokens:  tokens,
+			Dropped: slices.Contains(dropped, i+offset),
+		})
+
+		for range m.Images {
+			resp.Images = append(resp.Images, api.RenderImage{
+				ID:      id,
+				Message: i,
+				Offset:  strings.Index(prompt, fmt.Sprintf("[img-%d]", id)),
+			})
+			id += 1
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func handleErrorResponse(c *gin.Context, err error) {
 	if errors.Is(err, context.Canceled) {
 		c.JSON(499, gin.H{"error": "request canceled"})
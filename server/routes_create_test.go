@@ -1,6 +1,7 @@
 package server
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
@@ -8,15 +9,19 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
 )
 
 var stream bool = false
@@ -64,6 +69,7 @@ func createRequest(t *testing.T, fn func(*gin.Context), body any) *httptest.Resp
 	}
 
 	c.Request = &http.Request{
+		URL:  &url.URL{},
 		Body: io.NopCloser(&b),
 	}
 
@@ -71,6 +77,9 @@ func createRequest(t *testing.T, fn func(*gin.Context), body any) *httptest.Resp
 	return w.ResponseRecorder
 }
 
+// checkFileExists checks the files matching p are expect. Blobs of the
+// Modelfiles models were created from are skipped since their content, and so
+// their digest, has the paths of temporary files.
 func checkFileExists(t *testing.T, p string, expect []string) {
 	t.Helper()
 
@@ -79,6 +88,26 @@ func checkFileExists(t *testing.T, p string, expect []string) {
 		t.Fatal(err)
 	}
 
+	ms, err := Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range ms {
+		for _, layer := range m.Layers {
+			if layer.MediaType != "application/vnd.ollama.image.modelfile" {
+				continue
+			}
+
+			blob, err := GetBlobsPath(layer.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual = slices.DeleteFunc(actual, func(s string) bool { return s == blob })
+		}
+	}
+
 	if !slices.Equal(actual, expect) {
 		t.Fatalf("expected slices to be equal %v", actual)
 	}
@@ -568,3 +597,730 @@ func TestCreateDetectTemplate(t *testing.T) {
 		})
 	})
 }
+
+// createSafetensorsZip zips a small llama checkpoint with the extra files in
+// files and returns the path of the zip file.
+func createSafetensorsZip(t *testing.T, files map[string]any) string {
+	t.Helper()
+
+	shapes := map[string][]uint64{
+		"model.embed_tokens.weight":                      {3, 8},
+		"model.norm.weight":                              {8},
+		"model.layers.0.input_layernorm.weight":          {8},
+		"model.layers.0.post_attention_layernorm.weight": {8},
+		"model.layers.0.self_attn.q_proj.weight":         {8, 8},
+		"model.layers.0.self_attn.k_proj.weight":         {4, 8},
+		"model.layers.0.self_attn.v_proj.weight":         {4, 8},
+		"model.layers.0.self_attn.o_proj.weight":         {8, 8},
+		"model.layers.0.mlp.gate_proj.weight":            {6, 8},
+		"model.layers.0.mlp.up_proj.weight":              {6, 8},
+		"model.layers.0.mlp.down_proj.weight":            {8, 6},
+	}
+
+	// tensors are zero so only their offsets are needed
+	header := make(map[string]any)
+	var offset int64
+	for name, shape := range shapes {
+		size := int64(4)
+		for _, dim := range shape {
+			size *= int64(dim)
+		}
+
+		header[name] = map[string]any{"dtype": "F32", "shape": shape, "data_offsets": []int64{offset, offset + size}}
+		offset += size
+	}
+
+	bts, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var safetensors bytes.Buffer
+	if err := binary.Write(&safetensors, binary.LittleEndian, int64(len(bts))); err != nil {
+		t.Fatal(err)
+	}
+
+	safetensors.Write(bts)
+	safetensors.Write(make([]byte, offset))
+
+	contents := map[string]any{
+		"config.json": map[string]any{
+			"architectures":           []string{"LlamaForCausalLM"},
+			"vocab_size":              3,
+			"hidden_size":             8,
+			"num_hidden_layers":       1,
+			"max_position_embeddings": 128,
+			"intermediate_size":       6,
+			"num_attention_heads":     2,
+			"num_key_value_heads":     1,
+			"rms_norm_eps":            1e-5,
+		},
+		"tokenizer.json": map[string]any{
+			"added_tokens": []map[string]any{
+				{"id": 2, "content": "</s>", "special": true},
+			},
+			"model": map[string]any{
+				"type":   "BPE",
+				"vocab":  map[string]int{"a": 0, "b": 1},
+				"merges": []string{},
+			},
+		},
+		"model.safetensors": safetensors.Bytes(),
+	}
+
+	for name, content := range files {
+		contents[name] = content
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zf := zip.NewWriter(f)
+	for name, content := range contents {
+		w, err := zf.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bts, ok := content.([]byte)
+		if !ok {
+			if bts, err = json.Marshal(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := w.Write(bts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestCreateFromSafetensors(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	f, err := os.Open(createSafetensorsZip(t, map[string]any{
+		"generation_config.json": map[string]any{"do_sample": true, "temperature": 0.6, "eos_token_id": 2},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	layer, err := NewLayer(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM @%s", layer.Digest),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Options["temperature"] != 0.6 {
+		t.Errorf("expected temperature 0.6, actual %v", m.Options["temperature"])
+	}
+
+	if !reflect.DeepEqual(m.Options["stop"], []any{"</s>"}) {
+		t.Errorf("expected stop [</s>], actual %v", m.Options["stop"])
+	}
+}
+
+func TestCreateChatTemplate(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	// a template which doesn't match any of the bundled ones
+	chatTemplate := "{{ bos_token }}{% set ns = namespace(turns=0) %}{% for message in messages %}{% if message.role not in ['system', 'user', 'assistant'] %}{{ raise_exception('unknown role ' ~ message.role) }}{% endif %}{% set ns.turns = ns.turns + 1 %}{{ '[' ~ ns.turns ~ '] ' ~ message.role | upper ~ ': ' ~ message.content | trim ~ '\n' }}{% endfor %}{% if add_generation_prompt %}{{ '[' ~ (ns.turns + 1) ~ '] ASSISTANT:' }}{% endif %}"
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name: "jinja",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{
+			"tokenizer.chat_template":     chatTemplate,
+			"tokenizer.ggml.tokens":       []string{"<unk>", "<s>", "</s>"},
+			"tokenizer.ggml.bos_token_id": uint32(1),
+			"tokenizer.ggml.eos_token_id": uint32(2),
+		}, nil)),
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m, err := GetModel("jinja")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Template != "" {
+		t.Errorf("expected no template, got %q", m.Template)
+	}
+
+	if expect := (ChatTemplate{Template: chatTemplate, BOSToken: "<s>", EOSToken: "</s>"}); m.ChatTemplate != expect {
+		t.Errorf("expected chat template %#v, actual %#v", expect, m.ChatTemplate)
+	}
+
+	prompt, err := m.ChatTemplate.Render([]api.Message{{Role: "user", Content: "Hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "[1] USER: Hello\n[2] ASSISTANT:"; prompt != expect {
+		t.Errorf("expected prompt %q, actual %q", expect, prompt)
+	}
+
+	// the chat template is kept by models created from this one
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "jinja2",
+		Modelfile: "FROM jinja",
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	m2, err := GetModel("jinja2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m2.ChatTemplate != m.ChatTemplate {
+		t.Errorf("expected chat template %#v, actual %#v", m.ChatTemplate, m2.ChatTemplate)
+	}
+}
+
+func TestCreateMetadataChatTemplate(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	// the original template matches a bundled one
+	bin := createBinFile(t, llm.KV{
+		"tokenizer.chat_template":     "{{ bos_token }}{% for message in messages %}{{'<|' + message['role'] + '|>' + '\n' + message['content'] + '<|end|>\n' }}{% endfor %}{% if add_generation_prompt %}{{ '<|assistant|>\n' }}{% else %}{{ eos_token }}{% endif %}",
+		"tokenizer.ggml.tokens":       []string{"<unk>", "<s>", "</s>"},
+		"tokenizer.ggml.bos_token_id": uint32(1),
+		"tokenizer.ggml.eos_token_id": uint32(2),
+	}, nil)
+
+	chatTemplate := "{% for message in messages %}{{ message.role ~ ': ' ~ message.content }}{% endfor %}{{ eos_token }}"
+
+	cases := []struct {
+		name      string
+		modelfile string
+		template  string
+		chat      ChatTemplate
+	}{
+		{
+			"chat template",
+			fmt.Sprintf("FROM %s\nMETADATA tokenizer.chat_template \"%s\"", bin, chatTemplate),
+			"",
+			ChatTemplate{Template: chatTemplate, BOSToken: "<s>", EOSToken: "</s>"},
+		},
+		{
+			"eos token",
+			fmt.Sprintf("FROM %s\nMETADATA tokenizer.chat_template \"%s\"\nMETADATA tokenizer.ggml.eos_token_id 1", bin, chatTemplate),
+			"",
+			ChatTemplate{Template: chatTemplate, BOSToken: "<s>", EOSToken: "<s>"},
+		},
+		{
+			"template",
+			fmt.Sprintf("FROM %s\nTEMPLATE {{ .Prompt }}\nMETADATA tokenizer.chat_template \"%s\"", bin, chatTemplate),
+			"{{ .Prompt }}",
+			ChatTemplate{Template: chatTemplate, BOSToken: "<s>", EOSToken: "</s>"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+				Name:      "test",
+				Modelfile: tt.modelfile,
+				Stream:    &stream,
+			})
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+			}
+
+			m, err := GetModel("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.Template != tt.template {
+				t.Errorf("expected template %q, actual %q", tt.template, m.Template)
+			}
+
+			if m.ChatTemplate != tt.chat {
+				t.Errorf("expected chat template %#v, actual %#v", tt.chat, m.ChatTemplate)
+			}
+		})
+	}
+}
+
+func TestCreateMetadata(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	data := make([]byte, 32*4)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	bin := createBinFile(t, llm.KV{
+		"general.architecture":  "llama",
+		"llama.context_length":  uint32(2048),
+		"tokenizer.ggml.tokens": []string{"a", "b"},
+	}, []llm.Tensor{
+		{Name: "blk.0.attn_norm.weight", Kind: 0, Offset: 0, Shape: []uint64{32}, WriterTo: bytes.NewReader(data)},
+		{Name: "output_norm.weight", Kind: 0, Offset: 128, Shape: []uint64{32}, WriterTo: bytes.NewReader(data)},
+	})
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name: "test",
+		Modelfile: fmt.Sprintf(`FROM %s
+METADATA llama.context_length 8192
+METADATA tokenizer.ggml.eos_token_id 1
+METADATA general.description "a fixed model"
+`, bin),
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "test", Tensors: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]any{
+		"general.architecture":        "llama",
+		"general.description":         "a fixed model",
+		"llama.context_length":        float64(8192),
+		"tokenizer.ggml.eos_token_id": float64(1),
+		"tokenizer.ggml.tokens":       []any{"a", "b"},
+	} {
+		if !reflect.DeepEqual(resp.ModelInfo[k], v) {
+			t.Errorf("%s: expected %v, actual %v", k, v, resp.ModelInfo[k])
+		}
+	}
+
+	if len(resp.Tensors) != 2 {
+		t.Fatalf("expected 2 tensors, actual %d", len(resp.Tensors))
+	}
+
+	// tensor data is copied from the original file
+	m, err := ParseNamedManifest(model.ParseName("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, layer := range m.Layers {
+		if layer.MediaType != "application/vnd.ollama.image.model" {
+			continue
+		}
+
+		blob, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bts, err := os.ReadFile(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.HasSuffix(bts, append(slices.Clone(data), data...)) {
+			t.Error("expected tensor data to be unchanged")
+		}
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, modelfile := range []string{
+			"METADATA llama.context_length large",
+			"METADATA tokenizer.ggml.tokens c",
+		} {
+			w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+				Name:      "test",
+				Modelfile: fmt.Sprintf("FROM %s\n%s", bin, modelfile),
+				Stream:    &stream,
+			})
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("%s: expected status code 500, actual %d", modelfile, w.Code)
+			}
+		}
+	})
+}
+
+func TestCreateSplit(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	data := make([]byte, 32*4)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	dir := t.TempDir()
+	var digests []string
+	for i, kv := range []llm.KV{
+		{
+			"general.architecture":  "llama",
+			"tokenizer.ggml.tokens": []string{"a", "b"},
+			"split.no":              uint16(0),
+			"split.count":           uint16(2),
+			"split.tensors.count":   int32(2),
+		},
+		{
+			"split.no":    uint16(1),
+			"split.count": uint16(2),
+		},
+	} {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("model-%05d-of-00002.gguf", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := llm.NewGGUFV3(binary.LittleEndian).Encode(f, kv, []llm.Tensor{
+			{Name: fmt.Sprintf("blk.%d.attn_norm.weight", i), Kind: 0, Offset: 0, Shape: []uint64{32}, WriterTo: bytes.NewReader(data)},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		layer, err := NewLayer(f, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digests = append(digests, "@"+layer.Digest)
+	}
+
+	for _, tt := range []struct {
+		name string
+		from string
+	}{
+		{"path", filepath.Join(dir, "model-00001-of-00002.gguf")},
+		{"blobs", strings.Join(digests, " ")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+				Name:      "test",
+				Modelfile: fmt.Sprintf("FROM %s", tt.from),
+				Stream:    &stream,
+			})
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+			}
+
+			w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "test", Tensors: true})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d", w.Code)
+			}
+
+			var resp api.ShowResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(resp.Tensors) != 2 {
+				t.Fatalf("expected 2 tensors, actual %d", len(resp.Tensors))
+			}
+
+			if _, ok := resp.ModelInfo["split.count"]; ok {
+				t.Error("expected split metadata to be removed")
+			}
+
+			if !reflect.DeepEqual(resp.ModelInfo["tokenizer.ggml.tokens"], []any{"a", "b"}) {
+				t.Errorf("expected tokens [a b], actual %v", resp.ModelInfo["tokenizer.ggml.tokens"])
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, from := range []string{
+			digests[0],
+			digests[1] + " " + digests[0],
+			digests[0] + " " + filepath.Join(dir, "model-00002-of-00002.gguf"),
+		} {
+			w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+				Name:      "test",
+				Modelfile: fmt.Sprintf("FROM %s", from),
+				Stream:    &stream,
+			})
+
+			if w.Code == http.StatusOK {
+				t.Errorf("%s: expected an error, actual %d", from, w.Code)
+			}
+		}
+	})
+
+	t.Run("missing shard", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(dir, "model-00002-of-00002.gguf")); err != nil {
+			t.Fatal(err)
+		}
+
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "test",
+			Modelfile: fmt.Sprintf("FROM %s", filepath.Join(dir, "model-00001-of-00002.gguf")),
+			Stream:    &stream,
+		})
+
+		if w.Code == http.StatusOK {
+			t.Errorf("expected an error, actual %d", w.Code)
+		}
+	})
+}
+
+func TestCreateFromPathWithSpace(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	bin := createBinFile(t, nil, nil)
+	p := filepath.Join(t.TempDir(), "my model.gguf")
+	if err := os.Rename(bin, p); err != nil {
+		t.Fatal(err)
+	}
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s", p),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateBuildArgs(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	modelfile := fmt.Sprintf(`ARG base=%s
+ARG ctx=2048
+FROM ${base}
+PARAMETER num_ctx ${ctx}
+`, createBinFile(t, nil, nil))
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: modelfile,
+		BuildArgs: map[string]string{"ctx": "8192"},
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(resp.Parameters, "num_ctx") || !strings.Contains(resp.Parameters, "8192") {
+		t.Errorf("expected num_ctx 8192, actual %q", resp.Parameters)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tt := range []struct {
+			modelfile string
+			args      map[string]string
+		}{
+			{modelfile + "PARAMETER temperature ${temperature}\n", nil},
+			{modelfile, map[string]string{"temperature": "0.5"}},
+		} {
+			w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+				Name:      "test",
+				Modelfile: tt.modelfile,
+				BuildArgs: tt.args,
+				Stream:    &stream,
+			})
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status code 400, actual %d", w.Code)
+			}
+		}
+	})
+}
+
+func TestCreateInclude(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	var s Server
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("not a modelfile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	modelfile := fmt.Sprintf("FROM %s\nINCLUDE secret\n", createBinFile(t, nil, nil))
+	path := filepath.Join(dir, "Modelfile")
+	if err := os.WriteFile(path, []byte(modelfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []api.CreateRequest{
+		{Name: "test", Modelfile: modelfile, Stream: &stream},
+		{Name: "test", Path: path, Stream: &stream},
+	} {
+		w := createRequest(t, s.CreateModelHandler, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+
+		var resp map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp["error"] != errIncludeUnsupported.Error() {
+			t.Errorf("expected error %q, actual %q", errIncludeUnsupported, resp["error"])
+		}
+	}
+}
+
+func TestCreateAdapterScale(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+	var s Server
+
+	createAdapter := func(t *testing.T, r uint32) string {
+		t.Helper()
+
+		f, err := os.CreateTemp(t.TempDir(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := llm.NewGGLAV1().Encode(f, llm.KV{"r": r, "alpha": uint32(1)}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		return f.Name()
+	}
+
+	a, b := createAdapter(t, 1), createAdapter(t, 2)
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s\nADAPTER %s SCALE 0.5\nADAPTER %s\n", createBinFile(t, nil, nil), a, b),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	m, err := GetModel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(m.AdapterScales, []float32{0.5, 1}) {
+		t.Errorf("expected adapter scales [0.5 1], actual %v", m.AdapterScales)
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Adapters) != 2 || resp.Adapters[0].Scale != 0.5 || resp.Adapters[1].Scale != 1 {
+		t.Errorf("expected adapters at scales 0.5 and 1, actual %v", resp.Adapters)
+	}
+
+	if s := m.String(); !strings.Contains(s, fmt.Sprintf("ADAPTER %s SCALE 0.5\nADAPTER %s\n", m.AdapterPaths[0], m.AdapterPaths[1])) {
+		t.Errorf("expected adapter scales in Modelfile, actual %s", s)
+	}
+
+	t.Run("from model", func(t *testing.T) {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "derived",
+			Modelfile: "FROM test\nPARAMETER temperature 0.5\n",
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		m, err := GetModel("derived")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(m.AdapterScales, []float32{0.5, 1}) {
+			t.Errorf("expected adapter scales [0.5 1], actual %v", m.AdapterScales)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "test",
+			Modelfile: fmt.Sprintf("FROM %s\nADAPTER %s SCALE 1e40\n", createBinFile(t, nil, nil), a),
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+	})
+}
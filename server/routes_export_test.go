@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestExport(t *testing.T) {
+	p := t.TempDir()
+	exports := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	t.Setenv("OLLAMA_EXPORT_DIR", exports)
+	envconfig.LoadConfig()
+
+	var s Server
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name: "test",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{
+			"general.architecture":       "llama",
+			"llama.block_count":          uint32(1),
+			"llama.embedding_length":     uint32(4),
+			"llama.attention.head_count": uint32(1),
+			"tokenizer.ggml.model":       "gpt2",
+			"tokenizer.ggml.tokens":      []string{"a", "b"},
+			"tokenizer.ggml.token_type":  []int32{1, 1},
+		}, []llm.Tensor{
+			{Name: "token_embd.weight", Kind: 0, Offset: 0, Shape: []uint64{2, 4}, WriterTo: bytes.NewReader(make([]byte, 32))},
+			{Name: "output_norm.weight", Kind: 0, Offset: 32, Shape: []uint64{4}, WriterTo: bytes.NewReader(make([]byte, 16))},
+		})),
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	t.Run("export", func(t *testing.T) {
+		dir := filepath.Join(exports, "test")
+		w := createRequest(t, s.ExportModelHandler, api.ExportRequest{Model: "test", Path: "test", Stream: &stream})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		checkFileExists(t, filepath.Join(dir, "*"), []string{
+			filepath.Join(dir, "config.json"),
+			filepath.Join(dir, "model-00001-of-00001.safetensors"),
+			filepath.Join(dir, "model.safetensors.index.json"),
+			filepath.Join(dir, "tokenizer.json"),
+			filepath.Join(dir, "tokenizer_config.json"),
+		})
+
+		bts, err := os.ReadFile(filepath.Join(dir, "config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var config struct {
+			Architectures []string `json:"architectures"`
+			VocabSize     int      `json:"vocab_size"`
+		}
+
+		if err := json.Unmarshal(bts, &config); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(config.Architectures) != 1 || config.Architectures[0] != "LlamaForCausalLM" {
+			t.Errorf("expected architectures [LlamaForCausalLM], actual %v", config.Architectures)
+		}
+
+		if config.VocabSize != 2 {
+			t.Errorf("expected vocab_size 2, actual %d", config.VocabSize)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := createRequest(t, s.ExportModelHandler, api.ExportRequest{Model: "missing", Path: "missing"})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected status code 404, actual %d", w.Code)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		path string
+	}{
+		{"absolute path", filepath.Join(t.TempDir(), "test")},
+		{"outside the export directory", filepath.Join("..", "test")},
+		{"not empty", "test"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.ExportModelHandler, api.ExportRequest{Model: "test", Path: tt.path})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status code 400, actual %d", w.Code)
+			}
+		})
+	}
+}
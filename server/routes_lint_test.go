@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestLint(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	envconfig.LoadConfig()
+
+	var s Server
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "test",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	cases := []struct {
+		name      string
+		modelfile string
+		expected  []api.LintDiagnostic
+	}{
+		{
+			"valid",
+			"FROM test\nPARAMETER temperature 0.5",
+			[]api.LintDiagnostic{},
+		},
+		{
+			"missing targets",
+			fmt.Sprintf("FROM missing\nADAPTER %s\nPARAMETER temperature hot", filepath.Join(p, "adapter.gguf")),
+			[]api.LintDiagnostic{
+				{Line: 1, Column: 1, Severity: "warning", Message: "model 'missing' isn't available locally, it will be pulled"},
+				{Line: 2, Column: 1, Severity: "error", Message: fmt.Sprintf("%s doesn't exist", filepath.Join(p, "adapter.gguf"))},
+				{Line: 3, Column: 1, Severity: "error", Message: "temperature: invalid float value [hot]"},
+			},
+		},
+		{
+			"include",
+			"FROM test\nINCLUDE shared.modelfile",
+			[]api.LintDiagnostic{
+				{Line: 2, Column: 1, Severity: "error", Message: errIncludeUnsupported.Error()},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.LintHandler, api.LintRequest{Modelfile: tt.modelfile})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code 200, actual %d", w.Code)
+			}
+
+			var resp api.LintResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(resp.Diagnostics, tt.expected) {
+				t.Errorf("expected %v, actual %v", tt.expected, resp.Diagnostics)
+			}
+		})
+	}
+
+	t.Run("relative to path", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Rename(createBinFile(t, nil, nil), filepath.Join(dir, "model.gguf")); err != nil {
+			t.Fatal(err)
+		}
+
+		w := createRequest(t, s.LintHandler, api.LintRequest{
+			Modelfile: "FROM ./model.gguf",
+			Path:      filepath.Join(dir, "Modelfile"),
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.LintResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Diagnostics) > 0 {
+			t.Errorf("expected no diagnostics, actual %v", resp.Diagnostics)
+		}
+	})
+
+	t.Run("missing modelfile", func(t *testing.T) {
+		w := createRequest(t, s.LintHandler, api.LintRequest{})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+	})
+
+	t.Run("path isn't read", func(t *testing.T) {
+		modelfile := filepath.Join(t.TempDir(), "Modelfile")
+		if err := os.WriteFile(modelfile, []byte("FROM test"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		w := createRequest(t, s.LintHandler, api.LintRequest{Path: modelfile})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+	})
+}
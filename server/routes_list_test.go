@@ -3,10 +3,17 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
 )
@@ -61,3 +68,223 @@ func TestList(t *testing.T) {
 		t.Fatalf("expected slices to be equal %v", actualNames)
 	}
 }
+
+func TestListModelsDirs(t *testing.T) {
+	shared, user := t.TempDir(), t.TempDir()
+
+	t.Setenv("OLLAMA_MODELS", shared)
+	envconfig.LoadConfig()
+
+	var s Server
+	createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "shared",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, nil, nil)),
+	})
+
+	// searched first but read-only
+	writableDirs.Store(shared, false)
+	t.Cleanup(func() { writableDirs.Delete(shared) })
+
+	t.Setenv("OLLAMA_MODELS", strings.Join([]string{shared, user}, string(os.PathListSeparator)))
+	envconfig.LoadConfig()
+
+	createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "user",
+		Modelfile: "FROM shared\nSYSTEM hello",
+	})
+
+	w := createRequest(t, s.ListModelsHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ListResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make(map[string]string)
+	for _, m := range resp.Models {
+		roots[m.Name] = m.Root
+	}
+
+	if roots["shared:latest"] != shared || roots["user:latest"] != user {
+		t.Errorf("expected models in %s and %s, actual %v", shared, user, roots)
+	}
+
+	// the model layer is reused from the shared directory
+	checkFileExists(t, filepath.Join(user, "blobs", "*"), []string{
+		filepath.Join(user, "blobs", "sha256-2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"),
+		filepath.Join(user, "blobs", "sha256-9c4f80aea9d4a93010476ffc5e3e751c5bfc746b9680aa41b87f9d242a2ba11b"),
+	})
+
+	w = createRequest(t, s.DeleteModelHandler, api.DeleteRequest{Name: "shared"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status code 403, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(shared, "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(shared, "manifests", "registry.ollama.ai", "library", "shared", "latest"),
+	})
+}
+
+func TestListLabels(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+	for name, labels := range map[string]string{
+		"a": "LABEL owner=ml-team\nLABEL eval.mmlu=0.71\n",
+		"b": "LABEL owner=ml-team\nLABEL lineage=\"a, then b\"\n",
+		"c": "",
+	} {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      name,
+			Modelfile: fmt.Sprintf("FROM %s\n%s", createBinFile(t, nil, nil), labels),
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	list := func(t *testing.T, labels ...string) []api.ListModelResponse {
+		t.Helper()
+
+		w := NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/tags?"+url.Values{"label": labels}.Encode(), nil)
+		s.ListModelsHandler(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ListResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.Models
+	}
+
+	cases := []struct {
+		labels []string
+		expect []string
+	}{
+		{nil, []string{"a:latest", "b:latest", "c:latest"}},
+		{[]string{"owner=ml-team"}, []string{"a:latest", "b:latest"}},
+		{[]string{"owner"}, []string{"a:latest", "b:latest"}},
+		{[]string{"owner=ml-team", "eval.mmlu"}, []string{"a:latest"}},
+		{[]string{"lineage=a, then b"}, []string{"b:latest"}},
+		{[]string{"owner=someone"}, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(strings.Join(tt.labels, ","), func(t *testing.T) {
+			var names []string
+			for _, m := range list(t, tt.labels...) {
+				names = append(names, m.Name)
+			}
+
+			slices.Sort(names)
+			if !slices.Equal(names, tt.expect) {
+				t.Errorf("expected %v, actual %v", tt.expect, names)
+			}
+		})
+	}
+
+	models := list(t, "eval.mmlu=0.71")
+	if len(models) != 1 || models[0].Labels["owner"] != "ml-team" || models[0].Labels["eval.mmlu"] != "0.71" {
+		t.Errorf("expected labels of a, actual %v", models)
+	}
+
+	t.Run("show", func(t *testing.T) {
+		w := createRequest(t, s.ShowModelHandler, api.ShowRequest{Name: "b"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Labels["lineage"] != "a, then b" {
+			t.Errorf("expected lineage label, actual %v", resp.Labels)
+		}
+
+		m, err := GetModel("b")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := m.String(); !strings.Contains(s, "LABEL lineage=a, then b\nLABEL owner=ml-team\n") {
+			t.Errorf("expected labels in Modelfile, actual %s", s)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "d",
+			Modelfile: fmt.Sprintf("FROM %s\nLABEL owner\n", createBinFile(t, nil, nil)),
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status code 500, actual %d", w.Code)
+		}
+	})
+}
+
+func TestCreateInheritsLabels(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "base",
+		Modelfile: fmt.Sprintf("FROM %s\nLABEL owner=ml-team\nLABEL eval.mmlu=0.71\n", createBinFile(t, nil, nil)),
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	// a LABEL before FROM still overrides the base model's
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "derived",
+		Modelfile: "LABEL eval.mmlu=0.75\nFROM base\nLABEL lineage=base\n",
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Name: "derived"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{"owner": "ml-team", "eval.mmlu": "0.75", "lineage": "base"}
+	if !maps.Equal(resp.Labels, expect) {
+		t.Errorf("expected labels %v, actual %v", expect, resp.Labels)
+	}
+
+	m, err := GetModel("derived")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := m.String(); !strings.Contains(s, "LABEL eval.mmlu=0.75\nLABEL lineage=base\nLABEL owner=ml-team\n") {
+		t.Errorf("expected sorted labels in Modelfile, actual %s", s)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestRemoteTags(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/test/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+
+		tags := []string{"b", "a"}
+		if r.URL.Query().Get("last") == "b" {
+			tags = []string{"c"}
+		} else {
+			w.Header().Set("Link", `</v2/library/test/tags/list?last=b&n=2>; rel="next"`)
+		}
+
+		if err := json.NewEncoder(w).Encode(map[string]any{"name": "library/test", "tags": tags}); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s Server
+	w := createRequest(t, s.RemoteTagsHandler, api.RemoteTagsRequest{Model: u.Host + "/library/test", Insecure: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.RemoteTagsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(resp.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("expected tags a, b and c, actual %v", resp.Tags)
+	}
+
+	w = createRequest(t, s.RemoteTagsHandler, api.RemoteTagsRequest{Model: u.Host + "/library/missing", Insecure: true})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", w.Code)
+	}
+}
+
+// createOutdatedModel writes a local model with a single layer.
+func createOutdatedModel(t *testing.T, name, layer string) *Manifest {
+	t.Helper()
+
+	config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLayer(strings.NewReader(layer), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := model.ParseName(name)
+	if err := WriteManifest(n, config, []*Layer{l}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestOutdated(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/test/manifests/latest" && r.URL.Path != "/v2/library/test/manifests/old" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// both tags point at the current model
+		m, err := ParseNamedManifest(model.ParseName(r.Host + "/library/test:latest"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(m.ManifestV2); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := createOutdatedModel(t, u.Host+"/library/test:latest", "current")
+	createOutdatedModel(t, u.Host+"/library/test:old", "old")
+	createOutdatedModel(t, u.Host+"/library/missing:latest", "missing")
+
+	var s Server
+	w := createRequest(t, s.OutdatedHandler, api.OutdatedRequest{Insecure: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.OutdatedResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, m := range resp.Models {
+		actual = append(actual, fmt.Sprintf("%s outdated=%t local=%t error=%q", strings.TrimPrefix(m.Name, u.Host+"/library/"), m.Outdated, m.Local, m.Error))
+	}
+
+	expect := []string{
+		`missing:latest outdated=false local=true error=""`,
+		`test:latest outdated=false local=false error=""`,
+		`test:old outdated=true local=false error=""`,
+	}
+
+	if !slices.Equal(actual, expect) {
+		t.Errorf("expected %v, actual %v", expect, actual)
+	}
+
+	for _, m := range resp.Models {
+		if m.Name == u.Host+"/library/test:latest" && m.Digest != current.digest {
+			t.Errorf("expected digest %s, actual %s", current.digest, m.Digest)
+		}
+	}
+}
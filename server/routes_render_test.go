@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+	"github.com/ollama/ollama/gpu"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestRenderErrors(t *testing.T) {
+	var s Server
+
+	cases := []struct {
+		name string
+		req  api.RenderRequest
+		code int
+		want string
+	}{
+		{
+			"missing model",
+			api.RenderRequest{Prompt: "hi"},
+			http.StatusBadRequest,
+			"model is required",
+		},
+		{
+			"raw with system",
+			api.RenderRequest{Model: "test", Prompt: "hi", System: "You are a Wizard.", Raw: true},
+			http.StatusBadRequest,
+			"raw mode does not support template, system, or context",
+		},
+		{
+			"messages with prompt",
+			api.RenderRequest{Model: "test", Prompt: "hi", Messages: []api.Message{{Role: "user", Content: "hi"}}},
+			http.StatusBadRequest,
+			"messages cannot be combined with prompt, system, template, context, raw, or images",
+		},
+		{
+			"unsupported image",
+			api.RenderRequest{Model: "test", Messages: []api.Message{{Role: "user", Content: "hi", Images: []api.ImageData{[]byte("not an image")}}}},
+			http.StatusBadRequest,
+			"unsupported image format",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.RenderHandler, tt.req)
+			if w.Code != tt.code {
+				t.Fatalf("expected status code %d, actual %d", tt.code, w.Code)
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp["error"] != tt.want {
+				t.Errorf("expected error %q, actual %q", tt.want, resp["error"])
+			}
+		})
+	}
+}
+
+// wordLlm tokenizes by splitting on whitespace, each word of words being a
+// token, and records the prompt of the last completion.
+type wordLlm struct {
+	mockLlm
+	words  []string
+	prompt string
+}
+
+func (s *wordLlm) Completion(ctx context.Context, req llm.CompletionRequest, fn func(llm.CompletionResponse)) error {
+	s.prompt = req.Prompt
+	fn(llm.CompletionResponse{Done: true, DoneReason: "stop"})
+	return nil
+}
+
+func (s *wordLlm) Tokenize(ctx context.Context, content string) ([]int, error) {
+	var tokens []int
+	for _, field := range strings.Fields(content) {
+		id := slices.Index(s.words, field)
+		if id < 0 {
+			id = len(s.words)
+			s.words = append(s.words, field)
+		}
+
+		tokens = append(tokens, id)
+	}
+
+	return tokens, nil
+}
+
+func (s *wordLlm) Detokenize(ctx context.Context, tokens []int) (string, error) {
+	var words []string
+	for _, token := range tokens {
+		words = append(words, s.words[token])
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+func TestRender(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	llama := wordLlm{words: []string{"be", "nice", "hi", "there!"}}
+	s := Server{sched: InitScheduler(ctx)}
+	s.sched.newServerFn = func(gpu.GpuInfoList, string, *llm.GGML, []string, []float32, []string, api.Options) (llm.LlamaServer, error) {
+		return &llama, nil
+	}
+	s.sched.getGpuFn = func() gpu.GpuInfoList {
+		g := gpu.GpuInfo{Library: "cpu"}
+		g.TotalMemory = 32 * format.GigaByte
+		g.FreeMemory = 26 * format.GigaByte
+		return []gpu.GpuInfo{g}
+	}
+	s.sched.getCpuFn = s.sched.getGpuFn
+	s.sched.Run(ctx)
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name: "test",
+		Modelfile: fmt.Sprintf("FROM %s\nSYSTEM be nice\nTEMPLATE \"{{ if .System }}{{ .System }} {{ end }}{{ .Prompt }} {{ .Response }}\"", createBinFile(t, llm.KV{
+			"general.architecture":          "llama",
+			"llama.context_length":          uint32(32),
+			"llama.embedding_length":        uint32(4096),
+			"llama.block_count":             uint32(1),
+			"llama.attention.head_count":    uint32(32),
+			"llama.attention.head_count_kv": uint32(32),
+			"tokenizer.ggml.tokens":         []string{" "},
+			"tokenizer.ggml.scores":         []float32{0},
+			"tokenizer.ggml.token_type":     []int32{0},
+		}, []llm.Tensor{
+			{Name: "token_embd.weight", Kind: 0, Offset: 0, Shape: []uint64{1, 8}, WriterTo: bytes.NewReader(make([]byte, 32))},
+			{Name: "output.weight", Kind: 0, Offset: 32, Shape: []uint64{1, 8}, WriterTo: bytes.NewReader(make([]byte, 32))},
+		})),
+		Stream: &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+	}
+
+	t.Run("messages", func(t *testing.T) {
+		messages := []api.Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "there!"},
+			{Role: "user", Content: "hi there!"},
+		}
+
+		w := createRequest(t, s.RenderHandler, api.RenderRequest{
+			Model:    "test",
+			Messages: messages,
+			Options:  map[string]any{"num_ctx": 6},
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.RenderResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "be nice hi there! "; resp.Prompt != want {
+			t.Errorf("expected prompt %q, actual %q", want, resp.Prompt)
+		}
+
+		// messages are those of the request, without the system message
+		want := []api.RenderMessage{
+			{Role: "user", Tokens: 1, Dropped: true},
+			{Role: "assistant", Tokens: 1, Dropped: true},
+			{Role: "user", Tokens: 2},
+		}
+
+		if !reflect.DeepEqual(resp.Messages, want) {
+			t.Errorf("expected messages %v, actual %v", want, resp.Messages)
+		}
+
+		// chat truncates the same messages and sends the rendered prompt
+		w = createRequest(t, s.ChatHandler, api.ChatRequest{
+			Model:    "test",
+			Messages: messages,
+			Stream:   &stream,
+			Options:  map[string]any{"num_ctx": 6},
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+
+		if llama.prompt != resp.Prompt {
+			t.Errorf("expected chat prompt %q, actual %q", resp.Prompt, llama.prompt)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		w := createRequest(t, s.RenderHandler, api.RenderRequest{
+			Model:   "test",
+			Prompt:  "hi",
+			Context: []int{2, 3},
+			Options: map[string]any{"num_ctx": 6},
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body)
+		}
+
+		var resp api.RenderResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "hi there!be nice hi "; resp.Prompt != want {
+			t.Errorf("expected prompt %q, actual %q", want, resp.Prompt)
+		}
+
+		want := []api.RenderMessage{{Role: "user", Tokens: 1}}
+		if !reflect.DeepEqual(resp.Messages, want) {
+			t.Errorf("expected messages %v, actual %v", want, resp.Messages)
+		}
+	})
+}
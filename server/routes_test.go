@@ -67,7 +67,7 @@ func Test_Routes(t *testing.T) {
 		fn := func(resp api.ProgressResponse) {
 			t.Logf("Status: %s", resp.Status)
 		}
-		err = CreateModel(context.TODO(), model.ParseName(name), "", "", modelfile, fn)
+		err = CreateModel(context.TODO(), model.ParseName(name), "", "", "", modelfile, fn)
 		require.NoError(t, err)
 	}
 
@@ -364,3 +364,214 @@ func TestShow(t *testing.T) {
 		t.Fatal("Expected projector architecture to be 'clip', but got", resp.ProjectorInfo["general.architecture"])
 	}
 }
+
+func TestShowModelfile(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+
+	bin := createBinFile(t, llm.KV{"general.architecture": "test"}, nil)
+	source := fmt.Sprintf(`FROM %s
+PARAMETER top_k 10
+MESSAGE user "hello: there"
+PARAMETER temperature 0.5
+SYSTEM """
+be nice
+"""
+PARAMETER num_ctx 4096
+`, bin)
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "show-model",
+		Modelfile: source,
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Name: "show-model"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// the Modelfile is shown as it was written
+	header := "# Modelfile generated by \"ollama show\"\n# To build a new Modelfile based on this, replace FROM with:\n# FROM show-model:latest\n\n"
+	if resp.Modelfile != header+source {
+		t.Errorf("expected Modelfile\n%s\nactual\n%s", header+source, resp.Modelfile)
+	}
+
+	m, err := GetModel("show-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the generated Modelfile, which is shown for models created before the
+	// source was kept, skipping FROM and the default TEMPLATE
+	generated := m.String()
+	modelfile := generated[strings.Index(generated, "SYSTEM"):]
+
+	expected := `SYSTEM """
+be nice
+"""
+PARAMETER num_ctx 4096
+PARAMETER temperature 0.5
+PARAMETER top_k 10
+MESSAGE user hello: there
+`
+	if modelfile != expected {
+		t.Errorf("expected Modelfile\n%s\nactual\n%s", expected, modelfile)
+	}
+}
+
+func TestShowModelfileSource(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+
+	bin := createBinFile(t, llm.KV{"general.architecture": "test"}, nil)
+
+	// the client sends the Modelfile with ARGs expanded and files uploaded
+	// along with the source as it was written
+	source := `# the base model
+ARG model
+FROM ${model}
+
+# be brief
+PARAMETER top_k 10
+SYSTEM be nice
+# the end
+`
+
+	w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "show-model",
+		Modelfile: fmt.Sprintf("FROM %s\nPARAMETER top_k 10\nSYSTEM be nice\n", bin),
+		Source:    source,
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	// models created from it have their own source
+	w = createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name:      "derived-model",
+		Modelfile: "FROM show-model",
+		Stream:    &stream,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	header := func(name string) string {
+		return fmt.Sprintf("# Modelfile generated by \"ollama show\"\n# To build a new Modelfile based on this, replace FROM with:\n# FROM %s\n\n", name)
+	}
+
+	for _, tt := range []struct {
+		req    api.ShowRequest
+		expect string
+	}{
+		{api.ShowRequest{Name: "show-model"}, header("show-model:latest") + source},
+		{api.ShowRequest{Name: "derived-model"}, header("derived-model:latest") + "FROM show-model"},
+	} {
+		w = createRequest(t, s.ShowModelHandler, tt.req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		var resp api.ShowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Modelfile != tt.expect {
+			t.Errorf("expected Modelfile\n%s\nactual\n%s", tt.expect, resp.Modelfile)
+		}
+	}
+
+	// overrides are shown in a generated Modelfile
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Name: "show-model", System: "be rude"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(resp.Modelfile, header("show-model:latest")) || strings.Contains(resp.Modelfile, "# be brief") || !strings.Contains(resp.Modelfile, "SYSTEM be rude") {
+		t.Errorf("expected generated Modelfile, actual\n%s", resp.Modelfile)
+	}
+}
+
+func TestShowTensors(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var s Server
+
+	tensor := func(name string, kind uint32, offset uint64, shape ...uint64) llm.Tensor {
+		t := llm.Tensor{Name: name, Kind: kind, Offset: offset, Shape: shape}
+		t.WriterTo = bytes.NewReader(make([]byte, t.Size()))
+		return t
+	}
+
+	createRequest(t, s.CreateModelHandler, api.CreateRequest{
+		Name: "show-tensors",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{"general.architecture": "test"}, []llm.Tensor{
+			tensor("token_embd.weight", 1, 0, 32, 8),
+			tensor("blk.0.attn_norm.weight", 0, 512, 32),
+			tensor("blk.0.attn_q.weight", 8, 640, 32, 32),
+			tensor("output.weight", 14, 1728, 1, 256),
+		})),
+	})
+
+	w := createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "show-tensors", Tensors: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []api.TensorInfo{
+		{Name: "token_embd.weight", Type: "F16", Shape: []uint64{8, 32}, Size: 512, Offset: 0},
+		{Name: "blk.0.attn_norm.weight", Type: "F32", Shape: []uint64{32}, Size: 128, Offset: 512},
+		{Name: "blk.0.attn_q.weight", Type: "Q8_0", Shape: []uint64{32, 32}, Size: 1088, Offset: 640},
+		{Name: "output.weight", Type: "Q6_K", Shape: []uint64{256}, Size: 210, Offset: 1728},
+	}, resp.Tensors)
+
+	assert.Equal(t, []api.LayerInfo{
+		{Name: "token_embd", Size: 512, Types: map[string]uint64{"F16": 512}},
+		{Name: "blk.0", Size: 1216, Types: map[string]uint64{"F32": 128, "Q8_0": 1088}},
+		{Name: "output", Size: 210, Types: map[string]uint64{"Q6_K": 210}},
+	}, resp.Layers)
+
+	// tensors are only included when requested
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "show-tensors"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	resp = api.ShowResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Tensors != nil || resp.Layers != nil {
+		t.Errorf("expected no tensors, actual %v and %v", resp.Tensors, resp.Layers)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/envconfig"
+)
+
+const signatureMediaType = "application/vnd.ollama.image.signature"
+
+var (
+	errUnsigned           = errors.New("model is not signed")
+	errUntrustedSignature = errors.New("model is not signed by a trusted key")
+)
+
+// signaturePayload returns the bytes which are signed for a manifest. It
+// covers the config and every layer except the signatures themselves so
+// signatures can be added without invalidating each other.
+func signaturePayload(m *ManifestV2) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "ollama-manifest-signature-v1")
+	fmt.Fprintln(&b, "config", m.Config.MediaType, m.Config.Digest)
+	for _, layer := range m.Layers {
+		if layer.MediaType != signatureMediaType {
+			fmt.Fprintln(&b, "layer", layer.MediaType, layer.Digest)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// signManifest signs m with the local key, replacing any previous signature
+// made with the same key.
+func signManifest(ctx context.Context, m *ManifestV2) error {
+	signature, err := auth.Sign(ctx, signaturePayload(m))
+	if err != nil {
+		return err
+	}
+
+	key, _, _ := strings.Cut(signature, ":")
+	m.Layers = slices.DeleteFunc(m.Layers, func(layer *Layer) bool {
+		if layer.MediaType != signatureMediaType {
+			return false
+		}
+
+		previous, err := readSignature(layer)
+		if err != nil {
+			return false
+		}
+
+		k, _, _ := strings.Cut(previous, ":")
+		return k == key
+	})
+
+	layer, err := NewLayer(strings.NewReader(signature), signatureMediaType)
+	if err != nil {
+		return err
+	}
+
+	m.Layers = append(m.Layers, layer)
+	return nil
+}
+
+func readSignature(layer *Layer) (string, error) {
+	r, err := layer.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bts)), nil
+}
+
+// verifyManifest checks that at least one signature layer of m is a valid
+// signature by one of the trusted keys. Invalid signatures are skipped so
+// they can't hide a trusted one. The signature layers must already be
+// downloaded.
+func verifyManifest(m *ManifestV2, trusted []ssh.PublicKey) error {
+	payload := signaturePayload(m)
+
+	var signed, valid bool
+	var invalid error
+	for _, layer := range m.Layers {
+		if layer.MediaType != signatureMediaType {
+			continue
+		}
+
+		signed = true
+
+		signature, err := readSignature(layer)
+		if err != nil {
+			return err
+		}
+
+		key, err := auth.Verify(payload, signature)
+		if err != nil {
+			invalid = fmt.Errorf("invalid signature: %w", err)
+			continue
+		}
+
+		valid = true
+		if slices.ContainsFunc(trusted, func(k ssh.PublicKey) bool {
+			return bytes.Equal(k.Marshal(), key.Marshal())
+		}) {
+			return nil
+		}
+	}
+
+	switch {
+	case !signed:
+		return errUnsigned
+	case !valid:
+		return invalid
+	}
+
+	return errUntrustedSignature
+}
+
+// trustedKeys returns the public keys listed in OLLAMA_TRUSTED_KEYS.
+func trustedKeys() ([]ssh.PublicKey, error) {
+	if envconfig.TrustedKeys == "" {
+		return nil, nil
+	}
+
+	bts, err := os.ReadFile(envconfig.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(bts)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(bts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", envconfig.TrustedKeys, err)
+		}
+
+		keys = append(keys, key)
+		bts = rest
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func createKeypair(t *testing.T, home string) ssh.PublicKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestSignManifest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	key := createKeypair(t, home)
+	other, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOjNB2YIvPWFhBDAcc3KA5vWq/m0e+BBT+0wMKgvB4e5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newManifest := func() *ManifestV2 {
+		config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		layer, err := NewLayer(strings.NewReader("model"), "application/vnd.ollama.image.model")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &ManifestV2{Config: config, Layers: []*Layer{layer}}
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		m := newManifest()
+		if err := verifyManifest(m, []ssh.PublicKey{key}); !errors.Is(err, errUnsigned) {
+			t.Errorf("expected %v, actual %v", errUnsigned, err)
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		m := newManifest()
+		if err := signManifest(context.TODO(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := verifyManifest(m, []ssh.PublicKey{other, key}); err != nil {
+			t.Errorf("expected signature to verify, actual %v", err)
+		}
+
+		// signing again replaces the previous signature
+		if err := signManifest(context.TODO(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Layers) != 2 {
+			t.Errorf("expected 2 layers, actual %d", len(m.Layers))
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		m := newManifest()
+		if err := signManifest(context.TODO(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := verifyManifest(m, []ssh.PublicKey{other}); !errors.Is(err, errUntrustedSignature) {
+			t.Errorf("expected %v, actual %v", errUntrustedSignature, err)
+		}
+	})
+
+	t.Run("invalid before trusted", func(t *testing.T) {
+		m := newManifest()
+		if err := signManifest(context.TODO(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		invalid, err := NewLayer(strings.NewReader("not a signature"), signatureMediaType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m.Layers = append([]*Layer{m.Layers[0], invalid}, m.Layers[1:]...)
+		if err := verifyManifest(m, []ssh.PublicKey{key}); err != nil {
+			t.Errorf("expected signature to verify, actual %v", err)
+		}
+
+		if err := verifyManifest(m, []ssh.PublicKey{other}); !errors.Is(err, errUntrustedSignature) {
+			t.Errorf("expected %v, actual %v", errUntrustedSignature, err)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		m := newManifest()
+		if err := signManifest(context.TODO(), m); err != nil {
+			t.Fatal(err)
+		}
+
+		layer, err := NewLayer(strings.NewReader("tampered"), "application/vnd.ollama.image.model")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m.Layers[0] = layer
+		if err := verifyManifest(m, []ssh.PublicKey{key}); err == nil {
+			t.Error("expected signature verification to fail")
+		}
+	})
+}
+
+func TestPushSignedManifest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	createKeypair(t, home)
+
+	// every blob exists but the manifest can't be pushed
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := NewLayer(strings.NewReader("model"), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := model.ParseName(u.Host + "/library/test:latest")
+	if err := WriteManifest(n, config, []*Layer{layer}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PushModel(context.TODO(), n.String(), &registryOptions{Insecure: true, Sign: true}, func(api.ProgressResponse) {}); err == nil {
+		t.Fatal("expected pushing the manifest to fail")
+	}
+
+	// the local manifest is signed even though the push failed
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.ContainsFunc(m.Layers, func(l *Layer) bool { return l.MediaType == signatureMediaType }) {
+		t.Error("expected the local manifest to be signed")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -38,6 +39,7 @@ type blobUpload struct {
 	file *os.File
 
 	done       bool
+	skipped    bool
 	err        error
 	references atomic.Int32
 }
@@ -48,17 +50,41 @@ const (
 	maxUploadPartSize int64 = 1000 * format.MegaByte
 )
 
-func (b *blobUpload) Prepare(ctx context.Context, requestURL *url.URL, opts *registryOptions) error {
+// Prepare starts an upload of the blob to the repository of mp. Blobs which
+// already exist in the repository aren't uploaded again and blobs which exist
+// in another repository of the same registry are mounted from there instead.
+func (b *blobUpload) Prepare(ctx context.Context, mp ModelPath, opts *registryOptions) error {
 	p, err := GetBlobsPath(b.Digest)
 	if err != nil {
 		return err
 	}
 
-	if b.From != "" {
-		values := requestURL.Query()
-		values.Add("mount", b.Digest)
-		values.Add("from", ParseModelPath(b.From).GetNamespaceRepository())
-		requestURL.RawQuery = values.Encode()
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	b.Total = fi.Size()
+
+	if ok, err := blobExists(ctx, mp, b.Digest, opts); err != nil {
+		return err
+	} else if ok {
+		b.skip("exists")
+		return nil
+	}
+
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "blobs/uploads/")
+	for _, from := range mountCandidates(mp, b.Layer) {
+		if ok, err := blobExists(ctx, from, b.Digest, opts); err != nil {
+			slog.Debug("couldn't check blob for mount", "digest", b.Digest, "from", from.GetNamespaceRepository(), "error", err)
+			continue
+		} else if ok {
+			values := requestURL.Query()
+			values.Add("mount", b.Digest)
+			values.Add("from", from.GetNamespaceRepository())
+			requestURL.RawQuery = values.Encode()
+			break
+		}
 	}
 
 	resp, err := makeRequestWithRetry(ctx, http.MethodPost, requestURL, nil, nil, opts)
@@ -72,18 +98,10 @@ func (b *blobUpload) Prepare(ctx context.Context, requestURL *url.URL, opts *reg
 		location = resp.Header.Get("Location")
 	}
 
-	fi, err := os.Stat(p)
-	if err != nil {
-		return err
-	}
-
-	b.Total = fi.Size()
-
 	// http.StatusCreated indicates a blob has been mounted
 	// ref: https://distribution.github.io/distribution/spec/api/#cross-repository-blob-mount
 	if resp.StatusCode == http.StatusCreated {
-		b.Completed.Store(b.Total)
-		b.done = true
+		b.skip("mounted from " + requestURL.Query().Get("from"))
 		return nil
 	}
 
@@ -118,6 +136,66 @@ func (b *blobUpload) Prepare(ctx context.Context, requestURL *url.URL, opts *reg
 	return nil
 }
 
+// skip marks the blob as complete without uploading it.
+func (b *blobUpload) skip(reason string) {
+	slog.Info(fmt.Sprintf("skipping %s, %s", b.Digest[7:19], reason))
+	b.Completed.Store(b.Total)
+	b.skipped = true
+	b.done = true
+}
+
+// blobExists checks if the repository of mp has the blob for digest.
+func blobExists(ctx context.Context, mp ModelPath, digest string, opts *registryOptions) (bool, error) {
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "blobs", digest)
+	resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	return true, nil
+}
+
+// mountCandidates returns other repositories in the registry of mp which
+// are likely to have the blob for layer, i.e. the model it was created from
+// and local models from the same registry which use it.
+func mountCandidates(mp ModelPath, layer *Layer) []ModelPath {
+	var candidates []ModelPath
+	add := func(from ModelPath) {
+		if from.Registry != mp.Registry || from.GetNamespaceRepository() == mp.GetNamespaceRepository() {
+			return
+		}
+
+		if slices.ContainsFunc(candidates, func(c ModelPath) bool {
+			return c.GetNamespaceRepository() == from.GetNamespaceRepository()
+		}) {
+			return
+		}
+
+		candidates = append(candidates, from)
+	}
+
+	if layer.From != "" {
+		add(ParseModelPath(layer.From))
+	}
+
+	ms, err := Manifests()
+	if err != nil {
+		slog.Debug("couldn't list models for mount", "error", err)
+		return candidates
+	}
+
+	for n, m := range ms {
+		if slices.ContainsFunc(slices.Concat(m.Layers, []*Layer{m.Config}), func(l *Layer) bool { return l.Digest == layer.Digest }) {
+			add(ParseModelPath(n.String()))
+		}
+	}
+
+	return candidates
+}
+
 // Run uploads blob parts to the upstream. If the upstream supports redirection, parts will be uploaded
 // in parallel as defined by Prepare. Otherwise, parts will be uploaded serially. Run sets b.err on error.
 func (b *blobUpload) Run(ctx context.Context, opts *registryOptions) {
@@ -305,7 +383,8 @@ func (b *blobUpload) acquire() {
 }
 
 func (b *blobUpload) release() {
-	if b.references.Add(-1) == 0 {
+	// skipped blobs never run so there's nothing to cancel
+	if b.references.Add(-1) == 0 && b.CancelFunc != nil {
 		b.CancelFunc()
 	}
 }
@@ -322,11 +401,17 @@ func (b *blobUpload) Wait(ctx context.Context, fn func(api.ProgressResponse)) er
 			return ctx.Err()
 		}
 
+		status := fmt.Sprintf("pushing %s", b.Digest[7:19])
+		if b.skipped {
+			status = fmt.Sprintf("skipping %s", b.Digest[7:19])
+		}
+
 		fn(api.ProgressResponse{
-			Status:    fmt.Sprintf("pushing %s", b.Digest[7:19]),
+			Status:    status,
 			Digest:    b.Digest,
 			Total:     b.Total,
 			Completed: b.Completed.Load(),
+			Skipped:   b.skipped,
 		})
 
 		if b.done || b.err != nil {
@@ -361,38 +446,21 @@ func (p *progressWriter) Rollback() {
 }
 
 func uploadBlob(ctx context.Context, mp ModelPath, layer *Layer, opts *registryOptions, fn func(api.ProgressResponse)) error {
-	requestURL := mp.BaseURL()
-	requestURL = requestURL.JoinPath("v2", mp.GetNamespaceRepository(), "blobs", layer.Digest)
-
-	resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
-	switch {
-	case errors.Is(err, os.ErrNotExist):
-	case err != nil:
-		return err
-	default:
-		defer resp.Body.Close()
-		fn(api.ProgressResponse{
-			Status:    fmt.Sprintf("pushing %s", layer.Digest[7:19]),
-			Digest:    layer.Digest,
-			Total:     layer.Size,
-			Completed: layer.Size,
-		})
-
-		return nil
-	}
-
 	data, ok := blobUploadManager.LoadOrStore(layer.Digest, &blobUpload{Layer: layer})
 	upload := data.(*blobUpload)
 	if !ok {
-		requestURL := mp.BaseURL()
-		requestURL = requestURL.JoinPath("v2", mp.GetNamespaceRepository(), "blobs/uploads/")
-		if err := upload.Prepare(ctx, requestURL, opts); err != nil {
+		if err := upload.Prepare(ctx, mp, opts); err != nil {
 			blobUploadManager.Delete(layer.Digest)
 			return err
 		}
 
-		//nolint:contextcheck
-		go upload.Run(context.Background(), opts)
+		if upload.done {
+			// nothing to upload
+			blobUploadManager.Delete(layer.Digest)
+		} else {
+			//nolint:contextcheck
+			go upload.Run(context.Background(), opts)
+		}
 	}
 
 	return upload.Wait(ctx, fn)
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// createPushModel writes a local model with a layer for each of layers to
+// push.
+func createPushModel(t *testing.T, name string, layers ...string) *Manifest {
+	t.Helper()
+
+	config, err := NewLayer(strings.NewReader(name), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ls []*Layer
+	for _, l := range layers {
+		layer, err := NewLayer(strings.NewReader(l), "application/vnd.ollama.image.model")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ls = append(ls, layer)
+	}
+
+	n := model.ParseName(name)
+	if err := WriteManifest(n, config, ls); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestUploadBlob(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	var mu sync.Mutex
+	var requests []string
+	blobs := map[string][]string{}
+
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		repo, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/")
+		switch {
+		case r.Method == http.MethodHead:
+			if slices.Contains(blobs[repo], rest) {
+				return
+			}
+
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			if digest, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); slices.Contains(blobs[from], digest) {
+				blobs[repo] = append(blobs[repo], digest)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+
+			w.Header().Set("Location", registry.URL+"/upload/"+repo)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPatch:
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				t.Error(err)
+			}
+
+			w.Header().Set("Location", registry.URL+r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut:
+			repo := strings.TrimPrefix(r.URL.Path, "/upload/")
+			blobs[repo] = append(blobs[repo], r.URL.Query().Get("digest"))
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := createPushModel(t, u.Host+"/library/base:latest", "base")
+	blobs["library/base"] = []string{base.Layers[0].Digest}
+
+	derived := createPushModel(t, u.Host+"/library/derived:latest", "base", "adapter")
+	blobs["library/derived"] = []string{derived.Config.Digest}
+
+	mp := ParseModelPath(u.Host + "/library/derived:latest")
+	for _, tt := range []struct {
+		name    string
+		layer   *Layer
+		skipped bool
+		request string
+	}{
+		{"exists", derived.Config, true, "HEAD /v2/library/derived/blobs/" + derived.Config.Digest},
+		{"mount", derived.Layers[0], true, "POST /v2/library/derived/blobs/uploads/"},
+		{"upload", derived.Layers[1], false, "PUT /upload/library/derived"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			var last api.ProgressResponse
+			if err := uploadBlob(context.TODO(), mp, tt.layer, &registryOptions{Insecure: true}, func(r api.ProgressResponse) {
+				last = r
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if last.Skipped != tt.skipped {
+				t.Errorf("expected skipped %t, actual %t", tt.skipped, last.Skipped)
+			}
+
+			if last.Completed != tt.layer.Size {
+				t.Errorf("expected %d completed, actual %d", tt.layer.Size, last.Completed)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if requests[len(requests)-1] != tt.request {
+				t.Errorf("expected last request %q, actual %v", tt.request, requests)
+			}
+
+			if !slices.Contains(blobs["library/derived"], tt.layer.Digest) {
+				t.Errorf("expected %s to be in the registry", tt.layer.Digest)
+			}
+		})
+	}
+}